@@ -0,0 +1,173 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+// Package authorizer implements device.Authorizer by asking a local service
+// over HTTP, either on a TCP address or on a Unix socket.
+//
+// For every unknown initiator the service receives a POST request with a
+// JSON body:
+//
+//	{"interface": "wg0", "public_key": "<base64 public key>"}
+//
+// It admits the peer by answering 200 OK with the configuration to install,
+// using the field names of the wgtypes JSON schema; every field is optional:
+//
+//	{
+//	  "allowed_ips": ["10.0.0.2/32"],
+//	  "preshared_key": "<base64 key>",
+//	  "persistent_keepalive_seconds": 25,
+//	  "expires_at": "2020-12-01T00:00:00Z"
+//	}
+//
+// 403 Forbidden and 404 Not Found deny the peer; any other answer is an
+// error, which denies it as well.
+package authorizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+)
+
+// maxResponseSize bounds the answers read from the service.
+const maxResponseSize = 64 << 10
+
+// A Client queries an authorization service.
+type Client struct {
+	url       string
+	iface     string
+	transport *http.Client
+}
+
+type request struct {
+	Interface string `json:"interface"`
+	PublicKey string `json:"public_key"`
+}
+
+type response struct {
+	AllowedIPs          []string   `json:"allowed_ips"`
+	PresharedKey        *string    `json:"preshared_key"`
+	PersistentKeepalive *int64     `json:"persistent_keepalive_seconds"`
+	ExpiresAt           *time.Time `json:"expires_at"`
+}
+
+// New returns a client for the service at target, which is either an
+// http:// or https:// URL, or the path of a Unix socket, optionally
+// prefixed with unix:. iface is passed along with every query.
+func New(target, iface string) (*Client, error) {
+	c := &Client{iface: iface}
+
+	switch {
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		c.url = target
+		c.transport = &http.Client{}
+	case strings.HasPrefix(target, "unix:") || strings.HasPrefix(target, "/"):
+		path := strings.TrimPrefix(target, "unix:")
+		if path == "" {
+			return nil, errors.New("authorizer: empty socket path")
+		}
+
+		var dialer net.Dialer
+		c.url = "http://unix/"
+		c.transport = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+	default:
+		return nil, fmt.Errorf("authorizer: neither a URL nor a socket path: %s", target)
+	}
+
+	// the device bounds every query with a context as well
+	c.transport.Timeout = device.AuthorizerTimeout
+
+	return c, nil
+}
+
+// Authorize implements device.Authorizer.
+func (c *Client) Authorize(ctx context.Context, pk device.NoisePublicKey) (*device.PeerAuthorization, error) {
+	body, err := json.Marshal(request{
+		Interface: c.iface,
+		PublicKey: base64.StdEncoding.EncodeToString(pk[:]),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.transport.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound:
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxResponseSize))
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("authorizer: unexpected status: %s", res.Status)
+	}
+
+	var v response
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&v); err != nil {
+		return nil, fmt.Errorf("authorizer: invalid response: %v", err)
+	}
+
+	return v.authorization()
+}
+
+func (v *response) authorization() (*device.PeerAuthorization, error) {
+	auth := new(device.PeerAuthorization)
+
+	for _, s := range v.AllowedIPs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("authorizer: invalid allowed IP: %s", s)
+		}
+		auth.AllowedIPs = append(auth.AllowedIPs, *network)
+	}
+
+	if v.PresharedKey != nil {
+		key, err := base64.StdEncoding.DecodeString(*v.PresharedKey)
+		if err != nil || len(key) != device.AEADSymmetricKeySize {
+			return nil, errors.New("authorizer: invalid preshared key")
+		}
+		copy(auth.PresharedKey[:], key)
+	}
+
+	if v.PersistentKeepalive != nil {
+		if *v.PersistentKeepalive < 0 || *v.PersistentKeepalive > 65535 {
+			return nil, fmt.Errorf("authorizer: invalid persistent keepalive: %d", *v.PersistentKeepalive)
+		}
+		auth.PersistentKeepaliveInterval = time.Duration(*v.PersistentKeepalive) * time.Second
+	}
+
+	if v.ExpiresAt != nil {
+		auth.ExpiresAt = *v.ExpiresAt
+	}
+
+	return auth, nil
+}
@@ -0,0 +1,115 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package authorizer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+)
+
+func testService(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Interface != "wg0" {
+			t.Errorf("unexpected interface: %q", req.Interface)
+		}
+
+		key, _ := base64.StdEncoding.DecodeString(req.PublicKey)
+		switch key[0] {
+		case 0x02:
+			w.Write([]byte(`{"allowed_ips": ["10.0.0.2/32", "fd00::2/128"], "preshared_key": "` +
+				base64.StdEncoding.EncodeToString(make([]byte, 32)) + `", "persistent_keepalive_seconds": 25, ` +
+				`"expires_at": "2020-12-01T00:00:00Z"}`))
+		case 0x03:
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+func testAuthorize(t *testing.T, c *Client) {
+	admitted := device.NoisePublicKey{0x02}
+	auth, err := c.Authorize(context.Background(), admitted)
+	if err != nil {
+		t.Fatalf("failed to authorize: %v", err)
+	}
+
+	want := &device.PeerAuthorization{
+		AllowedIPs: []net.IPNet{
+			{IP: net.IPv4(10, 0, 0, 2).To4(), Mask: net.CIDRMask(32, 32)},
+			{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(128, 128)},
+		},
+		PersistentKeepaliveInterval: 25 * time.Second,
+		ExpiresAt:                   time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(want, auth); diff != "" {
+		t.Fatalf("unexpected authorization (-want +got):\n%s", diff)
+	}
+
+	denied := device.NoisePublicKey{0x03}
+	if auth, err := c.Authorize(context.Background(), denied); auth != nil || err != nil {
+		t.Fatalf("denied peer: got %v, %v", auth, err)
+	}
+
+	broken := device.NoisePublicKey{0x04}
+	if _, err := c.Authorize(context.Background(), broken); err == nil {
+		t.Fatal("server error is not reported")
+	}
+}
+
+func TestClientHTTP(t *testing.T) {
+	server := httptest.NewServer(testService(t))
+	defer server.Close()
+
+	c, err := New(server.URL, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAuthorize(t, c)
+}
+
+func TestClientUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorizer.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: testService(t)}
+	go server.Serve(l)
+	defer server.Close()
+
+	c, err := New("unix:"+path, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAuthorize(t, c)
+}
+
+func TestNew(t *testing.T) {
+	for _, target := range []string{"", "unix:", "ftp://example.com", "relative/path"} {
+		if _, err := New(target, "wg0"); err == nil {
+			t.Errorf("New(%q) accepted an invalid target", target)
+		}
+	}
+}
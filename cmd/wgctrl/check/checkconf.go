@@ -0,0 +1,104 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func showCheckConfUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s checkconf [--format text|json] [--no-resolve] <configuration filename>...\n", os.Args[0])
+}
+
+// CheckConf lints configuration files and exits with 1 when any of them has
+// an error; warnings alone are not fatal.
+func CheckConf(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showCheckConfUsage(os.Stdout)
+		return 0
+	}
+
+	format := "text"
+	var opts wgtypes.LintOptions
+	var files []string
+
+	for args = args[1:]; len(args) > 0; args = args[1:] {
+		switch {
+		case args[0] == "--format" && len(args) >= 2:
+			format = args[1]
+			args = args[1:]
+		case args[0] == "--no-resolve":
+			opts.NoResolve = true
+		default:
+			files = append(files, args[0])
+		}
+	}
+
+	if len(files) == 0 || (format != "text" && format != "json") {
+		showCheckConfUsage(os.Stderr)
+		return 1
+	}
+
+	problems := []wgtypes.Problem{}
+	for _, name := range files {
+		found, err := lintFile(name, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read configuration file: %v\n", err)
+			return 1
+		}
+		problems = append(problems, found...)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(problems); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to print problems: %v\n", err)
+			return 1
+		}
+	} else {
+		printProblems(os.Stdout, problems)
+	}
+
+	for _, p := range problems {
+		if p.Severity == wgtypes.SeverityError {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func lintFile(name string, opts wgtypes.LintOptions) ([]wgtypes.Problem, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return wgtypes.LintConfig(name, file, opts)
+}
+
+func printProblems(out io.Writer, problems []wgtypes.Problem) {
+	var errors, warnings int
+
+	for _, p := range problems {
+		fmt.Fprintln(out, p.String())
+
+		if p.Severity == wgtypes.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	fmt.Fprintf(out, "%d error(s), %d warning(s)\n", errors, warnings)
+}
@@ -0,0 +1,108 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgmetrics"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// DefaultListen is the address the exporter listens on unless --listen is
+// given.
+const DefaultListen = ":9586"
+
+// deviceClient is the part of the wgctrl client the exporter reads devices
+// with.
+type deviceClient interface {
+	Device(name string) (*wgtypes.Device, error)
+	Devices() ([]*wgtypes.Device, error)
+}
+
+func showExporterUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s exporter [--listen ADDR|unix:PATH] [<interface>...]\n", os.Args[0])
+}
+
+// Exporter serves the metrics of the given interfaces, or of all of them,
+// at /metrics in the OpenMetrics text format until interrupted.
+func Exporter(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showExporterUsage(os.Stdout)
+		return 0
+	}
+
+	listen := DefaultListen
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--listen" {
+		if len(args) < 2 {
+			showExporterUsage(os.Stderr)
+			return 1
+		}
+		listen = args[1]
+		args = args[2:]
+	}
+
+	c, err := remote.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	l, err := wgmetrics.Listen(listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to listen on %s: %s\n", listen, err)
+		return 1
+	}
+	defer l.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", wgmetrics.Handler(devices(c, args)))
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- http.Serve(l, mux)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+		return 0
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "unable to serve metrics: %s\n", err)
+		return 1
+	}
+}
+
+// devices returns a function which reads the named devices, or all of them
+// if names is empty.
+func devices(c deviceClient, names []string) func() ([]*wgtypes.Device, error) {
+	return func() ([]*wgtypes.Device, error) {
+		if len(names) == 0 {
+			return c.Devices()
+		}
+
+		ds := make([]*wgtypes.Device, 0, len(names))
+		for _, name := range names {
+			d, err := c.Device(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			ds = append(ds, d)
+		}
+		return ds, nil
+	}
+}
@@ -0,0 +1,45 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package exporter
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+type testClient map[string]*wgtypes.Device
+
+func (c testClient) Device(name string) (*wgtypes.Device, error) {
+	d, ok := c[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return d, nil
+}
+
+func (c testClient) Devices() ([]*wgtypes.Device, error) {
+	return []*wgtypes.Device{c["wg0"], c["wg1"]}, nil
+}
+
+func TestDevices(t *testing.T) {
+	c := testClient{"wg0": {Name: "wg0"}, "wg1": {Name: "wg1"}}
+
+	ds, err := devices(c, nil)()
+	if err != nil || len(ds) != 2 {
+		t.Fatalf("unexpected devices: %v, %v", ds, err)
+	}
+
+	ds, err = devices(c, []string{"wg1"})()
+	if err != nil || len(ds) != 1 || ds[0].Name != "wg1" {
+		t.Fatalf("unexpected devices: %v, %v", ds, err)
+	}
+
+	if _, err := devices(c, []string{"wg0", "wg2"})(); err == nil {
+		t.Fatal("expected an error for a missing device")
+	}
+}
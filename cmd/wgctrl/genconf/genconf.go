@@ -0,0 +1,384 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package genconf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const defaultConfigDir = "/etc/wireguard"
+
+func showGenConfUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s genconf <interface> [config <server config file>] [pool <ip>/<cidr>] [endpoint <host>:<port>] [dns <ip1>[,<ip2>]...] [reserve <ip1>[,<ip2>/<cidr2>]...] [allowed-ips <ip1>/<cidr1>[,<ip2>/<cidr2>]...] [persistent-keepalive <interval seconds>] [preshared-key] [name <label>] [out <file path>]\n", os.Args[0])
+}
+
+// options are the genconf arguments. pool, endpoint, dns and reserve are
+// remembered in the IPAM state, so later runs may omit them.
+type options struct {
+	iface               string
+	configPath          string
+	pool                string
+	endpoint            string
+	dns                 []string
+	reserve             []string
+	allowedIPs          []net.IPNet
+	persistentKeepalive int
+	presharedKey        bool
+	name                string
+	out                 string
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseArgs(args []string) (*options, error) {
+	if len(args) < 1 {
+		return nil, errors.New("missing interface name")
+	}
+
+	opts := &options{iface: args[0]}
+	args = args[1:]
+
+	for len(args) > 0 {
+		if args[0] == "preshared-key" {
+			opts.presharedKey = true
+			args = args[1:]
+			continue
+		}
+
+		if len(args) < 2 {
+			return nil, fmt.Errorf("invalid argument: %s", args[0])
+		}
+
+		value := args[1]
+		switch args[0] {
+		case "config":
+			opts.configPath = value
+		case "pool":
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return nil, err
+			}
+			opts.pool = value
+		case "endpoint":
+			if _, _, err := net.SplitHostPort(value); err != nil {
+				return nil, err
+			}
+			opts.endpoint = value
+		case "dns":
+			opts.dns = splitList(value)
+		case "reserve":
+			for _, s := range splitList(value) {
+				if _, err := parseHostOrCIDR(s); err != nil {
+					return nil, err
+				}
+			}
+			opts.reserve = splitList(value)
+		case "allowed-ips":
+			for _, s := range splitList(value) {
+				_, n, err := net.ParseCIDR(s)
+				if err != nil {
+					return nil, err
+				}
+				opts.allowedIPs = append(opts.allowedIPs, *n)
+			}
+		case "persistent-keepalive":
+			secs, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			if secs < 0 || secs > 65535 {
+				return nil, fmt.Errorf("persistent keepalive interval is neither 0 nor 1-65535: %d", secs)
+			}
+			opts.persistentKeepalive = secs
+		case "name":
+			opts.name = value
+		case "out":
+			opts.out = value
+		default:
+			return nil, fmt.Errorf("invalid argument: %s", args[0])
+		}
+
+		args = args[2:]
+	}
+
+	if opts.configPath == "" {
+		opts.configPath = filepath.Join(defaultConfigDir, opts.iface+".conf")
+	}
+
+	return opts, nil
+}
+
+// merge applies the command line options to the stored state.
+func (state *ipamState) merge(opts *options) error {
+	if opts.pool != "" {
+		if state.Pool != "" && state.Pool != opts.pool && len(state.Allocations) != 0 {
+			return fmt.Errorf("pool %s differs from %s used by existing allocations", opts.pool, state.Pool)
+		}
+		state.Pool = opts.pool
+	}
+	if opts.endpoint != "" {
+		state.Endpoint = opts.endpoint
+	}
+	if opts.dns != nil {
+		state.DNS = opts.dns
+	}
+	for _, r := range opts.reserve {
+		found := false
+		for _, existing := range state.Reserved {
+			found = found || existing == r
+		}
+		if !found {
+			state.Reserved = append(state.Reserved, r)
+		}
+	}
+
+	if state.Pool == "" {
+		return errors.New("no address pool configured, pass pool <ip>/<cidr>")
+	}
+	if state.Endpoint == "" {
+		return errors.New("no server endpoint configured, pass endpoint <host>:<port>")
+	}
+
+	return nil
+}
+
+// clientConfig is everything needed to render the configuration of a new
+// client.
+type clientConfig struct {
+	privateKey          wgtypes.Key
+	presharedKey        wgtypes.Key
+	address             *net.IPNet
+	dns                 []string
+	serverPublicKey     wgtypes.Key
+	endpoint            string
+	allowedIPs          []net.IPNet
+	persistentKeepalive int
+}
+
+func (cfg *clientConfig) write(out io.Writer) {
+	fmt.Fprintf(out, "[Interface]\n")
+	fmt.Fprintf(out, "PrivateKey = %s\n", base64.StdEncoding.EncodeToString(cfg.privateKey))
+	fmt.Fprintf(out, "Address = %s\n", cfg.address.String())
+	if len(cfg.dns) != 0 {
+		fmt.Fprintf(out, "DNS = %s\n", strings.Join(cfg.dns, ", "))
+	}
+
+	fmt.Fprintf(out, "\n[Peer]\n")
+	fmt.Fprintf(out, "PublicKey = %s\n", base64.StdEncoding.EncodeToString(cfg.serverPublicKey))
+	if cfg.presharedKey != nil {
+		fmt.Fprintf(out, "PresharedKey = %s\n", base64.StdEncoding.EncodeToString(cfg.presharedKey))
+	}
+	fmt.Fprintf(out, "Endpoint = %s\n", cfg.endpoint)
+
+	var s []string
+	for _, ip := range cfg.allowedIPs {
+		s = append(s, ip.String())
+	}
+	fmt.Fprintf(out, "AllowedIPs = %s\n", strings.Join(s, ", "))
+
+	if cfg.persistentKeepalive != 0 {
+		fmt.Fprintf(out, "PersistentKeepalive = %d\n", cfg.persistentKeepalive)
+	}
+}
+
+func GenConf(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showGenConfUsage(os.Stdout)
+		return 0
+	}
+
+	if len(args) < 2 {
+		showGenConfUsage(os.Stderr)
+		return 1
+	}
+
+	opts, err := parseArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse arguments: %v\n", err)
+		return 1
+	}
+
+	path := statePath(opts.configPath)
+	state, err := loadState(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load IPAM state: %v\n", err)
+		return 1
+	}
+
+	if err := state.merge(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	_, pool, err := net.ParseCIDR(state.Pool)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid address pool: %v\n", err)
+		return 1
+	}
+
+	c, err := remote.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	device, err := c.Device(opts.iface)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to retrieve current interface configuration: %s\n", err)
+		return 1
+	}
+
+	if len(device.PublicKey) == 0 {
+		fmt.Fprintf(os.Stderr, "interface %s has no private key\n", opts.iface)
+		return 1
+	}
+
+	// allocate an address
+
+	// the addresses of the server itself are taken as well
+	allowedIPs, err := serverAddresses(opts.configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read server addresses: %v\n", err)
+		return 1
+	}
+	for _, peer := range device.Peers {
+		allowedIPs = append(allowedIPs, peer.AllowedIPs...)
+	}
+
+	taken, err := state.takenNetworks(allowedIPs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ip, err := allocate(pool, taken)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to allocate an address from %s: %v\n", pool, err)
+		return 1
+	}
+	address := hostNetwork(ip)
+
+	// generate keys
+
+	client := &clientConfig{
+		address:             address,
+		dns:                 state.DNS,
+		serverPublicKey:     device.PublicKey,
+		endpoint:            state.Endpoint,
+		allowedIPs:          opts.allowedIPs,
+		persistentKeepalive: opts.persistentKeepalive,
+	}
+	if client.allowedIPs == nil {
+		client.allowedIPs = []net.IPNet{*pool}
+	}
+
+	client.privateKey, err = wgtypes.GeneratePrivateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate private key: %s\n", err)
+		return 1
+	}
+	publicKey := client.privateKey.PublicKey()
+
+	if opts.presharedKey {
+		client.presharedKey, err = wgtypes.GenerateKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to generate pre-shared key: %s\n", err)
+			return 1
+		}
+	}
+
+	// record the allocation and write the client configuration before
+	// touching the server, so that a peer is never added without either
+
+	var rendered bytes.Buffer
+	client.write(&rendered)
+
+	saved := state.Allocations
+	state.Allocations = append(state.Allocations, allocation{
+		Address:   address.String(),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Name:      opts.name,
+		Allocated: time.Now().UTC(),
+	})
+
+	if err := saveState(path, state); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save IPAM state: %v\n", err)
+		return 1
+	}
+
+	if opts.out != "" {
+		if err := ioutil.WriteFile(opts.out, rendered.Bytes(), 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write client configuration: %v\n", err)
+			releaseAllocation(path, state, saved)
+			return 1
+		}
+	}
+
+	// add the peer
+
+	peer := wgtypes.PeerConfig{
+		PublicKey:         publicKey,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        []net.IPNet{*address},
+	}
+	if client.presharedKey != nil {
+		peer.PresharedKey = &client.presharedKey
+	}
+	if opts.name != "" {
+		peer.Name = &opts.name
+	}
+
+	err = c.ConfigureDevice(opts.iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to configure device: %s\n", err)
+		if opts.out != "" {
+			os.Remove(opts.out)
+		}
+		releaseAllocation(path, state, saved)
+		return 1
+	}
+
+	// emit the client configuration
+
+	if opts.out == "" {
+		os.Stdout.Write(rendered.Bytes())
+	}
+
+	return 0
+}
+
+/* releaseAllocation restores the allocations of state to what they were
+ * before a failed run. Failing that, the address stays allocated, which
+ * wastes it but does no harm.
+ */
+func releaseAllocation(path string, state *ipamState, allocations []allocation) {
+	state.Allocations = allocations
+	if err := saveState(path, state); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to release the allocated address: %v\n", err)
+	}
+}
@@ -0,0 +1,258 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package genconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ipamState is the address allocation state of one server interface. It is
+// kept as JSON next to the server configuration file.
+type ipamState struct {
+	Pool         string       `json:"pool"`
+	Endpoint     string       `json:"endpoint,omitempty"`
+	DNS          []string     `json:"dns,omitempty"`
+	Reserved     []string     `json:"reserved,omitempty"`
+	Allocations  []allocation `json:"allocations,omitempty"`
+	LastModified time.Time    `json:"last_modified"`
+}
+
+type allocation struct {
+	Address   string    `json:"address"`
+	PublicKey string    `json:"public_key"`
+	Name      string    `json:"name,omitempty"`
+	Allocated time.Time `json:"allocated"`
+}
+
+// statePath returns the IPAM state file for a server configuration file,
+// e.g. /etc/wireguard/wg0.conf -> /etc/wireguard/wg0.ipam.json.
+func statePath(configPath string) string {
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".ipam.json"
+}
+
+func loadState(path string) (*ipamState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &ipamState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state ipamState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &state, nil
+}
+
+// saveState replaces the state file atomically, so that an interrupted run
+// never leaves a truncated file behind.
+func saveState(path string, state *ipamState) error {
+	state.LastModified = time.Now().UTC()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// takenNetworks collects every range which must not be handed out: the
+// AllowedIPs of the live peers, reserved addresses and earlier allocations.
+func (state *ipamState) takenNetworks(allowedIPs []net.IPNet) ([]net.IPNet, error) {
+	taken := append([]net.IPNet(nil), allowedIPs...)
+
+	for _, s := range state.Reserved {
+		n, err := parseHostOrCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved address %q: %v", s, err)
+		}
+		taken = append(taken, *n)
+	}
+
+	for _, a := range state.Allocations {
+		n, err := parseHostOrCIDR(a.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allocated address %q: %v", a.Address, err)
+		}
+		taken = append(taken, *n)
+	}
+
+	return taken, nil
+}
+
+// serverAddresses returns the host networks of the Address keys of the
+// [Interface] section of the server configuration file, if there is one.
+func serverAddresses(configPath string) ([]net.IPNet, error) {
+	file, err := os.Open(configPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addresses []net.IPNet
+	var section string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if section != "interface" || i < 0 || !strings.EqualFold(strings.TrimSpace(line[:i]), "address") {
+			continue
+		}
+
+		for _, s := range splitList(line[i+1:]) {
+			ip := net.ParseIP(s)
+			if strings.Contains(s, "/") {
+				ip, _, err = net.ParseCIDR(s)
+			}
+			if ip == nil || err != nil {
+				return nil, fmt.Errorf("%s: invalid address %q", configPath, s)
+			}
+			addresses = append(addresses, *hostNetwork(ip))
+		}
+	}
+
+	return addresses, scanner.Err()
+}
+
+// parseHostOrCIDR accepts either a CIDR or a single address.
+func parseHostOrCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	return hostNetwork(ip), nil
+}
+
+// hostNetwork returns the /32 or /128 network of ip.
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+func lastAddress(n *net.IPNet) net.IP {
+	last := make(net.IP, len(n.IP))
+	for i := range n.IP {
+		last[i] = n.IP[i] | ^n.Mask[i]
+	}
+	return last
+}
+
+// nextAddress returns ip+1, or nil on overflow.
+func nextAddress(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+var errPoolExhausted = errors.New("address pool exhausted")
+
+// allocate returns the lowest host address of pool that is not covered by
+// any of the taken networks. For IPv4 pools the network and broadcast
+// addresses are never returned.
+func allocate(pool *net.IPNet, taken []net.IPNet) (net.IP, error) {
+	first := pool.IP.Mask(pool.Mask)
+	last := lastAddress(&net.IPNet{IP: first, Mask: pool.Mask})
+
+	ones, bits := pool.Mask.Size()
+	if bits == 32 && ones < 31 {
+		first = nextAddress(first)
+		last[len(last)-1]--
+	} else if bits == 128 && ones < 127 {
+		first = nextAddress(first)
+	}
+
+	// Jump over whole taken networks rather than single addresses, so that
+	// the search is linear in the number of taken networks and not in the
+	// size of the pool.
+	candidate := first
+	for candidate != nil && bytes.Compare(candidate, last) <= 0 {
+		var covering *net.IPNet
+		for i := range taken {
+			if taken[i].Contains(candidate) {
+				covering = &taken[i]
+				break
+			}
+		}
+
+		if covering == nil {
+			return candidate, nil
+		}
+
+		end := lastAddress(&net.IPNet{IP: covering.IP.Mask(covering.Mask), Mask: covering.Mask})
+		if len(candidate) == net.IPv4len {
+			end = end.To4()
+		}
+		if end == nil || bytes.Compare(end, last) >= 0 {
+			break
+		}
+		candidate = nextAddress(end)
+	}
+
+	return nil, errPoolExhausted
+}
@@ -0,0 +1,160 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package genconf
+
+import (
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func mustCIDR(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return *n
+}
+
+func TestAllocate(t *testing.T) {
+	testVectors := []struct {
+		name   string
+		pool   string
+		taken  []string
+		result string
+	}{
+		{"empty pool", "10.0.0.0/24", nil, "10.0.0.1"},
+		{"skip hosts", "10.0.0.0/24", []string{"10.0.0.1/32", "10.0.0.2/32"}, "10.0.0.3"},
+		{"fill a hole", "10.0.0.0/24", []string{"10.0.0.1/32", "10.0.0.3/32"}, "10.0.0.2"},
+		{"skip subnet", "10.0.0.0/24", []string{"10.0.0.0/25"}, "10.0.0.128"},
+		{"wider entry", "10.0.0.0/24", []string{"10.0.0.1/32", "0.0.0.0/0"}, ""},
+		{"no broadcast", "10.0.0.0/30", []string{"10.0.0.1/32", "10.0.0.2/32"}, ""},
+		{"other family", "10.0.0.0/24", []string{"::/0"}, "10.0.0.1"},
+		{"ipv6", "fd00::/64", []string{"fd00::1/128"}, "fd00::2"},
+		{"point to point", "10.0.0.0/31", []string{"10.0.0.0/32"}, "10.0.0.1"},
+	}
+
+	for _, v := range testVectors {
+		t.Run(v.name, func(t *testing.T) {
+			var taken []net.IPNet
+			for _, s := range v.taken {
+				taken = append(taken, mustCIDR(s))
+			}
+			pool := mustCIDR(v.pool)
+
+			ip, err := allocate(&pool, taken)
+			if v.result == "" {
+				if err != errPoolExhausted {
+					t.Fatalf("expected pool exhaustion, got %v, %v", ip, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ip.Equal(net.ParseIP(v.result)) {
+				t.Fatalf("allocate() = %v, want %s", ip, v.result)
+			}
+		})
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	configPath := path.Join(t.TempDir(), "wg0.conf")
+	statePath := statePath(configPath)
+	if want := configPath[:len(configPath)-len(".conf")] + ".ipam.json"; statePath != want {
+		t.Fatalf("statePath() = %s, want %s", statePath, want)
+	}
+
+	state, err := loadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{pool: "10.0.0.0/24", endpoint: "vpn.example.com:51820", reserve: []string{"10.0.0.1"}}
+	if err := state.merge(opts); err != nil {
+		t.Fatal(err)
+	}
+	state.Allocations = append(state.Allocations, allocation{Address: "10.0.0.2/32", PublicKey: "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u"})
+
+	if err := saveState(statePath, state); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(state, loaded); diff != "" {
+		t.Fatalf("loadState() mismatch (-want +got):\n%s", diff)
+	}
+
+	// reserved and allocated addresses are never handed out again
+
+	taken, err := loaded.takenNetworks(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := mustCIDR(loaded.Pool)
+	ip, err := allocate(&pool, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("10.0.0.3")) {
+		t.Fatalf("allocate() = %v, want 10.0.0.3", ip)
+	}
+
+	// the pool of existing allocations cannot silently change
+
+	if err := loaded.merge(&options{pool: "10.1.0.0/24"}); err == nil {
+		t.Fatal("expected an error when changing the pool of existing allocations")
+	}
+}
+
+func TestServerAddresses(t *testing.T) {
+	configPath := path.Join(t.TempDir(), "wg0.conf")
+
+	addresses, err := serverAddresses(configPath)
+	if err != nil || addresses != nil {
+		t.Fatalf("serverAddresses() of a missing file = %v, %v", addresses, err)
+	}
+
+	config := `[Interface]
+PrivateKey = 27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk=
+Address = 10.0.0.1/24, fd00::1/64 # the server
+address = 10.0.1.1
+
+[Peer]
+PublicKey = AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u
+AllowedIPs = 10.0.0.2/32
+`
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addresses, err = serverAddresses(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []net.IPNet{mustCIDR("10.0.0.1/32"), mustCIDR("fd00::1/128"), mustCIDR("10.0.1.1/32")}
+	if diff := cmp.Diff(want, addresses); diff != "" {
+		t.Fatalf("serverAddresses() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the address of the server is skipped, not the rest of its subnet
+
+	pool := mustCIDR("10.0.0.0/24")
+	ip, err := allocate(&pool, addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.ParseIP("10.0.0.2")) {
+		t.Fatalf("allocate() = %v, want 10.0.0.2", ip)
+	}
+}
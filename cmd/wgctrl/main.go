@@ -10,9 +10,16 @@ import (
 	"io"
 	"os"
 
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/check"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/exporter"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/genconf"
 	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/key"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/monitor"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/quick"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
 	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/set"
 	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/show"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/top"
 )
 
 var gitRevision = "unknown"
@@ -28,9 +35,16 @@ var subcommands = []struct {
 	{"setconf", set.SetConf, "Applies a configuration file to a WireGuard interface"},
 	{"addconf", set.SetConf, "Appends a configuration file to a WireGuard interface"},
 	{"syncconf", set.SetConf, "Synchronizes a configuration file to a WireGuard interface"},
+	{"diffconf", set.DiffConf, "Shows the changes syncconf would make to a WireGuard interface, without applying them"},
+	{"checkconf", check.CheckConf, "Checks configuration files for mistakes, reporting them with line numbers"},
 	{"genkey", key.GenKey, "Generates a new private key and writes it to stdout"},
 	{"genpsk", key.GenPsk, "Generates a new preshared key and writes it to stdout"},
 	{"pubkey", key.PubKey, "Reads a private key from stdin and writes a public key to stdout"},
+	{"quick", quick.Quick, "Brings an interface up or down from a configuration file with addresses, routes, DNS and hooks"},
+	{"genconf", genconf.GenConf, "Allocates an address, adds a new peer to an interface and writes its client configuration"},
+	{"top", top.Top, "Shows a live view of peers with their throughput and handshake ages"},
+	{"monitor", monitor.Monitor, "Prints the events of interfaces, such as handshakes and roaming peers, as they happen"},
+	{"exporter", exporter.Exporter, "Serves the statistics of interfaces as OpenMetrics for Prometheus to scrape"},
 }
 
 func showUsage(file io.Writer) {
@@ -41,7 +55,8 @@ func showUsage(file io.Writer) {
 	for i := range subcommands {
 		fmt.Fprintf(file, "  %s: %s\n", subcommands[i].subcommand, subcommands[i].description)
 	}
-	fmt.Fprintf(file, "You may pass '--help' to any of these subcommands to view usage.\n")
+	fmt.Fprintf(file, "You may pass '--help' to any of these subcommands to view usage.\n\n")
+	fmt.Fprint(file, remote.Usage)
 }
 
 func main() {
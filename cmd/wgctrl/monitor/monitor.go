@@ -0,0 +1,126 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func showMonitorUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s monitor [<interface>]\n", os.Args[0])
+}
+
+// Monitor prints the events of one or all interfaces, a line each, as they
+// happen until interrupted.
+func Monitor(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showMonitorUsage(os.Stdout)
+		return 0
+	}
+	if len(args) > 2 {
+		showMonitorUsage(os.Stderr)
+		return 1
+	}
+
+	c, err := remote.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	var names []string
+	if len(args) == 2 {
+		names = []string{args[1]}
+	} else {
+		devices, err := c.Devices()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to retrieve interfaces configurations: %s\n", err)
+			return 1
+		}
+		if len(devices) == 0 {
+			fmt.Fprintf(os.Stderr, "no interfaces to monitor\n")
+			return 1
+		}
+		for _, device := range devices {
+			names = append(names, device.Name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Lines of concurrent watches must not interleave.
+	var mu sync.Mutex
+	printEvent := func(name string, e wgtypes.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(os.Stdout, formatEvent(name, e))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(names))
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			errs[i] = c.Watch(ctx, name, func(e wgtypes.Event) {
+				printEvent(name, e)
+			})
+		}(i, name)
+	}
+	wg.Wait()
+
+	ret := 0
+	for i, err := range errs {
+		if err != nil && err != context.Canceled {
+			fmt.Fprintf(os.Stderr, "unable to watch %s: %s\n", names[i], err)
+			ret = 1
+		}
+	}
+	return ret
+}
+
+// formatEvent returns the line printed for an event of interface name.
+func formatEvent(name string, e wgtypes.Event) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s %s", e.Time.Format("2006-01-02 15:04:05.000"), name, e.Type)
+	if e.Type == wgtypes.PrivateKeyEvent {
+		fmt.Fprintf(&b, " public key %s", e.PublicKey)
+	} else {
+		fmt.Fprintf(&b, " peer %s", e.PublicKey)
+	}
+	if e.Endpoint != nil {
+		fmt.Fprintf(&b, " endpoint %s", e.Endpoint)
+	}
+	if e.Dropped != 0 {
+		fmt.Fprintf(&b, " (%d events dropped)", e.Dropped)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,55 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package monitor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestFormatEvent(t *testing.T) {
+	key := wgtypes.Key{0x03, 0x0a, 0x07, 0xb2, 0x59, 0x17, 0xa7, 0x14, 0xb3, 0x19, 0x4e, 0x12, 0x5a, 0x5c, 0x18, 0x56, 0x6b, 0xd5, 0x84, 0x35, 0xd1, 0x05, 0xf6, 0xd2, 0xfa, 0xeb, 0x91, 0x90, 0xa3, 0xa6, 0x28, 0x35, 0x35}
+	when := time.Date(2020, 9, 13, 12, 26, 40, 5e6, time.Local)
+
+	tests := []struct {
+		name  string
+		event wgtypes.Event
+		want  string
+	}{
+		{
+			name:  "handshake",
+			event: wgtypes.Event{Type: wgtypes.HandshakeEvent, Time: when, PublicKey: key},
+			want:  "2020-09-13 12:26:40.005 wg0 handshake peer " + key.String(),
+		},
+		{
+			name: "endpoint dropped",
+			event: wgtypes.Event{
+				Type:      wgtypes.EndpointEvent,
+				Time:      when,
+				PublicKey: key,
+				Endpoint:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820},
+				Dropped:   3,
+			},
+			want: "2020-09-13 12:26:40.005 wg0 endpoint peer " + key.String() + " endpoint 192.0.2.1:51820 (3 events dropped)",
+		},
+		{
+			name:  "private key",
+			event: wgtypes.Event{Type: wgtypes.PrivateKeyEvent, Time: when, PublicKey: key},
+			want:  "2020-09-13 12:26:40.005 wg0 private_key public key " + key.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatEvent("wg0", tt.event); got != tt.want {
+				t.Fatalf("unexpected line:\nwant: %s\n got: %s", tt.want, got)
+			}
+		})
+	}
+}
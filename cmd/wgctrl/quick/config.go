@@ -0,0 +1,286 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package quick
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const defaultConfigDir = "/etc/wireguard"
+
+// Values of the Table key besides a routing table number.
+const (
+	tableAuto = "auto"
+	tableOff  = "off"
+)
+
+var interfaceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_=+.-]{1,15}$`)
+
+// config is a configuration file with the extended [Interface] keys which
+// are handled by wg quick itself rather than by the device.
+type config struct {
+	path  string
+	iface string
+
+	addresses  []net.IPNet
+	dns        []net.IP
+	dnsSearch  []string
+	mtu        int
+	table      string
+	preUp      []string
+	postUp     []string
+	preDown    []string
+	postDown   []string
+	saveConfig bool
+
+	// stripped is the file without the extended keys, as accepted by
+	// wg setconf.
+	stripped []byte
+
+	device *wgtypes.Config
+}
+
+// configPath resolves the argument of wg quick: either a path to a file
+// named <interface>.conf or a bare interface name, which refers to a file in
+// /etc/wireguard.
+func configPath(arg string) (path, iface string, err error) {
+	path = arg
+	if interfaceNameRegexp.MatchString(arg) && !strings.HasSuffix(arg, ".conf") {
+		path = filepath.Join(defaultConfigDir, arg+".conf")
+	}
+
+	base := filepath.Base(path)
+	if !strings.HasSuffix(base, ".conf") {
+		return "", "", fmt.Errorf("the config file must be a valid interface name, followed by .conf: %s", arg)
+	}
+
+	iface = strings.TrimSuffix(base, ".conf")
+	if !interfaceNameRegexp.MatchString(iface) {
+		return "", "", fmt.Errorf("the config file must be a valid interface name, followed by .conf: %s", arg)
+	}
+
+	return path, iface, nil
+}
+
+func loadConfig(arg string) (*config, error) {
+	path, iface, err := configPath(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg, err := parseConfig(path, file)
+	if err != nil {
+		return nil, err
+	}
+	cfg.iface = iface
+
+	return cfg, nil
+}
+
+// parseConfig splits the extended [Interface] keys off r and parses the rest
+// with wgtypes.ParseConfig. Errors keep the line numbers of the original file.
+func parseConfig(name string, r io.Reader) (*config, error) {
+	cfg := &config{path: name, table: tableAuto}
+
+	// masked replaces the extended keys with empty lines, so that errors
+	// reported by wgtypes.ParseConfig point at the right line.
+	var stripped, masked bytes.Buffer
+	var section string
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := scanner.Text()
+
+		line := raw
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+		}
+
+		if section == "interface" {
+			if i := strings.IndexByte(line, '='); i >= 0 {
+				key := strings.TrimSpace(line[:i])
+				value := strings.TrimSpace(line[i+1:])
+
+				handled, err := cfg.parseKey(strings.ToLower(key), value)
+				if err != nil {
+					return nil, &wgtypes.ParseError{Name: name, Line: lineNum, Err: fmt.Errorf("invalid %s: %v", key, err)}
+				}
+				if handled {
+					masked.WriteString("\n")
+					continue
+				}
+			}
+		}
+
+		stripped.WriteString(raw + "\n")
+		masked.WriteString(raw + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	device, err := wgtypes.ParseConfig(name, &masked)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.device = device
+	cfg.stripped = stripped.Bytes()
+
+	return cfg, nil
+}
+
+// parseKey handles one extended [Interface] key and reports whether key is
+// one of them.
+func (cfg *config) parseKey(key, value string) (bool, error) {
+	switch key {
+	case "address":
+		for _, s := range splitList(value) {
+			ip, n, err := net.ParseCIDR(s)
+			if err != nil {
+				// a bare address is a host route
+				ip = net.ParseIP(s)
+				if ip == nil {
+					return true, err
+				}
+				n = hostNetwork(ip)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			n.IP = ip
+			cfg.addresses = append(cfg.addresses, *n)
+		}
+	case "dns":
+		for _, s := range splitList(value) {
+			if ip := net.ParseIP(s); ip != nil {
+				cfg.dns = append(cfg.dns, ip)
+			} else {
+				cfg.dnsSearch = append(cfg.dnsSearch, s)
+			}
+		}
+	case "mtu":
+		mtu, err := strconv.Atoi(value)
+		if err != nil {
+			return true, err
+		}
+		if mtu < 576 || mtu > 65535 {
+			return true, fmt.Errorf("out of range: %d", mtu)
+		}
+		cfg.mtu = mtu
+	case "table":
+		switch value {
+		case tableAuto, tableOff:
+		default:
+			if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+				return true, errors.New("neither auto, off nor a routing table number")
+			}
+		}
+		cfg.table = value
+	case "preup":
+		cfg.preUp = append(cfg.preUp, value)
+	case "postup":
+		cfg.postUp = append(cfg.postUp, value)
+	case "predown":
+		cfg.preDown = append(cfg.preDown, value)
+	case "postdown":
+		cfg.postDown = append(cfg.postDown, value)
+	case "saveconfig":
+		save, err := strconv.ParseBool(value)
+		if err != nil {
+			return true, err
+		}
+		cfg.saveConfig = save
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// marshalQuick renders the extended [Interface] keys of cfg, in the order
+// wg quick save writes them.
+func (cfg *config) marshalQuick(w io.Writer) {
+	for _, addr := range cfg.addresses {
+		fmt.Fprintf(w, "Address = %s\n", addr.String())
+	}
+
+	var dns []string
+	for _, ip := range cfg.dns {
+		dns = append(dns, ip.String())
+	}
+	dns = append(dns, cfg.dnsSearch...)
+	if len(dns) != 0 {
+		fmt.Fprintf(w, "DNS = %s\n", strings.Join(dns, ", "))
+	}
+
+	if cfg.mtu != 0 {
+		fmt.Fprintf(w, "MTU = %d\n", cfg.mtu)
+	}
+	if cfg.table != tableAuto {
+		fmt.Fprintf(w, "Table = %s\n", cfg.table)
+	}
+
+	for _, hook := range cfg.preUp {
+		fmt.Fprintf(w, "PreUp = %s\n", hook)
+	}
+	for _, hook := range cfg.postUp {
+		fmt.Fprintf(w, "PostUp = %s\n", hook)
+	}
+	for _, hook := range cfg.preDown {
+		fmt.Fprintf(w, "PreDown = %s\n", hook)
+	}
+	for _, hook := range cfg.postDown {
+		fmt.Fprintf(w, "PostDown = %s\n", hook)
+	}
+
+	if cfg.saveConfig {
+		fmt.Fprintf(w, "SaveConfig = true\n")
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// hostNetwork returns the /32 or /128 network of ip.
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
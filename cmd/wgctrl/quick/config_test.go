@@ -0,0 +1,228 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package quick
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const testConfig = `[Interface]
+Address = 10.0.0.2/24, fd00::2/64
+Address = 10.0.1.2
+DNS = 10.0.0.1, example.com
+MTU = 1380
+PrivateKey = 27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk=
+PostUp = echo up %i # logged by the hook
+SaveConfig = true
+
+[Peer]
+PublicKey = AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1
+AllowedIPs = 10.0.0.0/24, 0.0.0.0/0
+AllowedIPs = 192.168.0.0/16
+`
+
+func mustCIDR(s string) net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	n.IP = ip
+	return *n
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig("wg0.conf", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]net.IPNet{mustCIDR("10.0.0.2/24"), mustCIDR("fd00::2/64"), mustCIDR("10.0.1.2/32")}, cfg.addresses); diff != "" {
+		t.Errorf("addresses mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]net.IP{net.ParseIP("10.0.0.1")}, cfg.dns); diff != "" {
+		t.Errorf("dns mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com"}, cfg.dnsSearch); diff != "" {
+		t.Errorf("dns search mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"echo up %i"}, cfg.postUp); diff != "" {
+		t.Errorf("hooks mismatch (-want +got):\n%s", diff)
+	}
+	if cfg.mtu != 1380 || cfg.table != tableAuto || !cfg.saveConfig {
+		t.Errorf("unexpected mtu %d, table %q, save %v", cfg.mtu, cfg.table, cfg.saveConfig)
+	}
+
+	if cfg.device.PrivateKey == nil || len(cfg.device.Peers) != 1 {
+		t.Fatalf("device configuration not parsed: %+v", cfg.device)
+	}
+
+	// the stripped configuration is what setconf accepts
+
+	stripped, err := wgtypes.ParseConfig("stripped", bytes.NewReader(cfg.stripped))
+	if err != nil {
+		t.Fatalf("stripped configuration is not accepted: %v\n%s", err, cfg.stripped)
+	}
+	if diff := cmp.Diff(cfg.device, stripped); diff != "" {
+		t.Errorf("stripped configuration mismatch (-want +got):\n%s", diff)
+	}
+	if bytes.Contains(cfg.stripped, []byte("Address")) || bytes.Contains(cfg.stripped, []byte("PostUp")) {
+		t.Errorf("extended keys left in stripped configuration:\n%s", cfg.stripped)
+	}
+
+	// routes are most specific first and the default route needs policy routing
+
+	want := []net.IPNet{mustCIDR("10.0.0.0/24"), mustCIDR("192.168.0.0/16"), mustCIDR("0.0.0.0/0")}
+	if diff := cmp.Diff(want, cfg.routes()); diff != "" {
+		t.Errorf("routes mismatch (-want +got):\n%s", diff)
+	}
+	if !cfg.usesPolicyRouting() || cfg.policyTable() != defaultPolicyTable {
+		t.Errorf("expected policy routing through table %d", defaultPolicyTable)
+	}
+
+	if diff := cmp.Diff([]bool{false}, cfg.policyFamilies()); diff != "" {
+		t.Errorf("policy families mismatch (-want +got):\n%s", diff)
+	}
+
+	cfg.table = "1234"
+	if cfg.usesPolicyRouting() {
+		t.Errorf("an explicit table must disable policy routing")
+	}
+}
+
+func TestDefaultRouteFamilies(t *testing.T) {
+	testVectors := []struct {
+		allowedIPs []string
+		families   []bool
+	}{
+		{nil, nil},
+		{[]string{"10.0.0.0/8", "fd00::/64"}, nil},
+		{[]string{"::/0"}, []bool{true}},
+		{[]string{"::/0", "10.0.0.0/8", "0.0.0.0/0"}, []bool{false, true}},
+	}
+
+	for _, v := range testVectors {
+		var allowedIPs []net.IPNet
+		for _, s := range v.allowedIPs {
+			allowedIPs = append(allowedIPs, mustCIDR(s))
+		}
+		if diff := cmp.Diff(v.families, defaultRouteFamilies(allowedIPs)); diff != "" {
+			t.Errorf("defaultRouteFamilies(%v) mismatch (-want +got):\n%s", v.allowedIPs, diff)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		line   int
+	}{
+		{"bad address", "[Interface]\nAddress = 10.0.0.300/24\n", 2},
+		{"bad mtu", "[Interface]\n\nMTU = 100\n", 3},
+		{"bad table", "[Interface]\nTable = main\n", 2},
+		{"bad save", "[Interface]\nSaveConfig = maybe\n", 2},
+		// line numbers of the device keys are kept despite the removed lines
+		{"bad device key", "[Interface]\nAddress = 10.0.0.1/24\nDNS = 1.1.1.1\nListenPort = x\n", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig("wg0.conf", strings.NewReader(tt.config))
+
+			var perr *wgtypes.ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a *wgtypes.ParseError, got: %v", err)
+			}
+			if perr.Line != tt.line {
+				t.Fatalf("unexpected line: %d, want %d (%v)", perr.Line, tt.line, err)
+			}
+		})
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		arg   string
+		path  string
+		iface string
+		ok    bool
+	}{
+		{"wg0", "/etc/wireguard/wg0.conf", "wg0", true},
+		{"/tmp/vpn.conf", "/tmp/vpn.conf", "vpn", true},
+		{"./wg1.conf", "./wg1.conf", "wg1", true},
+		{"/tmp/vpn.txt", "", "", false},
+		{"/tmp/name-too-long-for-linux.conf", "", "", false},
+	}
+
+	for _, tt := range tests {
+		path, iface, err := configPath(tt.arg)
+		if (err == nil) != tt.ok {
+			t.Fatalf("configPath(%q): unexpected error: %v", tt.arg, err)
+		}
+		if path != tt.path || iface != tt.iface {
+			t.Fatalf("configPath(%q) = %q, %q, want %q, %q", tt.arg, path, iface, tt.path, tt.iface)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	cfg, err := parseConfig("wg0.conf", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := wgtypes.ParseKey("27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk=")
+	peerKey, _ := wgtypes.ParseKey("AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1")
+	device := &wgtypes.Device{
+		PrivateKey:   key,
+		ListenPort:   51820,
+		FirewallMark: defaultPolicyTable,
+		Peers: []wgtypes.Peer{
+			{PublicKey: peerKey, AllowedIPs: []net.IPNet{mustCIDR("0.0.0.0/0")}},
+		},
+	}
+
+	text, err := cfg.marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[Interface]
+Address = 10.0.0.2/24
+Address = fd00::2/64
+Address = 10.0.1.2/32
+DNS = 10.0.0.1, example.com
+MTU = 1380
+PostUp = echo up %i
+SaveConfig = true
+ListenPort = 51820
+FwMark = 0xca6c
+PrivateKey = 27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk=
+
+[Peer]
+PublicKey = AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1
+AllowedIPs = 0.0.0.0/0
+`
+	if diff := cmp.Diff(want, string(text)); diff != "" {
+		t.Fatalf("marshal() mismatch (-want +got):\n%s", diff)
+	}
+
+	// a saved file loads again
+	if _, err := parseConfig("wg0.conf", bytes.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,538 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package quick
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const (
+	// defaultPolicyTable is the routing table, and the fwmark, used for
+	// default routes when the configuration sets neither Table nor FwMark.
+	defaultPolicyTable = 51820
+
+	// mainTable is RT_TABLE_MAIN.
+	mainTable = 254
+
+	// The policy rules are added with fixed priorities, those ip(8) would
+	// pick on a system without other rules, so that down removes exactly
+	// the rules up added and nobody else's.
+	suppressRulePriority = 32764
+	fwmarkRulePriority   = 32765
+
+	socketDirectory = "/var/run/wireguard"
+
+	envUserspaceImplementation = "WG_QUICK_USERSPACE_IMPLEMENTATION"
+	defaultUserspace           = "wireguard-go"
+)
+
+func showQuickUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s quick [ up | down | save | strip ] [ CONFIG_FILE | INTERFACE ]\n\n", os.Args[0])
+	fmt.Fprintf(file, "  CONFIG_FILE is a configuration file, whose filename is the interface name\n")
+	fmt.Fprintf(file, "  followed by `.conf'. Otherwise, INTERFACE is an interface name, with\n")
+	fmt.Fprintf(file, "  configuration found at %s/INTERFACE.conf. It is to be readable\n", defaultConfigDir)
+	fmt.Fprintf(file, "  by setconf with the addition of the following options in [Interface]:\n")
+	fmt.Fprintf(file, "  Address, DNS, MTU, Table, PreUp, PostUp, PreDown, PostDown and SaveConfig.\n\n")
+	fmt.Fprintf(file, "  The userspace implementation started by up is taken from $%s\n", envUserspaceImplementation)
+	fmt.Fprintf(file, "  and defaults to %s.\n", defaultUserspace)
+}
+
+func Quick(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showQuickUsage(os.Stdout)
+		return 0
+	}
+
+	if len(args) != 3 {
+		showQuickUsage(os.Stderr)
+		return 1
+	}
+
+	var action func(*config) error
+	switch args[1] {
+	case "up":
+		action = up
+	case "down":
+		action = down
+	case "save":
+		action = save
+	case "strip":
+		action = strip
+	default:
+		showQuickUsage(os.Stderr)
+		return 1
+	}
+
+	cfg, err := loadConfig(args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	if err := action(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// logCmd reports each step on stderr in the style of wg-quick, so that a
+// failure can be traced to the command which caused it.
+func logCmd(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "[#] "+format+"\n", a...)
+}
+
+func runHooks(iface string, hooks []string) error {
+	for _, hook := range hooks {
+		hook = strings.ReplaceAll(hook, "%i", iface)
+		logCmd("%s", hook)
+
+		cmd := exec.Command("sh", "-c", hook)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %q failed: %v", hook, err)
+		}
+	}
+
+	return nil
+}
+
+func startUserspace(iface string) error {
+	impl := os.Getenv(envUserspaceImplementation)
+	if impl == "" {
+		impl = defaultUserspace
+	}
+	logCmd("%s %s", impl, iface)
+
+	// wireguard-go daemonizes itself and returns once the UAPI socket
+	// is listening
+	cmd := exec.Command(impl, iface)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// stopUserspace removes the UAPI socket, which makes wireguard-go close the
+// device, and falls back to deleting the link if it does not go away.
+func stopUserspace(iface string) error {
+	logCmd("rm -f %s/%s.sock", socketDirectory, iface)
+	if err := os.Remove(filepath.Join(socketDirectory, iface+".sock")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	logCmd("ip link delete dev %s", iface)
+	return deleteLink(iface)
+}
+
+func setDNS(cfg *config) error {
+	if len(cfg.dns) == 0 && len(cfg.dnsSearch) == 0 {
+		return nil
+	}
+
+	var conf bytes.Buffer
+	for _, ip := range cfg.dns {
+		fmt.Fprintf(&conf, "nameserver %s\n", ip)
+	}
+	if len(cfg.dnsSearch) != 0 {
+		fmt.Fprintf(&conf, "search %s\n", strings.Join(cfg.dnsSearch, " "))
+	}
+
+	logCmd("resolvconf -a tun.%s -m 0 -x", cfg.iface)
+	cmd := exec.Command("resolvconf", "-a", "tun."+cfg.iface, "-m", "0", "-x")
+	cmd.Stdin = &conf
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func unsetDNS(cfg *config) error {
+	if len(cfg.dns) == 0 && len(cfg.dnsSearch) == 0 {
+		return nil
+	}
+
+	logCmd("resolvconf -d tun.%s -f", cfg.iface)
+	cmd := exec.Command("resolvconf", "-d", "tun."+cfg.iface, "-f")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// routes returns the AllowedIPs of every peer, most specific first, without
+// duplicates.
+func (cfg *config) routes() []net.IPNet {
+	seen := make(map[string]bool)
+	var routes []net.IPNet
+
+	for _, peer := range cfg.device.Peers {
+		for _, ip := range peer.AllowedIPs {
+			if !seen[ip.String()] {
+				seen[ip.String()] = true
+				routes = append(routes, ip)
+			}
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, _ := routes[i].Mask.Size()
+		b, _ := routes[j].Mask.Size()
+		return a > b
+	})
+
+	return routes
+}
+
+// policyTable returns the routing table of the default routes. It doubles as
+// the fwmark of the tunnel's own packets, so an explicit FwMark wins.
+func (cfg *config) policyTable() uint32 {
+	if cfg.device.FirewallMark != nil && *cfg.device.FirewallMark != 0 {
+		return uint32(*cfg.device.FirewallMark)
+	}
+	return defaultPolicyTable
+}
+
+// usesPolicyRouting reports whether a default route is routed through the
+// tunnel with fwmark-based policy rules.
+func (cfg *config) usesPolicyRouting() bool {
+	return len(cfg.policyFamilies()) != 0
+}
+
+// policyFamilies returns the address families, as the ipv6 flag, for which up
+// adds policy rules.
+func (cfg *config) policyFamilies() []bool {
+	if cfg.table != tableAuto {
+		return nil
+	}
+	return defaultRouteFamilies(cfg.routes())
+}
+
+// defaultRouteFamilies returns the families, IPv4 first, which have a
+// default route among allowedIPs.
+func defaultRouteFamilies(allowedIPs []net.IPNet) []bool {
+	var v4, v6 bool
+	for _, ip := range allowedIPs {
+		if ones, _ := ip.Mask.Size(); ones == 0 {
+			if ip.IP.To4() == nil {
+				v6 = true
+			} else {
+				v4 = true
+			}
+		}
+	}
+
+	var families []bool
+	if v4 {
+		families = append(families, false)
+	}
+	if v6 {
+		families = append(families, true)
+	}
+	return families
+}
+
+func up(cfg *config) error {
+	if _, err := net.InterfaceByName(cfg.iface); err == nil {
+		return fmt.Errorf("%s already exists", cfg.iface)
+	}
+
+	if err := runHooks(cfg.iface, cfg.preUp); err != nil {
+		return err
+	}
+
+	if err := startUserspace(cfg.iface); err != nil {
+		return fmt.Errorf("failed to start the userspace implementation: %v", err)
+	}
+
+	err := bringUp(cfg)
+	if err != nil {
+		// leave nothing half configured behind
+		for _, ipv6 := range cfg.policyFamilies() {
+			delPolicyRules(ipv6, cfg.policyTable())
+		}
+		unsetDNS(cfg)
+		stopUserspace(cfg.iface)
+		return err
+	}
+
+	return runHooks(cfg.iface, cfg.postUp)
+}
+
+func bringUp(cfg *config) error {
+	routes := cfg.routes()
+
+	device := *cfg.device
+	device.ReplacePeers = true
+
+	policy := cfg.usesPolicyRouting()
+	if policy {
+		mark := int(cfg.policyTable())
+		device.FirewallMark = &mark
+	}
+
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl: %v", err)
+	}
+	defer c.Close()
+
+	logCmd("wg setconf %s %s", cfg.iface, cfg.path)
+	if err := c.ConfigureDevice(cfg.iface, device); err != nil {
+		return fmt.Errorf("failed to configure device: %v", err)
+	}
+
+	for _, addr := range cfg.addresses {
+		logCmd("ip address add %s dev %s", addr.String(), cfg.iface)
+		if err := addAddress(cfg.iface, addr); err != nil {
+			return fmt.Errorf("failed to add address %s: %v", addr.String(), err)
+		}
+	}
+
+	if cfg.mtu != 0 {
+		logCmd("ip link set mtu %d dev %s", cfg.mtu, cfg.iface)
+		if err := setLinkMTU(cfg.iface, cfg.mtu); err != nil {
+			return fmt.Errorf("failed to set MTU: %v", err)
+		}
+	}
+
+	logCmd("ip link set up dev %s", cfg.iface)
+	if err := setLinkUp(cfg.iface); err != nil {
+		return fmt.Errorf("failed to set link up: %v", err)
+	}
+
+	if err := setDNS(cfg); err != nil {
+		return fmt.Errorf("failed to set DNS: %v", err)
+	}
+
+	if cfg.table == tableOff {
+		return nil
+	}
+
+	table := uint32(0)
+	if cfg.table != tableAuto {
+		t, _ := strconv.ParseUint(cfg.table, 10, 32)
+		table = uint32(t)
+	}
+
+	rulesAdded := make(map[bool]bool)
+	for _, route := range routes {
+		ones, _ := route.Mask.Size()
+		ipv6 := route.IP.To4() == nil
+
+		if policy && ones == 0 {
+			policyTable := cfg.policyTable()
+			if !rulesAdded[ipv6] {
+				logCmd("ip -%d rule add not fwmark %d table %d pref %d", familyNumber(ipv6), policyTable, policyTable, fwmarkRulePriority)
+				logCmd("ip -%d rule add table main suppress_prefixlength 0 pref %d", familyNumber(ipv6), suppressRulePriority)
+				if err := addPolicyRules(ipv6, policyTable); err != nil {
+					return fmt.Errorf("failed to add policy rules: %v", err)
+				}
+				rulesAdded[ipv6] = true
+			}
+
+			logCmd("ip -%d route add %s dev %s table %d", familyNumber(ipv6), route.String(), cfg.iface, policyTable)
+			if err := addRoute(cfg.iface, route, policyTable); err != nil {
+				return fmt.Errorf("failed to add route %s: %v", route.String(), err)
+			}
+			continue
+		}
+
+		routeTable := table
+		if routeTable == 0 {
+			routeTable = mainTable
+		}
+
+		logCmd("ip -%d route add %s dev %s table %d", familyNumber(ipv6), route.String(), cfg.iface, routeTable)
+		if err := addRoute(cfg.iface, route, routeTable); err != nil && !isExist(err) {
+			return fmt.Errorf("failed to add route %s: %v", route.String(), err)
+		}
+	}
+
+	return nil
+}
+
+func familyNumber(ipv6 bool) int {
+	if ipv6 {
+		return 6
+	}
+	return 4
+}
+
+func isExist(err error) bool {
+	return errors.Is(err, os.ErrExist)
+}
+
+func down(cfg *config) error {
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl: %v", err)
+	}
+	defer c.Close()
+
+	device, err := c.Device(cfg.iface)
+	if err != nil {
+		return fmt.Errorf("%s is not a WireGuard interface: %v", cfg.iface, err)
+	}
+
+	if cfg.saveConfig {
+		if err := saveDevice(cfg, device); err != nil {
+			return err
+		}
+	}
+
+	if err := runHooks(cfg.iface, cfg.preDown); err != nil {
+		return err
+	}
+
+	// up added policy rules for the families with a default route, using
+	// the fwmark of the device as the table
+	if cfg.table == tableAuto && device.FirewallMark != 0 {
+		var allowedIPs []net.IPNet
+		for _, peer := range device.Peers {
+			allowedIPs = append(allowedIPs, peer.AllowedIPs...)
+		}
+
+		for _, ipv6 := range defaultRouteFamilies(allowedIPs) {
+			logCmd("ip -%d rule delete not fwmark %d table %d pref %d", familyNumber(ipv6), device.FirewallMark, device.FirewallMark, fwmarkRulePriority)
+			logCmd("ip -%d rule delete table main suppress_prefixlength 0 pref %d", familyNumber(ipv6), suppressRulePriority)
+			if err := delPolicyRules(ipv6, uint32(device.FirewallMark)); err != nil {
+				return fmt.Errorf("failed to delete policy rules: %v", err)
+			}
+		}
+	}
+
+	if err := stopUserspace(cfg.iface); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", cfg.iface, err)
+	}
+
+	if err := unsetDNS(cfg); err != nil {
+		return fmt.Errorf("failed to unset DNS: %v", err)
+	}
+
+	return runHooks(cfg.iface, cfg.postDown)
+}
+
+func save(cfg *config) error {
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl: %v", err)
+	}
+	defer c.Close()
+
+	device, err := c.Device(cfg.iface)
+	if err != nil {
+		return fmt.Errorf("%s is not a WireGuard interface: %v", cfg.iface, err)
+	}
+
+	return saveDevice(cfg, device)
+}
+
+// saveDevice rewrites the configuration file from the live interface: its
+// addresses, MTU and peers replace the ones in the file, the remaining
+// extended keys are kept.
+func saveDevice(cfg *config, device *wgtypes.Device) error {
+	link, err := net.InterfaceByName(cfg.iface)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := link.Addrs()
+	if err != nil {
+		return err
+	}
+
+	cfg.addresses = nil
+	for _, addr := range addrs {
+		n, ok := addr.(*net.IPNet)
+		if !ok || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		cfg.addresses = append(cfg.addresses, *n)
+	}
+
+	if cfg.mtu != 0 {
+		cfg.mtu = link.MTU
+	}
+
+	text, err := cfg.marshal(device)
+	if err != nil {
+		return err
+	}
+
+	logCmd("wg showconf %s > %s", cfg.iface, cfg.path)
+
+	return writeFileAtomic(cfg.path, text)
+}
+
+// marshal renders the configuration file of device, with the extended keys
+// of cfg at the top of the [Interface] section.
+func (cfg *config) marshal(device *wgtypes.Device) ([]byte, error) {
+	text, err := device.Config().MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	const header = "[Interface]\n"
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	cfg.marshalQuick(&b)
+	b.Write(bytes.TrimPrefix(text, []byte(header)))
+
+	return b.Bytes(), nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func strip(cfg *config) error {
+	_, err := os.Stdout.Write(cfg.stripped)
+	return err
+}
@@ -0,0 +1,330 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package quick
+
+/* Minimal rtnetlink client: just enough to program the addresses, routes and
+ * policy rules of a tunnel without shelling out to ip(8).
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fib rule attributes and flags, from linux/fib_rules.h
+const (
+	fraPriority          = 6
+	fraFwmark            = 10
+	fraSuppressPrefixlen = 14
+	fraTable             = 15
+
+	frActToTbl    = 1
+	fibRuleInvert = 0x2
+
+	sizeofFibRuleHdr = 12
+)
+
+type fibRuleHdr struct {
+	Family uint8
+	DstLen uint8
+	SrcLen uint8
+	Tos    uint8
+	Table  uint8
+	Res1   uint8
+	Res2   uint8
+	Action uint8
+	Flags  uint32
+}
+
+var netlinkSeq uint32
+
+// netlinkRequest is a message under construction: a header, a fixed family
+// specific body and a list of attributes.
+type netlinkRequest struct {
+	buf []byte
+}
+
+func newNetlinkRequest(typ, flags uint16, body unsafe.Pointer, size int) *netlinkRequest {
+	req := &netlinkRequest{buf: make([]byte, unix.SizeofNlMsghdr+size)}
+
+	hdr := (*unix.NlMsghdr)(unsafe.Pointer(&req.buf[0]))
+	hdr.Type = typ
+	hdr.Flags = unix.NLM_F_REQUEST | unix.NLM_F_ACK | flags
+	hdr.Seq = atomic.AddUint32(&netlinkSeq, 1)
+
+	copy(req.buf[unix.SizeofNlMsghdr:], (*[1 << 16]byte)(body)[:size:size])
+
+	return req
+}
+
+func rtaAlign(n int) int {
+	return (n + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+}
+
+func (req *netlinkRequest) addAttr(typ uint16, data []byte) {
+	attr := make([]byte, rtaAlign(unix.SizeofRtAttr+len(data)))
+
+	rta := (*unix.RtAttr)(unsafe.Pointer(&attr[0]))
+	rta.Type = typ
+	rta.Len = uint16(unix.SizeofRtAttr + len(data))
+	copy(attr[unix.SizeofRtAttr:], data)
+
+	req.buf = append(req.buf, attr...)
+}
+
+func (req *netlinkRequest) addAttrUint32(typ uint16, v uint32) {
+	var data [4]byte
+	*(*uint32)(unsafe.Pointer(&data[0])) = v
+	req.addAttr(typ, data[:])
+}
+
+// execute sends the request and waits for the kernel to acknowledge it.
+func (req *netlinkRequest) execute() error {
+	hdr := (*unix.NlMsghdr)(unsafe.Pointer(&req.buf[0]))
+	hdr.Len = uint32(len(req.buf))
+	seq := hdr.Seq
+
+	sock, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(sock)
+
+	if err := unix.Bind(sock, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	if err := unix.Sendto(sock, req.buf, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	for msg := make([]byte, 1<<16); ; {
+		n, _, err := unix.Recvfrom(sock, msg, 0)
+		if err != nil {
+			return err
+		}
+
+		for remain := msg[:n]; len(remain) >= unix.SizeofNlMsghdr; {
+			reply := *(*unix.NlMsghdr)(unsafe.Pointer(&remain[0]))
+			if int(reply.Len) < unix.SizeofNlMsghdr || int(reply.Len) > len(remain) {
+				return fmt.Errorf("malformed netlink message")
+			}
+
+			if reply.Seq == seq && reply.Type == unix.NLMSG_ERROR {
+				if int(reply.Len) < unix.SizeofNlMsghdr+unix.SizeofNlMsgerr {
+					return fmt.Errorf("truncated netlink error")
+				}
+				e := *(*unix.NlMsgerr)(unsafe.Pointer(&remain[unix.SizeofNlMsghdr]))
+				if e.Error != 0 {
+					return unix.Errno(-e.Error)
+				}
+				return nil
+			}
+
+			remain = remain[rtaAlign(int(reply.Len)):]
+		}
+	}
+}
+
+func linkIndex(iface string) (int32, error) {
+	link, err := net.InterfaceByName(iface)
+	if err != nil {
+		return 0, err
+	}
+	return int32(link.Index), nil
+}
+
+func ipFamily(ip net.IP) uint8 {
+	if ip.To4() != nil {
+		return unix.AF_INET
+	}
+	return unix.AF_INET6
+}
+
+func ipBytes(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+func setLinkUp(iface string) error {
+	index, err := linkIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	msg := unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  index,
+		Flags:  unix.IFF_UP,
+		Change: unix.IFF_UP,
+	}
+
+	return newNetlinkRequest(unix.RTM_NEWLINK, 0, unsafe.Pointer(&msg), unix.SizeofIfInfomsg).execute()
+}
+
+func setLinkMTU(iface string, mtu int) error {
+	index, err := linkIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	msg := unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  index,
+	}
+
+	req := newNetlinkRequest(unix.RTM_NEWLINK, 0, unsafe.Pointer(&msg), unix.SizeofIfInfomsg)
+	req.addAttrUint32(unix.IFLA_MTU, uint32(mtu))
+
+	return req.execute()
+}
+
+func deleteLink(iface string) error {
+	index, err := linkIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	msg := unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  index,
+	}
+
+	return newNetlinkRequest(unix.RTM_DELLINK, 0, unsafe.Pointer(&msg), unix.SizeofIfInfomsg).execute()
+}
+
+func addAddress(iface string, addr net.IPNet) error {
+	index, err := linkIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	ones, _ := addr.Mask.Size()
+	msg := unix.IfAddrmsg{
+		Family:    ipFamily(addr.IP),
+		Prefixlen: uint8(ones),
+		Index:     uint32(index),
+	}
+
+	req := newNetlinkRequest(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, unsafe.Pointer(&msg), unix.SizeofIfAddrmsg)
+	req.addAttr(unix.IFA_LOCAL, ipBytes(addr.IP))
+	req.addAttr(unix.IFA_ADDRESS, ipBytes(addr.IP))
+
+	return req.execute()
+}
+
+func addRoute(iface string, dst net.IPNet, table uint32) error {
+	index, err := linkIndex(iface)
+	if err != nil {
+		return err
+	}
+
+	ones, _ := dst.Mask.Size()
+	msg := unix.RtMsg{
+		Family:   ipFamily(dst.IP),
+		Dst_len:  uint8(ones),
+		Table:    unix.RT_TABLE_UNSPEC,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_LINK,
+		Type:     unix.RTN_UNICAST,
+	}
+	if table < 256 {
+		msg.Table = uint8(table)
+	}
+
+	req := newNetlinkRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, unsafe.Pointer(&msg), unix.SizeofRtMsg)
+	if ones != 0 {
+		req.addAttr(unix.RTA_DST, ipBytes(dst.IP))
+	}
+	req.addAttrUint32(unix.RTA_OIF, uint32(index))
+	req.addAttrUint32(unix.RTA_TABLE, table)
+
+	return req.execute()
+}
+
+// policyRules returns the two rules which send everything but the tunnel's
+// own fwmark-tagged traffic to table, while still honouring more specific
+// routes of the main table:
+//
+//	32765: not fwmark <table> lookup <table>
+//	32764: lookup main suppress_prefixlength 0
+func policyRules(family uint8, table uint32) []*netlinkRequest {
+	return []*netlinkRequest{
+		newRuleRequest(family, fwmarkRulePriority, table, table, fibRuleInvert, -1),
+		newRuleRequest(family, suppressRulePriority, unix.RT_TABLE_MAIN, 0, 0, 0),
+	}
+}
+
+func newRuleRequest(family uint8, priority, table, fwmark, flags uint32, suppressPrefixlen int) *netlinkRequest {
+	msg := fibRuleHdr{
+		Family: family,
+		Action: frActToTbl,
+		Flags:  flags,
+	}
+
+	req := newNetlinkRequest(unix.RTM_NEWRULE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, unsafe.Pointer(&msg), sizeofFibRuleHdr)
+	req.addAttrUint32(fraPriority, priority)
+	req.addAttrUint32(fraTable, table)
+	if fwmark != 0 {
+		req.addAttrUint32(fraFwmark, fwmark)
+	}
+	if suppressPrefixlen >= 0 {
+		req.addAttrUint32(fraSuppressPrefixlen, uint32(suppressPrefixlen))
+	}
+
+	return req
+}
+
+func addPolicyRules(ipv6 bool, table uint32) error {
+	family := uint8(unix.AF_INET)
+	if ipv6 {
+		family = unix.AF_INET6
+	}
+
+	for _, req := range policyRules(family, table) {
+		if err := req.execute(); err != nil && err != unix.EEXIST {
+			return err
+		}
+	}
+
+	if !ipv6 {
+		// let the reverse path filter see the fwmark of our own packets
+		return ioutil.WriteFile("/proc/sys/net/ipv4/conf/all/src_valid_mark", []byte("1"), 0644)
+	}
+
+	return nil
+}
+
+// delPolicyRules removes the rules installed by addPolicyRules for the same
+// family and table. The requests carry every attribute of the rules, their
+// priority included, so no other rule matches. Missing rules are not an
+// error.
+func delPolicyRules(ipv6 bool, table uint32) error {
+	family := uint8(unix.AF_INET)
+	if ipv6 {
+		family = unix.AF_INET6
+	}
+
+	for _, req := range policyRules(family, table) {
+		hdr := (*unix.NlMsghdr)(unsafe.Pointer(&req.buf[0]))
+		hdr.Type = unix.RTM_DELRULE
+		hdr.Flags = unix.NLM_F_REQUEST | unix.NLM_F_ACK
+
+		err := req.execute()
+		if err != nil && err != unix.ENOENT && err != unix.EAFNOSUPPORT {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+// +build !linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package quick
+
+import (
+	"errors"
+	"net"
+)
+
+var errNotSupported = errors.New("wg quick is only supported on Linux")
+
+func setLinkUp(iface string) error {
+	return errNotSupported
+}
+
+func setLinkMTU(iface string, mtu int) error {
+	return errNotSupported
+}
+
+func deleteLink(iface string) error {
+	return errNotSupported
+}
+
+func addAddress(iface string, addr net.IPNet) error {
+	return errNotSupported
+}
+
+func addRoute(iface string, dst net.IPNet, table uint32) error {
+	return errNotSupported
+}
+
+func addPolicyRules(ipv6 bool, table uint32) error {
+	return errNotSupported
+}
+
+func delPolicyRules(ipv6 bool, table uint32) error {
+	return errNotSupported
+}
@@ -0,0 +1,58 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+// Package remote selects the devices which the wg tool controls: those on
+// this system or, with WG_REMOTE, those of a remote wireguard-go reached
+// through its management API.
+package remote
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgapi"
+)
+
+const (
+	envRemote     = "WG_REMOTE"
+	envRemoteCert = "WG_REMOTE_CERT"
+	envRemoteKey  = "WG_REMOTE_KEY"
+	envRemoteCA   = "WG_REMOTE_CA"
+)
+
+// Usage describes the environment variables, for the usage of wg.
+const Usage = `Set WG_REMOTE to the management API of a remote wireguard-go, unix:PATH or
+HOST:PORT, to control its devices instead. Over TCP the client certificate,
+its key and the CA of the server are read from WG_REMOTE_CERT, WG_REMOTE_KEY
+and WG_REMOTE_CA.
+`
+
+// NewClient opens a client of the remote devices if WG_REMOTE is set, or of
+// the devices on this system otherwise.
+func NewClient() (*wgctrl.Client, error) {
+	addr := os.Getenv(envRemote)
+	if addr == "" {
+		return wgctrl.New()
+	}
+
+	var creds *tls.Config
+	if !strings.HasPrefix(addr, "unix:") {
+		cert, key, ca := os.Getenv(envRemoteCert), os.Getenv(envRemoteKey), os.Getenv(envRemoteCA)
+		if cert == "" || key == "" || ca == "" {
+			return nil, fmt.Errorf("%s on TCP requires %s, %s and %s", envRemote, envRemoteCert, envRemoteKey, envRemoteCA)
+		}
+
+		var err error
+		creds, err = wgapi.ClientTLSConfig(cert, key, ca)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return wgctrl.NewRemote(addr, creds)
+}
@@ -0,0 +1,127 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package set
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func showDiffConfUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s diffconf <interface> <configuration filename> [json]\n", os.Args[0])
+}
+
+// DiffConf prints what syncconf would change on an interface, without
+// changing anything.
+func DiffConf(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showDiffConfUsage(os.Stdout)
+		return 0
+	}
+
+	if len(args) != 3 && !(len(args) == 4 && args[3] == "json") {
+		showDiffConfUsage(os.Stderr)
+		return 1
+	}
+
+	configFile, err := os.Open(args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open configuration file: %v\n", err)
+		return 1
+	}
+	defer configFile.Close()
+
+	config, err := parseConfigFile(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse configuration: %v\n", err)
+		return 1
+	}
+
+	c, err := remote.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	device, err := c.DeviceWithSecrets(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to retrieve current interface configuration: %s\n", err)
+		return 1
+	}
+
+	plan, err := wgtypes.Diff(device, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to compute changes: %s\n", err)
+		return 1
+	}
+
+	if len(args) == 4 {
+		err = printPlanJSON(os.Stdout, args[1], plan)
+	} else {
+		printPlan(os.Stdout, args[1], plan)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to print changes: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printPlan writes plan in the layout of wg show: one block per peer, with
+// one "field: old -> new" line per change.
+func printPlan(out io.Writer, iface string, plan *wgtypes.Plan) {
+	if plan.Empty() {
+		fmt.Fprintf(out, "interface: %s: no changes\n", iface)
+		return
+	}
+
+	fmt.Fprintf(out, "interface: %s\n", iface)
+	for _, change := range plan.Interface {
+		printChange(out, change)
+	}
+
+	for _, peer := range plan.Peers {
+		fmt.Fprintf(out, "\npeer: %s (%s)\n", peer.PublicKey.String(), peer.Action)
+		for _, change := range peer.Changes {
+			printChange(out, change)
+		}
+		if len(peer.AllowedIPsAdded) != 0 {
+			fmt.Fprintf(out, "  allowed ips added: %s\n", strings.Join(peer.AllowedIPsAdded, ", "))
+		}
+		if len(peer.AllowedIPsRemoved) != 0 {
+			fmt.Fprintf(out, "  allowed ips removed: %s\n", strings.Join(peer.AllowedIPsRemoved, ", "))
+		}
+	}
+}
+
+func printChange(out io.Writer, change wgtypes.Change) {
+	old, next := change.Old, change.New
+	if old == "" {
+		old = "(none)"
+	}
+	if next == "" {
+		next = "(none)"
+	}
+	fmt.Fprintf(out, "  %s: %s -> %s\n", change.Field, old, next)
+}
+
+func printPlanJSON(out io.Writer, iface string, plan *wgtypes.Plan) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(struct {
+		Interface string        `json:"interface"`
+		Changes   *wgtypes.Plan `json:"changes"`
+	}{iface, plan})
+}
@@ -0,0 +1,65 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package set
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestPrintPlan(t *testing.T) {
+	peer1, _ := wgtypes.ParseKey("AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1")
+	peer2, _ := wgtypes.ParseKey("AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u")
+	_, allowed, _ := net.ParseCIDR("10.0.0.2/32")
+	port := 51820
+
+	device := &wgtypes.Device{
+		ListenPort: 1337,
+		Peers:      []wgtypes.Peer{{PublicKey: peer1}},
+	}
+	cfg := &wgtypes.Config{
+		ListenPort: &port,
+		Peers:      []wgtypes.PeerConfig{{PublicKey: peer2, AllowedIPs: []net.IPNet{*allowed}}},
+	}
+
+	expected := `interface: wg0
+  ListenPort: 1337 -> 51820
+
+peer: AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u (add)
+  allowed ips added: 10.0.0.2/32
+
+peer: AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1 (remove)
+`
+
+	plan, err := wgtypes.Diff(device, cfg)
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+
+	var buf bytes.Buffer
+	printPlan(&buf, "wg0", plan)
+
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("printPlan() mismatch (-want +got):\n%s", diff)
+	}
+
+	plan, err = wgtypes.Diff(device, &wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: peer1}}})
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+
+	buf.Reset()
+	printPlan(&buf, "wg0", plan)
+
+	if diff := cmp.Diff("interface: wg0: no changes\n", buf.String()); diff != "" {
+		t.Errorf("printPlan() mismatch (-want +got):\n%s", diff)
+	}
+}
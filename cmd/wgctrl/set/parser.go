@@ -6,7 +6,6 @@
 package set
 
 import (
-	"bufio"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -184,6 +183,46 @@ func parsePersistentKeepalive(s string) (*time.Duration, error) {
 	return &duration, nil
 }
 
+// parseActivation accepts the times of wgtypes.ParseTime.
+func parseActivation(s string) (*time.Time, error) {
+	t, err := wgtypes.ParseTime(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("activation time is %v", err)
+	}
+
+	return &t, nil
+}
+
+// parseExpiry accepts a lifetime such as 8h in addition to the formats of
+// parseActivation.
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil && d > 0 {
+		t := now.Add(d)
+		return &t, nil
+	}
+
+	t, err := parseActivation(s)
+	if err != nil {
+		return nil, fmt.Errorf("expiry is neither a lifetime, RFC 3339 nor UNIX seconds: %s", s)
+	}
+	return t, nil
+}
+
+func parseRolloverWindow(s string) (*time.Duration, error) {
+	value, err := parseInt(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	if value < 0 {
+		return nil, fmt.Errorf("rollover window is negative: %d", value)
+	}
+
+	duration := time.Duration(value) * time.Second
+
+	return &duration, nil
+}
+
 func parseCmd(args []string) (*wgtypes.Config, error) {
 	var device wgtypes.Config
 	var peer *wgtypes.PeerConfig
@@ -215,6 +254,15 @@ func parseCmd(args []string) (*wgtypes.Config, error) {
 
 			device.PrivateKey = key
 
+			args = args[2:]
+		} else if args[0] == "rollover-window" && len(args) >= 2 && peer == nil {
+			window, err := parseRolloverWindow(args[1])
+			if err != nil {
+				return nil, err
+			}
+
+			device.RolloverWindow = window
+
 			args = args[2:]
 		} else if args[0] == "peer" && len(args) >= 2 {
 			if peer != nil {
@@ -230,6 +278,23 @@ func parseCmd(args []string) (*wgtypes.Config, error) {
 
 			peer.PublicKey = key
 
+			args = args[2:]
+		} else if args[0] == "name" && len(args) >= 2 && peer != nil {
+			name := args[1]
+			peer.Name = &name
+
+			args = args[2:]
+		} else if args[0] == "annotation" && len(args) >= 2 && peer != nil {
+			i := strings.IndexByte(args[1], '=')
+			if i <= 0 {
+				return nil, fmt.Errorf("annotation is not a key=value pair: %s", args[1])
+			}
+
+			if peer.Annotations == nil {
+				peer.Annotations = make(map[string]string)
+			}
+			peer.Annotations[args[1][:i]] = args[1][i+1:]
+
 			args = args[2:]
 		} else if args[0] == "remove" && peer != nil {
 			peer.Remove = true
@@ -272,150 +337,35 @@ func parseCmd(args []string) (*wgtypes.Config, error) {
 			peer.PresharedKey = key
 
 			args = args[2:]
-		} else {
-			return nil, fmt.Errorf("invalid argument: %s", args[0])
-		}
-	}
-
-	if peer != nil {
-		device.Peers = append(device.Peers, *peer)
-	}
-
-	return &device, nil
-}
-
-func parseConfigFile(file io.Reader) (*wgtypes.Config, error) {
-	var device wgtypes.Config
-	var peer *wgtypes.PeerConfig
-	var isDeviceSection bool
-	var isPeerSection bool
-
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-
-	var lines []string
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
-	}
-
-	for _, line := range lines {
-		if line == "[Interface]" {
-			isDeviceSection = true
-			isPeerSection = false
-			continue
-		}
-
-		if line == "[Peer]" {
-			isDeviceSection = false
-			isPeerSection = true
-
-			if peer != nil {
-				if peer.PublicKey == nil {
-					return nil, fmt.Errorf("a peer is missing a public key")
-				}
-
-				device.Peers = append(device.Peers, *peer)
+		} else if args[0] == "next-preshared-key" && len(args) >= 2 && peer != nil {
+			key, err := parsePrivateKeyFile(args[1])
+			if err != nil {
+				return nil, err
 			}
 
-			peer = new(wgtypes.PeerConfig)
-
-			continue
-		}
-
-		params := strings.SplitN(line, "=", 2)
-		key := strings.TrimSpace(params[0])
-		value := strings.TrimSpace(params[1])
-
-		if len(params) != 2 {
-			return nil, fmt.Errorf("line unrecognized: %s", line)
-		}
-
-		if isDeviceSection {
-			if key == "ListenPort" {
-				port, err := parseInt(value)
-				if err != nil {
-					return nil, err
-				}
-
-				device.ListenPort = &port
+			peer.NextPresharedKey = key
 
-				continue
-			} else if key == "FwMark" {
-				fwmark, err := parseFwmark(value)
-				if err != nil {
-					return nil, err
-				}
-
-				device.FirewallMark = fwmark
-
-				continue
-			} else if key == "PrivateKey" {
-				privateKey, err := parsePrivateKey(value)
-				if err != nil {
-					return nil, err
-				}
+			args = args[2:]
+		} else if args[0] == "next-preshared-key-activation" && len(args) >= 2 && peer != nil {
+			activation, err := parseActivation(args[1])
+			if err != nil {
+				return nil, err
+			}
 
-				device.PrivateKey = privateKey
+			peer.NextPresharedKeyActivation = activation
 
-				continue
-			} else {
-				return nil, fmt.Errorf("line unrecognized: %s", line)
+			args = args[2:]
+		} else if args[0] == "expires" && len(args) >= 2 && peer != nil {
+			expiresAt, err := parseExpiry(args[1], time.Now())
+			if err != nil {
+				return nil, err
 			}
-		}
 
-		if isPeerSection {
-			if key == "Endpoint" {
-				endpoint, err := parseEndpoint(value)
-				if err != nil {
-					return nil, err
-				}
-
-				peer.Endpoint = endpoint
-
-				continue
-			} else if key == "PublicKey" {
-				publicKey, err := parsePublicKey(value)
-				if err != nil {
-					return nil, err
-				}
-
-				peer.PublicKey = publicKey
-
-				continue
-			} else if key == "AllowedIPs" {
-				ips, err := parseAllowedIPs(value)
-				if err != nil {
-					return nil, err
-				}
-
-				peer.AllowedIPs = ips
-
-				continue
-			} else if key == "PersistentKeepalive" {
-				duration, err := parsePersistentKeepalive(value)
-				if err != nil {
-					return nil, err
-				}
-
-				peer.PersistentKeepaliveInterval = duration
-
-				continue
-			} else if key == "PresharedKey" {
-				key, err := parsePrivateKey(value)
-				if err != nil {
-					return nil, err
-				}
-
-				peer.PresharedKey = key
-
-				continue
-			} else {
-				return nil, fmt.Errorf("line unrecognized: %s", line)
-			}
+			peer.ExpiresAt = expiresAt
+
+			args = args[2:]
+		} else {
+			return nil, fmt.Errorf("invalid argument: %s", args[0])
 		}
 	}
 
@@ -425,3 +375,14 @@ func parseConfigFile(file io.Reader) (*wgtypes.Config, error) {
 
 	return &device, nil
 }
+
+// parseConfigFile parses a configuration file, see wgtypes.ParseConfig. Errors
+// carry the file name when file is an *os.File.
+func parseConfigFile(file io.Reader) (*wgtypes.Config, error) {
+	var name string
+	if f, ok := file.(interface{ Name() string }); ok {
+		name = f.Name()
+	}
+
+	return wgtypes.ParseConfig(name, file)
+}
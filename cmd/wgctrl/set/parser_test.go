@@ -242,6 +242,58 @@ func TestParsePersistentKeepalive(t *testing.T) {
 	}
 }
 
+func TestParseActivation(t *testing.T) {
+	testVectors := []struct {
+		input  string
+		result time.Time
+		ok     bool
+	}{
+		{"2020-11-18T12:00:00Z", time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC), true},
+		{" 1605700800 ", time.Unix(1605700800, 0), true},
+		{"0", time.Time{}, true},
+		{"-1", time.Time{}, false},
+		{"tomorrow", time.Time{}, false},
+	}
+
+	for _, v := range testVectors {
+		activation, err := parseActivation(v.input)
+		if (err == nil) != v.ok {
+			t.Fatalf("parseActivation(%q) error: %v", v.input, err)
+		}
+		if err == nil && !activation.Equal(v.result) {
+			t.Fatalf("parseActivation(%q) = %v, want %v", v.input, activation, v.result)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)
+
+	testVectors := []struct {
+		input  string
+		result time.Time
+		ok     bool
+	}{
+		{"8h", now.Add(8 * time.Hour), true},
+		{"90m", now.Add(90 * time.Minute), true},
+		{"2020-11-19T12:00:00Z", time.Date(2020, 11, 19, 12, 0, 0, 0, time.UTC), true},
+		{"1605700800", time.Unix(1605700800, 0), true},
+		{"0", time.Time{}, true},
+		{"-1h", time.Time{}, false},
+		{"tomorrow", time.Time{}, false},
+	}
+
+	for _, v := range testVectors {
+		expiresAt, err := parseExpiry(v.input, now)
+		if (err == nil) != v.ok {
+			t.Fatalf("parseExpiry(%q) error: %v", v.input, err)
+		}
+		if err == nil && !expiresAt.Equal(v.result) {
+			t.Fatalf("parseExpiry(%q) = %v, want %v", v.input, expiresAt, v.result)
+		}
+	}
+}
+
 func TestParseCmd(t *testing.T) {
 	tempDir := t.TempDir()
 	keyFile := path.Join(tempDir, "wg-test-private-key")
@@ -269,6 +321,7 @@ func TestParseCmd(t *testing.T) {
 		"listen-port", "1337",
 		"fwmark", "0x10",
 		"private-key", keyFile,
+		"rollover-window", "600",
 		"peer", "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u",
 		"remove",
 		"peer", "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1",
@@ -276,12 +329,15 @@ func TestParseCmd(t *testing.T) {
 		"allowed-ips", "10.10.10.1/32",
 		"persistent-keepalive", "3",
 		"preshared-key", pskFile,
+		"name", "alice laptop",
+		"annotation", "team=ops=oncall",
 	}
 
 	expectedConfig := &wgtypes.Config{
-		PrivateKey:   &wgtypes.Key{0xdb, 0xb4, 0x5a, 0xf8, 0x9d, 0xf6, 0x3e, 0xb7, 0x4d, 0x9e, 0xd5, 0x69, 0x1f, 0x48, 0x08, 0xe1, 0xa4, 0x61, 0xbc, 0xf4, 0x45, 0x44, 0xb1, 0xd0, 0x3e, 0x64, 0xf7, 0xbe, 0x12, 0x02, 0x7d, 0x59},
-		ListenPort:   new(int), // need to complete
-		FirewallMark: new(int), // need to complete
+		PrivateKey:     &wgtypes.Key{0xdb, 0xb4, 0x5a, 0xf8, 0x9d, 0xf6, 0x3e, 0xb7, 0x4d, 0x9e, 0xd5, 0x69, 0x1f, 0x48, 0x08, 0xe1, 0xa4, 0x61, 0xbc, 0xf4, 0x45, 0x44, 0xb1, 0xd0, 0x3e, 0x64, 0xf7, 0xbe, 0x12, 0x02, 0x7d, 0x59},
+		RolloverWindow: new(time.Duration), // need to complete
+		ListenPort:     new(int),           // need to complete
+		FirewallMark:   new(int),           // need to complete
 		Peers: []wgtypes.PeerConfig{
 			{
 				PublicKey: wgtypes.Key{0x02, 0xd0, 0x19, 0x45, 0x37, 0xec, 0x19, 0xd7, 0x96, 0xd4, 0x45, 0xf1, 0xd3, 0x27, 0x8e, 0xf4, 0xa6, 0x3e, 0x70, 0x0f, 0x78, 0x90, 0x93, 0x0f, 0x2f, 0xbd, 0x50, 0xd6, 0xe1, 0xca, 0xc7, 0x1e, 0xae},
@@ -297,13 +353,17 @@ func TestParseCmd(t *testing.T) {
 				PersistentKeepaliveInterval: new(time.Duration), // need to complete
 				ReplaceAllowedIPs:           true,
 				AllowedIPs:                  []net.IPNet{{IP: net.IPv4(10, 10, 10, 1).Mask(net.CIDRMask(32, 32)), Mask: net.CIDRMask(32, 32)}},
+				Name:                        new(string), // need to complete
+				Annotations:                 map[string]string{"team": "ops=oncall"},
 			},
 		},
 	}
 
+	*expectedConfig.RolloverWindow = 10 * time.Minute
 	*expectedConfig.ListenPort = 1337
 	*expectedConfig.FirewallMark = 16
 	*expectedConfig.Peers[1].PersistentKeepaliveInterval = time.Duration(3) * time.Second
+	*expectedConfig.Peers[1].Name = "alice laptop"
 
 	result, err := parseCmd(cmdArgs)
 	if err != nil {
@@ -334,6 +394,8 @@ PresharedKey = 3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI=
 PublicKey = AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u
 Endpoint = [fe80::1ff:fe23:4567:890a%eth0]:1337
 AllowedIPs = 10.10.10.2/32
+NextPresharedKey = 3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI=
+NextPresharedKeyActivation = 2020-11-18T12:00:00Z
 `
 
 	expectedConfig := &wgtypes.Config{
@@ -364,6 +426,8 @@ AllowedIPs = 10.10.10.2/32
 				AllowedIPs: []net.IPNet{
 					{IP: net.IPv4(10, 10, 10, 2).Mask(net.CIDRMask(32, 32)), Mask: net.CIDRMask(32, 32)},
 				},
+				NextPresharedKey:           &wgtypes.Key{0xde, 0x30, 0x79, 0xa3, 0x9f, 0xaa, 0x47, 0x73, 0x1c, 0xe6, 0x20, 0xcc, 0x1a, 0x16, 0x92, 0xac, 0xed, 0x46, 0x1a, 0xfc, 0x96, 0x85, 0x20, 0x0a, 0xd3, 0xfe, 0x9f, 0x4f, 0x54, 0x11, 0xf5, 0x72},
+				NextPresharedKeyActivation: new(time.Time), // need to complete
 			},
 		},
 	}
@@ -371,6 +435,7 @@ AllowedIPs = 10.10.10.2/32
 	*expectedConfig.ListenPort = 1337
 	*expectedConfig.FirewallMark = 16
 	*expectedConfig.Peers[0].PersistentKeepaliveInterval = time.Duration(3) * time.Second
+	*expectedConfig.Peers[1].NextPresharedKeyActivation = time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)
 
 	configReader := strings.NewReader(config)
 
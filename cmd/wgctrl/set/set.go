@@ -10,11 +10,11 @@ import (
 	"io"
 	"os"
 
-	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
 )
 
 func showSetUsage(file io.Writer) {
-	fmt.Fprintf(file, "Usage: %s set <interface> [listen-port <port>] [fwmark <mark>] [private-key <file path>] [peer <base64 public key> [remove] [preshared-key <file path>] [endpoint <ip>:<port>] [persistent-keepalive <interval seconds>] [allowed-ips <ip1>/<cidr1>[,<ip2>/<cidr2>]...] ]...\n", os.Args[0])
+	fmt.Fprintf(file, "Usage: %s set <interface> [listen-port <port>] [fwmark <mark>] [private-key <file path>] [rollover-window <seconds>] [peer <base64 public key> [remove] [name <text>] [annotation <key>=<value>]... [preshared-key <file path>] [next-preshared-key <file path>] [next-preshared-key-activation <time>] [expires <time>|<lifetime>] [endpoint <ip>:<port>] [persistent-keepalive <interval seconds>] [allowed-ips <ip1>/<cidr1>[,<ip2>/<cidr2>]...] ]...\n", os.Args[0])
 }
 
 func Set(args []string) int {
@@ -34,7 +34,7 @@ func Set(args []string) int {
 		return 1
 	}
 
-	c, err := wgctrl.New()
+	c, err := remote.NewClient()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
 		return 1
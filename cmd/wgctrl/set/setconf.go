@@ -10,7 +10,7 @@ import (
 	"io"
 	"os"
 
-	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
 )
 
 func showSetConfUsage(file io.Writer, cmd string) {
@@ -33,6 +33,7 @@ func SetConf(args []string) int {
 		fmt.Fprintf(os.Stderr, "failed to open configuration file: %v\n", err)
 		return 1
 	}
+	defer configFile.Close()
 
 	device, err := parseConfigFile(configFile)
 	if err != nil {
@@ -46,7 +47,7 @@ func SetConf(args []string) int {
 		device.ReplacePeers = false
 	}
 
-	c, err := wgctrl.New()
+	c, err := remote.NewClient()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
 		return 1
@@ -54,13 +55,16 @@ func SetConf(args []string) int {
 	defer c.Close()
 
 	if args[0] == "syncconf" {
-		oldDevice, err := c.Device(args[1])
+		oldDevice, err := c.DeviceWithSecrets(args[1])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "unable to retrieve current interface configuration: %s", err)
 			return 1
 		}
 
-		syncConf(oldDevice, device)
+		if err := syncConf(oldDevice, device); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to compute changes: %s\n", err)
+			return 1
+		}
 	}
 
 	err = c.ConfigureDevice(args[1], *device)
@@ -6,34 +6,18 @@
 package set
 
 import (
-	"bytes"
-
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
-func syncConf(oldDevice *wgtypes.Device, newDevice *wgtypes.Config) {
-	var removePeers []wgtypes.PeerConfig
-
-	// if flag is true then add peer in removePeers
-	flag := true
-	for _, oldPeer := range oldDevice.Peers {
-		for _, newPeer := range newDevice.Peers {
-			if bytes.Equal(oldPeer.PublicKey, newPeer.PublicKey) {
-				flag = false
-				break
-			}
-		}
-
-		if flag {
-			peer := wgtypes.PeerConfig{
-				PublicKey: oldPeer.PublicKey,
-				Remove:    true,
-			}
-			removePeers = append(removePeers, peer)
-		} else {
-			flag = true
-		}
+// syncConf replaces newDevice with the minimal set of changes which brings
+// oldDevice to it: unchanged peers are left alone, so that their sessions
+// survive, and updated ones only get the fields which differ. oldDevice must
+// have been read with its secrets.
+func syncConf(oldDevice *wgtypes.Device, newDevice *wgtypes.Config) error {
+	plan, err := wgtypes.Diff(oldDevice, newDevice)
+	if err != nil {
+		return err
 	}
-
-	newDevice.Peers = append(newDevice.Peers, removePeers...)
+	*newDevice = plan.Config()
+	return nil
 }
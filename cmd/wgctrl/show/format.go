@@ -8,8 +8,10 @@ package show
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -84,6 +86,27 @@ func prettyBytes(bytesSize int64) string {
 	}
 }
 
+func prettyRTT(rtt time.Duration) string {
+	if rtt < time.Second {
+		return fmt.Sprintf("%.2f ms", float64(rtt)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%.2f s", rtt.Seconds())
+}
+
+func prettyHandshakeErrors(errs map[string]int64) string {
+	var reasons []string
+	for reason := range errs {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	var s []string
+	for _, reason := range reasons {
+		s = append(s, fmt.Sprintf("%d %s", errs[reason], reason))
+	}
+	return strings.Join(s, ", ")
+}
+
 func prettyPrint(out io.Writer, device *wgtypes.Device) {
 	fmt.Fprintf(out, "interface: %s\n", device.Name)
 	if !bytes.Equal(device.PublicKey, zeroPublicKey[:]) {
@@ -92,21 +115,86 @@ func prettyPrint(out io.Writer, device *wgtypes.Device) {
 	if !bytes.Equal(device.PrivateKey, zeroPrivateKey[:]) {
 		fmt.Fprintf(out, "  private key: %s\n", base64.StdEncoding.EncodeToString(device.PrivateKey))
 	}
+	if len(device.PreviousPublicKey) != 0 {
+		fmt.Fprintf(out, "  previous public key: %s\n", base64.StdEncoding.EncodeToString(device.PreviousPublicKey))
+		fmt.Fprintf(out, "  rollover expires: ")
+		if left := device.RolloverExpires.Unix() - time.Now().Unix(); left > 0 {
+			fmt.Fprintf(out, "in %s\n", prettyTime(left))
+		} else {
+			fmt.Fprintf(out, "Now\n")
+		}
+	}
 	if device.ListenPort != 0 {
 		fmt.Fprintf(out, "  listening port: %d\n", device.ListenPort)
 	}
 	if device.FirewallMark != 0 {
 		fmt.Fprintf(out, "  fwmark: 0x%x\n", device.FirewallMark)
 	}
+	if device.LivenessDownAfter != 0 {
+		fmt.Fprintf(out, "  liveness: down after %s", prettyTime(int64(device.LivenessDownAfter/time.Second)))
+		if device.LivenessDegradedAfter != 0 {
+			fmt.Fprintf(out, ", degraded after %s", prettyTime(int64(device.LivenessDegradedAfter/time.Second)))
+		}
+		if device.LivenessProbeInterval != 0 {
+			fmt.Fprintf(out, ", probe every %s", prettyTime(int64(device.LivenessProbeInterval/time.Second)))
+		}
+		fmt.Fprintf(out, "\n")
+	}
+	if len(device.HandshakeErrors) != 0 {
+		fmt.Fprintf(out, "  handshake errors: %s\n", prettyHandshakeErrors(device.HandshakeErrors))
+	}
 
 	for _, peer := range device.Peers {
 		fmt.Fprintf(out, "\npeer: %s\n", base64.StdEncoding.EncodeToString(peer.PublicKey))
+		if peer.Name != "" {
+			fmt.Fprintf(out, "  name: %s\n", peer.Name)
+		}
+		if len(peer.Annotations) != 0 {
+			var keys []string
+			for key := range peer.Annotations {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			var pairs []string
+			for _, key := range keys {
+				pairs = append(pairs, key+"="+peer.Annotations[key])
+			}
+			fmt.Fprintf(out, "  annotations: %s\n", strings.Join(pairs, ", "))
+		}
 		if !bytes.Equal(peer.PresharedKey, zeroPrivateKey[:]) {
 			fmt.Fprintf(out, "  preshared key: %s\n", base64.StdEncoding.EncodeToString(peer.PresharedKey))
 		}
+		if !peer.NextPresharedKeyActivation.IsZero() {
+			fmt.Fprintf(out, "  next preshared key: %s\n", base64.StdEncoding.EncodeToString(peer.NextPresharedKey))
+			fmt.Fprintf(out, "  next preshared key activation: ")
+			if left := peer.NextPresharedKeyActivation.Unix() - time.Now().Unix(); left > 0 {
+				fmt.Fprintf(out, "in %s\n", prettyTime(left))
+			} else {
+				fmt.Fprintf(out, "Now\n")
+			}
+		}
+		if !peer.ExpiresAt.IsZero() {
+			fmt.Fprintf(out, "  expires: ")
+			if left := peer.ExpiresAt.Unix() - time.Now().Unix(); left > 0 {
+				fmt.Fprintf(out, "in %s\n", prettyTime(left))
+			} else {
+				fmt.Fprintf(out, "Now\n")
+			}
+		}
+		if peer.NextPresharedKeyHandshakes != 0 {
+			fmt.Fprintf(out, "  preshared key handshakes: %d current, %d next\n", peer.PresharedKeyHandshakes, peer.NextPresharedKeyHandshakes)
+		}
 		if peer.Endpoint != nil {
 			fmt.Fprintf(out, "  endpoint: %s\n", peer.Endpoint.String())
 		}
+		if peer.Liveness != wgtypes.LivenessUnknown {
+			fmt.Fprintf(out, "  liveness: %s", peer.Liveness)
+			if since := time.Now().Unix() - peer.LivenessChanged.Unix(); since > 0 {
+				fmt.Fprintf(out, ", for %s", prettyTime(since))
+			}
+			fmt.Fprintf(out, "\n")
+		}
 
 		fmt.Fprintf(out, "  allowed-ips: ")
 		var s []string
@@ -135,6 +223,25 @@ func prettyPrint(out io.Writer, device *wgtypes.Device) {
 		if peer.ReceiveBytes != 0 || peer.TransmitBytes != 0 {
 			fmt.Fprintf(out, "  transfer: %s received, %s sent\n", prettyBytes(peer.ReceiveBytes), prettyBytes(peer.TransmitBytes))
 		}
+		if peer.ReceivePackets != 0 || peer.TransmitPackets != 0 {
+			fmt.Fprintf(out, "  packets: %d received, %d sent\n", peer.ReceivePackets, peer.TransmitPackets)
+		}
+		if peer.HandshakeAttempts != 0 || peer.HandshakeInitiationsReceived != 0 {
+			fmt.Fprintf(out, "  handshakes: %d initiated, %d received", peer.HandshakeAttempts, peer.HandshakeInitiationsReceived)
+			if peer.HandshakeRTT != 0 {
+				fmt.Fprintf(out, ", round trip %s", prettyRTT(peer.HandshakeRTT))
+			}
+			fmt.Fprintf(out, "\n")
+		}
+		if peer.TransmitDrops != 0 || peer.ReceiveDrops != 0 {
+			fmt.Fprintf(out, "  dropped: %d outbound, %d inbound\n", peer.TransmitDrops, peer.ReceiveDrops)
+		}
+		if peer.DecryptFailures != 0 || peer.ReplayRejects != 0 || peer.AllowedIPsRejects != 0 {
+			fmt.Fprintf(out, "  rejected: %d failed decryption, %d replayed, %d outside allowed-ips\n", peer.DecryptFailures, peer.ReplayRejects, peer.AllowedIPsRejects)
+		}
+		if len(peer.HandshakeErrors) != 0 {
+			fmt.Fprintf(out, "  handshake errors: %s\n", prettyHandshakeErrors(peer.HandshakeErrors))
+		}
 
 		d := peer.PersistentKeepaliveInterval / time.Second
 		if d != 0 {
@@ -225,6 +332,15 @@ func uglyPrint(out io.Writer, device *wgtypes.Device, param string, showDeviceNa
 			fmt.Fprintf(out, "%s\t", device.Name)
 		}
 		fmt.Fprintf(out, "%s\n", base64.StdEncoding.EncodeToString(device.PrivateKey))
+	} else if param == "rollover" {
+		if showDeviceName {
+			fmt.Fprintf(out, "%s\t", device.Name)
+		}
+		if len(device.PreviousPublicKey) != 0 {
+			fmt.Fprintf(out, "%s\t%d\n", base64.StdEncoding.EncodeToString(device.PreviousPublicKey), device.RolloverExpires.Unix())
+		} else {
+			fmt.Fprintf(out, "(none)\n")
+		}
 	} else if param == "listen-port" {
 		if showDeviceName {
 			fmt.Fprintf(out, "%s\t", device.Name)
@@ -289,6 +405,37 @@ func uglyPrint(out io.Writer, device *wgtypes.Device, param string, showDeviceNa
 			}
 			fmt.Fprintf(out, "%s\t%d\t%d\n", base64.StdEncoding.EncodeToString(peer.PublicKey), peer.ReceiveBytes, peer.TransmitBytes)
 		}
+	} else if param == "counters" {
+		for _, peer := range device.Peers {
+			if showDeviceName {
+				fmt.Fprintf(out, "%s\t", device.Name)
+			}
+			fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", base64.StdEncoding.EncodeToString(peer.PublicKey),
+				peer.ReceivePackets, peer.TransmitPackets, peer.ReceiveDrops, peer.TransmitDrops,
+				peer.DecryptFailures, peer.ReplayRejects, peer.AllowedIPsRejects,
+				peer.HandshakeAttempts, peer.HandshakeInitiationsReceived, peer.HandshakeRTT.Microseconds())
+		}
+	} else if param == "handshake-errors" {
+		for _, peer := range device.Peers {
+			var reasons []string
+			for reason := range peer.HandshakeErrors {
+				reasons = append(reasons, reason)
+			}
+			sort.Strings(reasons)
+
+			for _, reason := range reasons {
+				if showDeviceName {
+					fmt.Fprintf(out, "%s\t", device.Name)
+				}
+				fmt.Fprintf(out, "%s\t%s\t%d\n", base64.StdEncoding.EncodeToString(peer.PublicKey), reason, peer.HandshakeErrors[reason])
+			}
+		}
+		for _, source := range device.HandshakeErrorSources {
+			if showDeviceName {
+				fmt.Fprintf(out, "%s\t", device.Name)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%d\t%d\n", source.IP, source.Reason, source.Count, source.LastSeen.Unix())
+		}
 	} else if param == "persistent-keepalive" {
 		for _, peer := range device.Peers {
 			if showDeviceName {
@@ -318,6 +465,52 @@ func uglyPrint(out io.Writer, device *wgtypes.Device, param string, showDeviceNa
 				fmt.Fprintf(out, "%s\n", base64.StdEncoding.EncodeToString(peer.PresharedKey))
 			}
 		}
+	} else if param == "preshared-key-schedule" {
+		for _, peer := range device.Peers {
+			if showDeviceName {
+				fmt.Fprintf(out, "%s\t", device.Name)
+			}
+
+			fmt.Fprintf(out, "%s\t", base64.StdEncoding.EncodeToString(peer.PublicKey))
+
+			if peer.NextPresharedKeyActivation.IsZero() {
+				fmt.Fprintf(out, "(none)\t")
+			} else {
+				fmt.Fprintf(out, "%d\t", peer.NextPresharedKeyActivation.Unix())
+			}
+
+			fmt.Fprintf(out, "%d\t%d\n", peer.PresharedKeyHandshakes, peer.NextPresharedKeyHandshakes)
+		}
+	} else if param == "expires" {
+		for _, peer := range device.Peers {
+			if showDeviceName {
+				fmt.Fprintf(out, "%s\t", device.Name)
+			}
+
+			fmt.Fprintf(out, "%s\t", base64.StdEncoding.EncodeToString(peer.PublicKey))
+
+			if peer.ExpiresAt.IsZero() {
+				fmt.Fprintf(out, "(none)\n")
+			} else if left := peer.ExpiresAt.Unix() - time.Now().Unix(); left > 0 {
+				fmt.Fprintf(out, "%d\n", left)
+			} else {
+				fmt.Fprintf(out, "0\n")
+			}
+		}
+	} else if param == "liveness" {
+		for _, peer := range device.Peers {
+			if showDeviceName {
+				fmt.Fprintf(out, "%s\t", device.Name)
+			}
+
+			fmt.Fprintf(out, "%s\t", base64.StdEncoding.EncodeToString(peer.PublicKey))
+
+			if peer.Liveness == wgtypes.LivenessUnknown {
+				fmt.Fprintf(out, "(none)\n")
+			} else {
+				fmt.Fprintf(out, "%s\t%d\n", peer.Liveness, peer.LivenessChanged.Unix())
+			}
+		}
 	} else if param == "peers" {
 		for _, peer := range device.Peers {
 			if showDeviceName {
@@ -335,43 +528,88 @@ func uglyPrint(out io.Writer, device *wgtypes.Device, param string, showDeviceNa
 	return nil
 }
 
-func printConf(out io.Writer, device *wgtypes.Device) {
-	fmt.Fprintf(out, "[Interface]\n")
-	if device.ListenPort != 0 {
-		fmt.Fprintf(out, "ListenPort = %d\n", device.ListenPort)
-	}
-	if device.FirewallMark != 0 {
-		fmt.Fprintf(out, "FwMark = 0x%x\n", device.FirewallMark)
-	}
-	if !bytes.Equal(device.PrivateKey, zeroPrivateKey[:]) {
-		fmt.Fprintf(out, "PrivateKey = %s\n", base64.StdEncoding.EncodeToString(device.PrivateKey))
+func printConf(out io.Writer, device *wgtypes.Device) error {
+	text, err := device.Config().MarshalText()
+	if err != nil {
+		return err
 	}
 
-	for _, peer := range device.Peers {
-		fmt.Fprintf(out, "\n[Peer]\nPublicKey = %s\n", base64.StdEncoding.EncodeToString(peer.PublicKey))
+	_, err = out.Write(text)
+	return err
+}
 
-		if !bytes.Equal(peer.PresharedKey, zeroPrivateKey[:]) {
-			fmt.Fprintf(out, "PresharedKey = %s\n", base64.StdEncoding.EncodeToString(peer.PresharedKey))
-		}
+// Formats accepted by --format besides the default text output.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
 
-		if peer.AllowedIPs != nil {
-			fmt.Fprintf(out, "AllowedIPs = ")
-			for i, ip := range peer.AllowedIPs {
-				fmt.Fprintf(out, "%s", ip.String())
+// parseFormat removes "--format <format>" from args.
+func parseFormat(args []string) ([]string, string, error) {
+	var rest []string
+	format := ""
 
-				if i != len(peer.AllowedIPs)-1 {
-					fmt.Fprintf(out, ", ")
-				}
-			}
-			fmt.Fprintf(out, "\n")
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--format" {
+			rest = append(rest, args[i])
+			continue
 		}
 
-		if peer.Endpoint != nil {
-			fmt.Fprintf(out, "Endpoint = %s\n", peer.Endpoint.String())
+		if i+1 == len(args) {
+			return nil, "", fmt.Errorf("--format requires an argument")
 		}
+		format = args[i+1]
+		i++
 
-		if peer.PersistentKeepaliveInterval != 0 {
-			fmt.Fprintf(out, "PersistentKeepalive = %d\n", peer.PersistentKeepaliveInterval/time.Second)
+		if format != formatJSON && format != formatYAML {
+			return nil, "", fmt.Errorf("invalid format: %s", format)
 		}
 	}
+
+	return rest, format, nil
+}
+
+// showDocument is the output of wg show --format, see
+// wgtypes.JSONSchemaVersion. Its devices are redacted: the private and
+// preshared keys are null and "redacted" is true, wg showconf --format gives
+// the keys.
+type showDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Interfaces    []*wgtypes.Device `json:"interfaces"`
+}
+
+// redactDevice returns a copy of device without the private key and the
+// preshared keys, which only showconf prints, marked as Redacted.
+func redactDevice(device *wgtypes.Device) *wgtypes.Device {
+	redacted := *device
+	redacted.Redacted = true
+	redacted.PrivateKey = nil
+	redacted.Peers = make([]wgtypes.Peer, len(device.Peers))
+	for i, peer := range device.Peers {
+		peer.PresharedKey = nil
+		peer.NextPresharedKey = nil
+		redacted.Peers[i] = peer
+	}
+	return &redacted
+}
+
+// showConfDocument is the output of wg showconf --format.
+type showConfDocument struct {
+	SchemaVersion int            `json:"schema_version"`
+	Interface     string         `json:"interface"`
+	Config        wgtypes.Config `json:"config"`
+}
+
+func structuredPrint(out io.Writer, format string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == formatYAML {
+		return jsonToYAML(out, data)
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
 }
@@ -7,7 +7,9 @@ package show
 
 import (
 	"bytes"
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -132,6 +134,148 @@ peer: AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u
 	}
 }
 
+func TestPrintExpiry(t *testing.T) {
+	device := *testDevice
+	device.Peers = []wgtypes.Peer{
+		{PublicKey: testDevice.Peers[0].PublicKey, ExpiresAt: time.Now().Add(90*time.Minute + 30*time.Second)},
+		{PublicKey: testDevice.Peers[1].PublicKey, ExpiresAt: time.Now().Add(-time.Minute)},
+	}
+
+	var pretty bytes.Buffer
+	prettyPrint(&pretty, &device)
+	if !strings.Contains(pretty.String(), "  expires: in 1 hour, 30 minutes, ") {
+		t.Errorf("remaining lifetime missing from prettyPrint():\n%s", pretty.String())
+	}
+	if !strings.Contains(pretty.String(), "  expires: Now\n") {
+		t.Errorf("passed expiry missing from prettyPrint():\n%s", pretty.String())
+	}
+
+	var ugly bytes.Buffer
+	if err := uglyPrint(&ugly, &device, "expires", false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(ugly.String(), "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t0\n") {
+		t.Errorf("unexpected uglyPrint() output:\n%s", ugly.String())
+	}
+}
+
+func TestPrintLiveness(t *testing.T) {
+	changed := time.Now().Add(-90 * time.Second)
+
+	device := *testDevice
+	device.LivenessDownAfter = 2 * time.Minute
+	device.LivenessDegradedAfter = 30 * time.Second
+	device.Peers = []wgtypes.Peer{
+		{PublicKey: testDevice.Peers[0].PublicKey, Liveness: wgtypes.LivenessDegraded, LivenessChanged: changed},
+		{PublicKey: testDevice.Peers[1].PublicKey},
+	}
+
+	var pretty bytes.Buffer
+	prettyPrint(&pretty, &device)
+	if !strings.Contains(pretty.String(), "  liveness: down after 2 minutes, degraded after 30 seconds\n") {
+		t.Errorf("liveness thresholds missing from prettyPrint():\n%s", pretty.String())
+	}
+	if !strings.Contains(pretty.String(), "  liveness: degraded, for 1 minute, 30 seconds\n") {
+		t.Errorf("peer liveness missing from prettyPrint():\n%s", pretty.String())
+	}
+
+	var ugly bytes.Buffer
+	if err := uglyPrint(&ugly, &device, "liveness", false); err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\tdegraded\t%d\nAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t(none)\n", changed.Unix())
+	if diff := cmp.Diff(expected, ugly.String()); diff != "" {
+		t.Errorf("uglyPrint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrintCounters(t *testing.T) {
+	device := *testDevice
+	device.Peers = []wgtypes.Peer{
+		{
+			PublicKey:                    testDevice.Peers[0].PublicKey,
+			ReceivePackets:               120,
+			TransmitPackets:              150,
+			ReceiveDrops:                 1,
+			TransmitDrops:                2,
+			DecryptFailures:              3,
+			ReplayRejects:                4,
+			AllowedIPsRejects:            5,
+			HandshakeAttempts:            6,
+			HandshakeInitiationsReceived: 7,
+			HandshakeRTT:                 12345 * time.Microsecond,
+		},
+		{PublicKey: testDevice.Peers[1].PublicKey},
+	}
+
+	var pretty bytes.Buffer
+	prettyPrint(&pretty, &device)
+	for _, line := range []string{
+		"  packets: 120 received, 150 sent\n",
+		"  handshakes: 6 initiated, 7 received, round trip 12.35 ms\n",
+		"  dropped: 2 outbound, 1 inbound\n",
+		"  rejected: 3 failed decryption, 4 replayed, 5 outside allowed-ips\n",
+	} {
+		if !strings.Contains(pretty.String(), line) {
+			t.Errorf("%q missing from prettyPrint():\n%s", line, pretty.String())
+		}
+	}
+	if strings.Count(pretty.String(), "  packets: ") != 1 {
+		t.Errorf("counters of an idle peer in prettyPrint():\n%s", pretty.String())
+	}
+
+	var ugly bytes.Buffer
+	if err := uglyPrint(&ugly, &device, "counters", true); err != nil {
+		t.Fatal(err)
+	}
+	expected := "wg0\tAwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\t120\t150\t1\t2\t3\t4\t5\t6\t7\t12345\n" +
+		"wg0\tAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\n"
+	if diff := cmp.Diff(expected, ugly.String()); diff != "" {
+		t.Errorf("uglyPrint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrintHandshakeErrors(t *testing.T) {
+	seen := time.Unix(1600000000, 0)
+
+	device := *testDevice
+	device.HandshakeErrors = map[string]int64{"unknown_peer": 1, "mac1_mismatch": 3}
+	device.HandshakeErrorSources = []wgtypes.HandshakeErrorSource{
+		{IP: net.ParseIP("192.0.2.1"), Reason: "mac1_mismatch", Count: 3, LastSeen: seen},
+		{IP: net.ParseIP("fd00::1"), Reason: "unknown_peer", Count: 1, LastSeen: seen},
+	}
+	device.Peers = []wgtypes.Peer{
+		{
+			PublicKey:       testDevice.Peers[0].PublicKey,
+			HandshakeErrors: map[string]int64{"replayed_timestamp": 2, "flood": 1},
+		},
+		{PublicKey: testDevice.Peers[1].PublicKey},
+	}
+
+	var pretty bytes.Buffer
+	prettyPrint(&pretty, &device)
+	for _, line := range []string{
+		"  handshake errors: 3 mac1_mismatch, 1 unknown_peer\n",
+		"  handshake errors: 1 flood, 2 replayed_timestamp\n",
+	} {
+		if !strings.Contains(pretty.String(), line) {
+			t.Errorf("%q missing from prettyPrint():\n%s", line, pretty.String())
+		}
+	}
+
+	var ugly bytes.Buffer
+	if err := uglyPrint(&ugly, &device, "handshake-errors", false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\tflood\t1\n" +
+		"AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\treplayed_timestamp\t2\n" +
+		"192.0.2.1\tmac1_mismatch\t3\t1600000000\n" +
+		"fd00::1\tunknown_peer\t1\t1600000000\n"
+	if diff := cmp.Diff(expected, ugly.String()); diff != "" {
+		t.Errorf("uglyPrint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestDumpPrint(t *testing.T) {
 	expectedOutput1 := `27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk=	A+FgEuzhza+9B9vU9Qel+Xn1gLJiah5bWLFMl22brPE2	1337	0x10
 AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1	3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI=	192.168.0.1:1337	10.10.10.1/32,192.168.1.0/24	10	5000000	10000000	0
@@ -197,6 +341,8 @@ func TestUglyPrint(t *testing.T) {
 		{"preshared-keys", false, "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\t3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI=\nAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t(none)\n"},
 		{"preshared-keys", true, "wg0\tAwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\t3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI=\nwg0\tAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t(none)\n"},
 
+		{"expires", false, "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\t(none)\nAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\t(none)\n"},
+
 		{"peers", false, "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\nAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\n"},
 		{"peers", true, "wg0\tAwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1\nwg0\tAtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u\n"},
 	}
@@ -241,3 +387,138 @@ Endpoint = [fe80::1ff:fe23:4567:890a%eth0]:1337
 		t.Fail()
 	}
 }
+
+func TestPrintConfRoundTrip(t *testing.T) {
+	device := *testDevice
+	device.Peers = append([]wgtypes.Peer(nil), testDevice.Peers...)
+	device.Peers[0].PersistentKeepaliveInterval = 25 * time.Second
+	device.Peers[1].NextPresharedKey = device.Peers[0].PresharedKey
+	device.Peers[1].NextPresharedKeyActivation = time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)
+
+	first := bytes.NewBufferString("")
+	if err := printConf(first, &device); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := wgtypes.ParseConfig("showconf", bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := cfg.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(first.String(), string(second)); diff != "" {
+		t.Errorf("showconf output does not round-trip (-want +got):\n%s", diff)
+	}
+}
+
+func TestStructuredPrintYAML(t *testing.T) {
+	device := &wgtypes.Device{
+		Name:       "wg0",
+		Type:       wgtypes.Userspace,
+		PrivateKey: testDevice.PrivateKey,
+		Peers: []wgtypes.Peer{{
+			PublicKey:    testDevice.Peers[1].PublicKey,
+			PresharedKey: testDevice.Peers[0].PresharedKey,
+			Annotations:  map[string]string{"+role": "edge", "true": "1", "site_2": "msk"},
+			Endpoint:     testDevice.Peers[1].Endpoint,
+		}},
+	}
+
+	expectedOutput := `---
+schema_version: 1
+interfaces:
+  - name: "wg0"
+    type: "userspace"
+    private_key: null
+    public_key: null
+    redacted: true
+    previous_public_key: null
+    rollover_expires: null
+    listen_port: 0
+    firewall_mark: 0
+    liveness_down_after_seconds: 0
+    liveness_degraded_after_seconds: 0
+    liveness_probe_interval_seconds: 0
+    encryption_queue:
+      length: 0
+      drops: 0
+    decryption_queue:
+      length: 0
+      drops: 0
+    handshake_queue:
+      length: 0
+      drops: 0
+    cookie_replies_sent: 0
+    ratelimiter_rejects: 0
+    decrypt_failures: 0
+    under_load: false
+    handshake_errors: {}
+    handshake_error_sources: []
+    peers:
+      - public_key: "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u"
+        name: ""
+        annotations:
+          "+role": "edge"
+          site_2: "msk"
+          "true": "1"
+        preshared_key: null
+        next_preshared_key: null
+        next_preshared_key_activation: null
+        preshared_key_handshakes: 0
+        next_preshared_key_handshakes: 0
+        expires_at: null
+        endpoint: "[fe80::1ff:fe23:4567:890a%eth0]:1337"
+        persistent_keepalive_seconds: 0
+        last_handshake_time: null
+        liveness: null
+        liveness_changed: null
+        receive_bytes: 0
+        transmit_bytes: 0
+        receive_packets: 0
+        transmit_packets: 0
+        handshake_attempts: 0
+        keypair_created: null
+        transmit_drops: 0
+        receive_drops: 0
+        decrypt_failures: 0
+        replay_rejects: 0
+        allowed_ips_rejects: 0
+        handshake_initiations_received: 0
+        handshake_rtt_ms: null
+        handshake_errors: {}
+        allowed_ips: []
+        protocol_version: 0
+`
+
+	result := bytes.NewBufferString("")
+	if err := structuredPrint(result, formatYAML, showDocument{wgtypes.JSONSchemaVersion, []*wgtypes.Device{redactDevice(device)}}); err != nil {
+		t.Fatalf("structuredPrint() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(expectedOutput, result.String()); diff != "" {
+		t.Errorf("structuredPrint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	args, format, err := parseFormat([]string{"show", "--format", "json", "all"})
+	if err != nil {
+		t.Fatalf("parseFormat() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{"show", "all"}, args); diff != "" {
+		t.Errorf("parseFormat() mismatch (-want +got):\n%s", diff)
+	}
+	if format != formatJSON {
+		t.Errorf("parseFormat() format = %q, want %q", format, formatJSON)
+	}
+
+	for _, args := range [][]string{{"show", "--format"}, {"show", "--format", "xml"}} {
+		if _, _, err := parseFormat(args); err == nil {
+			t.Errorf("parseFormat(%q) succeeded", args)
+		}
+	}
+}
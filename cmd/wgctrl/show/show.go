@@ -11,25 +11,34 @@ import (
 	"os"
 	"strings"
 
-	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
 func showUsage(file io.Writer) {
-	fmt.Fprintf(file, "Usage: %s show { <interface> | all | interfaces } [public-key | private-key | listen-port | fwmark | peers | preshared-keys | endpoints | allowed-ips | latest-handshakes | transfer | persistent-keepalive | dump]\n", os.Args[0])
+	fmt.Fprintf(file, "Usage: %s show [--format json|yaml] { <interface> | all }\n", os.Args[0])
+	fmt.Fprintf(file, "       %s show { <interface> | all | interfaces } [public-key | private-key | rollover | listen-port | fwmark | peers | preshared-keys | preshared-key-schedule | endpoints | allowed-ips | latest-handshakes | transfer | counters | handshake-errors | persistent-keepalive | expires | liveness | dump]\n", os.Args[0])
 }
 
 func Show(args []string) int {
 	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
-		showConfUsage(os.Stdout)
+		showUsage(os.Stdout)
 		return 0
 	}
 
-	if len(args) > 3 {
+	args, format, err := parseFormat(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		showUsage(os.Stderr)
+		return 1
+	}
+
+	if len(args) > 3 || format != "" && (len(args) > 2 || len(args) == 2 && args[1] == "interfaces") {
 		showUsage(os.Stderr)
 		return 1
 	}
 
-	c, err := wgctrl.New()
+	c, err := remote.NewClient()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
 		return 1
@@ -43,6 +52,17 @@ func Show(args []string) int {
 			return 1
 		}
 
+		if format != "" {
+			for i, device := range devices {
+				devices[i] = redactDevice(device)
+			}
+			if err := structuredPrint(os.Stdout, format, showDocument{wgtypes.JSONSchemaVersion, devices}); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return 1
+			}
+			return 0
+		}
+
 		for i, device := range devices {
 			if len(args) == 3 {
 				err := uglyPrint(os.Stdout, device, args[2], true)
@@ -78,7 +98,13 @@ func Show(args []string) int {
 			return 1
 		}
 
-		if len(args) == 3 {
+		if format != "" {
+			err := structuredPrint(os.Stdout, format, showDocument{wgtypes.JSONSchemaVersion, []*wgtypes.Device{redactDevice(device)}})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return 1
+			}
+		} else if len(args) == 3 {
 			err := uglyPrint(os.Stdout, device, args[2], false)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
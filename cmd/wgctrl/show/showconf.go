@@ -10,11 +10,12 @@ import (
 	"io"
 	"os"
 
-	"github.com/bi-zone/ruwireguard-go/wgctrl"
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
 func showConfUsage(file io.Writer) {
-	fmt.Fprintf(file, "Usage: %s showconf <interface>\n", os.Args[0])
+	fmt.Fprintf(file, "Usage: %s showconf [--format json|yaml] <interface>\n", os.Args[0])
 }
 
 func ShowConf(args []string) int {
@@ -23,25 +24,40 @@ func ShowConf(args []string) int {
 		return 0
 	}
 
+	args, format, err := parseFormat(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		showConfUsage(os.Stderr)
+		return 1
+	}
+
 	if len(args) != 2 {
 		showConfUsage(os.Stderr)
 		return 1
 	}
 
-	c, err := wgctrl.New()
+	c, err := remote.NewClient()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
 		return 1
 	}
 	defer c.Close()
 
-	device, err := c.Device(args[1])
+	device, err := c.DeviceWithSecrets(args[1])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "unable to retrieve current interface configuration: %s\n", err)
 		return 1
 	}
 
-	printConf(os.Stdout, device)
+	if format != "" {
+		err = structuredPrint(os.Stdout, format, showConfDocument{wgtypes.JSONSchemaVersion, device.Name, device.Config()})
+	} else {
+		err = printConf(os.Stdout, device)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to print interface configuration: %s\n", err)
+		return 1
+	}
 
 	return 0
 }
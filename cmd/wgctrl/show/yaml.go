@@ -0,0 +1,160 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package show
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/* There is no YAML library among our dependencies, so documents are
+ * marshalled to JSON and re-emitted in block style. Field order is kept,
+ * strings are always double-quoted (JSON escapes are valid in YAML), so are
+ * mapping keys other than plain identifiers such as annotation names, and
+ * everything else is written as-is.
+ */
+
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// yamlObject keeps the order of the fields of a JSON object.
+type yamlObject []yamlField
+
+func jsonToYAML(out io.Writer, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	writeYAML(&buf, v, 0)
+
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := yamlObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, yamlField{key.(string), value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	default:
+		return tok, nil
+	}
+}
+
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+
+	switch v := v.(type) {
+	case yamlObject:
+		for _, field := range v {
+			buf.WriteString(pad + yamlKey(field.key) + ":")
+			writeYAMLValue(buf, field.value, indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if obj, ok := item.(yamlObject); ok && len(obj) != 0 {
+				// the first field goes on the line of the dash
+				var nested bytes.Buffer
+				writeYAML(&nested, obj, indent+2)
+				buf.WriteString(pad + "- ")
+				buf.Write(nested.Bytes()[indent+2:])
+				continue
+			}
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, item, indent)
+		}
+	}
+}
+
+/* yamlKey leaves plain identifiers, such as the names of the schema fields,
+ * unquoted, and quotes every other key along with those YAML would read as
+ * a null, a boolean or a number.
+ */
+func yamlKey(key string) string {
+	plain := key != ""
+	for i, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			plain = false
+			break
+		}
+	}
+	switch strings.ToLower(key) {
+	case "null", "true", "false", "yes", "no", "on", "off", "y", "n":
+		plain = false
+	}
+	if plain {
+		return key
+	}
+
+	quoted, _ := json.Marshal(key)
+	return string(quoted)
+}
+
+// writeYAMLValue writes what follows "key:" or "-".
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch v := v.(type) {
+	case yamlObject:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, v, indent+2)
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, v, indent+2)
+	case string:
+		quoted, _ := json.Marshal(v)
+		fmt.Fprintf(buf, " %s\n", quoted)
+	case nil:
+		buf.WriteString(" null\n")
+	default:
+		fmt.Fprintf(buf, " %v\n", v)
+	}
+}
@@ -0,0 +1,52 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package top
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// readKeys switches the terminal on stdin to unbuffered input without echo
+// and delivers single key presses. Signals still work. The returned
+// function restores the terminal and may be called more than once. When
+// stdin is not a terminal no keys are ever delivered.
+func readKeys() (<-chan byte, func()) {
+	fd := int(os.Stdin.Fd())
+
+	saved, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, func() {}
+	}
+
+	raw := *saved
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, func() {}
+	}
+
+	keys := make(chan byte)
+	go func() {
+		var buf [1]byte
+		for {
+			if n, err := os.Stdin.Read(buf[:]); err != nil || n == 0 {
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	var once sync.Once
+	return keys, func() {
+		once.Do(func() {
+			unix.IoctlSetTermios(fd, unix.TCSETS, saved)
+		})
+	}
+}
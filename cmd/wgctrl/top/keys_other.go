@@ -0,0 +1,14 @@
+// +build !linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package top
+
+// readKeys is only implemented on Linux; elsewhere the table refreshes but
+// the sort order can only be set with --sort.
+func readKeys() (<-chan byte, func()) {
+	return nil, func() {}
+}
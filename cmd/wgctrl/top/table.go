@@ -0,0 +1,237 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package top
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// rejectAfterTime mirrors device.RejectAfterTime: once the latest handshake
+// is older than this, no session with the peer is usable any more.
+const rejectAfterTime = 180 * time.Second
+
+// Sort orders of the table.
+const (
+	sortRx        = "rx"
+	sortTx        = "tx"
+	sortHandshake = "handshake"
+	sortName      = "name"
+	sortEndpoint  = "endpoint"
+)
+
+var sortOrders = []string{sortRx, sortTx, sortHandshake, sortName, sortEndpoint}
+
+// counters is a sample of the transfer counters of a peer.
+type counters struct {
+	rx, tx int64
+}
+
+// sample is a poll of all devices, keyed by interface name and public key.
+type sample struct {
+	at       time.Time
+	counters map[string]counters
+}
+
+func sampleKey(iface string, peer wgtypes.Key) string {
+	return iface + "/" + string(peer)
+}
+
+func takeSample(devices []*wgtypes.Device, at time.Time) *sample {
+	s := &sample{at: at, counters: make(map[string]counters)}
+	for _, device := range devices {
+		for _, peer := range device.Peers {
+			s.counters[sampleKey(device.Name, peer.PublicKey)] = counters{peer.ReceiveBytes, peer.TransmitBytes}
+		}
+	}
+	return s
+}
+
+// row is a line of the table.
+type row struct {
+	iface    string
+	peer     wgtypes.Peer
+	rxRate   float64
+	txRate   float64
+	age      time.Duration
+	stale    bool
+	endpoint string
+}
+
+// buildRows computes the rates of every peer since prev, which may be nil
+// for the first poll.
+func buildRows(devices []*wgtypes.Device, prev *sample, now time.Time) []row {
+	var rows []row
+
+	for _, device := range devices {
+		for _, peer := range device.Peers {
+			r := row{iface: device.Name, peer: peer, endpoint: "(none)"}
+			if peer.Endpoint != nil {
+				r.endpoint = peer.Endpoint.String()
+			}
+
+			if !peer.LastHandshakeTime.IsZero() {
+				r.age = now.Sub(peer.LastHandshakeTime)
+				r.stale = r.age > rejectAfterTime
+			}
+
+			if prev != nil {
+				elapsed := now.Sub(prev.at).Seconds()
+				last, ok := prev.counters[sampleKey(device.Name, peer.PublicKey)]
+
+				// counters go back to zero when a peer is re-added
+				if ok && elapsed > 0 && peer.ReceiveBytes >= last.rx && peer.TransmitBytes >= last.tx {
+					r.rxRate = float64(peer.ReceiveBytes-last.rx) / elapsed
+					r.txRate = float64(peer.TransmitBytes-last.tx) / elapsed
+				}
+			}
+
+			rows = append(rows, r)
+		}
+	}
+
+	return rows
+}
+
+// filterRows keeps the rows matching filter: a network selects the peers
+// whose allowed IPs overlap it, anything else is a substring of the
+// interface name, the peer name, the public key or the endpoint.
+func filterRows(rows []row, filter string) []row {
+	if filter == "" {
+		return rows
+	}
+
+	var network *net.IPNet
+	if _, n, err := net.ParseCIDR(filter); err == nil {
+		network = n
+	} else if ip := net.ParseIP(filter); ip != nil {
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	var kept []row
+	for _, r := range rows {
+		if network != nil {
+			for _, allowed := range r.peer.AllowedIPs {
+				if allowed.Contains(network.IP) || network.Contains(allowed.IP) {
+					kept = append(kept, r)
+					break
+				}
+			}
+			continue
+		}
+
+		if strings.Contains(r.iface, filter) || strings.Contains(r.peer.Name, filter) ||
+			strings.Contains(r.peer.PublicKey.String(), filter) || strings.Contains(r.endpoint, filter) {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
+
+// sortRows sorts rates and handshake ages busiest and freshest first, and
+// names and endpoints alphabetically. Peers which never completed a
+// handshake come last.
+func sortRows(rows []row, order string) {
+	less := func(a, b row) bool {
+		switch order {
+		case sortRx:
+			return a.rxRate > b.rxRate
+		case sortTx:
+			return a.txRate > b.txRate
+		case sortHandshake:
+			if a.peer.LastHandshakeTime.IsZero() || b.peer.LastHandshakeTime.IsZero() {
+				return !a.peer.LastHandshakeTime.IsZero() && b.peer.LastHandshakeTime.IsZero()
+			}
+			return a.age < b.age
+		case sortName:
+			return a.peer.Name < b.peer.Name
+		case sortEndpoint:
+			return a.endpoint < b.endpoint
+		default:
+			return false
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if less(rows[i], rows[j]) {
+			return true
+		}
+		if less(rows[j], rows[i]) {
+			return false
+		}
+		if rows[i].iface != rows[j].iface {
+			return rows[i].iface < rows[j].iface
+		}
+		return rows[i].peer.PublicKey.String() < rows[j].peer.PublicKey.String()
+	})
+}
+
+// printTable writes the rows as aligned columns. With highlight, stale
+// handshakes are shown in red.
+func printTable(out io.Writer, rows []row, highlight bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "INTERFACE\tPEER\tENDPOINT\tRX/s\tTX/s\tRX\tTX\tHANDSHAKE\n")
+	for _, r := range rows {
+		handshake := "never"
+		if !r.peer.LastHandshakeTime.IsZero() {
+			handshake = formatAge(r.age)
+		}
+		if r.stale {
+			handshake += " (stale)"
+			if highlight {
+				handshake = "\x1b[31m" + handshake + "\x1b[0m"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.iface, r.peer.PublicKey.String(), r.endpoint,
+			formatBytes(r.rxRate)+"/s", formatBytes(r.txRate)+"/s",
+			formatBytes(float64(r.peer.ReceiveBytes)), formatBytes(float64(r.peer.TransmitBytes)),
+			handshake)
+	}
+
+	w.Flush()
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	for _, unit := range units {
+		if n < 1024 {
+			if unit == "B" {
+				return fmt.Sprintf("%.0f %s", n, unit)
+			}
+			return fmt.Sprintf("%.2f %s", n, unit)
+		}
+		n /= 1024
+	}
+	return fmt.Sprintf("%.2f TiB", n)
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "in the future"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%ds ago", int(d/time.Minute), int(d%time.Minute/time.Second))
+	default:
+		return fmt.Sprintf("%dh%dm ago", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+}
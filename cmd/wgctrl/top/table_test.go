@@ -0,0 +1,157 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package top
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func mustKey(s string) wgtypes.Key {
+	k, err := wgtypes.ParseKey(s)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func mustCIDR(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return *n
+}
+
+var (
+	now   = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	peer1 = mustKey("AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1")
+	peer2 = mustKey("AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u")
+)
+
+func testDevices(rx1, rx2 int64) []*wgtypes.Device {
+	return []*wgtypes.Device{{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:         peer1,
+				Name:              "alice",
+				Endpoint:          &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820},
+				LastHandshakeTime: now.Add(-10 * time.Second),
+				ReceiveBytes:      rx1,
+				TransmitBytes:     rx1 / 2,
+				AllowedIPs:        []net.IPNet{mustCIDR("10.0.0.1/32")},
+			},
+			{
+				PublicKey:         peer2,
+				Name:              "bob",
+				LastHandshakeTime: now.Add(-5 * time.Minute),
+				ReceiveBytes:      rx2,
+				TransmitBytes:     rx2 * 2,
+				AllowedIPs:        []net.IPNet{mustCIDR("10.0.1.0/24")},
+			},
+		},
+	}}
+}
+
+func TestBuildRows(t *testing.T) {
+	prev := takeSample(testDevices(1000, 5000), now.Add(-2*time.Second))
+	rows := buildRows(testDevices(3048, 1000), prev, now)
+
+	type rates struct {
+		RX, TX float64
+		Stale  bool
+	}
+
+	var got []rates
+	for _, r := range rows {
+		got = append(got, rates{r.rxRate, r.txRate, r.stale})
+	}
+
+	// the counters of the second peer went back, as after a re-add
+	expected := []rates{{1024, 512, false}, {0, 0, true}}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("buildRows() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFilterAndSortRows(t *testing.T) {
+	prev := takeSample(testDevices(0, 0), now.Add(-time.Second))
+	rows := buildRows(testDevices(100, 2000), prev, now)
+
+	tests := []struct {
+		filter string
+		sort   string
+		peers  []wgtypes.Key
+	}{
+		{sort: sortRx, peers: []wgtypes.Key{peer2, peer1}},
+		{sort: sortHandshake, peers: []wgtypes.Key{peer1, peer2}},
+		{sort: sortName, peers: []wgtypes.Key{peer1, peer2}},
+		{sort: sortEndpoint, peers: []wgtypes.Key{peer2, peer1}},
+		{filter: "192.0.2", sort: sortRx, peers: []wgtypes.Key{peer1}},
+		{filter: "AtAZ", sort: sortRx, peers: []wgtypes.Key{peer2}},
+		{filter: "10.0.1.7", sort: sortRx, peers: []wgtypes.Key{peer2}},
+		{filter: "10.0.0.0/16", sort: sortName, peers: []wgtypes.Key{peer1, peer2}},
+		{filter: "bob", sort: sortName, peers: []wgtypes.Key{peer2}},
+		{filter: "wg1", sort: sortRx},
+	}
+
+	for _, tt := range tests {
+		got := filterRows(append([]row{}, rows...), tt.filter)
+		sortRows(got, tt.sort)
+
+		var peers []wgtypes.Key
+		for _, r := range got {
+			peers = append(peers, r.peer.PublicKey)
+		}
+
+		if diff := cmp.Diff(tt.peers, peers); diff != "" {
+			t.Errorf("filter %q, sort %q: mismatch (-want +got):\n%s", tt.filter, tt.sort, diff)
+		}
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	prev := takeSample(testDevices(0, 0), now.Add(-time.Second))
+	rows := buildRows(testDevices(2048, 0), prev, now)
+
+	expected := `INTERFACE  PEER                                          ENDPOINT         RX/s        TX/s        RX        TX        HANDSHAKE
+wg0        AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1  192.0.2.1:51820  2.00 KiB/s  1.00 KiB/s  2.00 KiB  1.00 KiB  10s ago
+wg0        AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u  (none)           0 B/s       0 B/s       0 B       0 B       5m0s ago (stale)
+`
+
+	var buf bytes.Buffer
+	printTable(&buf, rows, false)
+
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("printTable() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"wg0", "--once", "--sort=tx", "--interval", "0.5", "--filter", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parseArgs() failed: %v", err)
+	}
+
+	expected := &options{iface: "wg0", interval: 500 * time.Millisecond, sort: sortTx, filter: "10.0.0.0/8", once: true}
+	if diff := cmp.Diff(expected, opts, cmp.AllowUnexported(options{})); diff != "" {
+		t.Errorf("parseArgs() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, args := range [][]string{{"--sort=bytes"}, {"--interval", "0"}, {"wg0", "wg1"}, {"--filter"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%q) succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package top
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/cmd/wgctrl/remote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func showTopUsage(file io.Writer) {
+	fmt.Fprintf(file, "Usage: %s top [<interface>] [--interval <seconds>] [--sort rx|tx|handshake|name|endpoint] [--filter <text>|<ip>[/<cidr>]] [--once]\n", os.Args[0])
+	fmt.Fprintf(file, "Keys: r, t, h, n, e change the sort order, q quits.\n")
+}
+
+type options struct {
+	iface    string
+	interval time.Duration
+	sort     string
+	filter   string
+	once     bool
+}
+
+// parseArgs accepts both "--flag value" and "--flag=value".
+func parseArgs(args []string) (*options, error) {
+	opts := &options{interval: time.Second, sort: sortRx}
+
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+
+		if arg == "--once" {
+			opts.once = true
+			continue
+		}
+
+		if !strings.HasPrefix(arg, "--") {
+			if opts.iface != "" {
+				return nil, fmt.Errorf("invalid argument: %s", arg)
+			}
+			opts.iface = arg
+			continue
+		}
+
+		name, value := arg, ""
+		if i := strings.IndexByte(arg, '='); i >= 0 {
+			name, value = arg[:i], arg[i+1:]
+		} else if len(args) > 0 {
+			value = args[0]
+			args = args[1:]
+		} else {
+			return nil, fmt.Errorf("%s requires an argument", arg)
+		}
+
+		switch name {
+		case "--interval":
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil || secs <= 0 {
+				return nil, fmt.Errorf("invalid interval: %s", value)
+			}
+			opts.interval = time.Duration(secs * float64(time.Second))
+		case "--sort":
+			if !validSort(value) {
+				return nil, fmt.Errorf("invalid sort order: %s", value)
+			}
+			opts.sort = value
+		case "--filter":
+			opts.filter = value
+		default:
+			return nil, fmt.Errorf("invalid argument: %s", arg)
+		}
+	}
+
+	return opts, nil
+}
+
+func validSort(order string) bool {
+	for _, o := range sortOrders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
+// Top shows the peers of one or all interfaces with their throughput,
+// refreshing the table every interval until interrupted. With --once it
+// takes two polls an interval apart and prints the table once.
+func Top(args []string) int {
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help" || args[1] == "help") {
+		showTopUsage(os.Stdout)
+		return 0
+	}
+
+	opts, err := parseArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		showTopUsage(os.Stderr)
+		return 1
+	}
+
+	c, err := remote.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open wgctrl: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	poll := func() ([]*wgtypes.Device, error) {
+		if opts.iface == "" {
+			return c.Devices()
+		}
+		device, err := c.Device(opts.iface)
+		if err != nil {
+			return nil, err
+		}
+		return []*wgtypes.Device{device}, nil
+	}
+
+	devices, err := poll()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to retrieve interfaces configurations: %s\n", err)
+		return 1
+	}
+	prev := takeSample(devices, time.Now())
+
+	if opts.once {
+		time.Sleep(opts.interval)
+
+		devices, err := poll()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to retrieve interfaces configurations: %s\n", err)
+			return 1
+		}
+
+		rows := filterRows(buildRows(devices, prev, time.Now()), opts.filter)
+		sortRows(rows, opts.sort)
+		printTable(os.Stdout, rows, false)
+
+		return 0
+	}
+
+	keys, restore := readKeys()
+	defer restore()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	var rows []row
+	redraw := func() {
+		sorted := append([]row{}, rows...)
+		sortRows(sorted, opts.sort)
+
+		var buf bytes.Buffer
+		buf.WriteString("\x1b[H\x1b[2J")
+		fmt.Fprintf(&buf, "%s  every %s  sort: %s", time.Now().Format("15:04:05"), opts.interval, opts.sort)
+		if opts.filter != "" {
+			fmt.Fprintf(&buf, "  filter: %s", opts.filter)
+		}
+		buf.WriteString("\n\n")
+		printTable(&buf, sorted, true)
+
+		// the terminal is in raw mode, so lines need an explicit return
+		os.Stdout.Write(bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte("\r\n")))
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			devices, err := poll()
+			if err != nil {
+				restore()
+				fmt.Fprintf(os.Stderr, "unable to retrieve interfaces configurations: %s\n", err)
+				return 1
+			}
+
+			now := time.Now()
+			rows = filterRows(buildRows(devices, prev, now), opts.filter)
+			prev = takeSample(devices, now)
+			redraw()
+		case key := <-keys:
+			switch key {
+			case 'q':
+				return 0
+			case 'r':
+				opts.sort = sortRx
+			case 't':
+				opts.sort = sortTx
+			case 'h':
+				opts.sort = sortHandshake
+			case 'n':
+				opts.sort = sortName
+			case 'e':
+				opts.sort = sortEndpoint
+			default:
+				continue
+			}
+			redraw()
+		case <-signals:
+			return 0
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// loadConfig reads a configuration file in the format of wg setconf, which
+// may also hold PeerUp and PeerDown hooks in its [Interface] section.
+func loadConfig(path string) (*wgtypes.Config, *peerHooks, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return parseConfig(path, file)
+}
+
+// parseConfig splits the hooks off r and parses the rest with
+// wgtypes.ParseConfig. Errors keep the line numbers of the original file.
+func parseConfig(name string, r io.Reader) (*wgtypes.Config, *peerHooks, error) {
+	hooks := new(peerHooks)
+
+	// masked replaces the hooks with empty lines, so that errors reported
+	// by wgtypes.ParseConfig point at the right line
+	var masked bytes.Buffer
+	var section string
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		raw := scanner.Text()
+
+		line := raw
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+		}
+
+		if section == "interface" {
+			if i := strings.IndexByte(line, '='); i >= 0 {
+				// hooks are shell commands, which may hold a '#' of their
+				// own, so their value is taken from the raw line
+				value := strings.TrimSpace(raw[strings.IndexByte(raw, '=')+1:])
+
+				switch strings.ToLower(strings.TrimSpace(line[:i])) {
+				case "peerup":
+					hooks.up = append(hooks.up, value)
+					masked.WriteString("\n")
+					continue
+				case "peerdown":
+					hooks.down = append(hooks.down, value)
+					masked.WriteString("\n")
+					continue
+				}
+			}
+		}
+
+		masked.WriteString(raw + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := wgtypes.ParseConfig(name, &masked)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, hooks, nil
+}
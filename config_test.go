@@ -0,0 +1,325 @@
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/tun/tuntest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const (
+	testPrivateKey = "27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk="
+	testPeer1      = "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1"
+	testPeer2      = "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u"
+)
+
+func mustParseConfig(t *testing.T, text string) *wgtypes.Config {
+	cfg, err := wgtypes.ParseConfig("test.conf", strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func mustParseKey(t *testing.T, s string) wgtypes.Key {
+	key, err := wgtypes.ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func peerKeys(t *testing.T, dev *device.Device) []string {
+	var s []string
+	for _, peer := range dev.Snapshot().Peers {
+		s = append(s, peer.PublicKey.String())
+	}
+	sort.Strings(s)
+	return s
+}
+
+func reloadPlan(t *testing.T, dev *device.Device, next *wgtypes.Config) *wgtypes.Plan {
+	current := dev.Snapshot()
+	plan, err := wgtypes.Diff(&current, next)
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	return plan
+}
+
+func TestConfigReload(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelError, "test: "))
+	defer dev.Close()
+
+	old := mustParseConfig(t, `
+[Interface]
+PrivateKey = `+testPrivateKey+`
+
+[Peer]
+# Name = alice
+PublicKey = `+testPeer1+`
+AllowedIPs = 10.0.0.1/32
+ExpiresAt = 2999-01-01T00:00:00Z
+
+[Peer]
+PublicKey = `+testPeer2+`
+AllowedIPs = 10.0.0.2/32
+PersistentKeepalive = 25
+`)
+
+	apply := *old
+	apply.ReplacePeers = true
+	if err := dev.Apply(apply); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := peerKeys(t, dev); len(got) != 2 {
+		t.Fatalf("expected two peers, got %v", got)
+	}
+
+	// an unchanged file yields an empty plan
+
+	if plan := reloadPlan(t, dev, old); !plan.Empty() {
+		t.Fatalf("expected an empty plan, got %+v", plan)
+	}
+
+	// an expiry set at runtime, by wg set or the authorizer, is kept as the
+	// file does not mention one
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	err := dev.Apply(wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+		PublicKey:  mustParseKey(t, testPeer2),
+		UpdateOnly: true,
+		ExpiresAt:  &expiresAt,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan := reloadPlan(t, dev, old); !plan.Empty() {
+		t.Fatalf("runtime expiry is undone by the reload: %+v", plan)
+	}
+
+	// changes made to the device since are undone, although the file did
+	// not change
+
+	keepalive := 10 * time.Second
+	err = dev.Apply(wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+		PublicKey:                   mustParseKey(t, testPeer2),
+		UpdateOnly:                  true,
+		PersistentKeepaliveInterval: &keepalive,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := reloadPlan(t, dev, old)
+	if len(plan.Peers) != 1 || plan.Peers[0].PublicKey.String() != testPeer2 {
+		t.Fatalf("unexpected plan: %+v", plan.Peers)
+	}
+	if err := dev.Apply(plan.Config()); err != nil {
+		t.Fatal(err)
+	}
+	if plan := reloadPlan(t, dev, old); !plan.Empty() {
+		t.Fatalf("device differs from the file after reload: %+v", plan)
+	}
+
+	// the second peer is dropped and the first one changes
+
+	next := mustParseConfig(t, `
+[Interface]
+PrivateKey = `+testPrivateKey+`
+
+[Peer]
+PublicKey = `+testPeer1+`
+AllowedIPs = 10.0.0.10/32
+ExpiresAt = 0
+`)
+
+	plan = reloadPlan(t, dev, next)
+	diff := plan.Config()
+	if diff.PrivateKey != nil {
+		t.Fatal("unchanged private key is part of the plan")
+	}
+	if len(diff.Peers) != 2 || !diff.Peers[0].ReplaceAllowedIPs || !diff.Peers[1].Remove {
+		t.Fatalf("unexpected plan: %+v", diff.Peers)
+	}
+	if name := diff.Peers[0].Name; name == nil || *name != "" {
+		t.Fatal("dropped peer name is not reset")
+	}
+	if expiresAt := diff.Peers[0].ExpiresAt; expiresAt == nil || !expiresAt.IsZero() {
+		t.Fatal("peer expiry is not cancelled")
+	}
+
+	if err := dev.Apply(diff); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := peerKeys(t, dev); len(got) != 1 || got[0] != testPeer1 {
+		t.Fatalf("unexpected peers after reload: %v", got)
+	}
+}
+
+func TestParseConfigHooks(t *testing.T) {
+	cfg, hooks, err := parseConfig("test.conf", strings.NewReader(`
+[Interface]
+PrivateKey = `+testPrivateKey+`
+PeerUp = logger -t wg "%i: $WG_PEER_NAME is up"
+PeerUp = curl -s "https://hooks.example.com/#/up" # notify the dashboard
+LivenessDownAfter = 60
+peerdown = /usr/local/bin/alert down
+
+[Peer]
+PublicKey = `+testPeer1+`
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &peerHooks{
+		up:   []string{`logger -t wg "%i: $WG_PEER_NAME is up"`, `curl -s "https://hooks.example.com/#/up" # notify the dashboard`},
+		down: []string{"/usr/local/bin/alert down"},
+	}
+	if !cmp.Equal(want, hooks, cmp.AllowUnexported(peerHooks{})) {
+		t.Fatalf("unexpected hooks: %+v", hooks)
+	}
+	if cfg.LivenessDownAfter == nil || *cfg.LivenessDownAfter != time.Minute || len(cfg.Peers) != 1 {
+		t.Fatalf("unexpected configuration: %+v", cfg)
+	}
+
+	// hooks are only known in [Interface], and errors keep their line
+
+	_, _, err = parseConfig("test.conf", strings.NewReader(`
+[Interface]
+PeerUp = true
+
+[Peer]
+PeerUp = true
+`))
+	var perr *wgtypes.ParseError
+	if !errors.As(err, &perr) || perr.Line != 6 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPeerHooks(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelError, "test: "))
+	defer dev.Close()
+
+	cfg := mustParseConfig(t, `
+[Peer]
+# Name = alice
+PublicKey = `+testPeer1+`
+Endpoint = 192.0.2.1:51820
+`)
+	if err := dev.Apply(*cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+	runner := &hookRunner{interfaceName: "wg0", device: dev, logger: device.NewLogger(device.LogLevelError, "test: ")}
+
+	var key device.NoisePublicKey
+	copy(key[:], mustParseKey(t, testPeer1))
+	runner.runHooks(device.Event{Type: device.EventLiveness, PublicKey: key, Liveness: device.LivenessDown},
+		[]string{`echo "%i $WG_INTERFACE $WG_PEER_PUBLIC_KEY $WG_PEER_NAME $WG_PEER_ENDPOINT $WG_PEER_STATE" > ` + out})
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "wg0 wg0 " + testPeer1 + " alice 192.0.2.1:51820 down\n"; string(b) != want {
+		t.Fatalf("unexpected hook output: %q, want %q", b, want)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-f", "--mtu", "1380", "--log-format", "json", "--uapi-socket", "/run/wg0.sock", "--authorizer", "unix:/run/wg-auth.sock", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.foreground || opts.mtu != 1380 || opts.logFormat != "json" || opts.uapiSocket != "/run/wg0.sock" ||
+		opts.authorizer != "unix:/run/wg-auth.sock" || opts.interfaceName != "wg0" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = parseArgs([]string{"--uapi-readonly", "--uapi-allow", "get=1000,:998", "--uapi-allow", "get=1001", "--uapi-allow", "set=:0", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := device.IpcPolicy{
+		Get: &device.IpcAccess{UIDs: []uint32{1000, 1001}, GIDs: []uint32{998}},
+		Set: &device.IpcAccess{GIDs: []uint32{0}},
+	}
+	if !opts.uapiReadOnly || !cmp.Equal(want, opts.uapiPolicy) {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = parseArgs([]string{"--api-listen", "127.0.0.1:8443", "--api-cert", "/etc/wg/api.crt", "--api-key", "/etc/wg/api.key", "--api-client-ca", "/etc/wg/ca.crt", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.apiListen != "127.0.0.1:8443" || opts.apiCert != "/etc/wg/api.crt" || opts.apiKey != "/etc/wg/api.key" || opts.apiClientCA != "/etc/wg/ca.crt" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = parseArgs([]string{"--api-listen", "unix:/run/wg0.api", "--api-secrets", "admin,0", "--api-secrets", "ops", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"admin", "0", "ops"}, opts.apiSecrets); diff != "" {
+		t.Fatalf("unexpected secrets policy (-want +got):\n%s", diff)
+	}
+
+	opts, err = parseArgs([]string{"--metrics-listen", "127.0.0.1:9586", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.metricsListen != "127.0.0.1:9586" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if opts.handshakeErrorLogRate != device.DefaultHandshakeErrorLogRate {
+		t.Fatalf("unexpected handshake error log rate: %d", opts.handshakeErrorLogRate)
+	}
+
+	opts, err = parseArgs([]string{"--handshake-error-log-rate", "0", "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.handshakeErrorLogRate != 0 {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"wg0", "wg1"},
+		{"--mtu", "10", "wg0"},
+		{"--log-format", "xml", "wg0"},
+		{"--handshake-error-log-rate", "-1", "wg0"},
+		{"--config"},
+		{"--bogus", "x", "wg0"},
+		{"--uapi-allow", "get", "wg0"},
+		{"--uapi-allow", "list=1000", "wg0"},
+		{"--uapi-allow", "set=no-such-user-here", "wg0"},
+		{"--api-listen", "127.0.0.1:8443", "wg0"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%q) succeeded", args)
+		}
+	}
+}
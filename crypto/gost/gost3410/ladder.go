@@ -0,0 +1,224 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package gost3410
+
+import (
+	"errors"
+	"math/big"
+)
+
+// jacobianPoint is a point in Jacobian projective coordinates:
+// x = X/Z², y = Y/Z³. The point at infinity has Z = 0.
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func newJacobianPoint(x, y *big.Int) *jacobianPoint {
+	return &jacobianPoint{
+		x: new(big.Int).Set(x),
+		y: new(big.Int).Set(y),
+		z: big.NewInt(1),
+	}
+}
+
+func (p *jacobianPoint) isInfinity() bool {
+	return p.z.Sign() == 0
+}
+
+// jacobianDouble computes 2p (dbl-2007-bl). Unlike Curve.add it does not
+// touch the shared curve temporaries and is safe for concurrent use.
+func (c *Curve) jacobianDouble(p *jacobianPoint) *jacobianPoint {
+	if p.isInfinity() || p.y.Sign() == 0 {
+		return &jacobianPoint{big.NewInt(0), big.NewInt(1), big.NewInt(0)}
+	}
+	xx := new(big.Int).Mul(p.x, p.x)
+	xx.Mod(xx, c.P)
+	yy := new(big.Int).Mul(p.y, p.y)
+	yy.Mod(yy, c.P)
+	yyyy := new(big.Int).Mul(yy, yy)
+	yyyy.Mod(yyyy, c.P)
+	zz := new(big.Int).Mul(p.z, p.z)
+	zz.Mod(zz, c.P)
+
+	// S = 2*((X+YY)²-XX-YYYY)
+	s := new(big.Int).Add(p.x, yy)
+	s.Mul(s, s)
+	s.Sub(s, xx)
+	s.Sub(s, yyyy)
+	s.Lsh(s, 1)
+	s.Mod(s, c.P)
+
+	// M = 3*XX+a*ZZ²
+	m := new(big.Int).Mul(zz, zz)
+	m.Mul(m, c.A)
+	m.Add(m, new(big.Int).Mul(xx, bigInt3))
+	m.Mod(m, c.P)
+
+	// X3 = M²-2*S
+	x3 := new(big.Int).Mul(m, m)
+	x3.Sub(x3, new(big.Int).Lsh(s, 1))
+	x3.Mod(x3, c.P)
+
+	// Y3 = M*(S-X3)-8*YYYY
+	y3 := new(big.Int).Sub(s, x3)
+	y3.Mul(y3, m)
+	y3.Sub(y3, new(big.Int).Lsh(yyyy, 3))
+	y3.Mod(y3, c.P)
+
+	// Z3 = (Y+Z)²-YY-ZZ
+	z3 := new(big.Int).Add(p.y, p.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, yy)
+	z3.Sub(z3, zz)
+	z3.Mod(z3, c.P)
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+// jacobianAdd computes p+q (add-2007-bl).
+func (c *Curve) jacobianAdd(p, q *jacobianPoint) *jacobianPoint {
+	if p.isInfinity() {
+		return &jacobianPoint{new(big.Int).Set(q.x), new(big.Int).Set(q.y), new(big.Int).Set(q.z)}
+	}
+	if q.isInfinity() {
+		return &jacobianPoint{new(big.Int).Set(p.x), new(big.Int).Set(p.y), new(big.Int).Set(p.z)}
+	}
+	z1z1 := new(big.Int).Mul(p.z, p.z)
+	z1z1.Mod(z1z1, c.P)
+	z2z2 := new(big.Int).Mul(q.z, q.z)
+	z2z2.Mod(z2z2, c.P)
+	u1 := new(big.Int).Mul(p.x, z2z2)
+	u1.Mod(u1, c.P)
+	u2 := new(big.Int).Mul(q.x, z1z1)
+	u2.Mod(u2, c.P)
+	s1 := new(big.Int).Mul(p.y, q.z)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, c.P)
+	s2 := new(big.Int).Mul(q.y, p.z)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, c.P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, c.P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Lsh(r, 1)
+	r.Mod(r, c.P)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.jacobianDouble(p)
+		}
+		return &jacobianPoint{big.NewInt(0), big.NewInt(1), big.NewInt(0)}
+	}
+
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	i.Mod(i, c.P)
+	j := new(big.Int).Mul(h, i)
+	j.Mod(j, c.P)
+	v := new(big.Int).Mul(u1, i)
+	v.Mod(v, c.P)
+
+	// X3 = r²-J-2*V
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	x3.Mod(x3, c.P)
+
+	// Y3 = r*(V-X3)-2*S1*J
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1.Mul(s1, j)
+	s1.Lsh(s1, 1)
+	y3.Sub(y3, s1)
+	y3.Mod(y3, c.P)
+
+	// Z3 = ((Z1+Z2)²-Z1Z1-Z2Z2)*H
+	z3 := new(big.Int).Add(p.z, q.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, c.P)
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+// jacobianAffine converts p back to affine coordinates.
+func (c *Curve) jacobianAffine(p *jacobianPoint) (*big.Int, *big.Int, error) {
+	if p.isInfinity() {
+		return nil, nil, errors.New("gogost/gost3410: point at infinity")
+	}
+	zInv := new(big.Int).ModInverse(p.z, c.P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	zInv2.Mod(zInv2, c.P)
+	x := new(big.Int).Mul(p.x, zInv2)
+	x.Mod(x, c.P)
+	zInv2.Mul(zInv2, zInv)
+	y := new(big.Int).Mul(p.y, zInv2)
+	y.Mod(y, c.P)
+	return x, y, nil
+}
+
+// fixedWords returns the words of v padded to exactly n entries.
+func fixedWords(v *big.Int, n int) []big.Word {
+	w := make([]big.Word, n)
+	copy(w, v.Bits())
+	return w
+}
+
+// cswap swaps a and b when bit is 1 without branching on bit.
+func cswap(a, b *big.Int, bit uint, n int) {
+	mask := -big.Word(bit)
+	aw := fixedWords(a, n)
+	bw := fixedWords(b, n)
+	for i := 0; i < n; i++ {
+		t := mask & (aw[i] ^ bw[i])
+		aw[i] ^= t
+		bw[i] ^= t
+	}
+	a.SetBits(aw)
+	b.SetBits(bw)
+}
+
+func (c *Curve) cswapPoints(p, q *jacobianPoint, bit uint, n int) {
+	cswap(p.x, q.x, bit, n)
+	cswap(p.y, q.y, bit, n)
+	cswap(p.z, q.z, bit, n)
+}
+
+// ExpLadder computes degree*(xS, yS) with a Montgomery ladder. The point
+// must belong to the subgroup of order Q, which holds for the base point
+// and for valid public keys.
+//
+// The scalar is reduced modulo Q and blinded to a fixed bit length, so the
+// ladder executes the same sequence of group operations for every scalar
+// of a given curve. math/big itself gives no timing guarantees, so this
+// narrows, but does not fully close, the timing side channel of Exp.
+// Unlike Exp, ExpLadder is safe for concurrent use on the same curve.
+func (c *Curve) ExpLadder(degree, xS, yS *big.Int) (*big.Int, *big.Int, error) {
+	k := new(big.Int).Mod(degree, c.Q)
+	if k.Sign() == 0 {
+		return nil, nil, errors.New("gogost/gost3410: zero degree value")
+	}
+	qBits := c.Q.BitLen()
+	n := len(c.P.Bits()) + 1
+
+	// Pick k+Q or k+2Q, whichever has exactly qBits+1 bits.
+	k1 := new(big.Int).Add(k, c.Q)
+	k2 := new(big.Int).Add(k1, c.Q)
+	cswap(k1, k2, 1-k1.Bit(qBits), n)
+
+	r0 := newJacobianPoint(xS, yS)
+	r1 := c.jacobianDouble(r0)
+	for i := qBits - 1; i >= 0; i-- {
+		bit := k1.Bit(i)
+		c.cswapPoints(r0, r1, bit, n)
+		r1 = c.jacobianAdd(r0, r1)
+		r0 = c.jacobianDouble(r0)
+		c.cswapPoints(r0, r1, bit, n)
+	}
+	return c.jacobianAffine(r0)
+}
@@ -59,7 +59,7 @@ func (prv *PrivateKey) Raw() []byte {
 }
 
 func (prv *PrivateKey) PublicKey() (*PublicKey, error) {
-	x, y, err := prv.C.Exp(prv.Key, prv.C.X, prv.C.Y)
+	x, y, err := prv.C.ExpLadder(prv.Key, prv.C.X, prv.C.Y)
 	if err != nil {
 		return nil, err
 	}
@@ -67,49 +67,23 @@ func (prv *PrivateKey) PublicKey() (*PublicKey, error) {
 }
 
 func (prv *PrivateKey) SignDigest(digest []byte, rand io.Reader) ([]byte, error) {
-	e := bytes2big(digest)
-	e.Mod(e, prv.C.Q)
-	if e.Cmp(zero) == 0 {
-		e = big.NewInt(1)
-	}
-	kRaw := make([]byte, prv.C.PointSize())
-	var err error
-	var k *big.Int
-	var r *big.Int
-	d := big.NewInt(0)
-	s := big.NewInt(0)
-Retry:
-	if _, err = io.ReadFull(rand, kRaw); err != nil {
-		return nil, err
-	}
-	k = bytes2big(kRaw)
-	k.Mod(k, prv.C.Q)
-	if k.Cmp(zero) == 0 {
-		goto Retry
-	}
-	r, _, err = prv.C.Exp(k, prv.C.X, prv.C.Y)
+	sig, err := prv.signRandom(digest, rand)
 	if err != nil {
 		return nil, err
 	}
-	r.Mod(r, prv.C.Q)
-	if r.Cmp(zero) == 0 {
-		goto Retry
-	}
-	d.Mul(prv.Key, r)
-	k.Mul(k, e)
-	s.Add(d, k)
-	s.Mod(s, prv.C.Q)
-	if s.Cmp(zero) == 0 {
-		goto Retry
-	}
-	pointSize := prv.C.PointSize()
-	return append(
-		pad(s.Bytes(), pointSize),
-		pad(r.Bytes(), pointSize)...,
-	), nil
+	return sig.Raw(prv.C, BigEndian), nil
 }
 
+// Sign implements crypto.Signer. If opts is a *SignerOpts, its byte orders
+// and encoding are honoured. If rand is nil, the nonce is generated
+// deterministically.
 func (prv *PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if o, ok := opts.(*SignerOpts); ok {
+		return prv.SignWithOpts(rand, digest, o)
+	}
+	if rand == nil {
+		return prv.SignDigestDeterministic(digest)
+	}
 	return prv.SignDigest(digest, rand)
 }
 
@@ -121,6 +95,9 @@ func (prv *PrivateKey) Public() crypto.PublicKey {
 	return pub
 }
 
+// PrivateKeyReverseDigest signs the reversed digest.
+//
+// Deprecated: use SignWithOpts with SignerOpts{DigestOrder: LittleEndian}.
 type PrivateKeyReverseDigest struct {
 	Prv *PrivateKey
 }
@@ -136,6 +113,11 @@ func (prv *PrivateKeyReverseDigest) Sign(rand io.Reader, digest []byte, opts cry
 	return prv.Prv.Sign(rand, d, opts)
 }
 
+// PrivateKeyReverseDigestAndSignature signs the reversed digest and
+// reverses the resulting signature.
+//
+// Deprecated: use SignWithOpts with
+// SignerOpts{DigestOrder: LittleEndian, SignatureOrder: LittleEndian}.
 type PrivateKeyReverseDigestAndSignature struct {
 	Prv *PrivateKey
 }
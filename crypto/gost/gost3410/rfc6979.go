@@ -0,0 +1,99 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package gost3410
+
+import (
+	"crypto/hmac"
+	"hash"
+	"math/big"
+
+	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost34112012256"
+	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost34112012512"
+)
+
+// nonceHash returns the Streebog variant matching the curve size.
+func nonceHash(c *Curve) func() hash.Hash {
+	if c.PointSize() == 64 {
+		return gost34112012512.New
+	}
+	return gost34112012256.New
+}
+
+// bits2int takes the leftmost qlen bits of b, RFC 6979 section 2.3.2.
+func bits2int(b []byte, qlen int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		v.Rsh(v, uint(blen-qlen))
+	}
+	return v
+}
+
+// int2octets encodes v as a big-endian string of rlen bytes.
+func int2octets(v *big.Int, rlen int) []byte {
+	out := make([]byte, rlen)
+	return v.FillBytes(out)
+}
+
+// DeterministicNonce generates the ephemeral k for signing digest with prv
+// following RFC 6979 section 3.2, using HMAC-Streebog instead of HMAC-SHA.
+// The 256-bit hash is used for 256-bit curves and the 512-bit hash for
+// 512-bit ones. The digest is taken as is, in the byte order used by
+// SignDigest. extra is optional additional data mixed into the generator
+// (RFC 6979 section 3.6) and may be nil.
+func (prv *PrivateKey) DeterministicNonce(digest, extra []byte) *big.Int {
+	q := prv.C.Q
+	qlen := q.BitLen()
+	rlen := (qlen + 7) / 8
+	newHash := nonceHash(prv.C)
+	hlen := newHash().Size()
+
+	// GOST reduces the whole digest modulo Q rather than truncating it.
+	h1 := bytes2big(digest)
+	h1.Mod(h1, q)
+	x := new(big.Int).Mod(prv.Key, q)
+	seed := append(int2octets(x, rlen), int2octets(h1, rlen)...)
+	seed = append(seed, extra...)
+
+	v := make([]byte, hlen)
+	k := make([]byte, hlen)
+	for i := range v {
+		v[i] = 0x01
+	}
+
+	mac := func(key []byte, parts ...[]byte) []byte {
+		m := hmac.New(newHash, key)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+
+	k = mac(k, v, []byte{0x00}, seed)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, seed)
+	v = mac(k, v)
+
+	for {
+		t := make([]byte, 0, rlen)
+		for len(t) < rlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		nonce := bits2int(t[:rlen], qlen)
+		if nonce.Sign() > 0 && nonce.Cmp(q) < 0 {
+			setZeroBytes(seed)
+			return nonce
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+func setZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,335 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package gost3410
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"runtime"
+	"sync"
+)
+
+// ByteOrder selects how digests and raw signatures are laid out in memory.
+type ByteOrder int
+
+const (
+	// BigEndian is the order expected by SignDigest and VerifyDigest.
+	BigEndian ByteOrder = iota
+	// LittleEndian is the whole value reversed, as GOST R 34.11 digests
+	// and many GOST R 34.10 wire formats are.
+	LittleEndian
+)
+
+// SignatureEncoding selects the signature serialization format.
+type SignatureEncoding int
+
+const (
+	// EncodingRaw is s||r, each part padded to the curve point size.
+	EncodingRaw SignatureEncoding = iota
+	// EncodingASN1 is a DER SEQUENCE of the INTEGERs r and s.
+	EncodingASN1
+)
+
+// SignerOpts makes the byte orders and the encoding of a signature explicit.
+// It replaces the PrivateKeyReverseDigest family of wrappers: a
+// PrivateKeyReverseDigestAndSignature is equivalent to
+//
+//	&SignerOpts{DigestOrder: LittleEndian, SignatureOrder: LittleEndian}
+//
+// The zero value matches SignDigest and VerifyDigest.
+type SignerOpts struct {
+	// Hash is reported by HashFunc. It is informational only, since the
+	// digest is always computed by the caller.
+	Hash crypto.Hash
+
+	DigestOrder ByteOrder
+	// SignatureOrder applies to EncodingRaw only.
+	SignatureOrder ByteOrder
+	Encoding       SignatureEncoding
+}
+
+func (opts *SignerOpts) HashFunc() crypto.Hash {
+	return opts.Hash
+}
+
+func (opts *SignerOpts) digest(digest []byte) []byte {
+	d := make([]byte, len(digest))
+	copy(d, digest)
+	if opts.DigestOrder == LittleEndian {
+		reverse(d)
+	}
+	return d
+}
+
+func (opts *SignerOpts) encode(c *Curve, sig *Signature) ([]byte, error) {
+	switch opts.Encoding {
+	case EncodingRaw:
+		return sig.Raw(c, opts.SignatureOrder), nil
+	case EncodingASN1:
+		return sig.MarshalASN1()
+	}
+	return nil, fmt.Errorf("gogost/gost3410: unknown signature encoding %d", opts.Encoding)
+}
+
+func (opts *SignerOpts) decode(c *Curve, signature []byte) (*Signature, error) {
+	switch opts.Encoding {
+	case EncodingRaw:
+		return ParseSignature(c, signature, opts.SignatureOrder)
+	case EncodingASN1:
+		return ParseSignatureASN1(c, signature)
+	}
+	return nil, fmt.Errorf("gogost/gost3410: unknown signature encoding %d", opts.Encoding)
+}
+
+// Signature is a decoded (r, s) signature pair.
+type Signature struct {
+	R *big.Int
+	S *big.Int
+}
+
+type asn1Signature struct {
+	R *big.Int
+	S *big.Int
+}
+
+// ParseSignature decodes a raw s||r signature.
+func ParseSignature(c *Curve, data []byte, order ByteOrder) (*Signature, error) {
+	pointSize := c.PointSize()
+	if len(data) != 2*pointSize {
+		return nil, fmt.Errorf("gogost/gost3410: len(signature) != %d", 2*pointSize)
+	}
+	raw := make([]byte, len(data))
+	copy(raw, data)
+	if order == LittleEndian {
+		reverse(raw)
+	}
+	return &Signature{
+		R: bytes2big(raw[pointSize:]),
+		S: bytes2big(raw[:pointSize]),
+	}, nil
+}
+
+// ParseSignatureASN1 decodes a DER SEQUENCE { r INTEGER, s INTEGER }. r and
+// s must lie in [1, q-1] of the curve c, so that the signature fits Raw.
+func ParseSignatureASN1(c *Curve, data []byte) (*Signature, error) {
+	var sig asn1Signature
+	rest, err := asn1.Unmarshal(data, &sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("gogost/gost3410: trailing data after signature")
+	}
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 ||
+		sig.R.Cmp(c.Q) >= 0 || sig.S.Cmp(c.Q) >= 0 {
+		return nil, errors.New("gogost/gost3410: invalid signature integers")
+	}
+	return &Signature{R: sig.R, S: sig.S}, nil
+}
+
+// Raw encodes the signature as s||r in the given byte order.
+func (sig *Signature) Raw(c *Curve, order ByteOrder) []byte {
+	pointSize := c.PointSize()
+	raw := make([]byte, 2*pointSize)
+	sig.S.FillBytes(raw[:pointSize])
+	sig.R.FillBytes(raw[pointSize:])
+	if order == LittleEndian {
+		reverse(raw)
+	}
+	return raw
+}
+
+// MarshalASN1 encodes the signature as DER.
+func (sig *Signature) MarshalASN1() ([]byte, error) {
+	return asn1.Marshal(asn1Signature{sig.R, sig.S})
+}
+
+func (c *Curve) digestToE(digest []byte) *big.Int {
+	e := bytes2big(digest)
+	e.Mod(e, c.Q)
+	if e.Cmp(zero) == 0 {
+		e = big.NewInt(1)
+	}
+	return e
+}
+
+// signWithNonce returns the signature of e for the nonce k, or nil if k
+// produced a degenerate r or s and a new nonce has to be chosen.
+func (prv *PrivateKey) signWithNonce(e, k *big.Int) (*Signature, error) {
+	if k.Cmp(zero) == 0 {
+		return nil, nil
+	}
+	r, _, err := prv.C.ExpLadder(k, prv.C.X, prv.C.Y)
+	if err != nil {
+		return nil, err
+	}
+	r.Mod(r, prv.C.Q)
+	if r.Cmp(zero) == 0 {
+		return nil, nil
+	}
+	s := new(big.Int).Mul(prv.Key, r)
+	ke := new(big.Int).Mul(k, e)
+	s.Add(s, ke)
+	s.Mod(s, prv.C.Q)
+	if s.Cmp(zero) == 0 {
+		return nil, nil
+	}
+	return &Signature{R: r, S: s}, nil
+}
+
+func (prv *PrivateKey) signRandom(digest []byte, rand io.Reader) (*Signature, error) {
+	e := prv.C.digestToE(digest)
+	kRaw := make([]byte, prv.C.PointSize())
+	for {
+		if _, err := io.ReadFull(rand, kRaw); err != nil {
+			return nil, err
+		}
+		k := bytes2big(kRaw)
+		k.Mod(k, prv.C.Q)
+		sig, err := prv.signWithNonce(e, k)
+		if err != nil || sig != nil {
+			return sig, err
+		}
+	}
+}
+
+func (prv *PrivateKey) signDeterministic(digest []byte) (*Signature, error) {
+	e := prv.C.digestToE(digest)
+	var extra []byte
+	for attempt := uint32(0); ; attempt++ {
+		if attempt > 0 {
+			extra = make([]byte, 4)
+			binary.BigEndian.PutUint32(extra, attempt)
+		}
+		sig, err := prv.signWithNonce(e, prv.DeterministicNonce(digest, extra))
+		if err != nil || sig != nil {
+			return sig, err
+		}
+	}
+}
+
+// SignDigestDeterministic is SignDigest with the nonce derived from the key
+// and the digest by DeterministicNonce instead of read from a random source.
+func (prv *PrivateKey) SignDigestDeterministic(digest []byte) ([]byte, error) {
+	sig, err := prv.signDeterministic(digest)
+	if err != nil {
+		return nil, err
+	}
+	return sig.Raw(prv.C, BigEndian), nil
+}
+
+// SignWithOpts signs digest using the byte orders and encoding from opts.
+// If rand is nil, the nonce is generated deterministically.
+func (prv *PrivateKey) SignWithOpts(rand io.Reader, digest []byte, opts *SignerOpts) ([]byte, error) {
+	d := opts.digest(digest)
+	var sig *Signature
+	var err error
+	if rand == nil {
+		sig, err = prv.signDeterministic(d)
+	} else {
+		sig, err = prv.signRandom(d, rand)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opts.encode(prv.C, sig)
+}
+
+// Verify checks signature over digest using the byte orders and encoding
+// from opts. A nil opts is the same as VerifyDigest. Unlike VerifyDigest,
+// Verify is safe for concurrent use on the same curve.
+func (pub *PublicKey) Verify(digest, signature []byte, opts *SignerOpts) (bool, error) {
+	if opts == nil {
+		opts = &SignerOpts{}
+	}
+	sig, err := opts.decode(pub.C, signature)
+	if err != nil {
+		return false, err
+	}
+	return pub.verifySignature(opts.digest(digest), sig)
+}
+
+func (pub *PublicKey) verifySignature(digest []byte, sig *Signature) (bool, error) {
+	c := pub.C
+	if sig.R.Cmp(zero) <= 0 ||
+		sig.R.Cmp(c.Q) >= 0 ||
+		sig.S.Cmp(zero) <= 0 ||
+		sig.S.Cmp(c.Q) >= 0 {
+		return false, nil
+	}
+	v := new(big.Int).ModInverse(c.digestToE(digest), c.Q)
+	z1 := new(big.Int).Mul(sig.S, v)
+	z1.Mod(z1, c.Q)
+	z2 := new(big.Int).Mul(sig.R, v)
+	z2.Mod(z2, c.Q)
+	z2.Sub(c.Q, z2)
+	p1x, p1y, err := c.ExpLadder(z1, c.X, c.Y)
+	if err != nil {
+		return false, err
+	}
+	q1x, q1y, err := c.ExpLadder(z2, pub.X, pub.Y)
+	if err != nil {
+		return false, err
+	}
+	sum := c.jacobianAdd(newJacobianPoint(p1x, p1y), newJacobianPoint(q1x, q1y))
+	if sum.isInfinity() {
+		return false, nil
+	}
+	x, _, err := c.jacobianAffine(sum)
+	if err != nil {
+		return false, err
+	}
+	x.Mod(x, c.Q)
+	return x.Cmp(sig.R) == 0, nil
+}
+
+// BatchEntry is a single signature for VerifyBatch.
+type BatchEntry struct {
+	Pub       *PublicKey
+	Digest    []byte
+	Signature []byte
+	Opts      *SignerOpts
+}
+
+// VerifyBatch verifies the entries in parallel. It reports whether all of
+// them are valid, and the individual result for each entry. Malformed
+// signatures count as invalid.
+func VerifyBatch(entries []BatchEntry) (bool, []bool) {
+	results := make([]bool, len(entries))
+	workers := runtime.NumCPU()
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry := &entries[i]
+				ok, err := entry.Pub.Verify(entry.Digest, entry.Signature, entry.Opts)
+				results[i] = ok && err == nil
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	all := true
+	for _, ok := range results {
+		all = all && ok
+	}
+	return all, results
+}
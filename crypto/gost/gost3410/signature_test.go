@@ -0,0 +1,229 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package gost3410
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"io"
+	"math/big"
+	"testing"
+	"testing/quick"
+)
+
+func TestExpLadder(t *testing.T) {
+	for _, c := range []*Curve{
+		CurveIdtc26gost34102012256paramSetA(),
+		CurveIdGostR34102001TestParamSet(),
+		CurveIdtc26gost341012512paramSetA(),
+	} {
+		f := func(raw [64]byte) bool {
+			k := bytes2big(raw[:c.PointSize()])
+			if new(big.Int).Mod(k, c.Q).Sign() == 0 {
+				return true
+			}
+			x1, y1, err := c.Exp(new(big.Int).Mod(k, c.Q), c.X, c.Y)
+			if err != nil {
+				return false
+			}
+			x2, y2, err := c.ExpLadder(k, c.X, c.Y)
+			if err != nil {
+				return false
+			}
+			return x1.Cmp(x2) == 0 && y1.Cmp(y2) == 0
+		}
+		if err := quick.Check(f, &quick.Config{MaxCount: 20}); err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+		}
+	}
+}
+
+func TestExpLadderSmallScalars(t *testing.T) {
+	c := CurveIdtc26gost34102012256paramSetA()
+	for _, k := range []*big.Int{
+		big.NewInt(1),
+		big.NewInt(2),
+		new(big.Int).Sub(c.Q, big.NewInt(1)),
+		new(big.Int).Sub(c.Q, big.NewInt(2)),
+	} {
+		x1, y1, err := c.Exp(k, c.X, c.Y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x2, y2, err := c.ExpLadder(k, c.X, c.Y)
+		if err != nil {
+			t.Fatalf("k=%v: %v", k, err)
+		}
+		if x1.Cmp(x2) != 0 || y1.Cmp(y2) != 0 {
+			t.Errorf("k=%v: ladder result differs", k)
+		}
+	}
+	if _, _, err := c.ExpLadder(c.Q, c.X, c.Y); err == nil {
+		t.Error("expected error for a multiple of Q")
+	}
+}
+
+func TestSignDigestDeterministic(t *testing.T) {
+	c := CurveIdtc26gost34102012256paramSetA()
+	prv, err := GenPrivateKey(c, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := prv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := make([]byte, 32)
+	rand.Read(digest)
+
+	sign1, err := prv.SignDigestDeterministic(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign2, err := prv.Sign(nil, digest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sign1, sign2) {
+		t.Fatal("deterministic signatures differ")
+	}
+	valid, err := pub.VerifyDigest(digest, sign1)
+	if err != nil || !valid {
+		t.Fatal("deterministic signature does not verify")
+	}
+
+	digest[0] ^= 1
+	sign3, _ := prv.SignDigestDeterministic(digest)
+	if bytes.Equal(sign1, sign3) {
+		t.Fatal("different digests produced the same signature")
+	}
+}
+
+func TestSignerOpts(t *testing.T) {
+	c := CurveIdtc26gost34102012256paramSetA()
+	prv, err := GenPrivateKey(c, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := prv.PublicKey()
+	digest := make([]byte, 32)
+	rand.Read(digest)
+
+	for _, opts := range []*SignerOpts{
+		{},
+		{DigestOrder: LittleEndian},
+		{DigestOrder: LittleEndian, SignatureOrder: LittleEndian},
+		{Encoding: EncodingASN1},
+		{DigestOrder: LittleEndian, Encoding: EncodingASN1},
+	} {
+		var signer crypto.Signer = prv
+		for _, rng := range []io.Reader{nil, rand.Reader} {
+			sign, err := signer.Sign(rng, digest, opts)
+			if err != nil {
+				t.Fatalf("%+v: %v", opts, err)
+			}
+			valid, err := pub.Verify(digest, sign, opts)
+			if err != nil || !valid {
+				t.Fatalf("%+v: signature does not verify: %v", opts, err)
+			}
+		}
+	}
+
+	// The explicit options must agree with the legacy wrappers.
+	sign, err := (&PrivateKeyReverseDigestAndSignature{prv}).Sign(rand.Reader, digest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := pub.Verify(digest, sign, &SignerOpts{DigestOrder: LittleEndian, SignatureOrder: LittleEndian})
+	if err != nil || !valid {
+		t.Fatal("legacy reversed signature does not verify with explicit options")
+	}
+}
+
+func TestSignatureEncodings(t *testing.T) {
+	c := CurveIdtc26gost341012512paramSetA()
+	sig := &Signature{R: big.NewInt(0x1234), S: big.NewInt(0x5678)}
+	for _, order := range []ByteOrder{BigEndian, LittleEndian} {
+		raw := sig.Raw(c, order)
+		if len(raw) != 2*c.PointSize() {
+			t.Fatalf("unexpected raw length %d", len(raw))
+		}
+		parsed, err := ParseSignature(c, raw, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.R.Cmp(sig.R) != 0 || parsed.S.Cmp(sig.S) != 0 {
+			t.Fatalf("order %d: raw round trip failed", order)
+		}
+	}
+	der, err := sig.MarshalASN1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSignatureASN1(c, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.R.Cmp(sig.R) != 0 || parsed.S.Cmp(sig.S) != 0 {
+		t.Fatal("ASN.1 round trip failed")
+	}
+	if _, err := ParseSignatureASN1(c, append(der, 0)); err == nil {
+		t.Fatal("expected error for trailing data")
+	}
+	oversized, err := (&Signature{R: new(big.Int).Lsh(c.Q, 8), S: sig.S}).MarshalASN1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSignatureASN1(c, oversized); err == nil {
+		t.Fatal("expected error for r beyond the curve order")
+	}
+	atOrder, err := (&Signature{R: sig.R, S: c.Q}).MarshalASN1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSignatureASN1(c, atOrder); err == nil {
+		t.Fatal("expected error for s equal to the curve order")
+	}
+	if _, err := ParseSignature(c, der, BigEndian); err == nil {
+		t.Fatal("expected error for wrong raw length")
+	}
+}
+
+func TestVerifyBatch(t *testing.T) {
+	c := CurveIdtc26gost34102012256paramSetA()
+	var entries []BatchEntry
+	for i := 0; i < 8; i++ {
+		prv, err := GenPrivateKey(c, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _ := prv.PublicKey()
+		digest := make([]byte, 32)
+		rand.Read(digest)
+		sign, err := prv.SignDigestDeterministic(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, BatchEntry{Pub: pub, Digest: digest, Signature: sign})
+	}
+	all, results := VerifyBatch(entries)
+	if !all {
+		t.Fatalf("valid batch rejected: %v", results)
+	}
+
+	entries[3].Digest[0] ^= 1
+	entries[5].Signature = entries[5].Signature[1:]
+	all, results = VerifyBatch(entries)
+	if all {
+		t.Fatal("invalid batch accepted")
+	}
+	for i, ok := range results {
+		if ok != (i != 3 && i != 5) {
+			t.Errorf("entry %d: got %v", i, ok)
+		}
+	}
+}
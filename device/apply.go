@@ -0,0 +1,191 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/conn"
+	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost3410"
+	"github.com/bi-zone/ruwireguard-go/ipc"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+/* Apply takes a wgtypes.Config through the same validation and application
+ * as a set request, so embedders get the same guarantees without the text
+ * format. Keys are given in the byte order of wgtypes, which is the order of
+ * the hex keys of the protocol.
+ */
+
+// Apply configures the device like a set operation of the configuration
+// protocol. The configuration is validated in full first and is then
+// applied as a whole; nothing changes if it is rejected. Errors are
+// *IPCError values.
+func (device *Device) Apply(cfg wgtypes.Config) error {
+	set, err := ipcSetConfigFrom(cfg)
+	if err != nil {
+		return err
+	}
+	return device.ipcSet(set)
+}
+
+func ipcSetConfigFrom(cfg wgtypes.Config) (*ipcSetConfig, error) {
+	set := &ipcSetConfig{
+		replacePeers: cfg.ReplacePeers,
+	}
+
+	if cfg.RolloverWindow != nil {
+		if *cfg.RolloverWindow < 0 {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "invalid rollover window: %v", *cfg.RolloverWindow)
+		}
+		window := *cfg.RolloverWindow
+		set.rolloverWindow = &window
+	}
+
+	if cfg.PrivateKey != nil {
+		if len(*cfg.PrivateKey) != NoisePrivateKeySize {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "invalid private key length: %d", len(*cfg.PrivateKey))
+		}
+		var sk NoisePrivateKey
+		copy(sk[:], *cfg.PrivateKey)
+		if !sk.IsZero() {
+			gost3410.Reverse(sk[:])
+		}
+		set.privateKey = &sk
+
+		if set.rolloverWindow != nil {
+			set.privateKeyWindow = *set.rolloverWindow
+		}
+	}
+
+	if cfg.ListenPort != nil {
+		if *cfg.ListenPort < 0 || *cfg.ListenPort > math.MaxUint16 {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "invalid listen port: %d", *cfg.ListenPort)
+		}
+		port := uint16(*cfg.ListenPort)
+		set.listenPort = &port
+	}
+
+	if cfg.FirewallMark != nil {
+		if *cfg.FirewallMark < 0 || int64(*cfg.FirewallMark) > math.MaxUint32 {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "invalid firewall mark: %d", *cfg.FirewallMark)
+		}
+		fwmark := uint32(*cfg.FirewallMark)
+		set.fwmark = &fwmark
+	}
+
+	for i, d := range []*time.Duration{cfg.LivenessDegradedAfter, cfg.LivenessDownAfter, cfg.LivenessProbeInterval} {
+		if d == nil {
+			continue
+		}
+		if *d < 0 || *d/time.Second > math.MaxUint32 {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "invalid liveness threshold: %v", *d)
+		}
+		threshold := *d / time.Second * time.Second
+		set.liveness[i] = &threshold
+	}
+
+	for _, p := range cfg.Peers {
+		peer, err := ipcPeerConfigFrom(p)
+		if err != nil {
+			return nil, ipcErrorf(ipc.IpcErrorInvalid, "peer %s: %v", p.PublicKey, err)
+		}
+		set.peers = append(set.peers, peer)
+	}
+
+	return set, nil
+}
+
+func ipcPeerConfigFrom(p wgtypes.PeerConfig) (*ipcPeerConfig, error) {
+	if len(p.PublicKey) != NoisePublicKeySize {
+		return nil, fmt.Errorf("invalid public key length: %d", len(p.PublicKey))
+	}
+
+	peer := &ipcPeerConfig{
+		updateOnly:                 p.UpdateOnly,
+		remove:                     p.Remove,
+		replaceAnnotations:         p.ReplaceAnnotations,
+		nextPresharedKeyActivation: p.NextPresharedKeyActivation,
+		expiresAt:                  p.ExpiresAt,
+		replaceAllowedIPs:          p.ReplaceAllowedIPs,
+	}
+	copy(peer.publicKey[:], p.PublicKey)
+
+	if p.Name != nil {
+		if err := validLabel(*p.Name, MaxPeerNameLength); err != nil {
+			return nil, fmt.Errorf("invalid name: %v", err)
+		}
+		peer.name = p.Name
+	}
+
+	keys := make([]string, 0, len(p.Annotations))
+	for key := range p.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := validAnnotation(key, p.Annotations[key]); err != nil {
+			return nil, fmt.Errorf("invalid annotation: %v", err)
+		}
+		peer.annotations = append(peer.annotations, [2]string{key, p.Annotations[key]})
+	}
+
+	if p.PresharedKey != nil {
+		psk, err := symmetricKeyFrom(*p.PresharedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preshared key: %v", err)
+		}
+		peer.presharedKey = &psk
+	}
+
+	if p.NextPresharedKey != nil {
+		psk, err := symmetricKeyFrom(*p.NextPresharedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next preshared key: %v", err)
+		}
+		peer.nextPresharedKey = &psk
+	}
+
+	if p.Endpoint != nil {
+		endpoint, err := conn.CreateEndpoint(p.Endpoint.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %v: %v", p.Endpoint, err)
+		}
+		peer.endpoint = endpoint
+	}
+
+	if p.PersistentKeepaliveInterval != nil {
+		secs := *p.PersistentKeepaliveInterval / time.Second
+		if secs < 0 || secs > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid persistent keepalive interval: %v", *p.PersistentKeepaliveInterval)
+		}
+		interval := uint16(secs)
+		peer.persistentKeepalive = &interval
+	}
+
+	for _, ip := range p.AllowedIPs {
+		network := net.IPNet{IP: ip.IP.Mask(ip.Mask), Mask: ip.Mask}
+		if network.IP == nil {
+			return nil, fmt.Errorf("invalid allowed IP: %v", ip)
+		}
+		peer.allowedIPs = append(peer.allowedIPs, network)
+	}
+
+	return peer, nil
+}
+
+func symmetricKeyFrom(key wgtypes.Key) (psk AEADSymmetricKey, err error) {
+	if len(key) != AEADSymmetricKeySize {
+		return psk, errors.New("invalid length")
+	}
+	copy(psk[:], key)
+	return psk, nil
+}
@@ -0,0 +1,171 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/ipc"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func mustGenerateKey(t *testing.T, generate func() (wgtypes.Key, error)) wgtypes.Key {
+	key, err := generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestApplySnapshot(t *testing.T) {
+	device := NewDevice(newDummyTUN("dummy"), NewLogger(LogLevelError, ""))
+	defer device.Close()
+
+	sk := mustGenerateKey(t, wgtypes.GeneratePrivateKey)
+	pk := mustGenerateKey(t, wgtypes.GeneratePrivateKey).PublicKey()
+	psk := mustGenerateKey(t, wgtypes.GenerateKey)
+
+	port, fwmark := 51820, 0
+	name := "alice laptop"
+	keepalive := 25 * time.Second
+	expiresAt := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	err := device.Apply(wgtypes.Config{
+		PrivateKey:   &sk,
+		ListenPort:   &port,
+		FirewallMark: &fwmark,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   pk,
+			Name:                        &name,
+			Annotations:                 map[string]string{"owner": "alice@example.com"},
+			PresharedKey:                &psk,
+			ExpiresAt:                   &expiresAt,
+			Endpoint:                    &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51821},
+			PersistentKeepaliveInterval: &keepalive,
+			AllowedIPs: []net.IPNet{
+				{IP: net.IPv4(10, 0, 0, 1).To4(), Mask: net.CIDRMask(32, 32)},
+				{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(64, 128)},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	want := wgtypes.Device{
+		Name:       "dummy",
+		Type:       wgtypes.Userspace,
+		PrivateKey: sk,
+		PublicKey:  sk.PublicKey(),
+		ListenPort: port,
+		Peers: []wgtypes.Peer{{
+			PublicKey:                   pk,
+			Name:                        name,
+			Annotations:                 map[string]string{"owner": "alice@example.com"},
+			PresharedKey:                psk,
+			ExpiresAt:                   expiresAt,
+			Endpoint:                    &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51821},
+			PersistentKeepaliveInterval: keepalive,
+			AllowedIPs: []net.IPNet{
+				{IP: net.IPv4(10, 0, 0, 1).To4(), Mask: net.CIDRMask(32, 32)},
+				{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)},
+			},
+			ProtocolVersion: 1,
+		}},
+	}
+
+	got := device.Snapshot()
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b net.IP) bool { return a.Equal(b) })); diff != "" {
+		t.Fatalf("unexpected snapshot (-want +got):\n%s", diff)
+	}
+
+	// keys are in the byte order of the configuration protocol
+
+	if get := ipcGet(t, device); !strings.Contains(get, "private_key="+hex.EncodeToString(sk)+"\n") {
+		t.Fatalf("private key differs from the get output:\n%s", get)
+	}
+
+	var key NoisePublicKey
+	copy(key[:], pk)
+	peer := device.LookupPeer(key)
+	if endpoint := peer.Endpoint(); endpoint == nil || endpoint.String() != "192.0.2.1:51821" {
+		t.Fatalf("unexpected endpoint: %v", endpoint)
+	}
+	if stats := peer.Stats(); stats != (PeerStats{}) || !peer.LastHandshake().IsZero() {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	pk := mustGenerateKey(t, wgtypes.GeneratePrivateKey).PublicKey()
+	short := pk[:16]
+	port := 65536
+	keepalive := 70000 * time.Second
+	name := "bad # name"
+
+	tests := []struct {
+		name string
+		cfg  wgtypes.Config
+	}{
+		{
+			name: "private key",
+			cfg:  wgtypes.Config{PrivateKey: &short},
+		},
+		{
+			name: "listen port",
+			cfg:  wgtypes.Config{ListenPort: &port},
+		},
+		{
+			name: "public key",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: short}}},
+		},
+		{
+			name: "preshared key",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: pk, PresharedKey: &short}}},
+		},
+		{
+			name: "keepalive",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: pk, PersistentKeepaliveInterval: &keepalive}}},
+		},
+		{
+			name: "name",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: pk, Name: &name}}},
+		},
+		{
+			name: "annotation",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: pk, Annotations: map[string]string{"bad key": "value"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a valid peer ahead of the invalid setting is not applied either
+			cfg := tt.cfg
+			cfg.Peers = append([]wgtypes.PeerConfig{{PublicKey: mustGenerateKey(t, wgtypes.GeneratePrivateKey).PublicKey()}}, cfg.Peers...)
+
+			err := device.Apply(cfg)
+
+			var ipcErr *IPCError
+			if !errors.As(err, &ipcErr) || ipcErr.ErrorCode() != ipc.IpcErrorInvalid {
+				t.Fatalf("expected an invalid configuration error, got %v", err)
+			}
+			if peers := device.Snapshot().Peers; len(peers) != 0 {
+				t.Fatalf("invalid configuration was partly applied: %d peers", len(peers))
+			}
+		})
+	}
+}
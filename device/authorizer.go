@@ -0,0 +1,226 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+/* An authorizer is consulted when an initiation decrypts to a static key
+ * which is not configured on the device. If it admits the key, the peer is
+ * installed on the fly and the handshake proceeds as if it had been there
+ * all along.
+ *
+ * Anyone who knows the public key of the device can produce such
+ * initiations with fresh keys, so queries must not be an amplifier: every
+ * decision is cached for AuthorizerCacheTTL, a key has at most one query in
+ * flight, and queries are rate limited globally and bounded in number. The
+ * handshake workers never wait for an answer: the initiation which asks is
+ * set aside, an admitted peer is installed as soon as the answer arrives, and
+ * the initiation is then put back on the handshake queue, so that it is
+ * answered without waiting for the initiator's retry.
+ */
+
+const (
+	AuthorizerCacheTTL         = time.Minute
+	AuthorizerCacheSize        = 4096
+	AuthorizerQueriesPerSecond = 10
+	AuthorizerQueryBurst       = 20
+	AuthorizerMaxPending       = 8
+	AuthorizerTimeout          = 5 * time.Second
+)
+
+// A PeerAuthorization is the configuration of a peer admitted by an
+// Authorizer.
+type PeerAuthorization struct {
+	AllowedIPs                  []net.IPNet
+	PresharedKey                AEADSymmetricKey
+	PersistentKeepaliveInterval time.Duration
+	ExpiresAt                   time.Time // zero = the peer does not expire
+}
+
+// An Authorizer decides whether an unknown peer may connect.
+type Authorizer interface {
+	// Authorize returns the configuration of the peer, or nil and no error
+	// to deny it. An error also denies the peer, and is logged.
+	Authorize(ctx context.Context, pk NoisePublicKey) (*PeerAuthorization, error)
+}
+
+type authorization struct {
+	done    bool // the authorizer answered
+	expires time.Time
+	pending *QueueHandshakeElement // initiation which asked, until the answer
+}
+
+type authorizerState struct {
+	sync.Mutex
+	install    sync.Mutex // serializes the installation of admitted peers
+	authorizer Authorizer
+	cache      map[NoisePublicKey]*authorization
+	pending    int
+	tokens     float64
+	refilled   time.Time
+}
+
+// SetAuthorizer installs an authorizer for unknown initiators; nil removes
+// it, which is the default.
+func (device *Device) SetAuthorizer(authorizer Authorizer) {
+	state := &device.authorizer
+	state.Lock()
+	defer state.Unlock()
+
+	state.authorizer = authorizer
+	state.cache = make(map[NoisePublicKey]*authorization)
+	state.tokens = AuthorizerQueryBurst
+	state.refilled = time.Now()
+}
+
+/* Must hold device.authorizer.Mutex
+ */
+func (state *authorizerState) unsafeTakeToken(now time.Time) bool {
+	state.tokens += now.Sub(state.refilled).Seconds() * AuthorizerQueriesPerSecond
+	if state.tokens > AuthorizerQueryBurst {
+		state.tokens = AuthorizerQueryBurst
+	}
+	state.refilled = now
+
+	if state.tokens < 1 {
+		return false
+	}
+	state.tokens--
+	return true
+}
+
+/* Must hold device.authorizer.Mutex
+ */
+func (state *authorizerState) unsafePrune(now time.Time) {
+	for pk, entry := range state.cache {
+		if entry.done && now.After(entry.expires) {
+			delete(state.cache, pk)
+		}
+	}
+}
+
+/* Asks the authorizer about pk in the background, unless a query for it is
+ * in flight or it was denied within AuthorizerCacheTTL. Never blocks; an
+ * admitted peer is installed once the answer arrives, and the initiation
+ * elem, if not nil, is then replayed. elem is copied, the caller keeps its
+ * buffer.
+ */
+func (device *Device) authorize(pk NoisePublicKey, elem *QueueHandshakeElement) {
+	state := &device.authorizer
+	now := time.Now()
+
+	state.Lock()
+	defer state.Unlock()
+
+	if state.authorizer == nil {
+		return
+	}
+
+	if entry, ok := state.cache[pk]; ok && (!entry.done || !now.After(entry.expires)) {
+		return
+	}
+
+	if len(state.cache) >= AuthorizerCacheSize {
+		state.unsafePrune(now)
+	}
+	if len(state.cache) >= AuthorizerCacheSize || state.pending >= AuthorizerMaxPending || !state.unsafeTakeToken(now) {
+		device.log.Debug.Println("Authorizer rate limited, dropping initiation")
+		return
+	}
+
+	entry := new(authorization)
+	if elem != nil {
+		buffer := device.GetMessageBuffer()
+		entry.pending = &QueueHandshakeElement{
+			msgType:  elem.msgType,
+			buffer:   buffer,
+			packet:   buffer[:copy(buffer[:], elem.packet)],
+			endpoint: elem.endpoint,
+		}
+	}
+	state.cache[pk] = entry
+	state.pending++
+	go device.queryAuthorizer(state.authorizer, pk, entry)
+}
+
+func (device *Device) queryAuthorizer(authorizer Authorizer, pk NoisePublicKey, entry *authorization) {
+	ctx, cancel := context.WithTimeout(context.Background(), AuthorizerTimeout)
+	defer cancel()
+
+	result, err := authorizer.Authorize(ctx, pk)
+	if err != nil {
+		device.log.Error.Println("Failed to query authorizer:", err)
+		result = nil
+	}
+
+	state := &device.authorizer
+	state.Lock()
+	entry.done = true
+	entry.expires = time.Now().Add(AuthorizerCacheTTL)
+	state.pending--
+	pending := entry.pending
+	entry.pending = nil
+	state.Unlock()
+
+	// the queue never blocks, a full one drops the initiation like any other
+	if result != nil && device.addAuthorizedPeer(pk, result) && pending != nil &&
+		device.addToHandshakeQueue(device.queue.handshake, *pending) {
+		return
+	}
+	if pending != nil {
+		device.PutMessageBuffer(pending.buffer)
+	}
+}
+
+/* Installs a peer admitted by the authorizer, unless it has been configured
+ * in the meantime. Reports whether the peer was installed.
+ */
+func (device *Device) addAuthorizedPeer(pk NoisePublicKey, auth *PeerAuthorization) bool {
+	state := &device.authorizer
+	state.install.Lock()
+	defer state.install.Unlock()
+
+	if device.LookupPeer(pk) != nil {
+		return false
+	}
+
+	peer, err := device.NewPeer(pk)
+	if err != nil {
+		device.log.Error.Println("Failed to add authorized peer:", err)
+		return false
+	}
+
+	peer.handshake.mutex.Lock()
+	peer.handshake.presharedKey = auth.PresharedKey
+	peer.handshake.mutex.Unlock()
+
+	peer.Lock()
+	peer.persistentKeepaliveInterval = uint16(auth.PersistentKeepaliveInterval / time.Second)
+	peer.Unlock()
+
+	for _, network := range auth.AllowedIPs {
+		ones, _ := network.Mask.Size()
+		device.allowedips.Insert(network.IP.Mask(network.Mask), uint(ones), peer)
+	}
+
+	if !auth.ExpiresAt.IsZero() {
+		peer.SetExpiry(auth.ExpiresAt)
+	}
+
+	// the peer now answers for itself; should it be removed, the next
+	// initiation asks the authorizer again
+	state.Lock()
+	delete(state.cache, pk)
+	state.Unlock()
+
+	device.log.Info.Println(peer, "- Added by authorizer")
+	return true
+}
@@ -0,0 +1,203 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/tun/tuntest"
+)
+
+type testAuthorizer struct {
+	sync.Mutex
+	queries int
+	admit   map[NoisePublicKey]*PeerAuthorization
+}
+
+func (a *testAuthorizer) Authorize(ctx context.Context, pk NoisePublicKey) (*PeerAuthorization, error) {
+	a.Lock()
+	defer a.Unlock()
+	a.queries++
+	return a.admit[pk], nil
+}
+
+func (a *testAuthorizer) count() int {
+	a.Lock()
+	defer a.Unlock()
+	return a.queries
+}
+
+func TestAuthorizerAdmitsUnknownPeer(t *testing.T) {
+	port1 := getFreePort(t)
+
+	priv1, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	priv2, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pub1, pub2 := priv1.PublicKey(), priv2.PublicKey()
+
+	// the first device only knows its authorizer
+
+	tun1 := tuntest.NewChannelTUN()
+	dev1 := NewDevice(tun1.TUN(), NewLogger(LogLevelError, "dev1: "))
+	dev1.Up()
+	defer dev1.Close()
+	assertNil(t, ipcSet(dev1, fmt.Sprintf("private_key=%s\nlisten_port=%s\n", priv1.ToHex(), port1)))
+
+	authorizer := &testAuthorizer{admit: map[NoisePublicKey]*PeerAuthorization{
+		pub2: {
+			AllowedIPs:                  []net.IPNet{{IP: net.IPv4(1, 0, 0, 2), Mask: net.CIDRMask(32, 32)}},
+			PersistentKeepaliveInterval: 25 * time.Second,
+		},
+	}}
+	dev1.SetAuthorizer(authorizer)
+
+	tun2 := tuntest.NewChannelTUN()
+	dev2 := NewDevice(tun2.TUN(), NewLogger(LogLevelError, "dev2: "))
+	dev2.Up()
+	defer dev2.Close()
+	assertNil(t, ipcSet(dev2, fmt.Sprintf("private_key=%s\nlisten_port=%s\npublic_key=%s\nallowed_ip=1.0.0.1/32\nendpoint=127.0.0.1:%s\n",
+		priv2.ToHex(), getFreePort(t), pub1.ToHex(), port1)))
+
+	// the first initiation is answered once the authorizer admits the key
+
+	msg2to1 := tuntest.Ping(net.ParseIP("1.0.0.1"), net.ParseIP("1.0.0.2"))
+	tun2.Outbound <- msg2to1
+	select {
+	case msgRecv := <-tun1.Inbound:
+		if !bytes.Equal(msg2to1, msgRecv) {
+			t.Fatal("ping did not transit correctly")
+		}
+	case <-time.After(RekeyTimeout + 2*time.Second):
+		t.Fatal("ping did not transit")
+	}
+
+	peer := dev1.LookupPeer(pub2)
+	if peer == nil {
+		t.Fatal("authorized peer was not added")
+	}
+	if peer.persistentKeepaliveInterval != 25 {
+		t.Fatalf("unexpected keepalive of the authorized peer: %d", peer.persistentKeepaliveInterval)
+	}
+	if n := authorizer.count(); n != 1 {
+		t.Fatalf("authorizer was queried %d times", n)
+	}
+}
+
+func TestAuthorizerAnswersFirstInitiation(t *testing.T) {
+	port1 := getFreePort(t)
+
+	dev1 := randDevice(t)
+	defer dev1.Close()
+	dev1.Up()
+	assertNil(t, ipcSet(dev1, fmt.Sprintf("listen_port=%s\n", port1)))
+
+	// a single initiation, which is never retried, from a key the
+	// authorizer admits
+
+	dev2 := randDevice(t)
+	defer dev2.Close()
+	dev1.SetAuthorizer(&testAuthorizer{admit: map[NoisePublicKey]*PeerAuthorization{
+		dev2.staticIdentity.publicKey: {},
+	}})
+
+	peer1, err := dev2.NewPeer(dev1.staticIdentity.publicKey)
+	assertNil(t, err)
+	msg, err := dev2.CreateMessageInitiation(peer1)
+	assertNil(t, err)
+	var buf bytes.Buffer
+	assertNil(t, binary.Write(&buf, binary.LittleEndian, msg))
+	packet := buf.Bytes()
+	peer1.cookieGenerator.AddMacs(packet)
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+port1)
+	assertNil(t, err)
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	assertNil(t, err)
+
+	// the initiation is answered once the authorizer admits the key
+
+	assertNil(t, conn.SetReadDeadline(time.Now().Add(RekeyTimeout)))
+	res := make([]byte, MaxMessageSize)
+	n, err := conn.Read(res)
+	if err != nil {
+		t.Fatalf("initiation not answered: %v", err)
+	}
+	var response MessageResponse
+	if n != MessageResponseSize || binary.Read(bytes.NewReader(res[:n]), binary.LittleEndian, &response) != nil ||
+		response.Type != MessageResponseType {
+		t.Fatalf("unexpected answer of %d bytes", n)
+	}
+	if dev2.ConsumeMessageResponse(&response) != peer1 {
+		t.Fatal("invalid handshake response")
+	}
+}
+
+func TestAuthorizerCacheAndRateLimit(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	device.authorize(NoisePublicKey{}, nil)
+	if len(device.authorizer.cache) != 0 {
+		t.Fatal("authorizer queried without an authorizer")
+	}
+
+	authorizer := &testAuthorizer{}
+	device.SetAuthorizer(authorizer)
+
+	// a key has one query in flight, and denials are cached
+
+	var pk NoisePublicKey
+	pk[0] = 0x02
+	for i := 0; i < 3; i++ {
+		device.authorize(pk, nil)
+	}
+	waitAuthorizer(t, device)
+	for i := 0; i < 3; i++ {
+		device.authorize(pk, nil)
+	}
+	if n := authorizer.count(); n != 1 {
+		t.Fatalf("pending and cached decisions queried %d times", n)
+	}
+	if device.LookupPeer(pk) != nil {
+		t.Fatal("denied peer added")
+	}
+
+	// a burst of fresh keys only reaches the authorizer up to the limit
+
+	for i := 0; i < 3*AuthorizerQueryBurst; i++ {
+		pk[1], pk[2] = byte(i), byte(i>>8)
+		device.authorize(pk, nil)
+	}
+	waitAuthorizer(t, device)
+	if n := authorizer.count(); n > AuthorizerQueryBurst+1 {
+		t.Fatalf("authorizer queried %d times, more than the burst of %d", n, AuthorizerQueryBurst)
+	}
+}
+
+// waitAuthorizer waits for the queries in flight to be answered.
+func waitAuthorizer(t *testing.T, device *Device) {
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		device.authorizer.Lock()
+		pending := device.authorizer.pending
+		device.authorizer.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d authorizer queries not answered", pending)
+		}
+	}
+}
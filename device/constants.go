@@ -38,4 +38,6 @@ const (
 	UnderLoadQueueSize = QueueHandshakeSize / 8
 	UnderLoadAfterTime = time.Second // how long does the device remain under load after detected
 	MaxPeers           = 1 << 16     // maximum number of configured peers
+
+	PresharedKeyOverlap = RekeyAttemptTime // how long both preshared keys are tried around a scheduled switch
 )
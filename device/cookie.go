@@ -27,6 +27,11 @@ type CookieChecker struct {
 		secretSet     time.Time
 		encryptionKey [AEADSymmetricKeySize]byte
 	}
+	previous struct {
+		active        bool
+		mac1Key       [gost34112012256.Size]byte
+		encryptionKey [AEADSymmetricKeySize]byte
+	}
 }
 
 type CookieGenerator struct {
@@ -68,16 +73,55 @@ func (st *CookieChecker) Init(pk NoisePublicKey) {
 	st.mac2.secretSet = time.Time{}
 }
 
+// InitPrevious makes the checker also accept messages addressed to the
+// previous identity pk, until ClearPrevious is called.
+func (st *CookieChecker) InitPrevious(pk NoisePublicKey) {
+	st.Lock()
+	defer st.Unlock()
+
+	func() {
+		hash := gost34112012256.New()
+		hash.Write([]byte(WireGuardLabelMAC1))
+		hash.Write(pk[:])
+		hash.Sum(st.previous.mac1Key[:0])
+	}()
+
+	func() {
+		hash := gost34112012256.New()
+		hash.Write([]byte(WireGuardLabelCookie))
+		hash.Write(pk[:])
+		hash.Sum(st.previous.encryptionKey[:0])
+	}()
+
+	st.previous.active = true
+}
+
+func (st *CookieChecker) ClearPrevious() {
+	st.Lock()
+	defer st.Unlock()
+
+	setZero(st.previous.mac1Key[:])
+	setZero(st.previous.encryptionKey[:])
+	st.previous.active = false
+}
+
 func (st *CookieChecker) CheckMAC1(msg []byte) bool {
 	st.RLock()
 	defer st.RUnlock()
 
+	if st.checkMAC1(st.mac1.key[:], msg) {
+		return true
+	}
+	return st.previous.active && st.checkMAC1(st.previous.mac1Key[:], msg)
+}
+
+func (st *CookieChecker) checkMAC1(key []byte, msg []byte) bool {
 	size := len(msg)
 	smac2 := size - gost34112012256.Size
 	smac1 := smac2 - gost34112012256.Size
 
 	var mac1 [gost34112012256.Size]byte
-	MAC(&mac1, st.mac1.key[:], msg[:smac1])
+	MAC(&mac1, key, msg[:smac1])
 
 	return hmac.Equal(mac1[:], msg[smac1:smac2])
 }
@@ -156,7 +200,14 @@ func (st *CookieChecker) CreateReply(
 		return nil, err
 	}
 
-	aead, _ := mgm.NewMGM(gost3412128.NewCipher(st.mac2.encryptionKey[:]))
+	// the initiator expects the cookie sealed for the identity it addressed
+
+	encryptionKey := st.mac2.encryptionKey[:]
+	if st.previous.active && !st.checkMAC1(st.mac1.key[:], msg) && st.checkMAC1(st.previous.mac1Key[:], msg) {
+		encryptionKey = st.previous.encryptionKey[:]
+	}
+
+	aead, _ := mgm.NewMGM(gost3412128.NewCipher(encryptionKey))
 	aead.Seal(reply.Cookie[:0], reply.Nonce[:], cookie[:], msg[smac1:smac2])
 
 	st.RUnlock()
@@ -117,3 +117,65 @@ func TestCookieMAC1(t *testing.T) {
 
 	checkMAC2(msg[:])
 }
+
+func TestCookieMAC1Previous(t *testing.T) {
+
+	// setup a checker in the middle of a key rollover
+
+	var (
+		oldGenerator CookieGenerator
+		newGenerator CookieGenerator
+		checker      CookieChecker
+	)
+
+	oldSK, err := newNoisePrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSK, err := newNoisePrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldGenerator.Init(oldSK.PublicKey())
+	newGenerator.Init(newSK.PublicKey())
+	checker.Init(newSK.PublicKey())
+	checker.InitPrevious(oldSK.PublicKey())
+
+	src := []byte{192, 168, 13, 37, 10, 10, 10}
+
+	// both identities pass mac1, and each gets a cookie it can open
+
+	for _, generator := range []*CookieGenerator{&oldGenerator, &newGenerator} {
+		var msg [MessageInitiationSize]byte
+		_, err = rand.Read(msg[:])
+		if err != nil {
+			t.Fatal("fail to read from rand: ", err)
+		}
+		generator.AddMacs(msg[:])
+		if !checker.CheckMAC1(msg[:]) {
+			t.Fatal("MAC1 verification failed during rollover")
+		}
+		reply, err := checker.CreateReply(msg[:], 1377, src)
+		if err != nil {
+			t.Fatal("Failed to create cookie reply:", err)
+		}
+		if !generator.ConsumeReply(reply) {
+			t.Fatal("Failed to consume cookie reply during rollover")
+		}
+	}
+
+	// the previous identity is rejected once cleared
+
+	checker.ClearPrevious()
+
+	var msg [MessageInitiationSize]byte
+	_, err = rand.Read(msg[:])
+	if err != nil {
+		t.Fatal("fail to read from rand: ", err)
+	}
+	oldGenerator.AddMacs(msg[:])
+	if checker.CheckMAC1(msg[:]) {
+		t.Fatal("MAC1 of previous identity accepted after rollover")
+	}
+}
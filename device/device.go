@@ -24,12 +24,16 @@ import (
 )
 
 type Device struct {
+	stats deviceStats // atomically accessed, kept first for 64-bit alignment
+
 	isUp     AtomicBool // device is (going) up
 	isClosed AtomicBool // device is closed? (acting as guard)
 	log      *Logger
 
 	// synchronized resources (locks acquired in order)
 
+	ipcMutex sync.RWMutex // held by UAPI operations for their whole duration
+
 	state struct {
 		starting sync.WaitGroup
 		stopping sync.WaitGroup
@@ -46,12 +50,23 @@ type Device struct {
 		netlinkCancel *rwcancel.RWCancel
 		port          uint16 // listening port
 		fwmark        uint32 // mark value (0 = disabled)
+		createBind    func(port uint16) (conn.Bind, uint16, error)
 	}
 
 	staticIdentity struct {
 		sync.RWMutex
 		privateKey NoisePrivateKey
 		publicKey  NoisePublicKey
+
+		// previous identity, still accepted for incoming
+		// handshakes until the rollover window expires
+
+		previous struct {
+			privateKey NoisePrivateKey
+			publicKey  NoisePublicKey
+			expires    time.Time
+			timer      *time.Timer
+		}
 	}
 
 	peers struct {
@@ -64,6 +79,12 @@ type Device struct {
 	allowedips    AllowedIPs
 	indexTable    IndexTable
 	cookieChecker CookieChecker
+	authorizer    authorizerState
+	ipcPolicy     atomic.Value // IpcPolicy
+	events        eventState
+	liveness      livenessState
+
+	handshakeErrors handshakeErrorState
 
 	rate struct {
 		underLoadUntil atomic.Value
@@ -109,11 +130,14 @@ func unsafeRemovePeer(device *Device, peer *Peer, key NoisePublicKey) {
 	// stop routing and processing of packets
 
 	device.allowedips.RemoveByPeer(peer)
+	peer.stopExpiry()
 	peer.Stop()
 
 	// remove from peer map
 
 	delete(device.peers.keyMap, key)
+
+	device.publishEvent(Event{Type: EventPeerRemoved, PublicKey: key})
 }
 
 func deviceUpdateState(device *Device) {
@@ -217,6 +241,17 @@ func (device *Device) IsUnderLoad() bool {
 }
 
 func (device *Device) SetPrivateKey(sk NoisePrivateKey) error {
+	return device.SetPrivateKeyWithRollover(sk, 0)
+}
+
+/* Replaces the static identity of the device.
+ *
+ * If window is positive and the device already has an identity,
+ * the old identity keeps being accepted for incoming handshakes
+ * until the window elapses, while the new key is used for
+ * everything we send. A zero window drops the old identity at once.
+ */
+func (device *Device) SetPrivateKeyWithRollover(sk NoisePrivateKey, window time.Duration) error {
 	// lock required resources
 
 	device.staticIdentity.Lock()
@@ -244,11 +279,31 @@ func (device *Device) SetPrivateKey(sk NoisePrivateKey) error {
 		}
 	}
 
+	// retire the current identity
+
+	rollover := window > 0 && !device.staticIdentity.privateKey.IsZero()
+	device.unsafeClearPreviousIdentity()
+	if rollover {
+		previous := &device.staticIdentity.previous
+		previous.privateKey = device.staticIdentity.privateKey
+		previous.publicKey = device.staticIdentity.publicKey
+		previous.expires = time.Now().Add(window)
+		previous.timer = time.AfterFunc(window, device.expirePreviousIdentity)
+		for _, peer := range device.peers.keyMap {
+			handshake := &peer.handshake
+			handshake.precomputedStaticStaticPrevious = handshake.precomputedStaticStatic
+		}
+		device.log.Info.Println("Static key rollover started, previous identity accepted until", previous.expires.Format(time.RFC3339))
+	}
+
 	// update key material
 
 	device.staticIdentity.privateKey = sk
 	device.staticIdentity.publicKey = publicKey
 	device.cookieChecker.Init(publicKey)
+	if rollover {
+		device.cookieChecker.InitPrevious(device.staticIdentity.previous.publicKey)
+	}
 
 	// do static-static DH pre-computations
 
@@ -266,9 +321,94 @@ func (device *Device) SetPrivateKey(sk NoisePrivateKey) error {
 		peer.ExpireCurrentKeypairs()
 	}
 
+	device.publishEvent(Event{Type: EventPrivateKey, PublicKey: publicKey})
+
 	return nil
 }
 
+/* Changes the remaining lifetime of the previous identity.
+ * A non-positive window ends the rollover immediately.
+ */
+func (device *Device) SetRolloverWindow(window time.Duration) {
+	device.staticIdentity.Lock()
+	defer device.staticIdentity.Unlock()
+
+	previous := &device.staticIdentity.previous
+	if previous.expires.IsZero() {
+		return
+	}
+	if window > 0 {
+		previous.expires = time.Now().Add(window)
+		previous.timer.Reset(window)
+		return
+	}
+
+	device.peers.Lock()
+	defer device.peers.Unlock()
+	device.unsafeClearPreviousIdentity()
+}
+
+/* Reports the previous public key and when it stops being accepted.
+ * The returned time is zero if no rollover is in progress.
+ */
+func (device *Device) PreviousIdentity() (NoisePublicKey, time.Time) {
+	device.staticIdentity.RLock()
+	defer device.staticIdentity.RUnlock()
+
+	if !device.previousIdentityActive() {
+		return NoisePublicKey{}, time.Time{}
+	}
+	previous := &device.staticIdentity.previous
+	return previous.publicKey, previous.expires
+}
+
+/* Must hold device.staticIdentity.RWMutex
+ */
+func (device *Device) previousIdentityActive() bool {
+	expires := device.staticIdentity.previous.expires
+	return !expires.IsZero() && time.Now().Before(expires)
+}
+
+func (device *Device) expirePreviousIdentity() {
+	device.staticIdentity.Lock()
+	defer device.staticIdentity.Unlock()
+
+	previous := &device.staticIdentity.previous
+	if previous.expires.IsZero() || time.Now().Before(previous.expires) {
+		return
+	}
+
+	device.peers.Lock()
+	defer device.peers.Unlock()
+	device.unsafeClearPreviousIdentity()
+}
+
+/* Wipes the previous identity and the
+ * per-peer secrets derived from it.
+ *
+ * Must hold device.staticIdentity.RWMutex and device.peers.RWMutex
+ */
+func (device *Device) unsafeClearPreviousIdentity() {
+	previous := &device.staticIdentity.previous
+	if previous.expires.IsZero() {
+		return
+	}
+	if previous.timer != nil {
+		previous.timer.Stop()
+		previous.timer = nil
+	}
+	for _, peer := range device.peers.keyMap {
+		handshake := &peer.handshake
+		setZero(handshake.precomputedStaticStaticPrevious)
+		handshake.precomputedStaticStaticPrevious = nil
+	}
+	setZero(previous.privateKey[:])
+	previous.publicKey = NoisePublicKey{}
+	previous.expires = time.Time{}
+	device.cookieChecker.ClearPrevious()
+	device.log.Info.Println("Static key rollover finished, previous identity removed")
+}
+
 func NewDevice(tunDevice tun.Device, logger *Logger) *Device {
 	device := new(Device)
 
@@ -294,6 +434,8 @@ func NewDevice(tunDevice tun.Device, logger *Logger) *Device {
 	device.rate.limiter.Init()
 	device.rate.underLoadUntil.Store(time.Time{})
 
+	device.handshakeErrors.logRate = DefaultHandshakeErrorLogRate
+
 	device.indexTable.Init()
 	device.allowedips.Reset()
 
@@ -404,12 +546,23 @@ func (device *Device) Close() {
 	close(device.signals.stop)
 	device.state.stopping.Wait()
 
+	// end a rollover in progress, so that its timer does not outlive the
+	// device and the previous private key is wiped
+
+	device.staticIdentity.Lock()
+	device.peers.Lock()
+	device.unsafeClearPreviousIdentity()
+	device.peers.Unlock()
+	device.staticIdentity.Unlock()
+
 	device.RemoveAllPeers()
 
 	device.FlushPacketQueues()
 
 	device.rate.limiter.Close()
 
+	device.closeSubscriptions()
+
 	device.state.changing.Set(false)
 	device.log.Info.Println("Interface closed")
 }
@@ -490,6 +643,15 @@ func (device *Device) BindSetMark(mark uint32) error {
 	return nil
 }
 
+// SetBindCreator replaces conn.CreateBind as the function which opens the
+// sockets of the device, for programs which bring their own transport; nil
+// restores the default. It takes effect on the next BindUpdate.
+func (device *Device) SetBindCreator(create func(port uint16) (conn.Bind, uint16, error)) {
+	device.net.Lock()
+	defer device.net.Unlock()
+	device.net.createBind = create
+}
+
 func (device *Device) BindUpdate() error {
 
 	device.net.Lock()
@@ -509,7 +671,11 @@ func (device *Device) BindUpdate() error {
 
 		var err error
 		netc := &device.net
-		netc.bind, netc.port, err = conn.CreateBind(netc.port)
+		createBind := netc.createBind
+		if createBind == nil {
+			createBind = conn.CreateBind
+		}
+		netc.bind, netc.port, err = createBind(netc.port)
 		if err != nil {
 			netc.bind = nil
 			netc.port = 0
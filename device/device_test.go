@@ -120,6 +120,65 @@ endpoint=127.0.0.1:{{PORT1}}`
 			t.Error("return ping did not transit")
 		}
 	})
+
+	t.Run("statistics", func(t *testing.T) {
+		p1, p2 := dev1.Snapshot().Peers[0], dev2.Snapshot().Peers[0]
+		if p1.ReceivePackets == 0 || p1.TransmitPackets == 0 || p2.ReceivePackets == 0 || p2.TransmitPackets == 0 {
+			t.Errorf("packets not counted: %+v, %+v", p1, p2)
+		}
+		if p2.HandshakeAttempts == 0 || p1.HandshakeInitiationsReceived == 0 {
+			t.Error("handshake initiation not counted")
+		}
+		if p2.HandshakeRTT <= 0 || p1.HandshakeRTT != 0 {
+			t.Errorf("unexpected handshake round trips: %v initiator, %v responder", p2.HandshakeRTT, p1.HandshakeRTT)
+		}
+		if p1.KeypairCreated.IsZero() || p2.KeypairCreated.IsZero() {
+			t.Error("keypair creation time not reported")
+		}
+		if stats := dev1.Stats(); stats.DecryptFailures != 0 || stats.UnderLoad {
+			t.Errorf("unexpected device statistics: %+v", stats)
+		}
+	})
+
+	t.Run("disallowed source", func(t *testing.T) {
+		tun2.Outbound <- tuntest.Ping(net.ParseIP("1.0.0.1"), net.ParseIP("1.0.0.3"))
+		for deadline := time.Now().Add(300 * time.Millisecond); ; time.Sleep(10 * time.Millisecond) {
+			if dev1.Snapshot().Peers[0].AllowedIPsRejects == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("packet with a disallowed source not counted")
+			}
+		}
+		select {
+		case <-tun1.Inbound:
+			t.Error("packet with a disallowed source delivered")
+		default:
+		}
+	})
+}
+
+func TestHandshakeRTTFromInitiation(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	peer, err := device.NewPeer(sk.PublicKey())
+	assertNil(t, err)
+
+	// a response sent to the peer after the initiation does not shorten
+	// the round trip
+
+	peer.handshake.mutex.Lock()
+	peer.handshake.lastSentInitiation = time.Now().Add(-time.Second)
+	peer.handshake.lastSentHandshake = time.Now()
+	peer.handshake.mutex.Unlock()
+
+	peer.measureHandshakeRTT()
+	if rtt := device.Snapshot().Peers[0].HandshakeRTT; rtt < time.Second {
+		t.Fatalf("handshake round trip of %v measured from the response", rtt)
+	}
 }
 
 func assertNil(t *testing.T, err error) {
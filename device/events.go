@@ -0,0 +1,203 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* Events report what the device does on its own, outside of any
+ * configuration request: handshakes, roaming, giving up on a peer and
+ * wiping its keys. They are published from the packet and timer paths, so
+ * publishing never blocks: every subscriber has a bounded queue, and an
+ * event which does not fit is counted as dropped for that subscriber only.
+ */
+
+// EventQueueSize is the number of events buffered for a subscriber which
+// does not keep up; further events are dropped.
+const EventQueueSize = 256
+
+// An EventType identifies the kind of an Event.
+type EventType int
+
+const (
+	EventHandshake       EventType = iota + 1 // a handshake with the peer completed
+	EventEndpoint                             // the peer roamed to a new endpoint
+	EventHandshakeFailed                      // the handshake was given up after MaxTimerHandshakes retries
+	EventKeysZeroed                           // the session keys of the peer were wiped
+	EventPeerAdded                            // the peer was added
+	EventPeerRemoved                          // the peer was removed
+	EventPrivateKey                           // the private key of the device changed
+	EventLiveness                             // the liveness state of the peer changed
+)
+
+var eventTypeNames = map[EventType]string{
+	EventHandshake:       "handshake",
+	EventEndpoint:        "endpoint",
+	EventHandshakeFailed: "handshake_failed",
+	EventKeysZeroed:      "keys_zeroed",
+	EventPeerAdded:       "peer_added",
+	EventPeerRemoved:     "peer_removed",
+	EventPrivateKey:      "private_key",
+	EventLiveness:        "liveness",
+}
+
+// String returns the name of the event type in the configuration protocol.
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// An Event is something which happened to the device or to one of its
+// peers.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// PublicKey is the key of the peer, or the new public key of the device
+	// for EventPrivateKey.
+	PublicKey NoisePublicKey
+
+	// Endpoint is the new endpoint of the peer for EventEndpoint.
+	Endpoint string
+
+	// Liveness is the new state of the peer for EventLiveness.
+	Liveness LivenessState
+}
+
+// A Subscription receives the events of a device.
+type Subscription struct {
+	device    *Device
+	types     map[EventType]bool // nil for every type
+	events    chan Event
+	dropped   uint64 // accessed atomically
+	closeOnce sync.Once
+}
+
+type eventState struct {
+	sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	count       int32 // number of subscribers, accessed atomically
+}
+
+// Subscribe returns a subscription to the events of the device, which
+// stays open until it is closed or the device is. If types are given, only
+// events of those types are queued, so others never fill the queue.
+func (device *Device) Subscribe(types ...EventType) *Subscription {
+	sub := &Subscription{
+		device: device,
+		events: make(chan Event, EventQueueSize),
+	}
+	if len(types) != 0 {
+		sub.types = make(map[EventType]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	state := &device.events
+	state.Lock()
+	defer state.Unlock()
+
+	if state.closed {
+		close(sub.events)
+		return sub
+	}
+	if state.subscribers == nil {
+		state.subscribers = make(map[*Subscription]struct{})
+	}
+	state.subscribers[sub] = struct{}{}
+	atomic.AddInt32(&state.count, 1)
+
+	return sub
+}
+
+// Events returns the channel of the events, which is closed along with the
+// subscription.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+// Dropped returns the number of events which were dropped because the
+// queue of the subscription was full.
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// Close ends the subscription. Events already queued can still be read.
+func (sub *Subscription) Close() {
+	state := &sub.device.events
+	state.Lock()
+	defer state.Unlock()
+
+	sub.unsafeClose()
+}
+
+/* Must hold device.events.Mutex
+ */
+func (sub *Subscription) unsafeClose() {
+	sub.closeOnce.Do(func() {
+		state := &sub.device.events
+		if _, ok := state.subscribers[sub]; ok {
+			delete(state.subscribers, sub)
+			atomic.AddInt32(&state.count, -1)
+		}
+		close(sub.events)
+	})
+}
+
+/* Reports whether anyone listens, to skip building events nobody reads
+ */
+func (device *Device) eventsWanted() bool {
+	return atomic.LoadInt32(&device.events.count) > 0
+}
+
+func (device *Device) publishEvent(event Event) {
+	if !device.eventsWanted() {
+		return
+	}
+	event.Time = time.Now()
+
+	state := &device.events
+	state.RLock()
+	defer state.RUnlock()
+
+	for sub := range state.subscribers {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+func (peer *Peer) publishEvent(eventType EventType) {
+	peer.device.publishEvent(Event{
+		Type:      eventType,
+		PublicKey: peer.handshake.remoteStatic,
+	})
+}
+
+/* Ends all subscriptions, once the device is closed
+ */
+func (device *Device) closeSubscriptions() {
+	state := &device.events
+	state.Lock()
+	defer state.Unlock()
+
+	state.closed = true
+	for sub := range state.subscribers {
+		sub.unsafeClose()
+	}
+}
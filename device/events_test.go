@@ -0,0 +1,188 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/conn"
+)
+
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestSubscribe(t *testing.T) {
+	device := randDevice(t)
+	sub := device.Subscribe()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+
+	peer, err := device.NewPeer(pk)
+	assertNil(t, err)
+
+	endpoint1, err := conn.CreateEndpoint("192.0.2.1:51820")
+	assertNil(t, err)
+	endpoint2, err := conn.CreateEndpoint("192.0.2.2:51820")
+	assertNil(t, err)
+
+	// only a change of the endpoint is reported
+	peer.SetEndpointFromPacket(endpoint1)
+	peer.SetEndpointFromPacket(endpoint1)
+	peer.SetEndpointFromPacket(endpoint2)
+
+	device.RemovePeer(pk)
+
+	sk2, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	assertNil(t, device.SetPrivateKey(sk2))
+
+	want := []Event{
+		{Type: EventPeerAdded, PublicKey: pk},
+		{Type: EventEndpoint, PublicKey: pk, Endpoint: "192.0.2.1:51820"},
+		{Type: EventEndpoint, PublicKey: pk, Endpoint: "192.0.2.2:51820"},
+		{Type: EventPeerRemoved, PublicKey: pk},
+		{Type: EventPrivateKey, PublicKey: sk2.PublicKey()},
+	}
+
+	var got []Event
+	for range want {
+		event := nextEvent(t, sub)
+		if event.Time.IsZero() {
+			t.Fatalf("event without a time: %+v", event)
+		}
+		event.Time = time.Time{}
+		got = append(got, event)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// closing the device ends the subscription
+
+	device.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("subscription still open after closing the device")
+	}
+	if _, ok := <-device.Subscribe().Events(); ok {
+		t.Fatal("subscription to a closed device is open")
+	}
+}
+
+func TestSubscribeDropped(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	slow, fast := device.Subscribe(), device.Subscribe()
+	defer slow.Close()
+
+	for i := 0; i < EventQueueSize+5; i++ {
+		device.publishEvent(Event{Type: EventHandshake})
+		nextEvent(t, fast)
+	}
+
+	if dropped := slow.Dropped(); dropped != 5 {
+		t.Fatalf("expected 5 dropped events, got %d", dropped)
+	}
+	if dropped := fast.Dropped(); dropped != 0 {
+		t.Fatalf("expected no dropped events, got %d", dropped)
+	}
+
+	// a closed subscription no longer counts
+	fast.Close()
+	device.publishEvent(Event{Type: EventHandshake})
+	if dropped := fast.Dropped(); dropped != 0 {
+		t.Fatalf("closed subscription dropped %d events", dropped)
+	}
+}
+
+func TestSubscribeTypes(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	liveness := device.Subscribe(EventLiveness)
+	defer liveness.Close()
+
+	for i := 0; i < EventQueueSize+5; i++ {
+		device.publishEvent(Event{Type: EventHandshake})
+	}
+	device.publishEvent(Event{Type: EventLiveness, Liveness: LivenessDown})
+
+	if event := nextEvent(t, liveness); event.Type != EventLiveness {
+		t.Fatalf("unexpected event %v", event.Type)
+	}
+	if dropped := liveness.Dropped(); dropped != 0 {
+		t.Fatalf("events of other types dropped %d events", dropped)
+	}
+}
+
+func TestUAPIWatch(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	client, server := net.Pipe()
+	go device.IpcHandle(server)
+	defer client.Close()
+
+	if _, err := io.WriteString(client, "watch=1\n\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(client)
+	readBlock := func() string {
+		var block strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return block.String()
+			}
+			block.WriteString(line)
+		}
+	}
+
+	if ack := readBlock(); ack != "errno=0\n" {
+		t.Fatalf("unexpected answer: %q", ack)
+	}
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\n"))
+
+	block := readBlock()
+	if !strings.HasPrefix(block, "event=peer_added\ntime_sec=") || !strings.HasSuffix(block, "public_key="+pk.ToHex()+"\n") {
+		t.Fatalf("unexpected event:\n%s", block)
+	}
+
+	// anything but an empty line is refused
+	if res := ipcHandle(t, device, "watch=1\nfoo=bar\n\n"); !strings.Contains(res, "errno=-22\n") {
+		t.Fatalf("unexpected answer: %q", res)
+	}
+}
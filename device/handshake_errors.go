@@ -0,0 +1,236 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/conn"
+)
+
+// HandshakeError is the reason a handshake message was rejected.
+type HandshakeError int
+
+const (
+	HandshakeOK                   HandshakeError = iota // the message was accepted
+	HandshakeMalformed                                  // the message could not be decoded
+	HandshakeMAC1Mismatch                               // mac1 is not keyed by the public key of the device, which the sender has wrong
+	HandshakeCookieRequired                             // the device is under load and the message carries no valid cookie
+	HandshakeRateLimited                                // the device is under load and the source sends too many handshakes
+	HandshakeInvalidEphemeral                           // the ephemeral key of the sender yields no shared secret
+	HandshakeStaticDecryption                           // the static key of the initiator failed authentication
+	HandshakeUnknownPeer                                // the initiator is neither configured nor authorized
+	HandshakeInvalidStatic                              // the static key of the peer yields no shared secret
+	HandshakeIdentityMismatch                           // the timestamp failed authentication: the initiator lacks the private key of the peer
+	HandshakeReplayedTimestamp                          // the TAI64N timestamp is not newer than the last one from the peer
+	HandshakeFlood                                      // initiations from the peer arrive faster than HandshakeInitationRate
+	HandshakeUnknownIndex                               // the response names no handshake of the device
+	HandshakeUnexpectedResponse                         // the response arrived while no initiation was pending
+	HandshakePresharedKeyMismatch                       // the response failed authentication with every preshared key of the peer
+
+	numHandshakeErrors
+)
+
+var handshakeErrorNames = [numHandshakeErrors]string{
+	HandshakeOK:                   "ok",
+	HandshakeMalformed:            "malformed",
+	HandshakeMAC1Mismatch:         "mac1_mismatch",
+	HandshakeCookieRequired:       "cookie_required",
+	HandshakeRateLimited:          "rate_limited",
+	HandshakeInvalidEphemeral:     "invalid_ephemeral",
+	HandshakeStaticDecryption:     "static_decryption",
+	HandshakeUnknownPeer:          "unknown_peer",
+	HandshakeInvalidStatic:        "invalid_static",
+	HandshakeIdentityMismatch:     "identity_mismatch",
+	HandshakeReplayedTimestamp:    "replayed_timestamp",
+	HandshakeFlood:                "flood",
+	HandshakeUnknownIndex:         "unknown_index",
+	HandshakeUnexpectedResponse:   "unexpected_response",
+	HandshakePresharedKeyMismatch: "preshared_key_mismatch",
+}
+
+func (e HandshakeError) String() string {
+	if e < 0 || e >= numHandshakeErrors {
+		return "unknown"
+	}
+	return handshakeErrorNames[e]
+}
+
+const (
+	// DefaultHandshakeErrorLogRate is the number of rejected handshake
+	// messages logged per second unless SetHandshakeErrorLogRate is called.
+	DefaultHandshakeErrorLogRate = 1
+
+	maxHandshakeErrorSources = 256 // addresses remembered, the least recently seen forgotten first
+)
+
+// HandshakeErrorSource counts the handshake messages from one address
+// rejected for one reason.
+type HandshakeErrorSource struct {
+	IP       net.IP
+	Reason   HandshakeError
+	Count    uint64
+	LastSeen time.Time // of the last rejection of any reason from IP
+}
+
+type handshakeErrorSource struct {
+	counts   [numHandshakeErrors]uint64
+	lastSeen time.Time
+}
+
+type handshakeErrorState struct {
+	sync.Mutex
+	sources map[string]*handshakeErrorSource // keyed by the IP as a string
+
+	logRate    int // lines per second, 0 disables logging
+	logWindow  time.Time
+	logged     int
+	suppressed int
+}
+
+// SetHandshakeErrorLogRate limits the rejected handshake messages logged to
+// perSecond a second. Zero disables the log; the rejections are still
+// counted.
+func (device *Device) SetHandshakeErrorLogRate(perSecond int) {
+	if perSecond < 0 {
+		perSecond = 0
+	}
+	device.handshakeErrors.Lock()
+	device.handshakeErrors.logRate = perSecond
+	device.handshakeErrors.Unlock()
+}
+
+/* Counts a handshake message from endpoint rejected for reason, against the
+ * device, the source address and peer when it is known, and logs it within
+ * the configured rate
+ */
+func (device *Device) handshakeRejected(reason HandshakeError, endpoint conn.Endpoint, peer *Peer) {
+	atomic.AddUint64(&device.stats.handshakeErrors[reason], 1)
+	if peer != nil {
+		atomic.AddUint64(&peer.stats.handshakeErrors[reason], 1)
+	}
+
+	ip := endpoint.DstIP()
+	now := time.Now()
+
+	state := &device.handshakeErrors
+	state.Lock()
+
+	if state.sources == nil {
+		state.sources = make(map[string]*handshakeErrorSource)
+	}
+	source := state.sources[ip.String()]
+	if source == nil {
+		if len(state.sources) >= maxHandshakeErrorSources {
+			state.forgetOldest()
+		}
+		source = new(handshakeErrorSource)
+		state.sources[ip.String()] = source
+	}
+	source.counts[reason]++
+	source.lastSeen = now
+
+	if now.Sub(state.logWindow) >= time.Second {
+		state.logWindow = now
+		state.logged = 0
+	}
+	log := state.logged < state.logRate
+	suppressed := 0
+	if log {
+		state.logged++
+		suppressed, state.suppressed = state.suppressed, 0
+	} else {
+		state.suppressed++
+	}
+
+	state.Unlock()
+
+	if !log {
+		return
+	}
+
+	from := endpoint.DstToString()
+	if peer != nil {
+		from = peer.String() + " at " + from
+	}
+	if suppressed != 0 {
+		device.log.Info.Printf("Rejected handshake message from %s: %s (%d more rejections not logged)\n", from, reason, suppressed)
+	} else {
+		device.log.Info.Printf("Rejected handshake message from %s: %s\n", from, reason)
+	}
+}
+
+/* Must hold the state lock
+ */
+func (state *handshakeErrorState) forgetOldest() {
+	var oldest string
+	var oldestSeen time.Time
+	for ip, source := range state.sources {
+		if oldest == "" || source.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = ip, source.lastSeen
+		}
+	}
+	delete(state.sources, oldest)
+}
+
+// HandshakeErrorSources returns the rejected handshake messages of the most
+// recently seen addresses, by address and reason, sorted by address.
+func (device *Device) HandshakeErrorSources() []HandshakeErrorSource {
+	state := &device.handshakeErrors
+	state.Lock()
+	defer state.Unlock()
+
+	var sources []HandshakeErrorSource
+	for ip, source := range state.sources {
+		for reason, count := range source.counts {
+			if count == 0 {
+				continue
+			}
+			sources = append(sources, HandshakeErrorSource{
+				IP:       net.ParseIP(ip),
+				Reason:   HandshakeError(reason),
+				Count:    count,
+				LastSeen: source.lastSeen,
+			})
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		if c := bytes.Compare(sources[i].IP.To16(), sources[j].IP.To16()); c != 0 {
+			return c < 0
+		}
+		return sources[i].Reason < sources[j].Reason
+	})
+
+	return sources
+}
+
+// HandshakeErrors returns the handshake messages rejected by the device, by
+// reason, leaving out the reasons which never occurred.
+func (device *Device) HandshakeErrors() map[HandshakeError]uint64 {
+	return loadHandshakeErrors(&device.stats.handshakeErrors)
+}
+
+// HandshakeErrors returns the handshake messages from the peer rejected by
+// the device, by reason, leaving out the reasons which never occurred.
+func (peer *Peer) HandshakeErrors() map[HandshakeError]uint64 {
+	return loadHandshakeErrors(&peer.stats.handshakeErrors)
+}
+
+func loadHandshakeErrors(counts *[numHandshakeErrors]uint64) map[HandshakeError]uint64 {
+	errs := make(map[HandshakeError]uint64)
+	for reason := range counts {
+		if count := atomic.LoadUint64(&counts[reason]); count != 0 {
+			errs[HandshakeError(reason)] = count
+		}
+	}
+	return errs
+}
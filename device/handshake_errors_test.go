@@ -0,0 +1,119 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/bi-zone/ruwireguard-go/conn"
+)
+
+func TestHandshakeErrorReasons(t *testing.T) {
+	dev1 := randDevice(t)
+	dev2 := randDevice(t)
+	dev3 := randDevice(t)
+
+	defer dev1.Close()
+	defer dev2.Close()
+	defer dev3.Close()
+
+	peer1, _ := dev2.NewPeer(dev1.staticIdentity.publicKey)
+	peer2, _ := dev1.NewPeer(dev2.staticIdentity.publicKey)
+
+	// the peers disagree on the preshared key
+
+	_, err := rand.Read(peer1.handshake.presharedKey[:])
+	assertNil(t, err)
+
+	msg1, err := dev1.CreateMessageInitiation(peer2)
+	assertNil(t, err)
+	if peer, reason := dev2.consumeMessageInitiation(msg1, nil); peer != peer1 || reason != HandshakeOK {
+		t.Fatalf("initiation rejected: %v", reason)
+	}
+
+	if peer, reason := dev2.consumeMessageInitiation(msg1, nil); peer != peer1 || reason != HandshakeReplayedTimestamp {
+		t.Errorf("replayed initiation: got %v from %v, want %v", reason, peer, HandshakeReplayedTimestamp)
+	}
+
+	msg2, err := dev2.CreateMessageResponse(peer1)
+	assertNil(t, err)
+
+	unknown := *msg2
+	unknown.Receiver++
+	if peer, reason := dev1.consumeMessageResponse(&unknown); peer != nil || reason != HandshakeUnknownIndex {
+		t.Errorf("response to an unknown index: got %v from %v, want %v", reason, peer, HandshakeUnknownIndex)
+	}
+
+	if peer, reason := dev1.consumeMessageResponse(msg2); peer != peer2 || reason != HandshakePresharedKeyMismatch {
+		t.Errorf("response with another preshared key: got %v from %v, want %v", reason, peer, HandshakePresharedKeyMismatch)
+	}
+	if dev1.ConsumeMessageResponse(msg2) != nil {
+		t.Error("rejected response returned a peer")
+	}
+
+	// an initiator the responder does not know
+
+	stranger, _ := dev3.NewPeer(dev2.staticIdentity.publicKey)
+	msg3, err := dev3.CreateMessageInitiation(stranger)
+	assertNil(t, err)
+	if peer, reason := dev2.consumeMessageInitiation(msg3, nil); peer != nil || reason != HandshakeUnknownPeer {
+		t.Errorf("initiation from an unknown peer: got %v from %v, want %v", reason, peer, HandshakeUnknownPeer)
+	}
+}
+
+func TestHandshakeErrorAccounting(t *testing.T) {
+	dev := randDevice(t)
+	defer dev.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	peer, _ := dev.NewPeer(sk.PublicKey())
+
+	endpoint, err := conn.CreateEndpoint("192.0.2.1:51820")
+	assertNil(t, err)
+
+	dev.SetHandshakeErrorLogRate(1)
+	dev.handshakeRejected(HandshakeMAC1Mismatch, endpoint, nil)
+	dev.handshakeRejected(HandshakeMAC1Mismatch, endpoint, nil)
+	dev.handshakeRejected(HandshakeReplayedTimestamp, endpoint, peer)
+
+	if errs := dev.HandshakeErrors(); len(errs) != 2 || errs[HandshakeMAC1Mismatch] != 2 || errs[HandshakeReplayedTimestamp] != 1 {
+		t.Errorf("unexpected device handshake errors: %v", errs)
+	}
+	if errs := peer.HandshakeErrors(); len(errs) != 1 || errs[HandshakeReplayedTimestamp] != 1 {
+		t.Errorf("unexpected peer handshake errors: %v", errs)
+	}
+
+	sources := dev.HandshakeErrorSources()
+	if len(sources) != 2 ||
+		!sources[0].IP.Equal(net.IPv4(192, 0, 2, 1)) || sources[0].Reason != HandshakeMAC1Mismatch || sources[0].Count != 2 ||
+		sources[1].Reason != HandshakeReplayedTimestamp || sources[1].Count != 1 {
+		t.Errorf("unexpected handshake error sources: %+v", sources)
+	}
+
+	// one line a second, the rest summed up in the next line
+
+	if dev.handshakeErrors.logged != 1 || dev.handshakeErrors.suppressed != 2 {
+		t.Errorf("rejections logged: %d, suppressed: %d", dev.handshakeErrors.logged, dev.handshakeErrors.suppressed)
+	}
+
+	// the table of sources is bounded
+
+	for i := 0; i < maxHandshakeErrorSources; i++ {
+		endpoint, err := conn.CreateEndpoint(fmt.Sprintf("198.51.100.%d:51820", i))
+		assertNil(t, err)
+		dev.handshakeRejected(HandshakeUnknownPeer, endpoint, nil)
+	}
+	if n := len(dev.handshakeErrors.sources); n != maxHandshakeErrorSources {
+		t.Errorf("%d handshake error sources remembered, want %d", n, maxHandshakeErrorSources)
+	}
+	if _, ok := dev.handshakeErrors.sources["192.0.2.1"]; ok {
+		t.Error("least recently seen handshake error source not forgotten")
+	}
+}
@@ -32,6 +32,10 @@ type Keypair struct {
 	created      time.Time
 	localIndex   uint32
 	remoteIndex  uint32
+
+	// usedNextPresharedKey records the preshared key of the handshake of
+	// a responder, which is counted when the keypair is confirmed
+	usedNextPresharedKey bool
 }
 
 type Keypairs struct {
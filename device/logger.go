@@ -6,10 +6,14 @@
 package device
 
 import (
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -57,3 +61,54 @@ func NewLogger(level int, prepend string) *Logger {
 	)
 	return logger
 }
+
+// jsonWriter turns every line written by a log.Logger into one JSON object.
+type jsonWriter struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level string
+	iface string
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	line, err := json.Marshal(struct {
+		Time      string `json:"time"`
+		Level     string `json:"level"`
+		Interface string `json:"interface,omitempty"`
+		Message   string `json:"message"`
+	}{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     w.level,
+		Interface: w.iface,
+		Message:   strings.TrimSuffix(string(p), "\n"),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.out.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewJSONLogger is like NewLogger, but writes one JSON object per line with
+// the time, level, interface name and message, for log collectors.
+func NewJSONLogger(level int, iface string) *Logger {
+	mu := new(sync.Mutex)
+	writer := func(name string, minLevel int) io.Writer {
+		if level < minLevel {
+			return ioutil.Discard
+		}
+		return &jsonWriter{mu: mu, out: os.Stdout, level: name, iface: iface}
+	}
+
+	return &Logger{
+		Debug: log.New(writer("debug", LogLevelDebug), "", 0),
+		Info:  log.New(writer("info", LogLevelInfo), "", 0),
+		Error: log.New(writer("error", LogLevelError), "", 0),
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost34112012256"
@@ -110,20 +111,25 @@ type MessageCookieReply struct {
 }
 
 type Handshake struct {
-	state                     handshakeState
-	mutex                     sync.RWMutex
-	hash                      [gost34112012256.Size]byte // hash value
-	chainKey                  [gost34112012256.Size]byte // chain key
-	presharedKey              AEADSymmetricKey           // psk
-	localEphemeral            NoisePrivateKey            // ephemeral secret key
-	localIndex                uint32                     // used to clear hash-table
-	remoteIndex               uint32                     // index for sending
-	remoteStatic              NoisePublicKey             // long term key
-	remoteEphemeral           NoisePublicKey             // ephemeral public key
-	precomputedStaticStatic   []byte          // precomputed shared secret
-	lastTimestamp             tai64n.Timestamp
-	lastInitiationConsumption time.Time
-	lastSentHandshake         time.Time
+	state                           handshakeState
+	mutex                           sync.RWMutex
+	hash                            [gost34112012256.Size]byte // hash value
+	chainKey                        [gost34112012256.Size]byte // chain key
+	presharedKey                    AEADSymmetricKey           // psk
+	nextPresharedKey                AEADSymmetricKey           // scheduled psk
+	nextPresharedKeyActivation      time.Time                  // when the scheduled psk takes over (zero = none)
+	usedNextPresharedKey            bool                       // the response created was keyed with the scheduled psk
+	localEphemeral                  NoisePrivateKey            // ephemeral secret key
+	localIndex                      uint32                     // used to clear hash-table
+	remoteIndex                     uint32                     // index for sending
+	remoteStatic                    NoisePublicKey             // long term key
+	remoteEphemeral                 NoisePublicKey             // ephemeral public key
+	precomputedStaticStatic         []byte                     // precomputed shared secret
+	precomputedStaticStaticPrevious []byte                     // shared secret with the previous identity during rollover
+	lastTimestamp                   tai64n.Timestamp
+	lastInitiationConsumption       time.Time
+	lastSentHandshake               time.Time
+	lastSentInitiation              time.Time // start of the handshake round trip
 }
 
 var (
@@ -161,6 +167,52 @@ func (h *Handshake) mixKey(data []byte) {
 	mixKey(&h.chainKey, &h.chainKey, data)
 }
 
+/* Returns the preshared keys to try at the given time, preferred first.
+ *
+ * Within PresharedKeyOverlap of the activation of a scheduled key both keys
+ * are returned, so that a handshake succeeds whichever key the other side
+ * has already switched to. The boolean slice reports which candidates are
+ * the scheduled key.
+ */
+func (h *Handshake) presharedKeys(now time.Time) ([]*AEADSymmetricKey, []bool) {
+	activation := h.nextPresharedKeyActivation
+	switch {
+	case activation.IsZero() || now.Before(activation.Add(-PresharedKeyOverlap)):
+		return []*AEADSymmetricKey{&h.presharedKey}, []bool{false}
+	case now.Before(activation):
+		return []*AEADSymmetricKey{&h.presharedKey, &h.nextPresharedKey}, []bool{false, true}
+	case now.Before(activation.Add(PresharedKeyOverlap)):
+		return []*AEADSymmetricKey{&h.nextPresharedKey, &h.presharedKey}, []bool{true, false}
+	default:
+		return []*AEADSymmetricKey{&h.nextPresharedKey}, []bool{true}
+	}
+}
+
+/* Returns the preshared key in effect and the pending schedule,
+ * as they will be once the scheduled key has been promoted.
+ */
+func (h *Handshake) presharedKeySchedule(now time.Time) (AEADSymmetricKey, AEADSymmetricKey, time.Time) {
+	activation := h.nextPresharedKeyActivation
+	if activation.IsZero() || now.Before(activation.Add(PresharedKeyOverlap)) {
+		return h.presharedKey, h.nextPresharedKey, activation
+	}
+	return h.nextPresharedKey, AEADSymmetricKey{}, time.Time{}
+}
+
+/* Promotes the scheduled preshared key once the overlap is over.
+ *
+ * Must hold the handshake mutex for writing
+ */
+func (h *Handshake) rotatePresharedKey(now time.Time) {
+	activation := h.nextPresharedKeyActivation
+	if activation.IsZero() || now.Before(activation.Add(PresharedKeyOverlap)) {
+		return
+	}
+	h.presharedKey = h.nextPresharedKey
+	setZero(h.nextPresharedKey[:])
+	h.nextPresharedKeyActivation = time.Time{}
+}
+
 // Do basic precomputations.
 func init() {
 	Hash(&InitialChainKey, []byte(NoiseConstruction))
@@ -177,6 +229,8 @@ func (device *Device) CreateMessageInitiation(peer *Peer) (*MessageInitiation, e
 	handshake.mutex.Lock()
 	defer handshake.mutex.Unlock()
 
+	handshake.rotatePresharedKey(time.Now())
+
 	// create ephemeral key
 	var err error
 	handshake.hash = InitialHash
@@ -251,43 +305,51 @@ func (device *Device) CreateMessageInitiation(peer *Peer) (*MessageInitiation, e
 }
 
 func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
+	peer, reason := device.consumeMessageInitiation(msg, nil)
+	if reason != HandshakeOK {
+		return nil
+	}
+	return peer
+}
+
+/* Consumes an initiation like ConsumeMessageInitiation, returning the
+ * reason for a rejection, and the peer as well when it is known. elem is the
+ * queued initiation, which is replayed should the authorizer admit an
+ * unknown initiator
+ */
+func (device *Device) consumeMessageInitiation(msg *MessageInitiation, elem *QueueHandshakeElement) (*Peer, HandshakeError) {
 	var (
 		hash     [gost34112012256.Size]byte
 		chainKey [gost34112012256.Size]byte
 	)
 
 	if msg.Type != MessageInitiationType {
-		return nil
+		return nil, HandshakeMalformed
 	}
 
 	device.staticIdentity.RLock()
 	defer device.staticIdentity.RUnlock()
 
-	mixHash(&hash, &InitialHash, device.staticIdentity.publicKey[:])
-	mixHash(&hash, &hash, msg.Ephemeral[:])
-	mixKey(&chainKey, &InitialChainKey, msg.Ephemeral[:])
+	// decrypt static key, trying the previous identity during rollover
 
-	// decrypt static key
-	var err error
-	var peerPK NoisePublicKey
-	var key [AEADSymmetricKeySize]byte
-	ss := device.staticIdentity.privateKey.SharedSecret(msg.Ephemeral)
-	if isZero(ss[:]) {
-		return nil
+	peerPK, reason := consumeInitiationStatic(msg, &device.staticIdentity.privateKey, device.staticIdentity.publicKey, &hash, &chainKey)
+	usedPrevious := false
+	if reason != HandshakeOK && device.previousIdentityActive() {
+		previous := &device.staticIdentity.previous
+		peerPK, reason = consumeInitiationStatic(msg, &previous.privateKey, previous.publicKey, &hash, &chainKey)
+		usedPrevious = reason == HandshakeOK
 	}
-	KDF2(&chainKey, &key, chainKey[:], ss[:])
-	aead, _ := mgm.NewMGM(gost3412128.NewCipher(key[:]))
-	_, err = aead.Open(peerPK[:0], ZeroNonce[:], msg.Static[:], hash[:])
-	if err != nil {
-		return nil
+	if reason != HandshakeOK {
+		return nil, reason
 	}
-	mixHash(&hash, &hash, msg.Static[:])
 
-	// lookup peer
+	// lookup peer, asking the authorizer about unknown ones; a peer it
+	// admits is found by the replayed initiation
 
 	peer := device.LookupPeer(peerPK)
 	if peer == nil {
-		return nil
+		device.authorize(peerPK, elem)
+		return nil, HandshakeUnknownPeer
 	}
 
 	handshake := &peer.handshake
@@ -295,24 +357,29 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	// verify identity
 
 	var timestamp tai64n.Timestamp
+	var key [AEADSymmetricKeySize]byte
 
 	handshake.mutex.RLock()
 
-	if isZero(handshake.precomputedStaticStatic[:]) {
+	precomputedStaticStatic := handshake.precomputedStaticStatic
+	if usedPrevious {
+		precomputedStaticStatic = handshake.precomputedStaticStaticPrevious
+	}
+	if isZero(precomputedStaticStatic[:]) {
 		handshake.mutex.RUnlock()
-		return nil
+		return peer, HandshakeInvalidStatic
 	}
 	KDF2(
 		&chainKey,
 		&key,
 		chainKey[:],
-		handshake.precomputedStaticStatic[:],
+		precomputedStaticStatic[:],
 	)
-	aead, _ = mgm.NewMGM(gost3412128.NewCipher(key[:]))
-	_, err = aead.Open(timestamp[:0], ZeroNonce[:], msg.Timestamp[:], hash[:])
+	aead, _ := mgm.NewMGM(gost3412128.NewCipher(key[:]))
+	_, err := aead.Open(timestamp[:0], ZeroNonce[:], msg.Timestamp[:], hash[:])
 	if err != nil {
 		handshake.mutex.RUnlock()
-		return nil
+		return peer, HandshakeIdentityMismatch
 	}
 	mixHash(&hash, &hash, msg.Timestamp[:])
 
@@ -323,11 +390,14 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	handshake.mutex.RUnlock()
 	if replay {
 		device.log.Debug.Printf("%v - ConsumeMessageInitiation: handshake replay @ %v\n", peer, timestamp)
-		return nil
+		return peer, HandshakeReplayedTimestamp
 	}
 	if flood {
 		device.log.Debug.Printf("%v - ConsumeMessageInitiation: handshake flood\n", peer)
-		return nil
+		return peer, HandshakeFlood
+	}
+	if usedPrevious {
+		device.log.Debug.Printf("%v - ConsumeMessageInitiation: handshake addressed to previous identity\n", peer)
 	}
 
 	// update handshake state
@@ -352,7 +422,39 @@ func (device *Device) ConsumeMessageInitiation(msg *MessageInitiation) *Peer {
 	setZero(hash[:])
 	setZero(chainKey[:])
 
-	return peer
+	return peer, HandshakeOK
+}
+
+/* Mixes the responder identity (sk, pk) and the initiator ephemeral
+ * into hash and chainKey, and decrypts the initiator static key.
+ * Returns the reason it could not.
+ */
+func consumeInitiationStatic(
+	msg *MessageInitiation,
+	sk *NoisePrivateKey,
+	pk NoisePublicKey,
+	hash *[gost34112012256.Size]byte,
+	chainKey *[gost34112012256.Size]byte,
+) (NoisePublicKey, HandshakeError) {
+	var peerPK NoisePublicKey
+	var key [AEADSymmetricKeySize]byte
+
+	mixHash(hash, &InitialHash, pk[:])
+	mixHash(hash, hash, msg.Ephemeral[:])
+	mixKey(chainKey, &InitialChainKey, msg.Ephemeral[:])
+
+	ss := sk.SharedSecret(msg.Ephemeral)
+	if isZero(ss[:]) {
+		return peerPK, HandshakeInvalidEphemeral
+	}
+	KDF2(chainKey, &key, chainKey[:], ss[:])
+	aead, _ := mgm.NewMGM(gost3412128.NewCipher(key[:]))
+	_, err := aead.Open(peerPK[:0], ZeroNonce[:], msg.Static[:], hash[:])
+	if err != nil {
+		return peerPK, HandshakeStaticDecryption
+	}
+	mixHash(hash, hash, msg.Static[:])
+	return peerPK, HandshakeOK
 }
 
 func (device *Device) CreateMessageResponse(peer *Peer) (*MessageResponse, error) {
@@ -397,6 +499,14 @@ func (device *Device) CreateMessageResponse(peer *Peer) (*MessageResponse, error
 
 	// add preshared key
 
+	now := time.Now()
+	handshake.rotatePresharedKey(now)
+	presharedKeys, scheduled := handshake.presharedKeys(now)
+
+	// counted once the initiator confirms the keypair, see
+	// ReceivedWithKeypair
+	handshake.usedNextPresharedKey = scheduled[0]
+
 	var tau [gost34112012256.Size]byte
 	var key [AEADSymmetricKeySize]byte
 
@@ -405,7 +515,7 @@ func (device *Device) CreateMessageResponse(peer *Peer) (*MessageResponse, error
 		&tau,
 		&key,
 		handshake.chainKey[:],
-		handshake.presharedKey[:],
+		presharedKeys[0][:],
 	)
 
 	handshake.mixHash(tau[:])
@@ -426,24 +536,36 @@ func (device *Device) CreateMessageResponse(peer *Peer) (*MessageResponse, error
 }
 
 func (device *Device) ConsumeMessageResponse(msg *MessageResponse) *Peer {
-	if msg.Type != MessageResponseType {
+	peer, reason := device.consumeMessageResponse(msg)
+	if reason != HandshakeOK {
 		return nil
 	}
+	return peer
+}
+
+/* Consumes a response like ConsumeMessageResponse, returning the reason
+ * for a rejection, and the peer as well when it is known
+ */
+func (device *Device) consumeMessageResponse(msg *MessageResponse) (*Peer, HandshakeError) {
+	if msg.Type != MessageResponseType {
+		return nil, HandshakeMalformed
+	}
 
 	// lookup handshake by receiver
 
 	lookup := device.indexTable.Lookup(msg.Receiver)
 	handshake := lookup.handshake
 	if handshake == nil {
-		return nil
+		return nil, HandshakeUnknownIndex
 	}
 
 	var (
-		hash     [gost34112012256.Size]byte
-		chainKey [gost34112012256.Size]byte
+		hash          [gost34112012256.Size]byte
+		chainKey      [gost34112012256.Size]byte
+		usedScheduled bool
 	)
 
-	ok := func() bool {
+	reason := func() HandshakeError {
 
 		// lock handshake state
 
@@ -451,7 +573,7 @@ func (device *Device) ConsumeMessageResponse(msg *MessageResponse) *Peer {
 		defer handshake.mutex.RUnlock()
 
 		if handshake.state != handshakeInitiationCreated {
-			return false
+			return HandshakeUnexpectedResponse
 		}
 
 		// lock private key for reading
@@ -476,35 +598,45 @@ func (device *Device) ConsumeMessageResponse(msg *MessageResponse) *Peer {
 			setZero(ss[:])
 		}()
 
-		// add preshared key (psk)
-
-		var tau [gost34112012256.Size]byte
-		var key [AEADSymmetricKeySize]byte
-		KDF3(
-			&chainKey,
-			&tau,
-			&key,
-			chainKey[:],
-			handshake.presharedKey[:],
-		)
-		mixHash(&hash, &hash, tau[:])
-
-		// authenticate transcript
-		cipher, err := gosthopper.NewCipher(key[:])
-		if err != nil {
-			panic(err)
+		// add preshared key (psk), trying each candidate key in turn
+
+		presharedKeys, scheduled := handshake.presharedKeys(time.Now())
+		for i, presharedKey := range presharedKeys {
+			candidateHash := hash
+			candidateChainKey := chainKey
+
+			var tau [gost34112012256.Size]byte
+			var key [AEADSymmetricKeySize]byte
+			KDF3(
+				&candidateChainKey,
+				&tau,
+				&key,
+				candidateChainKey[:],
+				presharedKey[:],
+			)
+			mixHash(&candidateHash, &candidateHash, tau[:])
+
+			// authenticate transcript
+			cipher, err := gosthopper.NewCipher(key[:])
+			if err != nil {
+				panic(err)
+			}
+			aead, _ := mgm.NewMGM(cipher)
+			_, err = aead.Open(nil, ZeroNonce[:], msg.Empty[:], candidateHash[:])
+			if err != nil {
+				continue
+			}
+			mixHash(&candidateHash, &candidateHash, msg.Empty[:])
+			hash = candidateHash
+			chainKey = candidateChainKey
+			usedScheduled = scheduled[i]
+			return HandshakeOK
 		}
-		aead, _ := mgm.NewMGM(cipher)
-		_, err = aead.Open(nil, ZeroNonce[:], msg.Empty[:], hash[:])
-		if err != nil {
-			return false
-		}
-		mixHash(&hash, &hash, msg.Empty[:])
-		return true
+		return HandshakePresharedKeyMismatch
 	}()
 
-	if !ok {
-		return nil
+	if reason != HandshakeOK {
+		return lookup.peer, reason
 	}
 
 	// update handshake state
@@ -518,10 +650,16 @@ func (device *Device) ConsumeMessageResponse(msg *MessageResponse) *Peer {
 
 	handshake.mutex.Unlock()
 
+	if usedScheduled {
+		atomic.AddUint64(&lookup.peer.stats.nextPresharedKeyHandshakes, 1)
+	} else {
+		atomic.AddUint64(&lookup.peer.stats.presharedKeyHandshakes, 1)
+	}
+
 	setZero(hash[:])
 	setZero(chainKey[:])
 
-	return lookup.peer
+	return lookup.peer, HandshakeOK
 }
 
 /* Derives a new keypair from the current handshake state
@@ -589,6 +727,7 @@ func (peer *Peer) BeginSymmetricSession() error {
 	keypair.sendNonce = 0
 	keypair.replayFilter.Reset()
 	keypair.isInitiator = isInitiator
+	keypair.usedNextPresharedKey = handshake.usedNextPresharedKey
 	keypair.localIndex = peer.handshake.localIndex
 	keypair.remoteIndex = peer.handshake.remoteIndex
 
@@ -643,5 +782,13 @@ func (peer *Peer) ReceivedWithKeypair(receivedKeypair *Keypair) bool {
 	peer.device.DeleteKeypair(old)
 	keypairs.current = keypairs.loadNext()
 	keypairs.storeNext(nil)
+
+	// the handshake of the responder completes with the first packet of
+	// the initiator
+	if receivedKeypair.usedNextPresharedKey {
+		atomic.AddUint64(&peer.stats.nextPresharedKeyHandshakes, 1)
+	} else {
+		atomic.AddUint64(&peer.stats.presharedKeyHandshakes, 1)
+	}
 	return true
 }
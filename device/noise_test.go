@@ -12,6 +12,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"testing"
+	"time"
 )
 
 func TestCurveWrappers(t *testing.T) {
@@ -338,3 +339,134 @@ func TestNoiseHandshakeVectors(t *testing.T) {
 		assertEqual(t, out, testMsg)
 	}()
 }
+
+func TestNoiseHandshakeRollover(t *testing.T) {
+	dev1 := randDevice(t)
+	dev2 := randDevice(t)
+
+	defer dev1.Close()
+	defer dev2.Close()
+
+	oldPK := dev2.staticIdentity.publicKey
+	peer2, _ := dev1.NewPeer(oldPK)
+	peer1, _ := dev2.NewPeer(dev1.staticIdentity.publicKey)
+
+	// rotate the responder identity, keeping the old one for a while
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	assertNil(t, dev2.SetPrivateKeyWithRollover(sk, time.Minute))
+
+	previous, expires := dev2.PreviousIdentity()
+	if !previous.Equals(oldPK) || expires.IsZero() {
+		t.Fatal("previous identity not retained")
+	}
+
+	// the initiator still addresses the old public key
+
+	msg, err := dev1.CreateMessageInitiation(peer2)
+	assertNil(t, err)
+	if dev2.ConsumeMessageInitiation(msg) != peer1 {
+		t.Fatal("initiation to previous identity rejected during rollover")
+	}
+
+	resp, err := dev2.CreateMessageResponse(peer1)
+	assertNil(t, err)
+	if dev1.ConsumeMessageResponse(resp) != peer2 {
+		t.Fatal("response rejected during rollover")
+	}
+
+	// once the window is over, the old identity is gone
+
+	dev2.SetRolloverWindow(0)
+	if _, expires := dev2.PreviousIdentity(); !expires.IsZero() {
+		t.Fatal("rollover not finished")
+	}
+
+	msg, err = dev1.CreateMessageInitiation(peer2)
+	assertNil(t, err)
+	if dev2.ConsumeMessageInitiation(msg) != nil {
+		t.Fatal("initiation to previous identity accepted after rollover")
+	}
+}
+
+func TestRolloverClose(t *testing.T) {
+	dev := randDevice(t)
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	assertNil(t, dev.SetPrivateKeyWithRollover(sk, time.Hour))
+
+	dev.Close()
+
+	previous := &dev.staticIdentity.previous
+	if previous.timer != nil || !previous.expires.IsZero() || !previous.privateKey.IsZero() {
+		t.Fatal("rollover outlived the device")
+	}
+}
+
+func TestNoiseHandshakePresharedKeySchedule(t *testing.T) {
+	dev1 := randDevice(t)
+	dev2 := randDevice(t)
+
+	defer dev1.Close()
+	defer dev2.Close()
+
+	peer1, _ := dev2.NewPeer(dev1.staticIdentity.publicKey)
+	peer2, _ := dev1.NewPeer(dev2.staticIdentity.publicKey)
+
+	var oldPSK, newPSK AEADSymmetricKey
+	_, err := rand.Read(oldPSK[:])
+	assertNil(t, err)
+	_, err = rand.Read(newPSK[:])
+	assertNil(t, err)
+
+	// the responder has already passed the activation, the initiator has not
+
+	now := time.Now()
+	peer2.handshake.presharedKey = oldPSK
+	peer2.handshake.nextPresharedKey = newPSK
+	peer2.handshake.nextPresharedKeyActivation = now.Add(PresharedKeyOverlap / 2)
+	peer1.handshake.presharedKey = oldPSK
+	peer1.handshake.nextPresharedKey = newPSK
+	peer1.handshake.nextPresharedKeyActivation = now.Add(-PresharedKeyOverlap / 2)
+
+	msg1, err := dev1.CreateMessageInitiation(peer2)
+	assertNil(t, err)
+	if dev2.ConsumeMessageInitiation(msg1) != peer1 {
+		t.Fatal("handshake failed at initiation message")
+	}
+	msg2, err := dev2.CreateMessageResponse(peer1)
+	assertNil(t, err)
+	if dev1.ConsumeMessageResponse(msg2) != peer2 {
+		t.Fatal("handshake failed at response message with scheduled preshared key")
+	}
+	assertEqual(t, peer1.handshake.chainKey[:], peer2.handshake.chainKey[:])
+
+	if peer2.stats.nextPresharedKeyHandshakes != 1 {
+		t.Fatal("handshake with scheduled preshared key not counted by the initiator")
+	}
+
+	// the responder counts the handshake once its keypair is confirmed
+
+	if peer1.stats.nextPresharedKeyHandshakes != 0 || peer1.stats.presharedKeyHandshakes != 0 {
+		t.Fatal("handshake counted by the responder before confirmation")
+	}
+	assertNil(t, peer1.BeginSymmetricSession())
+	if !peer1.ReceivedWithKeypair(peer1.keypairs.loadNext()) {
+		t.Fatal("responder keypair not confirmed")
+	}
+	if peer1.stats.nextPresharedKeyHandshakes != 1 || peer1.stats.presharedKeyHandshakes != 0 {
+		t.Fatal("handshake with scheduled preshared key not counted by the responder")
+	}
+
+	// after the overlap the scheduled key is promoted
+
+	peer2.handshake.nextPresharedKeyActivation = now.Add(-2 * PresharedKeyOverlap)
+	_, err = dev1.CreateMessageInitiation(peer2)
+	assertNil(t, err)
+	assertEqual(t, peer2.handshake.presharedKey[:], newPSK[:])
+	if !peer2.handshake.nextPresharedKeyActivation.IsZero() {
+		t.Fatal("preshared key schedule not cleared after promotion")
+	}
+}
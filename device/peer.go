@@ -30,6 +30,8 @@ type Peer struct {
 	endpoint                    conn.Endpoint
 	persistentKeepaliveInterval uint16
 	disableRoaming              bool
+	name                        atomic.Value      // string, read without locks by String
+	annotations                 map[string]string // free-form labels, protected by the peer lock
 
 	// These fields are accessed with atomic operations, which must be
 	// 64-bit aligned even on 32-bit platforms. Go guarantees that an
@@ -39,15 +41,34 @@ type Peer struct {
 	stats struct {
 		txBytes           uint64 // bytes send to peer (endpoint)
 		rxBytes           uint64 // bytes received from peer
+		txPackets         uint64 // datagrams sent to peer
+		rxPackets         uint64 // authenticated datagrams received from peer
+		handshakeAttempts uint64 // handshake initiations sent to peer
 		lastHandshakeNano int64  // nano seconds since epoch
+
+		txDrops                      uint64 // packets to peer dropped, a queue being full
+		rxDrops                      uint64 // packets from peer dropped, a queue being full
+		decryptFailures              uint64 // transport packets from peer which failed authentication
+		replayRejects                uint64 // transport packets from peer refused by the replay filter
+		sourceRejects                uint64 // packets from peer with a source outside its allowed IPs
+		handshakeInitiationsReceived uint64 // handshake initiations received from peer
+		handshakeRTTNano             int64  // round trip of the last handshake initiated with peer
+
+		handshakeErrors [numHandshakeErrors]uint64 // handshake messages from peer rejected, by reason
+
+		presharedKeyHandshakes     uint64 // handshakes completed with the preshared key in effect
+		nextPresharedKeyHandshakes uint64 // handshakes completed with the scheduled preshared key
 	}
 
+	liveness peerLiveness // starts with atomically accessed fields as well
+
 	timers struct {
 		retransmitHandshake     *Timer
 		sendKeepalive           *Timer
 		newHandshake            *Timer
 		zeroKeyMaterial         *Timer
 		persistentKeepalive     *Timer
+		liveness                *Timer
 		handshakeAttempts       uint32
 		needAnotherKeepalive    AtomicBool
 		sentLastMinuteHandshake AtomicBool
@@ -73,6 +94,12 @@ type Peer struct {
 		stop       chan struct{}  // size 0, stop all go routines in peer
 	}
 
+	expiry struct {
+		sync.Mutex
+		at    time.Time   // when the peer is removed (zero = never)
+		timer *time.Timer // fires at, nil if at is zero
+	}
+
 	cookieGenerator CookieGenerator
 }
 
@@ -117,6 +144,9 @@ func (device *Device) NewPeer(pk NoisePublicKey) (*Peer, error) {
 	handshake := &peer.handshake
 	handshake.mutex.Lock()
 	handshake.precomputedStaticStatic = device.staticIdentity.privateKey.SharedSecret(pk)
+	if device.previousIdentityActive() {
+		handshake.precomputedStaticStaticPrevious = device.staticIdentity.previous.privateKey.SharedSecret(pk)
+	}
 	handshake.remoteStatic = pk
 	handshake.mutex.Unlock()
 
@@ -124,6 +154,10 @@ func (device *Device) NewPeer(pk NoisePublicKey) (*Peer, error) {
 
 	peer.endpoint = nil
 
+	// a new peer is down until it is heard from
+
+	peer.liveness.changed = time.Now()
+
 	// add
 
 	device.peers.keyMap[pk] = peer
@@ -134,6 +168,8 @@ func (device *Device) NewPeer(pk NoisePublicKey) (*Peer, error) {
 		peer.Start()
 	}
 
+	device.publishEvent(Event{Type: EventPeerAdded, PublicKey: pk})
+
 	return peer, nil
 }
 
@@ -155,11 +191,15 @@ func (peer *Peer) SendBuffer(buffer []byte) error {
 	err := peer.device.net.bind.Send(buffer, peer.endpoint)
 	if err == nil {
 		atomic.AddUint64(&peer.stats.txBytes, uint64(len(buffer)))
+		atomic.AddUint64(&peer.stats.txPackets, 1)
 	}
 	return err
 }
 
 func (peer *Peer) String() string {
+	if name := peer.Name(); name != "" {
+		return fmt.Sprintf("peer(%s)", name)
+	}
 	base64Key := base64.StdEncoding.EncodeToString(peer.handshake.remoteStatic[:])
 	abbreviatedKey := "invalid"
 	if len(base64Key) > 4 {
@@ -216,6 +256,8 @@ func (peer *Peer) Start() {
 
 	peer.routines.starting.Wait()
 	peer.isRunning.Set(true)
+
+	peer.scheduleLiveness()
 }
 
 func (peer *Peer) ZeroAndFlushAll() {
@@ -301,6 +343,15 @@ func (peer *Peer) SetEndpointFromPacket(endpoint conn.Endpoint) {
 		return
 	}
 	peer.Lock()
+	roamed := peer.device.eventsWanted() && (peer.endpoint == nil || peer.endpoint.DstToString() != endpoint.DstToString())
 	peer.endpoint = endpoint
 	peer.Unlock()
+
+	if roamed {
+		peer.device.publishEvent(Event{
+			Type:      EventEndpoint,
+			PublicKey: peer.handshake.remoteStatic,
+			Endpoint:  endpoint.DstToString(),
+		})
+	}
 }
@@ -0,0 +1,96 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"time"
+)
+
+/* A peer may be given an expiry time, for temporary access. Once it passes
+ * the peer is removed from the device like with remove=true, and the keys
+ * it was configured with are wiped, so that a forgotten contractor peer
+ * does not outlive its purpose.
+ */
+
+// ExpiresAt returns when the peer is removed, or the zero time if it does
+// not expire.
+func (peer *Peer) ExpiresAt() time.Time {
+	peer.expiry.Lock()
+	defer peer.expiry.Unlock()
+	return peer.expiry.at
+}
+
+// SetExpiry schedules the removal of the peer at the given time; the zero
+// time cancels it. A time in the past removes the peer right away.
+func (peer *Peer) SetExpiry(at time.Time) {
+	peer.expiry.Lock()
+	defer peer.expiry.Unlock()
+
+	peer.unsafeStopExpiry()
+	peer.expiry.at = at
+	if !at.IsZero() {
+		peer.expiry.timer = time.AfterFunc(time.Until(at), peer.expire)
+	}
+}
+
+/* Must hold peer.expiry.Mutex
+ */
+func (peer *Peer) unsafeStopExpiry() {
+	if peer.expiry.timer != nil {
+		peer.expiry.timer.Stop()
+		peer.expiry.timer = nil
+	}
+}
+
+func (peer *Peer) stopExpiry() {
+	peer.expiry.Lock()
+	defer peer.expiry.Unlock()
+	peer.unsafeStopExpiry()
+}
+
+func (peer *Peer) expire() {
+	peer.handshake.mutex.RLock()
+	pk := peer.handshake.remoteStatic
+	peer.handshake.mutex.RUnlock()
+
+	device := peer.device
+	device.peers.Lock()
+
+	// the expiry is checked again under the lock, as it may have been
+	// renewed, and the peer removed and configured anew, in the meantime
+	at := peer.ExpiresAt()
+	if device.peers.keyMap[pk] != peer || at.IsZero() || time.Now().Before(at) {
+		device.peers.Unlock()
+		return
+	}
+	unsafeRemovePeer(device, peer, pk)
+	device.peers.Unlock()
+
+	device.log.Info.Println(peer, "- Expired at", at.UTC().Format(time.RFC3339), "- removed peer")
+	peer.wipeKeys()
+}
+
+func (peer *Peer) removeExpired(at time.Time) {
+	device := peer.device
+	device.log.Info.Println(peer, "- Expired at", at.UTC().Format(time.RFC3339), "- removing peer")
+	device.RemovePeer(peer.handshake.remoteStatic)
+	peer.wipeKeys()
+}
+
+// wipeKeys zeroes the preshared keys and the static-static secrets of a
+// removed peer, which Stop leaves in place.
+func (peer *Peer) wipeKeys() {
+	handshake := &peer.handshake
+	handshake.mutex.Lock()
+	defer handshake.mutex.Unlock()
+
+	setZero(handshake.presharedKey[:])
+	setZero(handshake.nextPresharedKey[:])
+	handshake.nextPresharedKeyActivation = time.Time{}
+	setZero(handshake.precomputedStaticStatic)
+	setZero(handshake.precomputedStaticStaticPrevious)
+	handshake.precomputedStaticStaticPrevious = nil
+}
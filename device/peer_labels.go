@@ -0,0 +1,112 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* Peers may carry a friendly name, which replaces the abbreviated public
+ * key in log lines, and free-form annotations. Neither takes part in the
+ * protocol; they only exist so that operators do not have to keep a table
+ * mapping keys to people.
+ */
+
+const (
+	MaxPeerNameLength        = 64
+	MaxAnnotationKeyLength   = 64
+	MaxAnnotationValueLength = 256
+)
+
+var annotationKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// validLabel rejects text which would garble UAPI lines, configuration
+// files or logs.
+func validLabel(s string, max int) error {
+	if len(s) > max {
+		return errors.New("too long")
+	}
+	if !utf8.ValidString(s) {
+		return errors.New("not valid UTF-8")
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) || r == '#' {
+			return errors.New("contains a control character or '#'")
+		}
+	}
+	return nil
+}
+
+// validAnnotation checks an annotation before it is set.
+func validAnnotation(key, value string) error {
+	if len(key) > MaxAnnotationKeyLength || !annotationKeyRegexp.MatchString(key) {
+		return errors.New("invalid annotation key")
+	}
+	return validLabel(value, MaxAnnotationValueLength)
+}
+
+// Name returns the friendly name of the peer, if any.
+func (peer *Peer) Name() string {
+	name, _ := peer.name.Load().(string)
+	return name
+}
+
+// SetName sets the friendly name of the peer; an empty name removes it.
+func (peer *Peer) SetName(name string) error {
+	if err := validLabel(name, MaxPeerNameLength); err != nil {
+		return err
+	}
+	peer.name.Store(name)
+	return nil
+}
+
+// SetAnnotation sets an annotation of the peer; an empty value removes it.
+func (peer *Peer) SetAnnotation(key, value string) error {
+	if err := validAnnotation(key, value); err != nil {
+		return err
+	}
+
+	peer.Lock()
+	defer peer.Unlock()
+
+	if value == "" {
+		delete(peer.annotations, key)
+		return nil
+	}
+	if peer.annotations == nil {
+		peer.annotations = make(map[string]string)
+	}
+	peer.annotations[key] = value
+
+	return nil
+}
+
+// Annotations returns a copy of the annotations of the peer.
+func (peer *Peer) Annotations() map[string]string {
+	peer.RLock()
+	defer peer.RUnlock()
+
+	annotations := make(map[string]string, len(peer.annotations))
+	for key, value := range peer.annotations {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// annotationKeys returns the annotation keys in order. The caller must hold
+// the peer lock.
+func (peer *Peer) annotationKeys() []string {
+	keys := make([]string, 0, len(peer.annotations))
+	for key := range peer.annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,284 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* WireGuard itself has no notion of a peer being down. Liveness monitoring
+ * derives one from the last authenticated packet received from the peer:
+ * it is up while the peer is heard from, degraded once it has been silent
+ * for DegradedAfter or a handshake with it has to be retried, and down once
+ * it has been silent for DownAfter or a handshake with it was given up.
+ * Monitoring starts with every peer down until it is heard from.
+ *
+ * An idle peer sends nothing, so without probes it goes down as well. A
+ * probe is a keepalive, sent after ProbeInterval of silence, which keeps the
+ * view the peer has of this device fresh. Keepalives are not answered,
+ * though, so once the peer is no longer up probes are handshake
+ * initiations, which the peer has to answer.
+ */
+
+// A LivenessState is the health of a peer, as seen by liveness monitoring.
+type LivenessState uint32
+
+const (
+	LivenessDown     LivenessState = iota // silent for DownAfter, or the handshake was given up
+	LivenessDegraded                      // silent for DegradedAfter, or the handshake is retried
+	LivenessUp                            // heard from recently
+)
+
+var livenessStateNames = map[LivenessState]string{
+	LivenessDown:     "down",
+	LivenessDegraded: "degraded",
+	LivenessUp:       "up",
+}
+
+// String returns the name of the state in the configuration protocol.
+func (state LivenessState) String() string {
+	if name, ok := livenessStateNames[state]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// LivenessConfig holds the thresholds of liveness monitoring. Monitoring is
+// off while DownAfter is 0; DegradedAfter and ProbeInterval are optional.
+type LivenessConfig struct {
+	DegradedAfter time.Duration
+	DownAfter     time.Duration
+	ProbeInterval time.Duration
+}
+
+func (cfg LivenessConfig) enabled() bool {
+	return cfg.DownAfter > 0
+}
+
+func (cfg LivenessConfig) check() error {
+	if cfg.DegradedAfter < 0 || cfg.DownAfter < 0 || cfg.ProbeInterval < 0 {
+		return errors.New("negative liveness threshold")
+	}
+	if cfg.enabled() && cfg.DegradedAfter >= cfg.DownAfter {
+		return errors.New("liveness degraded threshold is not below the down threshold")
+	}
+	return nil
+}
+
+type livenessState struct {
+	sync.RWMutex
+	config  LivenessConfig
+	enabled AtomicBool // config.enabled(), read without locks on receive
+}
+
+type peerLiveness struct {
+	lastReceivedNano int64  // last authenticated packet, accessed atomically
+	lastProbeNano    int64  // accessed atomically
+	state            uint32 // LivenessState, accessed atomically
+
+	sync.Mutex // serializes changes of the state
+	changed    time.Time
+}
+
+// Liveness returns the liveness monitoring thresholds of the device.
+func (device *Device) Liveness() LivenessConfig {
+	device.liveness.RLock()
+	defer device.liveness.RUnlock()
+	return device.liveness.config
+}
+
+// SetLiveness changes the liveness monitoring thresholds of the device.
+// Turning monitoring on starts every peer down.
+func (device *Device) SetLiveness(cfg LivenessConfig) error {
+	if err := cfg.check(); err != nil {
+		return err
+	}
+
+	device.liveness.Lock()
+	device.liveness.config = cfg
+	started := !device.liveness.enabled.Swap(cfg.enabled()) && cfg.enabled()
+	device.liveness.Unlock()
+
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+
+	for _, peer := range device.peers.keyMap {
+		if started {
+			peer.resetLiveness()
+		}
+		peer.scheduleLiveness()
+	}
+
+	return nil
+}
+
+// Liveness returns the liveness state of the peer and when it was entered.
+// It is only meaningful while the device monitors liveness.
+func (peer *Peer) Liveness() (LivenessState, time.Time) {
+	peer.liveness.Lock()
+	defer peer.liveness.Unlock()
+	return LivenessState(atomic.LoadUint32(&peer.liveness.state)), peer.liveness.changed
+}
+
+func (peer *Peer) resetLiveness() {
+	peer.liveness.Lock()
+	defer peer.liveness.Unlock()
+
+	atomic.StoreInt64(&peer.liveness.lastReceivedNano, 0)
+	atomic.StoreInt64(&peer.liveness.lastProbeNano, 0)
+	atomic.StoreUint32(&peer.liveness.state, uint32(LivenessDown))
+	peer.liveness.changed = time.Now()
+}
+
+func (peer *Peer) setLiveness(state LivenessState) {
+	peer.liveness.Lock()
+	old := LivenessState(atomic.SwapUint32(&peer.liveness.state, uint32(state)))
+	if old != state {
+		peer.liveness.changed = time.Now()
+	}
+	peer.liveness.Unlock()
+
+	if old == state {
+		return
+	}
+
+	peer.device.log.Info.Printf("%v - Liveness changed from %s to %s\n", peer, old, state)
+	peer.device.publishEvent(Event{
+		Type:      EventLiveness,
+		PublicKey: peer.handshake.remoteStatic,
+		Liveness:  state,
+	})
+	peer.scheduleLiveness()
+}
+
+/* Called for every authenticated packet received, keep it cheap
+ */
+func (peer *Peer) livenessReceived() {
+	if !peer.device.liveness.enabled.Get() {
+		return
+	}
+	atomic.StoreInt64(&peer.liveness.lastReceivedNano, time.Now().UnixNano())
+	if LivenessState(atomic.LoadUint32(&peer.liveness.state)) != LivenessUp {
+		peer.setLiveness(LivenessUp)
+	}
+}
+
+/* Called when a handshake with the peer is retried or given up
+ */
+func (peer *Peer) livenessHandshakeFailed(givenUp bool) {
+	if !peer.device.liveness.enabled.Get() {
+		return
+	}
+	switch state := LivenessState(atomic.LoadUint32(&peer.liveness.state)); {
+	case givenUp:
+		peer.setLiveness(LivenessDown)
+	case state == LivenessUp:
+		peer.setLiveness(LivenessDegraded)
+	}
+}
+
+/* Arms the liveness timer for the next threshold or probe
+ */
+func (peer *Peer) scheduleLiveness() {
+	if !peer.timersActive() {
+		return
+	}
+
+	cfg := peer.device.Liveness()
+	if !cfg.enabled() {
+		peer.timers.liveness.Del()
+		return
+	}
+
+	now := time.Now()
+	last := time.Unix(0, atomic.LoadInt64(&peer.liveness.lastReceivedNano))
+
+	var next time.Time
+	consider := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	switch LivenessState(atomic.LoadUint32(&peer.liveness.state)) {
+	case LivenessUp:
+		if cfg.DegradedAfter > 0 {
+			consider(last.Add(cfg.DegradedAfter))
+		} else {
+			consider(last.Add(cfg.DownAfter))
+		}
+	case LivenessDegraded:
+		consider(last.Add(cfg.DownAfter))
+	}
+
+	if cfg.ProbeInterval > 0 {
+		probe := time.Unix(0, atomic.LoadInt64(&peer.liveness.lastProbeNano))
+		if probe.Before(last) {
+			probe = last
+		}
+		consider(probe.Add(cfg.ProbeInterval))
+	}
+
+	if next.IsZero() {
+		peer.timers.liveness.Del()
+		return
+	}
+	wait := next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	peer.timers.liveness.Mod(wait)
+}
+
+func expiredLiveness(peer *Peer) {
+	cfg := peer.device.Liveness()
+	if !cfg.enabled() {
+		return
+	}
+
+	now := time.Now()
+	last := time.Unix(0, atomic.LoadInt64(&peer.liveness.lastReceivedNano))
+	silence := now.Sub(last)
+
+	state := LivenessState(atomic.LoadUint32(&peer.liveness.state))
+	switch {
+	case silence >= cfg.DownAfter:
+		state = LivenessDown
+	case cfg.DegradedAfter > 0 && silence >= cfg.DegradedAfter && state == LivenessUp:
+		state = LivenessDegraded
+	}
+	peer.setLiveness(state)
+
+	if cfg.ProbeInterval > 0 && silence >= cfg.ProbeInterval && peer.timersActive() {
+		probe := time.Unix(0, atomic.LoadInt64(&peer.liveness.lastProbeNano))
+		if now.Sub(probe) >= cfg.ProbeInterval {
+			atomic.StoreInt64(&peer.liveness.lastProbeNano, now.UnixNano())
+			peer.sendLivenessProbe(state)
+		}
+	}
+
+	peer.scheduleLiveness()
+}
+
+func (peer *Peer) sendLivenessProbe(state LivenessState) {
+	if state == LivenessUp {
+		peer.device.log.Debug.Println(peer, "- Sending liveness probe")
+		peer.SendKeepalive()
+		return
+	}
+
+	// a handshake in flight is answer enough, and restarting it would reset
+	// the count of attempts before giving up
+
+	if peer.timers.retransmitHandshake.IsPending() {
+		return
+	}
+	peer.device.log.Debug.Println(peer, "- Sending liveness probe handshake")
+	peer.SendHandshakeInitiation(false)
+}
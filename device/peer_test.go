@@ -39,5 +39,6 @@ func TestPeerAlignment(t *testing.T) {
 	}
 
 	checkAlignment(t, "Peer.stats", unsafe.Offsetof(p.stats))
+	checkAlignment(t, "Peer.liveness", unsafe.Offsetof(p.liveness))
 	checkAlignment(t, "Peer.isRunning", unsafe.Offsetof(p.isRunning))
 }
@@ -35,6 +35,7 @@ type QueueInboundElement struct {
 	packet   []byte
 	counter  uint64
 	keypair  *Keypair
+	peer     *Peer
 	endpoint conn.Endpoint
 }
 
@@ -55,11 +56,14 @@ func (device *Device) addToInboundAndDecryptionQueues(inboundQueue chan *QueueIn
 		case decryptionQueue <- element:
 			return true
 		default:
+			atomic.AddUint64(&device.stats.decryptionDrops, 1)
+			atomic.AddUint64(&element.peer.stats.rxDrops, 1)
 			element.Drop()
 			element.Unlock()
 			return false
 		}
 	default:
+		atomic.AddUint64(&element.peer.stats.rxDrops, 1)
 		device.PutInboundElement(element)
 		return false
 	}
@@ -70,6 +74,7 @@ func (device *Device) addToHandshakeQueue(queue chan QueueHandshakeElement, elem
 	case queue <- element:
 		return true
 	default:
+		atomic.AddUint64(&device.stats.handshakeDrops, 1)
 		return false
 	}
 }
@@ -180,6 +185,7 @@ func (device *Device) RoutineReceiveIncoming(IP int, bind conn.Bind) {
 			elem.packet = packet
 			elem.buffer = buffer
 			elem.keypair = keypair
+			elem.peer = peer
 			elem.dropped = AtomicFalse
 			elem.endpoint = endpoint
 			elem.counter = 0
@@ -281,6 +287,8 @@ func (device *Device) RoutineDecryption() {
 				additionalData[:],
 			)
 			if err != nil {
+				atomic.AddUint64(&device.stats.decryptFailures, 1)
+				atomic.AddUint64(&elem.peer.stats.decryptFailures, 1)
 				elem.Drop()
 				device.PutMessageBuffer(elem.buffer)
 			}
@@ -292,7 +300,6 @@ func (device *Device) RoutineDecryption() {
 /* Handles incoming packets related to handshake
  */
 func (device *Device) RoutineHandshake() {
-	logInfo := device.log.Info
 	logError := device.log.Error
 	logDebug := device.log.Debug
 
@@ -367,6 +374,7 @@ func (device *Device) RoutineHandshake() {
 
 			if !device.cookieChecker.CheckMAC1(elem.packet) {
 				logDebug.Println("Received packet with invalid mac1")
+				device.handshakeRejected(HandshakeMAC1Mismatch, elem.endpoint, nil)
 				continue
 			}
 
@@ -379,6 +387,7 @@ func (device *Device) RoutineHandshake() {
 				// verify MAC2 field
 
 				if !device.cookieChecker.CheckMAC2(elem.packet, elem.endpoint.DstToBytes()) {
+					device.handshakeRejected(HandshakeCookieRequired, elem.endpoint, nil)
 					device.SendHandshakeCookie(&elem)
 					continue
 				}
@@ -386,6 +395,8 @@ func (device *Device) RoutineHandshake() {
 				// check ratelimiter
 
 				if !device.rate.limiter.Allow(elem.endpoint.DstIP()) {
+					atomic.AddUint64(&device.stats.ratelimiterRejects, 1)
+					device.handshakeRejected(HandshakeRateLimited, elem.endpoint, nil)
 					continue
 				}
 			}
@@ -407,16 +418,14 @@ func (device *Device) RoutineHandshake() {
 			err := binary.Read(reader, binary.LittleEndian, &msg)
 			if err != nil {
 				logError.Println("Failed to decode initiation message")
+				device.handshakeRejected(HandshakeMalformed, elem.endpoint, nil)
 				continue
 			}
 
 			// consume initiation
-			peer := device.ConsumeMessageInitiation(&msg)
-			if peer == nil {
-				logInfo.Println(
-					"Received invalid initiation message from",
-					elem.endpoint.DstToString(),
-				)
+			peer, reason := device.consumeMessageInitiation(&msg, &elem)
+			if reason != HandshakeOK {
+				device.handshakeRejected(reason, elem.endpoint, peer)
 				continue
 			}
 
@@ -430,6 +439,8 @@ func (device *Device) RoutineHandshake() {
 
 			logDebug.Println(peer, "- Received handshake initiation")
 			atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)))
+			atomic.AddUint64(&peer.stats.rxPackets, 1)
+			atomic.AddUint64(&peer.stats.handshakeInitiationsReceived, 1)
 
 			peer.SendHandshakeResponse()
 
@@ -442,17 +453,15 @@ func (device *Device) RoutineHandshake() {
 			err := binary.Read(reader, binary.LittleEndian, &msg)
 			if err != nil {
 				logError.Println("Failed to decode response message")
+				device.handshakeRejected(HandshakeMalformed, elem.endpoint, nil)
 				continue
 			}
 
 			// consume response
 
-			peer := device.ConsumeMessageResponse(&msg)
-			if peer == nil {
-				logInfo.Println(
-					"Received invalid response message from",
-					elem.endpoint.DstToString(),
-				)
+			peer, reason := device.consumeMessageResponse(&msg)
+			if reason != HandshakeOK {
+				device.handshakeRejected(reason, elem.endpoint, peer)
 				continue
 			}
 
@@ -461,6 +470,8 @@ func (device *Device) RoutineHandshake() {
 
 			logDebug.Println(peer, "- Received handshake response")
 			atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)))
+			atomic.AddUint64(&peer.stats.rxPackets, 1)
+			peer.measureHandshakeRTT()
 
 			// update timers
 
@@ -541,6 +552,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 		// check for replay
 
 		if !elem.keypair.replayFilter.ValidateCounter(elem.counter, RejectAfterMessages) {
+			atomic.AddUint64(&peer.stats.replayRejects, 1)
 			continue
 		}
 
@@ -560,6 +572,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 		peer.timersAnyAuthenticatedPacketTraversal()
 		peer.timersAnyAuthenticatedPacketReceived()
 		atomic.AddUint64(&peer.stats.rxBytes, uint64(len(elem.packet)+MinMessageSize))
+		atomic.AddUint64(&peer.stats.rxPackets, 1)
 
 		// check for keepalive
 
@@ -592,6 +605,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 
 			src := elem.packet[IPv4offsetSrc : IPv4offsetSrc+net.IPv4len]
 			if device.allowedips.LookupIPv4(src) != peer {
+				atomic.AddUint64(&peer.stats.sourceRejects, 1)
 				logInfo.Println(
 					"IPv4 packet with disallowed source address from",
 					peer,
@@ -620,6 +634,7 @@ func (peer *Peer) RoutineSequentialReceiver() {
 
 			src := elem.packet[IPv6offsetSrc : IPv6offsetSrc+net.IPv6len]
 			if device.allowedips.LookupIPv6(src) != peer {
+				atomic.AddUint64(&peer.stats.sourceRejects, 1)
 				logInfo.Println(
 					"IPv6 packet with disallowed source address from",
 					peer,
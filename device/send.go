@@ -71,7 +71,8 @@ func (elem *QueueOutboundElement) IsDropped() bool {
 	return atomic.LoadInt32(&elem.dropped) == AtomicTrue
 }
 
-func addToNonceQueue(queue chan *QueueOutboundElement, element *QueueOutboundElement, device *Device) {
+func addToNonceQueue(queue chan *QueueOutboundElement, element *QueueOutboundElement, peer *Peer) {
+	device := peer.device
 	for {
 		select {
 		case queue <- element:
@@ -79,6 +80,7 @@ func addToNonceQueue(queue chan *QueueOutboundElement, element *QueueOutboundEle
 		default:
 			select {
 			case old := <-queue:
+				atomic.AddUint64(&peer.stats.txDrops, 1)
 				device.PutMessageBuffer(old.buffer)
 				device.PutOutboundElement(old)
 			default:
@@ -96,11 +98,14 @@ func addToOutboundAndEncryptionQueues(outboundQueue chan *QueueOutboundElement,
 		case encryptionQueue <- element:
 			return
 		default:
+			atomic.AddUint64(&element.peer.device.stats.encryptionDrops, 1)
+			atomic.AddUint64(&element.peer.stats.txDrops, 1)
 			element.Drop()
 			element.peer.device.PutMessageBuffer(element.buffer)
 			element.Unlock()
 		}
 	default:
+		atomic.AddUint64(&element.peer.stats.txDrops, 1)
 		element.peer.device.PutMessageBuffer(element.buffer)
 		element.peer.device.PutOutboundElement(element)
 	}
@@ -147,6 +152,7 @@ func (peer *Peer) SendHandshakeInitiation(isRetry bool) error {
 		return nil
 	}
 	peer.handshake.lastSentHandshake = time.Now()
+	peer.handshake.lastSentInitiation = peer.handshake.lastSentHandshake
 	peer.handshake.mutex.Unlock()
 
 	peer.device.log.Debug.Println(peer, "- Sending handshake initiation")
@@ -166,6 +172,7 @@ func (peer *Peer) SendHandshakeInitiation(isRetry bool) error {
 	peer.timersAnyAuthenticatedPacketTraversal()
 	peer.timersAnyAuthenticatedPacketSent()
 
+	atomic.AddUint64(&peer.stats.handshakeAttempts, 1)
 	err = peer.SendBuffer(packet)
 	if err != nil {
 		peer.device.log.Error.Println(peer, "- Failed to send handshake initiation", err)
@@ -225,7 +232,10 @@ func (device *Device) SendHandshakeCookie(initiatingElem *QueueHandshakeElement)
 	var buff [MessageCookieReplySize]byte
 	writer := bytes.NewBuffer(buff[:0])
 	binary.Write(writer, binary.LittleEndian, reply)
-	device.net.bind.Send(writer.Bytes(), initiatingElem.endpoint)
+	if err := device.net.bind.Send(writer.Bytes(), initiatingElem.endpoint); err != nil {
+		return err
+	}
+	atomic.AddUint64(&device.stats.cookieRepliesSent, 1)
 	return nil
 }
 
@@ -320,7 +330,7 @@ func (device *Device) RoutineReadFromTUN() {
 			if peer.queue.packetInNonceQueueIsAwaitingKey.Get() {
 				peer.SendHandshakeInitiation(false)
 			}
-			addToNonceQueue(peer.queue.nonce, elem, device)
+			addToNonceQueue(peer.queue.nonce, elem, peer)
 			elem = nil
 		}
 		peer.queue.RUnlock()
@@ -0,0 +1,268 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost3410"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+/* Snapshot is the typed counterpart of a get operation, for programs which
+ * embed the device and would otherwise format and parse UAPI text to
+ * inspect it.
+ */
+
+// PeerStats holds the counters of a peer.
+type PeerStats struct {
+	ReceiveBytes               uint64
+	TransmitBytes              uint64
+	ReceivePackets             uint64
+	TransmitPackets            uint64
+	HandshakeAttempts          uint64 // handshake initiations sent
+	PresharedKeyHandshakes     uint64
+	NextPresharedKeyHandshakes uint64
+	LastHandshake              time.Time // zero if there was none
+	KeypairCreated             time.Time // zero without a current keypair
+
+	TransmitDrops                uint64 // packets dropped before encryption, a queue being full
+	ReceiveDrops                 uint64 // packets dropped before decryption, a queue being full
+	DecryptFailures              uint64
+	ReplayRejects                uint64
+	AllowedIPsRejects            uint64 // packets with a source outside the allowed IPs
+	HandshakeInitiationsReceived uint64
+	HandshakeRTT                 time.Duration // zero until a handshake initiated with the peer completes
+}
+
+// Stats returns the counters of the peer.
+func (peer *Peer) Stats() PeerStats {
+	return PeerStats{
+		ReceiveBytes:               atomic.LoadUint64(&peer.stats.rxBytes),
+		TransmitBytes:              atomic.LoadUint64(&peer.stats.txBytes),
+		ReceivePackets:             atomic.LoadUint64(&peer.stats.rxPackets),
+		TransmitPackets:            atomic.LoadUint64(&peer.stats.txPackets),
+		HandshakeAttempts:          atomic.LoadUint64(&peer.stats.handshakeAttempts),
+		PresharedKeyHandshakes:     atomic.LoadUint64(&peer.stats.presharedKeyHandshakes),
+		NextPresharedKeyHandshakes: atomic.LoadUint64(&peer.stats.nextPresharedKeyHandshakes),
+		LastHandshake:              peer.LastHandshake(),
+		KeypairCreated:             peer.keypairCreated(),
+
+		TransmitDrops:                atomic.LoadUint64(&peer.stats.txDrops),
+		ReceiveDrops:                 atomic.LoadUint64(&peer.stats.rxDrops),
+		DecryptFailures:              atomic.LoadUint64(&peer.stats.decryptFailures),
+		ReplayRejects:                atomic.LoadUint64(&peer.stats.replayRejects),
+		AllowedIPsRejects:            atomic.LoadUint64(&peer.stats.sourceRejects),
+		HandshakeInitiationsReceived: atomic.LoadUint64(&peer.stats.handshakeInitiationsReceived),
+		HandshakeRTT:                 time.Duration(atomic.LoadInt64(&peer.stats.handshakeRTTNano)),
+	}
+}
+
+// keypairCreated returns when the current keypair of the peer was derived,
+// or the zero time if it has none.
+func (peer *Peer) keypairCreated() time.Time {
+	keypair := peer.keypairs.Current()
+	if keypair == nil {
+		return time.Time{}
+	}
+	return keypair.created
+}
+
+// LastHandshake returns the time of the last completed handshake with the
+// peer, or the zero time if there was none.
+func (peer *Peer) LastHandshake() time.Time {
+	nano := atomic.LoadInt64(&peer.stats.lastHandshakeNano)
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+// Endpoint returns the current endpoint of the peer, or nil if it has none.
+func (peer *Peer) Endpoint() *net.UDPAddr {
+	peer.RLock()
+	defer peer.RUnlock()
+	return peer.unsafeEndpoint()
+}
+
+/* Must hold peer.RWMutex
+ */
+func (peer *Peer) unsafeEndpoint() *net.UDPAddr {
+	if peer.endpoint == nil {
+		return nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", peer.endpoint.DstToString())
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// Snapshot returns the configuration and the state of the device and of
+// its peers, as reported by a get operation, in the byte order of wgtypes.
+// Peers are sorted by public key.
+func (device *Device) Snapshot() wgtypes.Device {
+	d := wgtypes.Device{
+		Type: wgtypes.Userspace,
+	}
+	if name, err := device.tun.device.Name(); err == nil {
+		d.Name = name
+	}
+
+	var peers []*Peer
+
+	func() {
+		device.ipcMutex.RLock()
+		defer device.ipcMutex.RUnlock()
+
+		device.net.RLock()
+		defer device.net.RUnlock()
+
+		device.staticIdentity.RLock()
+		defer device.staticIdentity.RUnlock()
+
+		device.peers.RLock()
+		defer device.peers.RUnlock()
+
+		if !device.staticIdentity.privateKey.IsZero() {
+			d.PrivateKey = gost3410.Reversed(device.staticIdentity.privateKey[:])
+			d.PublicKey = copyKey(device.staticIdentity.publicKey[:])
+		}
+
+		if device.previousIdentityActive() {
+			d.PreviousPublicKey = copyKey(device.staticIdentity.previous.publicKey[:])
+			d.RolloverExpires = device.staticIdentity.previous.expires
+		}
+
+		d.ListenPort = int(device.net.port)
+		d.FirewallMark = int(device.net.fwmark)
+
+		stats := device.Stats()
+		d.EncryptionQueue = wgtypes.QueueStats{Length: int64(stats.Encryption.Length), Drops: int64(stats.Encryption.Drops)}
+		d.DecryptionQueue = wgtypes.QueueStats{Length: int64(stats.Decryption.Length), Drops: int64(stats.Decryption.Drops)}
+		d.HandshakeQueue = wgtypes.QueueStats{Length: int64(stats.Handshake.Length), Drops: int64(stats.Handshake.Drops)}
+		d.CookieRepliesSent = int64(stats.CookieRepliesSent)
+		d.RatelimiterRejects = int64(stats.RatelimiterRejects)
+		d.DecryptFailures = int64(stats.DecryptFailures)
+		d.UnderLoad = stats.UnderLoad
+		d.HandshakeErrors = snapshotHandshakeErrors(device.HandshakeErrors())
+		for _, source := range device.HandshakeErrorSources() {
+			d.HandshakeErrorSources = append(d.HandshakeErrorSources, wgtypes.HandshakeErrorSource{
+				IP:       source.IP,
+				Reason:   source.Reason.String(),
+				Count:    int64(source.Count),
+				LastSeen: source.LastSeen,
+			})
+		}
+
+		liveness := device.Liveness()
+		if liveness.enabled() {
+			d.LivenessDownAfter = liveness.DownAfter
+			d.LivenessDegradedAfter = liveness.DegradedAfter
+			d.LivenessProbeInterval = liveness.ProbeInterval
+		}
+
+		peers = make([]*Peer, 0, len(device.peers.keyMap))
+		for _, peer := range device.peers.keyMap {
+			peers = append(peers, peer)
+		}
+	}()
+
+	d.Peers = make([]wgtypes.Peer, 0, len(peers))
+	for _, peer := range peers {
+
+		// skip peers removed since the selection
+
+		if device.LookupPeer(peer.handshake.remoteStatic) != peer {
+			continue
+		}
+
+		d.Peers = append(d.Peers, device.snapshotPeer(peer))
+	}
+	sort.Slice(d.Peers, func(i, j int) bool {
+		return bytes.Compare(d.Peers[i].PublicKey, d.Peers[j].PublicKey) < 0
+	})
+
+	return d
+}
+
+func (device *Device) snapshotPeer(peer *Peer) wgtypes.Peer {
+	peer.RLock()
+	defer peer.RUnlock()
+
+	presharedKey, nextPresharedKey, activation := peer.handshake.presharedKeySchedule(time.Now())
+	stats := peer.Stats()
+
+	p := wgtypes.Peer{
+		PublicKey:                    copyKey(peer.handshake.remoteStatic[:]),
+		Name:                         peer.Name(),
+		PresharedKey:                 copyKey(presharedKey[:]),
+		PresharedKeyHandshakes:       int64(stats.PresharedKeyHandshakes),
+		NextPresharedKeyHandshakes:   int64(stats.NextPresharedKeyHandshakes),
+		ExpiresAt:                    peer.ExpiresAt(),
+		Endpoint:                     peer.unsafeEndpoint(),
+		PersistentKeepaliveInterval:  time.Duration(peer.persistentKeepaliveInterval) * time.Second,
+		LastHandshakeTime:            stats.LastHandshake,
+		ReceiveBytes:                 int64(stats.ReceiveBytes),
+		TransmitBytes:                int64(stats.TransmitBytes),
+		ReceivePackets:               int64(stats.ReceivePackets),
+		TransmitPackets:              int64(stats.TransmitPackets),
+		HandshakeAttempts:            int64(stats.HandshakeAttempts),
+		KeypairCreated:               stats.KeypairCreated,
+		TransmitDrops:                int64(stats.TransmitDrops),
+		ReceiveDrops:                 int64(stats.ReceiveDrops),
+		DecryptFailures:              int64(stats.DecryptFailures),
+		ReplayRejects:                int64(stats.ReplayRejects),
+		AllowedIPsRejects:            int64(stats.AllowedIPsRejects),
+		HandshakeInitiationsReceived: int64(stats.HandshakeInitiationsReceived),
+		HandshakeRTT:                 stats.HandshakeRTT,
+		HandshakeErrors:              snapshotHandshakeErrors(peer.HandshakeErrors()),
+		ProtocolVersion:              1,
+	}
+
+	if device.liveness.enabled.Get() {
+		state, changed := peer.Liveness()
+		p.Liveness = wgtypes.ParseLivenessState(state.String())
+		p.LivenessChanged = changed
+	}
+
+	if len(peer.annotations) != 0 {
+		p.Annotations = make(map[string]string, len(peer.annotations))
+		for key, value := range peer.annotations {
+			p.Annotations[key] = value
+		}
+	}
+
+	if !activation.IsZero() {
+		p.NextPresharedKey = copyKey(nextPresharedKey[:])
+		p.NextPresharedKeyActivation = activation
+	}
+
+	p.AllowedIPs = device.allowedips.EntriesForPeer(peer)
+
+	return p
+}
+
+func copyKey(b []byte) wgtypes.Key {
+	return append(wgtypes.Key(nil), b...)
+}
+
+// snapshotHandshakeErrors returns errs keyed by the names of the reasons,
+// or nil if there are none.
+func snapshotHandshakeErrors(errs map[HandshakeError]uint64) map[string]int64 {
+	if len(errs) == 0 {
+		return nil
+	}
+	m := make(map[string]int64, len(errs))
+	for reason, count := range errs {
+		m[reason.String()] = int64(count)
+	}
+	return m
+}
@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/* Device-wide counters, exported by get operations and by the metrics
+ * listener. The work queues are shared by all peers, so a packet dropped
+ * because one of them is full is counted against the device.
+ */
+
+type deviceStats struct {
+	encryptionDrops    uint64 // outbound packets dropped, the encryption queue being full
+	decryptionDrops    uint64 // inbound packets dropped, the decryption queue being full
+	handshakeDrops     uint64 // handshake messages dropped, the handshake queue being full
+	cookieRepliesSent  uint64
+	ratelimiterRejects uint64 // handshake messages refused by the ratelimiter under load
+	decryptFailures    uint64 // transport packets which failed authentication
+	handshakeErrors    [numHandshakeErrors]uint64
+}
+
+// QueueStats holds the state of one of the work queues of the device.
+type QueueStats struct {
+	Length uint64 // elements currently queued
+	Drops  uint64 // elements dropped because the queue was full
+}
+
+// DeviceStats holds the device-wide counters.
+type DeviceStats struct {
+	Encryption         QueueStats
+	Decryption         QueueStats
+	Handshake          QueueStats
+	CookieRepliesSent  uint64
+	RatelimiterRejects uint64
+	DecryptFailures    uint64
+	UnderLoad          bool
+}
+
+// Stats returns the device-wide counters.
+func (device *Device) Stats() DeviceStats {
+	return DeviceStats{
+		Encryption: QueueStats{
+			Length: uint64(len(device.queue.encryption)),
+			Drops:  atomic.LoadUint64(&device.stats.encryptionDrops),
+		},
+		Decryption: QueueStats{
+			Length: uint64(len(device.queue.decryption)),
+			Drops:  atomic.LoadUint64(&device.stats.decryptionDrops),
+		},
+		Handshake: QueueStats{
+			Length: uint64(len(device.queue.handshake)),
+			Drops:  atomic.LoadUint64(&device.stats.handshakeDrops),
+		},
+		CookieRepliesSent:  atomic.LoadUint64(&device.stats.cookieRepliesSent),
+		RatelimiterRejects: atomic.LoadUint64(&device.stats.ratelimiterRejects),
+		DecryptFailures:    atomic.LoadUint64(&device.stats.decryptFailures),
+		UnderLoad:          device.underLoad(),
+	}
+}
+
+/* Reports the load like IsUnderLoad, without extending the period
+ */
+func (device *Device) underLoad() bool {
+	if len(device.queue.handshake) >= UnderLoadQueueSize {
+		return true
+	}
+	until, _ := device.rate.underLoadUntil.Load().(time.Time)
+	return until.After(time.Now())
+}
+
+/* Records the time from the last handshake initiation sent to the peer to the
+ * response just received, which is the round trip of the handshake. Responses
+ * sent to the peer in the meantime do not count.
+ */
+func (peer *Peer) measureHandshakeRTT() {
+	peer.handshake.mutex.RLock()
+	sent := peer.handshake.lastSentInitiation
+	peer.handshake.mutex.RUnlock()
+
+	if sent.IsZero() {
+		return
+	}
+	atomic.StoreInt64(&peer.stats.handshakeRTTNano, int64(time.Since(sent)))
+}
@@ -96,6 +96,9 @@ func expiredRetransmitHandshake(peer *Peer) {
 		if peer.timersActive() && !peer.timers.zeroKeyMaterial.IsPending() {
 			peer.timers.zeroKeyMaterial.Mod(RejectAfterTime * 3)
 		}
+
+		peer.publishEvent(EventHandshakeFailed)
+		peer.livenessHandshakeFailed(true)
 	} else {
 		atomic.AddUint32(&peer.timers.handshakeAttempts, 1)
 		peer.device.log.Debug.Printf("%s - Handshake did not complete after %d seconds, retrying (try %d)\n", peer, int(RekeyTimeout.Seconds()), atomic.LoadUint32(&peer.timers.handshakeAttempts)+1)
@@ -107,6 +110,7 @@ func expiredRetransmitHandshake(peer *Peer) {
 		}
 		peer.Unlock()
 
+		peer.livenessHandshakeFailed(false)
 		peer.SendHandshakeInitiation(true)
 	}
 }
@@ -136,6 +140,7 @@ func expiredNewHandshake(peer *Peer) {
 func expiredZeroKeyMaterial(peer *Peer) {
 	peer.device.log.Debug.Printf("%s - Removing all keys, since we haven't received a new one in %d seconds\n", peer, int((RejectAfterTime * 3).Seconds()))
 	peer.ZeroAndFlushAll()
+	peer.publishEvent(EventKeysZeroed)
 }
 
 func expiredPersistentKeepalive(peer *Peer) {
@@ -174,6 +179,7 @@ func (peer *Peer) timersAnyAuthenticatedPacketReceived() {
 	if peer.timersActive() {
 		peer.timers.newHandshake.Del()
 	}
+	peer.livenessReceived()
 }
 
 /* Should be called after a handshake initiation message is sent. */
@@ -191,6 +197,7 @@ func (peer *Peer) timersHandshakeComplete() {
 	atomic.StoreUint32(&peer.timers.handshakeAttempts, 0)
 	peer.timers.sentLastMinuteHandshake.Set(false)
 	atomic.StoreInt64(&peer.stats.lastHandshakeNano, time.Now().UnixNano())
+	peer.publishEvent(EventHandshake)
 }
 
 /* Should be called after an ephemeral key is created, which is before sending a handshake response or after receiving a handshake response. */
@@ -213,6 +220,7 @@ func (peer *Peer) timersInit() {
 	peer.timers.newHandshake = peer.NewTimer(expiredNewHandshake)
 	peer.timers.zeroKeyMaterial = peer.NewTimer(expiredZeroKeyMaterial)
 	peer.timers.persistentKeepalive = peer.NewTimer(expiredPersistentKeepalive)
+	peer.timers.liveness = peer.NewTimer(expiredLiveness)
 	atomic.StoreUint32(&peer.timers.handshakeAttempts, 0)
 	peer.timers.sentLastMinuteHandshake.Set(false)
 	peer.timers.needAnotherKeepalive.Set(false)
@@ -224,4 +232,5 @@ func (peer *Peer) timersStop() {
 	peer.timers.newHandshake.DelSync()
 	peer.timers.zeroKeyMaterial.DelSync()
 	peer.timers.persistentKeepalive.DelSync()
+	peer.timers.liveness.DelSync()
 }
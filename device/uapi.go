@@ -8,10 +8,14 @@ package device
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -22,27 +26,189 @@ import (
 )
 
 type IPCError struct {
-	int64
+	code int64
+	line int // offending line of a request, 0 if not applicable
+	err  error
+}
+
+func ipcErrorf(code int64, format string, args ...interface{}) *IPCError {
+	return &IPCError{code: code, err: fmt.Errorf(format, args...)}
 }
 
 func (s IPCError) Error() string {
-	return fmt.Sprintf("IPC error: %d", s.int64)
+	if s.line != 0 {
+		return fmt.Sprintf("IPC error %d: line %d: %v", s.code, s.line, s.err)
+	}
+	return fmt.Sprintf("IPC error %d: %v", s.code, s.err)
+}
+
+func (s IPCError) Unwrap() error {
+	return s.err
 }
 
 func (s IPCError) ErrorCode() int64 {
-	return s.int64
+	return s.code
+}
+
+// Line returns the line of a request which was rejected, counting from the
+// first line after set=1 or get=1, or 0 if the error is not tied to a line.
+func (s IPCError) Line() int {
+	return s.line
+}
+
+/* A get request may be followed by filter lines, up to the terminating
+ * empty line:
+ *
+ *   device_only=true           omit all peers
+ *   public_key=<hex>           select a peer, may be repeated
+ *   public_key_prefix=<hex>    select the peers whose key starts with these bytes
+ *   cursor=<hex>               continue after this key, see below
+ *   limit=<n>                  return at most n peers
+ *
+ * With a cursor or a limit the peers are ordered by public key. If a limit
+ * leaves peers out, the response ends with next_cursor=<hex>, which the
+ * client passes as cursor to fetch the following page.
+ *
+ * On the read-only socket the private and preshared keys are left out,
+ * device_public_key=<hex> takes the place of private_key, and redacted=true
+ * tells the keys apart from keys which are not set.
+ *
+ * The response is streamed. Device fields and the selection of peers are
+ * taken at once, but each peer is only locked while its own lines are
+ * gathered, so a large response does not hold up configuration and may
+ * observe a concurrent set peer by peer.
+ */
+
+type ipcGetFilter struct {
+	deviceOnly bool
+	publicKeys map[NoisePublicKey]bool
+	prefix     []byte
+	cursor     *NoisePublicKey
+	limit      int  // 0 = no limit
+	redact     bool // omit secrets, for the read-only socket or on request
+}
+
+func (filter *ipcGetFilter) match(pk NoisePublicKey) bool {
+	if filter.publicKeys != nil && !filter.publicKeys[pk] {
+		return false
+	}
+	if !bytes.HasPrefix(pk[:], filter.prefix) {
+		return false
+	}
+	return filter.cursor == nil || bytes.Compare(pk[:], filter.cursor[:]) > 0
+}
+
+func ipcParseGet(socket *bufio.Reader) (*ipcGetFilter, error) {
+	scanner := bufio.NewScanner(socket)
+	filter := new(ipcGetFilter)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			return filter, nil
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, &IPCError{code: ipc.IpcErrorProtocol, line: n, err: errors.New("not a key=value pair")}
+		}
+		if err := filter.parse(parts[0], parts[1]); err != nil {
+			return nil, &IPCError{code: ipc.IpcErrorInvalid, line: n, err: err}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, ipcErrorf(ipc.IpcErrorIO, "failed to read request: %v", err)
+	}
+
+	return filter, nil
+}
+
+func (filter *ipcGetFilter) parse(key, value string) error {
+	switch key {
+	case "device_only":
+		if value != "true" {
+			return fmt.Errorf("invalid device_only: %q", value)
+		}
+		filter.deviceOnly = true
+
+	case "public_key":
+		var pk NoisePublicKey
+		if err := pk.FromHex(value); err != nil {
+			return fmt.Errorf("invalid public_key: %v", err)
+		}
+		if filter.publicKeys == nil {
+			filter.publicKeys = make(map[NoisePublicKey]bool)
+		}
+		filter.publicKeys[pk] = true
+
+	case "public_key_prefix":
+		prefix, err := hex.DecodeString(value)
+		if err != nil || len(prefix) > NoisePublicKeySize {
+			return fmt.Errorf("invalid public_key_prefix: %q", value)
+		}
+		filter.prefix = prefix
+
+	case "cursor":
+		var pk NoisePublicKey
+		if err := pk.FromHex(value); err != nil {
+			return fmt.Errorf("invalid cursor: %v", err)
+		}
+		filter.cursor = &pk
+
+	case "limit":
+		limit, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid limit: %q", value)
+		}
+		filter.limit = int(limit)
+
+	case "redact":
+		if value != "true" {
+			return fmt.Errorf("invalid redact: %q", value)
+		}
+		filter.redact = true
+
+	default:
+		return fmt.Errorf("invalid get key: %q", key)
+	}
+
+	return nil
 }
 
 func (device *Device) IpcGetOperation(socket *bufio.Writer) error {
-	lines := make([]string, 0, 100)
+	return device.ipcGet(socket, new(ipcGetFilter))
+}
+
+// IpcGetFilteredOperation serves a get request whose filter lines are read
+// from request, up to the terminating empty line.
+func (device *Device) IpcGetFilteredOperation(request *bufio.Reader, socket *bufio.Writer) error {
+	filter, err := ipcParseGet(request)
+	if err != nil {
+		return err
+	}
+	return device.ipcGet(socket, filter)
+}
+
+type ipcGetPeer struct {
+	publicKey NoisePublicKey
+	peer      *Peer
+}
+
+func (device *Device) ipcGet(socket *bufio.Writer, filter *ipcGetFilter) error {
+	lines := make([]string, 0, 32)
 	send := func(line string) {
 		lines = append(lines, line)
 	}
 
+	var peers []ipcGetPeer
+
 	func() {
 
 		// lock required resources
 
+		device.ipcMutex.RLock()
+		defer device.ipcMutex.RUnlock()
+
 		device.net.RLock()
 		defer device.net.RUnlock()
 
@@ -54,7 +220,20 @@ func (device *Device) IpcGetOperation(socket *bufio.Writer) error {
 
 		// serialize device related values
 		if !device.staticIdentity.privateKey.IsZero() {
-			send("private_key=" + device.staticIdentity.privateKey.ToHex())
+			if filter.redact {
+				// stands in for the private key, public_key would start a peer
+				send("device_public_key=" + device.staticIdentity.publicKey.ToHex())
+			} else {
+				send("private_key=" + device.staticIdentity.privateKey.ToHex())
+			}
+		}
+		if filter.redact {
+			send("redacted=true")
+		}
+
+		if device.previousIdentityActive() {
+			send("previous_public_key=" + device.staticIdentity.previous.publicKey.ToHex())
+			send(fmt.Sprintf("rollover_expires=%d", device.staticIdentity.previous.expires.Unix()))
 		}
 
 		if device.net.port != 0 {
@@ -65,343 +244,791 @@ func (device *Device) IpcGetOperation(socket *bufio.Writer) error {
 			send(fmt.Sprintf("fwmark=%d", device.net.fwmark))
 		}
 
-		// serialize each peer state
+		if liveness := device.Liveness(); liveness.enabled() {
+			send(fmt.Sprintf("liveness_degraded_after=%d", liveness.DegradedAfter/time.Second))
+			send(fmt.Sprintf("liveness_down_after=%d", liveness.DownAfter/time.Second))
+			send(fmt.Sprintf("liveness_probe_interval=%d", liveness.ProbeInterval/time.Second))
+		}
 
-		for _, peer := range device.peers.keyMap {
-			peer.RLock()
-			defer peer.RUnlock()
-			send("public_key=" + peer.handshake.remoteStatic.ToHex())
-			send("preshared_key=" + peer.handshake.presharedKey.ToHex())
-			send("protocol_version=1")
-			if peer.endpoint != nil {
-				send("endpoint=" + peer.endpoint.DstToString())
-			}
+		stats := device.Stats()
+		send(fmt.Sprintf("encryption_queue_len=%d", stats.Encryption.Length))
+		send(fmt.Sprintf("encryption_queue_drops=%d", stats.Encryption.Drops))
+		send(fmt.Sprintf("decryption_queue_len=%d", stats.Decryption.Length))
+		send(fmt.Sprintf("decryption_queue_drops=%d", stats.Decryption.Drops))
+		send(fmt.Sprintf("handshake_queue_len=%d", stats.Handshake.Length))
+		send(fmt.Sprintf("handshake_queue_drops=%d", stats.Handshake.Drops))
+		send(fmt.Sprintf("cookie_replies_sent=%d", stats.CookieRepliesSent))
+		send(fmt.Sprintf("ratelimiter_rejects=%d", stats.RatelimiterRejects))
+		send(fmt.Sprintf("decrypt_failures=%d", stats.DecryptFailures))
+		if stats.UnderLoad {
+			send("under_load=true")
+		}
+		ipcGetHandshakeErrors(device.HandshakeErrors(), send)
+		for _, source := range device.HandshakeErrorSources() {
+			send(fmt.Sprintf("handshake_error_source=%s,%s,%d,%d", source.IP, source.Reason, source.Count, source.LastSeen.Unix()))
+		}
 
-			nano := atomic.LoadInt64(&peer.stats.lastHandshakeNano)
-			secs := nano / time.Second.Nanoseconds()
-			nano %= time.Second.Nanoseconds()
+		// select peers
 
-			send(fmt.Sprintf("last_handshake_time_sec=%d", secs))
-			send(fmt.Sprintf("last_handshake_time_nsec=%d", nano))
-			send(fmt.Sprintf("tx_bytes=%d", atomic.LoadUint64(&peer.stats.txBytes)))
-			send(fmt.Sprintf("rx_bytes=%d", atomic.LoadUint64(&peer.stats.rxBytes)))
-			send(fmt.Sprintf("persistent_keepalive_interval=%d", peer.persistentKeepaliveInterval))
+		if filter.deviceOnly {
+			return
+		}
 
-			for _, ip := range device.allowedips.EntriesForPeer(peer) {
-				send("allowed_ip=" + ip.String())
+		if filter.publicKeys != nil {
+			for pk := range filter.publicKeys {
+				if peer, ok := device.peers.keyMap[pk]; ok && filter.match(pk) {
+					peers = append(peers, ipcGetPeer{pk, peer})
+				}
+			}
+		} else {
+			peers = make([]ipcGetPeer, 0, len(device.peers.keyMap))
+			for pk, peer := range device.peers.keyMap {
+				if filter.match(pk) {
+					peers = append(peers, ipcGetPeer{pk, peer})
+				}
 			}
-
 		}
 	}()
 
+	var next *NoisePublicKey
+
+	if filter.cursor != nil || filter.limit != 0 {
+		sort.Slice(peers, func(i, j int) bool {
+			return bytes.Compare(peers[i].publicKey[:], peers[j].publicKey[:]) < 0
+		})
+		if filter.limit != 0 && len(peers) > filter.limit {
+			peers = peers[:filter.limit]
+			next = &peers[len(peers)-1].publicKey
+		}
+	}
+
 	// send lines (does not require resource locks)
 
-	for _, line := range lines {
-		_, err := socket.WriteString(line + "\n")
-		if err != nil {
-			return &IPCError{ipc.IpcErrorIO}
+	flush := func() error {
+		for _, line := range lines {
+			_, err := socket.WriteString(line + "\n")
+			if err != nil {
+				return ipcErrorf(ipc.IpcErrorIO, "failed to write response: %v", err)
+			}
 		}
+		lines = lines[:0]
+		return nil
 	}
 
-	return nil
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, p := range peers {
+
+		// skip peers removed since the selection
+
+		if device.LookupPeer(p.publicKey) != p.peer {
+			continue
+		}
+
+		device.ipcGetPeer(p.peer, filter.redact, send)
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	if next != nil {
+		send("next_cursor=" + next.ToHex())
+	}
+
+	return flush()
+}
+
+/* Sends the non-zero handshake error counters, one line a reason
+ */
+func ipcGetHandshakeErrors(errs map[HandshakeError]uint64, send func(string)) {
+	for reason := HandshakeOK; reason < numHandshakeErrors; reason++ {
+		if count := errs[reason]; count != 0 {
+			send(fmt.Sprintf("handshake_error=%s,%d", reason, count))
+		}
+	}
+}
+
+/* Serializes the state of a peer
+ */
+func (device *Device) ipcGetPeer(peer *Peer, redact bool, send func(string)) {
+	peer.RLock()
+	defer peer.RUnlock()
+
+	presharedKey, nextPresharedKey, activation := peer.handshake.presharedKeySchedule(time.Now())
+	send("public_key=" + peer.handshake.remoteStatic.ToHex())
+	if name := peer.Name(); name != "" {
+		send("name=" + name)
+	}
+	for _, key := range peer.annotationKeys() {
+		send("annotation=" + key + "=" + peer.annotations[key])
+	}
+	if !redact {
+		send("preshared_key=" + presharedKey.ToHex())
+	}
+	if !activation.IsZero() {
+		if !redact {
+			send("next_preshared_key=" + nextPresharedKey.ToHex())
+		}
+		send(fmt.Sprintf("next_preshared_key_activation=%d", activation.Unix()))
+	}
+	if expiresAt := peer.ExpiresAt(); !expiresAt.IsZero() {
+		send(fmt.Sprintf("expires_at=%d", expiresAt.Unix()))
+	}
+	send("protocol_version=1")
+	if peer.endpoint != nil {
+		send("endpoint=" + peer.endpoint.DstToString())
+	}
+
+	nano := atomic.LoadInt64(&peer.stats.lastHandshakeNano)
+	secs := nano / time.Second.Nanoseconds()
+	nano %= time.Second.Nanoseconds()
+
+	send(fmt.Sprintf("last_handshake_time_sec=%d", secs))
+	send(fmt.Sprintf("last_handshake_time_nsec=%d", nano))
+	send(fmt.Sprintf("tx_bytes=%d", atomic.LoadUint64(&peer.stats.txBytes)))
+	send(fmt.Sprintf("rx_bytes=%d", atomic.LoadUint64(&peer.stats.rxBytes)))
+	send(fmt.Sprintf("tx_packets=%d", atomic.LoadUint64(&peer.stats.txPackets)))
+	send(fmt.Sprintf("rx_packets=%d", atomic.LoadUint64(&peer.stats.rxPackets)))
+	send(fmt.Sprintf("handshake_attempts=%d", atomic.LoadUint64(&peer.stats.handshakeAttempts)))
+	if created := peer.keypairCreated(); !created.IsZero() {
+		send(fmt.Sprintf("keypair_created=%d", created.Unix()))
+	}
+	send(fmt.Sprintf("tx_drops=%d", atomic.LoadUint64(&peer.stats.txDrops)))
+	send(fmt.Sprintf("rx_drops=%d", atomic.LoadUint64(&peer.stats.rxDrops)))
+	send(fmt.Sprintf("decrypt_failures=%d", atomic.LoadUint64(&peer.stats.decryptFailures)))
+	send(fmt.Sprintf("replay_rejects=%d", atomic.LoadUint64(&peer.stats.replayRejects)))
+	send(fmt.Sprintf("allowed_ips_rejects=%d", atomic.LoadUint64(&peer.stats.sourceRejects)))
+	send(fmt.Sprintf("handshake_initiations_received=%d", atomic.LoadUint64(&peer.stats.handshakeInitiationsReceived)))
+	if rtt := atomic.LoadInt64(&peer.stats.handshakeRTTNano); rtt != 0 {
+		send(fmt.Sprintf("handshake_rtt_nsec=%d", rtt))
+	}
+	ipcGetHandshakeErrors(peer.HandshakeErrors(), send)
+	send(fmt.Sprintf("preshared_key_handshakes=%d", atomic.LoadUint64(&peer.stats.presharedKeyHandshakes)))
+	send(fmt.Sprintf("next_preshared_key_handshakes=%d", atomic.LoadUint64(&peer.stats.nextPresharedKeyHandshakes)))
+	send(fmt.Sprintf("persistent_keepalive_interval=%d", peer.persistentKeepaliveInterval))
+	if device.liveness.enabled.Get() {
+		state, changed := peer.Liveness()
+		send("liveness=" + state.String())
+		send(fmt.Sprintf("liveness_changed=%d", changed.Unix()))
+	}
+
+	for _, ip := range device.allowedips.EntriesForPeer(peer) {
+		send("allowed_ip=" + ip.String())
+	}
+}
+
+/* A set request is parsed and validated in full before anything is
+ * applied, so that a bad line does not leave the device half-configured.
+ * It is then applied while holding device.ipcMutex, which keeps other UAPI
+ * operations from observing or interleaving with a partial update, and the
+ * authorizer installation lock, which keeps the peer count stable.
+ *
+ * The only steps which can still fail while applying are binding the new
+ * listen port and setting the fwmark. They are applied first and are
+ * rolled back on failure, before anything else has changed.
+ */
+
+type ipcSetConfig struct {
+	privateKey       *NoisePrivateKey
+	privateKeyWindow time.Duration // rollover window preceding private_key
+	rolloverWindow   *time.Duration
+	listenPort       *uint16
+	listenPortLine   int
+	fwmark           *uint32
+	fwmarkLine       int
+	liveness         [3]*time.Duration // degraded after, down after, probe interval
+	livenessLine     int
+	replacePeers     bool
+	peers            []*ipcPeerConfig // in request order, keys may repeat
+}
+
+type ipcPeerConfig struct {
+	line                       int // line of public_key
+	publicKey                  NoisePublicKey
+	updateOnly                 bool
+	remove                     bool
+	name                       *string
+	replaceAnnotations         bool
+	annotations                [][2]string // key, value (empty = remove)
+	presharedKey               *AEADSymmetricKey
+	nextPresharedKey           *AEADSymmetricKey // activated now unless an activation follows
+	nextPresharedKeyActivation *time.Time        // zero cancels the schedule
+	expiresAt                  *time.Time        // zero cancels the expiry
+	endpoint                   conn.Endpoint
+	persistentKeepalive        *uint16
+	replaceAllowedIPs          bool
+	allowedIPs                 []net.IPNet
 }
 
 func (device *Device) IpcSetOperation(socket *bufio.Reader) error {
-	scanner := bufio.NewScanner(socket)
-	logError := device.log.Error
-	logDebug := device.log.Debug
+	cfg, err := ipcParseSet(socket)
+	if err != nil {
+		return err
+	}
+	return device.ipcSet(cfg)
+}
+
+/* Applies a validated set request as a whole
+ */
+func (device *Device) ipcSet(cfg *ipcSetConfig) error {
+	device.ipcMutex.Lock()
+	defer device.ipcMutex.Unlock()
+
+	device.authorizer.install.Lock()
+	defer device.authorizer.install.Unlock()
 
-	var peer *Peer
+	if err := device.ipcCheckSet(cfg); err != nil {
+		return err
+	}
+
+	if err := device.ipcApplyBind(cfg); err != nil {
+		return err
+	}
+
+	if err := device.ipcApplyIdentity(cfg); err != nil {
+		return err
+	}
 
-	dummy := false
-	createdNewPeer := false
-	deviceConfig := true
+	for _, peer := range cfg.peers {
+		if err := device.ipcApplyPeer(peer); err != nil {
+			return err
+		}
+	}
 
-	for scanner.Scan() {
+	return nil
+}
+
+/* Reads a set request up to the terminating empty line or the end of the
+ * input.
+ */
+func ipcParseSet(socket *bufio.Reader) (*ipcSetConfig, error) {
+	scanner := bufio.NewScanner(socket)
+	cfg := new(ipcSetConfig)
+
+	var peer *ipcPeerConfig
+
+	for n := 1; scanner.Scan(); n++ {
 
 		// parse line
 
 		line := scanner.Text()
 		if line == "" {
-			return nil
+			return cfg, nil
 		}
-		parts := strings.Split(line, "=")
+		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			return &IPCError{ipc.IpcErrorProtocol}
+			return nil, &IPCError{code: ipc.IpcErrorProtocol, line: n, err: errors.New("not a key=value pair")}
 		}
 		key := parts[0]
 		value := parts[1]
 
-		/* device configuration */
+		var err error
+		switch {
+		case key == "public_key":
+			// switch to the configuration of a peer
+			peer = &ipcPeerConfig{line: n}
+			cfg.peers = append(cfg.peers, peer)
+			if err = peer.publicKey.FromHex(value); err != nil {
+				err = fmt.Errorf("invalid public_key: %v", err)
+			}
+		case peer == nil:
+			err = cfg.parse(key, value, n)
+		default:
+			err = peer.parse(key, value)
+		}
 
-		if deviceConfig {
+		if err != nil {
+			return nil, &IPCError{code: ipc.IpcErrorInvalid, line: n, err: err}
+		}
+	}
 
-			switch key {
-			case "private_key":
-				var sk NoisePrivateKey
-				err := sk.FromMaybeZeroHex(value)
-				if err != nil {
-					logError.Println("Failed to decode private_key:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
-				logDebug.Println("UAPI: Updating private key")
-				err = device.SetPrivateKey(sk)
-				if err != nil {
-					logDebug.Println("Failed to set private key :", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	if err := scanner.Err(); err != nil {
+		return nil, ipcErrorf(ipc.IpcErrorIO, "failed to read request: %v", err)
+	}
 
-			case "listen_port":
+	return cfg, nil
+}
 
-				// parse port number
+func (cfg *ipcSetConfig) parse(key, value string, line int) error {
+	switch key {
+	case "private_key":
+		var sk NoisePrivateKey
+		if err := sk.FromMaybeZeroHex(value); err != nil {
+			return fmt.Errorf("invalid private_key: %v", err)
+		}
+		cfg.privateKey = &sk
 
-				port, err := strconv.ParseUint(value, 10, 16)
-				if err != nil {
-					logError.Println("Failed to parse listen_port:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+		// a rollover window applies to a following private_key
+		if cfg.rolloverWindow != nil {
+			cfg.privateKeyWindow = *cfg.rolloverWindow
+		}
 
-				// update port and rebind
+	case "rollover_window":
+		secs, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid rollover_window: %q", value)
+		}
+		window := time.Duration(secs) * time.Second
+		cfg.rolloverWindow = &window
 
-				logDebug.Println("UAPI: Updating listen port")
+	case "listen_port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid listen_port: %q", value)
+		}
+		p := uint16(port)
+		cfg.listenPort, cfg.listenPortLine = &p, line
+
+	case "fwmark":
+		var fwmark uint32
+		if value != "" {
+			mark, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid fwmark: %q", value)
+			}
+			fwmark = uint32(mark)
+		}
+		cfg.fwmark, cfg.fwmarkLine = &fwmark, line
 
-				device.net.Lock()
-				device.net.port = uint16(port)
-				device.net.Unlock()
+	case "liveness_degraded_after", "liveness_down_after", "liveness_probe_interval":
+		secs, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q", key, value)
+		}
+		d := time.Duration(secs) * time.Second
+		switch key {
+		case "liveness_degraded_after":
+			cfg.liveness[0] = &d
+		case "liveness_down_after":
+			cfg.liveness[1] = &d
+		default:
+			cfg.liveness[2] = &d
+		}
+		cfg.livenessLine = line
 
-				if err := device.BindUpdate(); err != nil {
-					logError.Println("Failed to set listen_port:", err)
-					return &IPCError{ipc.IpcErrorPortInUse}
-				}
+	case "replace_peers":
+		if value != "true" {
+			return fmt.Errorf("invalid replace_peers: %q", value)
+		}
+		cfg.replacePeers = true
 
-			case "fwmark":
+	default:
+		return fmt.Errorf("invalid device key: %q", key)
+	}
 
-				// parse fwmark field
+	return nil
+}
 
-				fwmark, err := func() (uint32, error) {
-					if value == "" {
-						return 0, nil
-					}
-					mark, err := strconv.ParseUint(value, 10, 32)
-					return uint32(mark), err
-				}()
+func (peer *ipcPeerConfig) parse(key, value string) error {
+	switch key {
+	case "update_only":
+		if value != "true" {
+			return fmt.Errorf("invalid update_only: %q", value)
+		}
+		peer.updateOnly = true
 
-				if err != nil {
-					logError.Println("Invalid fwmark", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	case "remove":
+		if value != "true" {
+			return fmt.Errorf("invalid remove: %q", value)
+		}
+		peer.remove = true
 
-				logDebug.Println("UAPI: Updating fwmark")
+	case "name":
+		if err := validLabel(value, MaxPeerNameLength); err != nil {
+			return fmt.Errorf("invalid name: %v", err)
+		}
+		peer.name = &value
 
-				if err := device.BindSetMark(fwmark); err != nil {
-					logError.Println("Failed to update fwmark:", err)
-					return &IPCError{ipc.IpcErrorPortInUse}
-				}
+	case "replace_annotations":
+		if value != "true" {
+			return fmt.Errorf("invalid replace_annotations: %q", value)
+		}
+		peer.replaceAnnotations = true
+		peer.annotations = nil
 
-			case "public_key":
-				// switch to peer configuration
-				logDebug.Println("UAPI: Transition to peer configuration")
-				deviceConfig = false
+	case "annotation":
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("annotation without a value: %q", value)
+		}
+		if err := validAnnotation(parts[0], parts[1]); err != nil {
+			return fmt.Errorf("invalid annotation: %v", err)
+		}
+		peer.annotations = append(peer.annotations, [2]string{parts[0], parts[1]})
 
-			case "replace_peers":
-				if value != "true" {
-					logError.Println("Failed to set replace_peers, invalid value:", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
-				logDebug.Println("UAPI: Removing all peers")
-				device.RemoveAllPeers()
+	case "preshared_key":
+		var psk AEADSymmetricKey
+		if err := psk.FromHex(value); err != nil {
+			return fmt.Errorf("invalid preshared_key: %v", err)
+		}
+		peer.presharedKey = &psk
 
-			default:
-				logError.Println("Invalid UAPI device key:", key)
-				return &IPCError{ipc.IpcErrorInvalid}
-			}
+	case "next_preshared_key":
+		var psk AEADSymmetricKey
+		if err := psk.FromHex(value); err != nil {
+			return fmt.Errorf("invalid next_preshared_key: %v", err)
 		}
+		peer.nextPresharedKey = &psk
+		peer.nextPresharedKeyActivation = nil
 
-		/* peer configuration */
+	case "next_preshared_key_activation":
+		at, err := parseUnixTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid next_preshared_key_activation: %q", value)
+		}
+		peer.nextPresharedKeyActivation = &at
 
-		if !deviceConfig {
+	case "expires_at":
+		at, err := parseUnixTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid expires_at: %q", value)
+		}
+		peer.expiresAt = &at
 
-			switch key {
+	case "endpoint":
+		endpoint, err := conn.CreateEndpoint(value)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %v", value, err)
+		}
+		peer.endpoint = endpoint
 
-			case "public_key":
-				var publicKey NoisePublicKey
-				err := publicKey.FromHex(value)
-				if err != nil {
-					logError.Println("Failed to get peer by public key:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	case "persistent_keepalive_interval":
+		secs, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid persistent_keepalive_interval: %q", value)
+		}
+		interval := uint16(secs)
+		peer.persistentKeepalive = &interval
 
-				// ignore peer with public key of device
+	case "replace_allowed_ips":
+		if value != "true" {
+			return fmt.Errorf("invalid replace_allowed_ips: %q", value)
+		}
+		peer.replaceAllowedIPs = true
+		peer.allowedIPs = nil
 
-				device.staticIdentity.RLock()
-				dummy = device.staticIdentity.publicKey.Equals(publicKey)
-				device.staticIdentity.RUnlock()
+	case "allowed_ip":
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid allowed_ip: %q", value)
+		}
+		peer.allowedIPs = append(peer.allowedIPs, *network)
 
-				if dummy {
-					peer = &Peer{}
-				} else {
-					peer = device.LookupPeer(publicKey)
-				}
+	case "protocol_version":
+		if value != "1" {
+			return fmt.Errorf("invalid protocol_version: %q", value)
+		}
 
-				createdNewPeer = peer == nil
-				if createdNewPeer {
-					peer, err = device.NewPeer(publicKey)
-					if err != nil {
-						logError.Println("Failed to create new peer:", err)
-						return &IPCError{ipc.IpcErrorInvalid}
-					}
-					if peer == nil {
-						dummy = true
-						peer = &Peer{}
-					} else {
-						logDebug.Println(peer, "- UAPI: Created")
-					}
-				}
+	default:
+		return fmt.Errorf("invalid peer key: %q", key)
+	}
 
-			case "update_only":
+	return nil
+}
 
-				// allow disabling of creation
+/* Parses UNIX seconds, where zero stands for the zero time.
+ */
+func parseUnixTime(value string) (time.Time, error) {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, errors.New("invalid time")
+	}
+	if secs == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(secs, 0), nil
+}
 
-				if value != "true" {
-					logError.Println("Failed to set update only, invalid value:", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
-				if createdNewPeer && !dummy {
-					device.RemovePeer(peer.handshake.remoteStatic)
-					peer = &Peer{}
-					dummy = true
-				}
+func (peer *ipcPeerConfig) expired(now time.Time) bool {
+	return peer.expiresAt != nil && !peer.expiresAt.IsZero() && !now.Before(*peer.expiresAt)
+}
 
-			case "remove":
+/* Merges the liveness thresholds of the request into the current ones
+ */
+func (cfg *ipcSetConfig) livenessConfig(current LivenessConfig) LivenessConfig {
+	for i, d := range []*time.Duration{&current.DegradedAfter, &current.DownAfter, &current.ProbeInterval} {
+		if cfg.liveness[i] != nil {
+			*d = *cfg.liveness[i]
+		}
+	}
+	return current
+}
 
-				// remove currently selected peer from device
+func (cfg *ipcSetConfig) setsLiveness() bool {
+	return cfg.liveness != [3]*time.Duration{}
+}
 
-				if value != "true" {
-					logError.Println("Failed to set remove, invalid value:", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
-				if !dummy {
-					logDebug.Println(peer, "- UAPI: Removing")
-					device.RemovePeer(peer.handshake.remoteStatic)
-				}
-				peer = &Peer{}
-				dummy = true
+/* Checks the request against the state of the device: the peers it leaves
+ * configured must not exceed MaxPeers, and the liveness thresholds must
+ * remain consistent.
+ *
+ * Must hold device.ipcMutex and device.authorizer.install
+ */
+func (device *Device) ipcCheckSet(cfg *ipcSetConfig) error {
+	if cfg.setsLiveness() {
+		if err := cfg.livenessConfig(device.Liveness()).check(); err != nil {
+			return &IPCError{code: ipc.IpcErrorInvalid, line: cfg.livenessLine, err: err}
+		}
+	}
 
-			case "preshared_key":
+	device.staticIdentity.RLock()
+	own := device.staticIdentity.publicKey
+	device.staticIdentity.RUnlock()
+	if cfg.privateKey != nil {
+		own = cfg.privateKey.PublicKey()
+	}
 
-				// update PSK
+	present := make(map[NoisePublicKey]bool)
+	if !cfg.replacePeers {
+		device.peers.RLock()
+		for pk := range device.peers.keyMap {
+			present[pk] = true
+		}
+		device.peers.RUnlock()
+	}
+	delete(present, own)
+
+	now := time.Now()
+	for _, peer := range cfg.peers {
+		switch {
+		case peer.publicKey.Equals(own):
+		case peer.remove || peer.expired(now):
+			delete(present, peer.publicKey)
+		case !present[peer.publicKey] && !peer.updateOnly:
+			present[peer.publicKey] = true
+			if len(present) > MaxPeers {
+				return &IPCError{code: ipc.IpcErrorInvalid, line: peer.line, err: errors.New("too many peers")}
+			}
+		}
+	}
 
-				logDebug.Println(peer, "- UAPI: Updating preshared key")
+	return nil
+}
 
-				peer.handshake.mutex.Lock()
-				err := peer.handshake.presharedKey.FromHex(value)
-				peer.handshake.mutex.Unlock()
+/* Must hold device.ipcMutex
+ */
+func (device *Device) ipcApplyBind(cfg *ipcSetConfig) error {
+	if cfg.listenPort == nil && cfg.fwmark == nil {
+		return nil
+	}
 
-				if err != nil {
-					logError.Println("Failed to set preshared key:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	logDebug := device.log.Debug
 
-			case "endpoint":
+	device.net.RLock()
+	port, fwmark := device.net.port, device.net.fwmark
+	device.net.RUnlock()
 
-				// set endpoint destination
+	// puts back the previous bind, should the new one fail
 
-				logDebug.Println(peer, "- UAPI: Updating endpoint")
+	restore := func() {
+		device.net.Lock()
+		device.net.port = port
+		device.net.fwmark = fwmark
+		device.net.Unlock()
 
-				err := func() error {
-					peer.Lock()
-					defer peer.Unlock()
-					endpoint, err := conn.CreateEndpoint(value)
-					if err != nil {
-						return err
-					}
-					peer.endpoint = endpoint
-					return nil
-				}()
+		if err := device.BindUpdate(); err != nil {
+			device.log.Error.Println("Failed to restore UDP bind:", err)
+		}
+	}
 
-				if err != nil {
-					logError.Println("Failed to set endpoint:", err, ":", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	if cfg.listenPort != nil {
+		logDebug.Println("UAPI: Updating listen port")
+
+		device.net.Lock()
+		device.net.port = *cfg.listenPort
+		device.net.Unlock()
+
+		if err := device.BindUpdate(); err != nil {
+			restore()
+			return &IPCError{code: ipc.IpcErrorPortInUse, line: cfg.listenPortLine, err: fmt.Errorf("failed to set listen_port: %v", err)}
+		}
+	}
 
-			case "persistent_keepalive_interval":
+	if cfg.fwmark != nil {
+		logDebug.Println("UAPI: Updating fwmark")
 
-				// update persistent keepalive interval
+		if err := device.BindSetMark(*cfg.fwmark); err != nil {
+			restore()
+			return &IPCError{code: ipc.IpcErrorPortInUse, line: cfg.fwmarkLine, err: fmt.Errorf("failed to set fwmark: %v", err)}
+		}
+	}
 
-				logDebug.Println(peer, "- UAPI: Updating persistent keepalive interval")
+	return nil
+}
 
-				secs, err := strconv.ParseUint(value, 10, 16)
-				if err != nil {
-					logError.Println("Failed to set persistent keepalive interval:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+/* Must hold device.ipcMutex
+ */
+func (device *Device) ipcApplyIdentity(cfg *ipcSetConfig) error {
+	logDebug := device.log.Debug
 
-				old := peer.persistentKeepaliveInterval
-				peer.persistentKeepaliveInterval = uint16(secs)
+	if cfg.rolloverWindow != nil {
+		// adjusts an ongoing rollover
+		logDebug.Println("UAPI: Updating rollover window")
+		device.SetRolloverWindow(*cfg.rolloverWindow)
+	}
 
-				// send immediate keepalive if we're turning it on and before it wasn't on
+	if cfg.privateKey != nil {
+		logDebug.Println("UAPI: Updating private key")
+		if err := device.SetPrivateKeyWithRollover(*cfg.privateKey, cfg.privateKeyWindow); err != nil {
+			return ipcErrorf(ipc.IpcErrorInvalid, "failed to set private key: %v", err)
+		}
+	}
 
-				// TODO: err is always nil
-				if old == 0 && secs != 0 {
-					if err != nil {
-						logError.Println("Failed to get tun device status:", err)
-						return &IPCError{ipc.IpcErrorIO}
-					}
-					if device.isUp.Get() && !dummy {
-						peer.SendKeepalive()
-					}
-				}
+	if cfg.setsLiveness() {
+		// validated by ipcCheckSet
+		logDebug.Println("UAPI: Updating liveness thresholds")
+		device.SetLiveness(cfg.livenessConfig(device.Liveness()))
+	}
 
-			case "replace_allowed_ips":
+	if cfg.replacePeers {
+		logDebug.Println("UAPI: Removing all peers")
+		device.RemoveAllPeers()
+	}
 
-				logDebug.Println(peer, "- UAPI: Removing all allowedips")
+	return nil
+}
 
-				if value != "true" {
-					logError.Println("Failed to replace allowedips, invalid value:", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+/* Must hold device.ipcMutex and device.authorizer.install
+ */
+func (device *Device) ipcApplyPeer(cfg *ipcPeerConfig) error {
+	logDebug := device.log.Debug
 
-				if dummy {
-					continue
-				}
+	// ignore peer with public key of device
 
-				device.allowedips.RemoveByPeer(peer)
+	device.staticIdentity.RLock()
+	own := device.staticIdentity.publicKey.Equals(cfg.publicKey)
+	device.staticIdentity.RUnlock()
 
-			case "allowed_ip":
+	if own {
+		return nil
+	}
 
-				logDebug.Println(peer, "- UAPI: Adding allowedip")
+	peer := device.LookupPeer(cfg.publicKey)
 
-				_, network, err := net.ParseCIDR(value)
-				if err != nil {
-					logError.Println("Failed to set allowed ip:", err)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	switch {
+	case cfg.remove:
+		if peer != nil {
+			logDebug.Println(peer, "- UAPI: Removing")
+			device.RemovePeer(cfg.publicKey)
+		}
+		return nil
 
-				if dummy {
-					continue
-				}
+	case cfg.expired(time.Now()):
+		if peer != nil {
+			peer.removeExpired(*cfg.expiresAt)
+		}
+		return nil
 
-				ones, _ := network.Mask.Size()
-				device.allowedips.Insert(network.IP, uint(ones), peer)
+	case peer == nil && cfg.updateOnly:
+		return nil
 
-			case "protocol_version":
+	case peer == nil:
+		var err error
+		peer, err = device.NewPeer(cfg.publicKey)
+		if err != nil {
+			return &IPCError{code: ipc.IpcErrorInvalid, line: cfg.line, err: fmt.Errorf("failed to create peer: %v", err)}
+		}
+		logDebug.Println(peer, "- UAPI: Created")
+	}
 
-				if value != "1" {
-					logError.Println("Invalid protocol version:", value)
-					return &IPCError{ipc.IpcErrorInvalid}
-				}
+	// validated while parsing, setting labels cannot fail
 
-			default:
-				logError.Println("Invalid UAPI peer key:", key)
-				return &IPCError{ipc.IpcErrorInvalid}
+	if cfg.name != nil {
+		logDebug.Println(peer, "- UAPI: Updating name")
+		peer.SetName(*cfg.name)
+	}
+
+	if cfg.replaceAnnotations {
+		logDebug.Println(peer, "- UAPI: Removing all annotations")
+		peer.Lock()
+		peer.annotations = nil
+		peer.Unlock()
+	}
+
+	for _, annotation := range cfg.annotations {
+		logDebug.Println(peer, "- UAPI: Updating annotation")
+		peer.SetAnnotation(annotation[0], annotation[1])
+	}
+
+	if cfg.presharedKey != nil {
+		logDebug.Println(peer, "- UAPI: Updating preshared key")
+		peer.handshake.mutex.Lock()
+		peer.handshake.presharedKey = *cfg.presharedKey
+		peer.handshake.mutex.Unlock()
+	}
+
+	if cfg.nextPresharedKey != nil || cfg.nextPresharedKeyActivation != nil {
+		logDebug.Println(peer, "- UAPI: Scheduling next preshared key")
+		handshake := &peer.handshake
+		handshake.mutex.Lock()
+		if cfg.nextPresharedKey != nil {
+			handshake.nextPresharedKey = *cfg.nextPresharedKey
+			handshake.nextPresharedKeyActivation = time.Now()
+		}
+		if at := cfg.nextPresharedKeyActivation; at != nil {
+			if at.IsZero() {
+				setZero(handshake.nextPresharedKey[:])
 			}
+			handshake.nextPresharedKeyActivation = *at
 		}
+		handshake.mutex.Unlock()
+	}
+
+	if cfg.expiresAt != nil {
+		logDebug.Println(peer, "- UAPI: Updating expiry")
+		peer.SetExpiry(*cfg.expiresAt)
+	}
+
+	if cfg.endpoint != nil {
+		logDebug.Println(peer, "- UAPI: Updating endpoint")
+		peer.Lock()
+		peer.endpoint = cfg.endpoint
+		peer.Unlock()
+	}
+
+	if cfg.persistentKeepalive != nil {
+		logDebug.Println(peer, "- UAPI: Updating persistent keepalive interval")
+
+		peer.Lock()
+		old := peer.persistentKeepaliveInterval
+		peer.persistentKeepaliveInterval = *cfg.persistentKeepalive
+		peer.Unlock()
+
+		// send immediate keepalive if we're turning it on and before it wasn't on
+
+		if old == 0 && *cfg.persistentKeepalive != 0 && device.isUp.Get() {
+			peer.SendKeepalive()
+		}
+	}
+
+	if cfg.replaceAllowedIPs {
+		logDebug.Println(peer, "- UAPI: Removing all allowedips")
+		device.allowedips.RemoveByPeer(peer)
+	}
+
+	for _, network := range cfg.allowedIPs {
+		logDebug.Println(peer, "- UAPI: Adding allowedip")
+		ones, _ := network.Mask.Size()
+		device.allowedips.Insert(network.IP, uint(ones), peer)
 	}
 
 	return nil
 }
 
+// IpcHandle serves a UAPI connection.
 func (device *Device) IpcHandle(socket net.Conn) {
+	device.ipcHandle(socket, false)
+}
+
+// IpcHandleReadOnly serves a connection to the read-only UAPI socket, which
+// refuses set and redacts the private and preshared keys from get.
+func (device *Device) IpcHandleReadOnly(socket net.Conn) {
+	device.ipcHandle(socket, true)
+}
+
+func (device *Device) ipcHandle(socket net.Conn, readOnly bool) {
 
 	// create buffered read/writer
 
@@ -420,27 +1047,82 @@ func (device *Device) IpcHandle(socket net.Conn) {
 		return
 	}
 
+	// identify the caller
+
+	caller := "unknown caller"
+	cred, err := ipc.PeerCredentials(socket)
+	if err == nil {
+		caller = cred.String()
+	}
+	policy := device.getIpcPolicy()
+
 	// handle operation
 
 	var status *IPCError
 
 	switch op {
 	case "set=1\n":
-		err = device.IpcSetOperation(buffered.Reader)
-		if err != nil && !errors.As(err, &status) {
-			// should never happen
-			device.log.Error.Println("Invalid UAPI error:", err)
-			status = &IPCError{1}
+		switch {
+		case readOnly:
+			status = ipcErrorf(ipc.IpcErrorAccess, "set on the read-only socket by %s", caller)
+		case !policy.Set.allows(cred):
+			status = ipcErrorf(ipc.IpcErrorAccess, "set not permitted for %s", caller)
+		default:
+			err = device.IpcSetOperation(buffered.Reader)
+			if err != nil && !errors.As(err, &status) {
+				// should never happen
+				device.log.Error.Println("Invalid UAPI error:", err)
+				status = ipcErrorf(1, "%v", err)
+			}
+		}
+
+		// audit every attempt to change the configuration
+
+		if status != nil {
+			device.log.Info.Printf("UAPI: set by %s rejected: %v\n", caller, status.err)
+		} else {
+			device.log.Info.Printf("UAPI: set by %s applied\n", caller)
 		}
 
 	case "get=1\n":
-		err = device.IpcGetOperation(buffered.Writer)
+		if !policy.Get.allows(cred) {
+			status = ipcErrorf(ipc.IpcErrorAccess, "get not permitted for %s", caller)
+			break
+		}
+
+		var filter *ipcGetFilter
+		filter, err = ipcParseGet(buffered.Reader)
+		if err == nil {
+			filter.redact = filter.redact || readOnly
+			err = device.ipcGet(buffered.Writer, filter)
+		}
 		if err != nil && !errors.As(err, &status) {
 			// should never happen
 			device.log.Error.Println("Invalid UAPI error:", err)
-			status = &IPCError{1}
+			status = ipcErrorf(1, "%v", err)
 		}
 
+	case "watch=1\n":
+		if !policy.Get.allows(cred) {
+			status = ipcErrorf(ipc.IpcErrorAccess, "watch not permitted for %s", caller)
+			break
+		}
+		if err = ipcParseWatch(buffered.Reader); err != nil {
+			errors.As(err, &status)
+			break
+		}
+
+		// the watcher ends the stream by closing the connection
+
+		stop := make(chan struct{})
+		go func() {
+			defer close(stop)
+			buffered.Reader.WriteTo(ioutil.Discard)
+		}()
+
+		device.IpcWatchOperation(buffered.Writer, stop)
+		return
+
 	default:
 		device.log.Error.Println("Invalid UAPI operation:", op)
 		return
@@ -450,6 +1132,12 @@ func (device *Device) IpcHandle(socket net.Conn) {
 
 	if status != nil {
 		device.log.Error.Println(status)
+
+		// name the offending line of the request; wg(8) ignores both keys
+		if status.line != 0 {
+			fmt.Fprintf(buffered, "line=%d\n", status.line)
+		}
+		fmt.Fprintf(buffered, "message=%s\n", strings.Replace(status.err.Error(), "\n", " ", -1))
 		fmt.Fprintf(buffered, "errno=%d\n\n", status.ErrorCode())
 	} else {
 		fmt.Fprintf(buffered, "errno=0\n\n")
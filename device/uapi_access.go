@@ -0,0 +1,70 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"github.com/bi-zone/ruwireguard-go/ipc"
+)
+
+/* Anyone who can connect to the UAPI socket may read the private key and
+ * reconfigure the device. Besides file permissions, access can be narrowed
+ * in two ways: connections to the read-only socket may only get, and have
+ * the secrets redacted; and a policy restricts each operation to the
+ * users and groups the kernel reports for the connecting process.
+ */
+
+// An IpcAccess lists the users and groups allowed to perform a UAPI
+// operation. Groups are matched against the primary group of the caller
+// only. Root is always allowed.
+type IpcAccess struct {
+	UIDs []uint32
+	GIDs []uint32
+}
+
+// An IpcPolicy restricts UAPI operations by the credentials of the caller.
+// A nil IpcAccess allows anyone able to connect to the socket, which is the
+// default.
+type IpcPolicy struct {
+	Get *IpcAccess
+	Set *IpcAccess
+}
+
+// SetIpcPolicy replaces the policy checked by IpcHandle and
+// IpcHandleReadOnly.
+func (device *Device) SetIpcPolicy(policy IpcPolicy) {
+	device.ipcPolicy.Store(policy)
+}
+
+func (device *Device) getIpcPolicy() IpcPolicy {
+	policy, _ := device.ipcPolicy.Load().(IpcPolicy)
+	return policy
+}
+
+/* Reports whether a caller is allowed; callers without known credentials
+ * are only allowed if anyone is.
+ */
+func (access *IpcAccess) allows(cred *ipc.Credentials) bool {
+	if access == nil {
+		return true
+	}
+	if cred == nil {
+		return false
+	}
+	if cred.UID == 0 {
+		return true
+	}
+	for _, uid := range access.UIDs {
+		if cred.UID == uid {
+			return true
+		}
+	}
+	for _, gid := range access.GIDs {
+		if cred.GID == gid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,443 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/ipc"
+)
+
+func ipcGet(t *testing.T, device *Device) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := device.IpcGetOperation(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func ipcSet(device *Device, cfg string) error {
+	return device.IpcSetOperation(bufio.NewReader(strings.NewReader(cfg)))
+}
+
+func TestUAPIPeerLabels(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\n"+
+		"name=alice laptop\n"+
+		"annotation=owner=alice@example.com\n"+
+		"annotation=team=ops=oncall\n"))
+
+	peer := device.LookupPeer(pk)
+	if peer == nil {
+		t.Fatal("peer was not created")
+	}
+	if got := peer.String(); got != "peer(alice laptop)" {
+		t.Fatalf("unexpected peer string: %q", got)
+	}
+
+	get := ipcGet(t, device)
+	want := "name=alice laptop\nannotation=owner=alice@example.com\nannotation=team=ops=oncall\n"
+	if !strings.Contains(get, want) {
+		t.Fatalf("labels missing from get output:\n%s", get)
+	}
+
+	// an empty value removes an annotation, replace_annotations removes all
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\nannotation=owner=\n"))
+	if got := peer.Annotations(); len(got) != 1 || got["team"] != "ops=oncall" {
+		t.Fatalf("unexpected annotations: %v", got)
+	}
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\nreplace_annotations=true\nname=\n"))
+	if got := peer.Annotations(); len(got) != 0 {
+		t.Fatalf("unexpected annotations: %v", got)
+	}
+	if strings.Contains(ipcGet(t, device), "name=") {
+		t.Fatal("empty name is reported")
+	}
+
+	for _, cfg := range []string{
+		"name=" + strings.Repeat("x", MaxPeerNameLength+1) + "\n",
+		"name=bad # name\n",
+		"annotation=bad key=value\n",
+		"annotation=novalue\n",
+	} {
+		if err := ipcSet(device, "public_key="+pk.ToHex()+"\n"+cfg); err == nil {
+			t.Errorf("invalid label accepted: %q", cfg)
+		}
+	}
+}
+
+func TestUAPIPeerExpiry(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	assertNil(t, ipcSet(device, fmt.Sprintf("public_key=%s\npreshared_key=%s\nexpires_at=%d\n",
+		pk.ToHex(), strings.Repeat("11", AEADSymmetricKeySize), expiresAt)))
+
+	peer := device.LookupPeer(pk)
+	if peer == nil {
+		t.Fatal("peer was not created")
+	}
+	if get := ipcGet(t, device); !strings.Contains(get, fmt.Sprintf("expires_at=%d\n", expiresAt)) {
+		t.Fatalf("expiry missing from get output:\n%s", get)
+	}
+
+	// the timer removes the peer and wipes its keys
+	peer.SetExpiry(time.Now().Add(10 * time.Millisecond))
+	wiped := func() bool {
+		peer.handshake.mutex.RLock()
+		defer peer.handshake.mutex.RUnlock()
+		return peer.handshake.presharedKey == AEADSymmetricKey{}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for device.LookupPeer(pk) != nil || !wiped() {
+		if time.Now().After(deadline) {
+			t.Fatal("expired peer was not removed and wiped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// an expiry in the past removes the peer right away, along with the
+	// rest of its section
+	assertNil(t, ipcSet(device, fmt.Sprintf("public_key=%s\nexpires_at=%d\nallowed_ip=10.0.0.1/32\n",
+		pk.ToHex(), time.Now().Add(-time.Minute).Unix())))
+	if device.LookupPeer(pk) != nil {
+		t.Fatal("expired peer was configured")
+	}
+
+	// zero cancels the expiry
+	assertNil(t, ipcSet(device, fmt.Sprintf("public_key=%s\nexpires_at=%d\n", pk.ToHex(), expiresAt)))
+	assertNil(t, ipcSet(device, fmt.Sprintf("public_key=%s\nexpires_at=0\n", pk.ToHex())))
+	if at := device.LookupPeer(pk).ExpiresAt(); !at.IsZero() {
+		t.Fatalf("expiry was not cancelled: %v", at)
+	}
+
+	// a renewal racing with the timer wins
+	peer = device.LookupPeer(pk)
+	device.peers.Lock()
+	peer.expiry.Lock()
+	peer.expiry.at = time.Now().Add(-time.Second)
+	peer.expiry.Unlock()
+	expired := make(chan struct{})
+	go func() {
+		peer.expire()
+		close(expired)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	peer.SetExpiry(time.Now().Add(time.Hour))
+	device.peers.Unlock()
+	<-expired
+	if device.LookupPeer(pk) != peer {
+		t.Fatal("renewed peer was removed")
+	}
+}
+
+func TestUAPIPeerLiveness(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\n"))
+	peer := device.LookupPeer(pk)
+
+	if get := ipcGet(t, device); strings.Contains(get, "liveness") {
+		t.Fatalf("liveness reported while not monitored:\n%s", get)
+	}
+
+	// the degraded threshold must be below the down one, given in this
+	// request or before
+	assertNil(t, ipcSet(device, "liveness_down_after=60\nliveness_degraded_after=20\nliveness_probe_interval=10\n"))
+	err = ipcSet(device, "listen_port=0\nliveness_degraded_after=60\n")
+	var status *IPCError
+	if !errors.As(err, &status) || status.ErrorCode() != ipc.IpcErrorInvalid || status.Line() != 2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	get := ipcGet(t, device)
+	for _, line := range []string{"liveness_degraded_after=20\n", "liveness_down_after=60\n", "liveness_probe_interval=10\n", "liveness=down\n"} {
+		if !strings.Contains(get, line) {
+			t.Fatalf("%q missing from get output:\n%s", line, get)
+		}
+	}
+
+	sub := device.Subscribe()
+	defer sub.Close()
+
+	expect := func(want LivenessState) {
+		t.Helper()
+		if state, _ := peer.Liveness(); state != want {
+			t.Fatalf("expected liveness %s, got %s", want, state)
+		}
+		event := nextEvent(t, sub)
+		if event.Type != EventLiveness || event.Liveness != want || !event.PublicKey.Equals(pk) {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	}
+	silentFor := func(d time.Duration) {
+		atomic.StoreInt64(&peer.liveness.lastReceivedNano, time.Now().Add(-d).UnixNano())
+		expiredLiveness(peer)
+	}
+
+	peer.livenessReceived()
+	expect(LivenessUp)
+	silentFor(30 * time.Second)
+	expect(LivenessDegraded)
+	peer.livenessReceived()
+	expect(LivenessUp)
+	silentFor(time.Minute)
+	expect(LivenessDown)
+
+	// a retried handshake degrades the peer, giving it up takes it down
+	peer.livenessReceived()
+	expect(LivenessUp)
+	peer.livenessHandshakeFailed(false)
+	expect(LivenessDegraded)
+	peer.livenessHandshakeFailed(true)
+	expect(LivenessDown)
+
+	// turning monitoring off and on starts over
+	assertNil(t, ipcSet(device, "liveness_down_after=0\nliveness_degraded_after=0\n"))
+	if get := ipcGet(t, device); strings.Contains(get, "liveness") {
+		t.Fatalf("liveness reported after turning it off:\n%s", get)
+	}
+}
+
+func TestUAPISetTransactional(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+
+	assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\nallowed_ip=10.0.0.1/32\n"))
+	before := ipcGet(t, device)
+
+	// a bad line anywhere rejects the whole request
+
+	sk2, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	cfg := "replace_peers=true\n" +
+		"public_key=" + pk.ToHex() + "\n" +
+		"replace_allowed_ips=true\n" +
+		"allowed_ip=10.0.0.2/32\n" +
+		"public_key=" + sk2.PublicKey().ToHex() + "\n" +
+		"allowed_ip=10.0.0.300/32\n"
+
+	err = ipcSet(device, cfg)
+	var status *IPCError
+	if !errors.As(err, &status) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.ErrorCode() != ipc.IpcErrorInvalid || status.Line() != 6 {
+		t.Fatalf("unexpected error code %d on line %d", status.ErrorCode(), status.Line())
+	}
+	if after := ipcGet(t, device); after != before {
+		t.Fatalf("rejected request changed the device:\n%s\nwas:\n%s", after, before)
+	}
+
+	// the error is reported over the socket along with the line
+
+	res := ipcHandle(t, device, "set=1\n"+cfg+"\n")
+	want := fmt.Sprintf("line=6\nmessage=invalid allowed_ip: \"10.0.0.300/32\"\nerrno=%d\n\n", ipc.IpcErrorInvalid)
+	if res != want {
+		t.Fatalf("unexpected response:\n%q\nwant:\n%q", res, want)
+	}
+}
+
+func ipcHandle(t *testing.T, device *Device, req string) string {
+	client, server := net.Pipe()
+	go device.IpcHandle(server)
+	defer client.Close()
+
+	if _, err := io.WriteString(client, req); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res)
+}
+
+func TestUAPIGetFilter(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		sk, err := newNoisePrivateKey(rand.Reader)
+		assertNil(t, err)
+		pk := sk.PublicKey()
+		keys = append(keys, pk.ToHex())
+		assertNil(t, ipcSet(device, "public_key="+pk.ToHex()+"\n"))
+	}
+	sort.Strings(keys)
+
+	peerKeys := func(res string) (found []string, next string) {
+		for _, line := range strings.Split(res, "\n") {
+			switch {
+			case strings.HasPrefix(line, "public_key="):
+				found = append(found, strings.TrimPrefix(line, "public_key="))
+			case strings.HasPrefix(line, "next_cursor="):
+				next = strings.TrimPrefix(line, "next_cursor=")
+			}
+		}
+		return
+	}
+
+	// pages of two walk the peers in order
+
+	var paged []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(keys) {
+			t.Fatal("pagination does not end")
+		}
+		req := "get=1\nlimit=2\n"
+		if cursor != "" {
+			req += "cursor=" + cursor + "\n"
+		}
+		res := ipcHandle(t, device, req+"\n")
+		if !strings.HasPrefix(res, "private_key=") || !strings.HasSuffix(res, "errno=0\n\n") {
+			t.Fatalf("unexpected response:\n%s", res)
+		}
+		found, next := peerKeys(res)
+		paged = append(paged, found...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if diff := cmp.Diff(keys, paged); diff != "" {
+		t.Fatalf("unexpected pages (-want +got):\n%s", diff)
+	}
+
+	// a single peer, a prefix and device fields only
+
+	if found, _ := peerKeys(ipcHandle(t, device, "get=1\npublic_key="+keys[3]+"\n\n")); !cmp.Equal(found, keys[3:4]) {
+		t.Fatalf("unexpected peers for public_key: %v", found)
+	}
+	if found, _ := peerKeys(ipcHandle(t, device, "get=1\npublic_key_prefix="+keys[2][:8]+"\n\n")); !cmp.Equal(found, keys[2:3]) {
+		t.Fatalf("unexpected peers for public_key_prefix: %v", found)
+	}
+	if res := ipcHandle(t, device, "get=1\ndevice_only=true\n\n"); strings.Contains(res, "public_key=") {
+		t.Fatalf("peers returned for device_only:\n%s", res)
+	}
+	if res := ipcHandle(t, device, "get=1\nredact=true\n\n"); strings.Contains(res, "private_key=") || strings.Contains(res, "preshared_key=") {
+		t.Fatalf("secrets returned for redact:\n%s", res)
+	}
+
+	want := fmt.Sprintf("line=1\nmessage=invalid limit: \"-1\"\nerrno=%d\n\n", ipc.IpcErrorInvalid)
+	if res := ipcHandle(t, device, "get=1\nlimit=-1\n\n"); res != want {
+		t.Fatalf("unexpected response to a bad filter:\n%q", res)
+	}
+}
+
+func TestUAPIReadOnly(t *testing.T) {
+	device := randDevice(t)
+	defer device.Close()
+
+	sk, err := newNoisePrivateKey(rand.Reader)
+	assertNil(t, err)
+	pk := sk.PublicKey()
+	assertNil(t, ipcSet(device, fmt.Sprintf("public_key=%s\npreshared_key=%s\n",
+		pk.ToHex(), strings.Repeat("11", AEADSymmetricKeySize))))
+
+	// serve a real unix socket, so that peer credentials are available
+
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "wg0.ro.sock"))
+	assertNil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go device.IpcHandleReadOnly(conn)
+		}
+	}()
+
+	request := func(req string) string {
+		conn, err := net.Dial("unix", l.Addr().String())
+		assertNil(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, req)
+		assertNil(t, err)
+		res, err := ioutil.ReadAll(conn)
+		assertNil(t, err)
+		return string(res)
+	}
+
+	res := request("get=1\n\n")
+	device.staticIdentity.RLock()
+	want := "device_public_key=" + device.staticIdentity.publicKey.ToHex() + "\n"
+	device.staticIdentity.RUnlock()
+	if !strings.HasPrefix(res, want) || !strings.Contains(res, "redacted=true\n") || !strings.Contains(res, "public_key="+pk.ToHex()+"\n") ||
+		strings.Contains(res, "private_key=") || strings.Contains(res, "preshared_key=") {
+		t.Fatalf("secrets not redacted from get:\n%s", res)
+	}
+
+	if res := request("set=1\nreplace_peers=true\n\n"); !strings.HasSuffix(res, fmt.Sprintf("errno=%d\n\n", ipc.IpcErrorAccess)) {
+		t.Fatalf("set accepted on the read-only socket:\n%s", res)
+	}
+	if device.LookupPeer(pk) == nil {
+		t.Fatal("peer removed through the read-only socket")
+	}
+}
+
+func TestIpcAccess(t *testing.T) {
+	access := &IpcAccess{UIDs: []uint32{1000}, GIDs: []uint32{998}}
+
+	for _, tt := range []struct {
+		access *IpcAccess
+		cred   *ipc.Credentials
+		ok     bool
+	}{
+		{nil, nil, true},
+		{access, nil, false},
+		{access, &ipc.Credentials{UID: 0, GID: 0}, true},
+		{access, &ipc.Credentials{UID: 1000, GID: 1000}, true},
+		{access, &ipc.Credentials{UID: 1001, GID: 998}, true},
+		{access, &ipc.Credentials{UID: 1001, GID: 1001}, false},
+	} {
+		if ok := tt.access.allows(tt.cred); ok != tt.ok {
+			t.Errorf("%+v allows %v: got %v, want %v", tt.access, tt.cred, ok, tt.ok)
+		}
+	}
+}
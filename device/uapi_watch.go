@@ -0,0 +1,102 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/bi-zone/ruwireguard-go/ipc"
+)
+
+/* A watch request, watch=1 followed by an empty line, subscribes to the
+ * events of the device. The answer starts with errno=0 and an empty line
+ * once the subscription is in place, and goes on with a block per event,
+ * each ended by an empty line:
+ *
+ *   event=endpoint
+ *   time_sec=1600000000
+ *   time_nsec=123456789
+ *   public_key=<hex>
+ *   endpoint=192.0.2.1:51820
+ *   dropped=3
+ *
+ * public_key is the key of the peer, or the new key of the device for
+ * private_key events, endpoint is only sent with endpoint events, liveness
+ * with the new state of the peer only with liveness events, and dropped
+ * counts the events the watcher lost so far by falling behind, if any. The
+ * stream ends when the watcher closes the connection or the device is
+ * closed.
+ */
+
+func ipcParseWatch(socket *bufio.Reader) error {
+	line, err := socket.ReadString('\n')
+	if err != nil {
+		return ipcErrorf(ipc.IpcErrorIO, "failed to read request: %v", err)
+	}
+	if line != "\n" {
+		return &IPCError{code: ipc.IpcErrorInvalid, line: 1, err: fmt.Errorf("invalid watch key: %q", strings.TrimSuffix(line, "\n"))}
+	}
+	return nil
+}
+
+// IpcWatchOperation streams the events of the device to socket, in the
+// format of the answer to a watch request, until stop is closed, the device
+// is closed or writing fails.
+func (device *Device) IpcWatchOperation(socket *bufio.Writer, stop <-chan struct{}) error {
+	sub := device.Subscribe()
+	defer sub.Close()
+
+	if err := ipcWriteFlush(socket, "errno=0\n\n"); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if err := ipcWriteFlush(socket, ipcFormatEvent(event, sub.Dropped())); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func ipcFormatEvent(event Event, dropped uint64) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "event=%s\n", event.Type)
+	fmt.Fprintf(&b, "time_sec=%d\n", event.Time.Unix())
+	fmt.Fprintf(&b, "time_nsec=%d\n", event.Time.Nanosecond())
+	fmt.Fprintf(&b, "public_key=%s\n", event.PublicKey.ToHex())
+	if event.Endpoint != "" {
+		fmt.Fprintf(&b, "endpoint=%s\n", event.Endpoint)
+	}
+	if event.Type == EventLiveness {
+		fmt.Fprintf(&b, "liveness=%s\n", event.Liveness)
+	}
+	if dropped != 0 {
+		fmt.Fprintf(&b, "dropped=%d\n", dropped)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+func ipcWriteFlush(socket *bufio.Writer, s string) error {
+	if _, err := socket.WriteString(s); err != nil {
+		return ipcErrorf(ipc.IpcErrorIO, "failed to write response: %v", err)
+	}
+	if err := socket.Flush(); err != nil {
+		return ipcErrorf(ipc.IpcErrorIO, "failed to write response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// hookTimeout bounds every hook command, so that a hanging one does not hold
+// up the hooks of later events.
+const hookTimeout = 30 * time.Second
+
+// peerHooks are the commands run when the liveness monitoring of the device
+// takes a peer up or down.
+type peerHooks struct {
+	up   []string
+	down []string
+}
+
+// hookRunner runs the hooks of the configuration file for the liveness
+// events of a device, one at a time and in the order of the events.
+type hookRunner struct {
+	interfaceName string
+	device        *device.Device
+	logger        *device.Logger
+
+	mu    sync.Mutex
+	hooks *peerHooks
+}
+
+// set replaces the hooks, for a reload of the configuration file.
+func (r *hookRunner) set(hooks *peerHooks) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = hooks
+}
+
+func (r *hookRunner) get() *peerHooks {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hooks
+}
+
+// subscribe subscribes to the liveness events of the device, which are
+// the only ones run needs; other events would only crowd them out.
+func (r *hookRunner) subscribe() *device.Subscription {
+	return r.device.Subscribe(device.EventLiveness)
+}
+
+// run runs the hooks until sub, a subscription to the liveness events, is
+// closed. Events missed while hooks ran are logged.
+func (r *hookRunner) run(sub *device.Subscription) {
+	var dropped uint64
+
+	for event := range sub.Events() {
+		if n := sub.Dropped(); n != dropped {
+			r.logger.Error.Printf("Peer hooks missed %d liveness events\n", n-dropped)
+			dropped = n
+		}
+
+		hooks := r.get()
+		if hooks == nil {
+			continue
+		}
+
+		switch event.Liveness {
+		case device.LivenessUp:
+			r.runHooks(event, hooks.up)
+		case device.LivenessDown:
+			r.runHooks(event, hooks.down)
+		}
+	}
+}
+
+// runHooks runs commands with sh, replacing %i with the interface name. The
+// public key, name, endpoint and new state of the peer are passed in the
+// environment as WG_PEER_PUBLIC_KEY, WG_PEER_NAME, WG_PEER_ENDPOINT and
+// WG_PEER_STATE. A command is killed after hookTimeout; a failing command is
+// logged and does not stop the others.
+func (r *hookRunner) runHooks(event device.Event, commands []string) {
+	if len(commands) == 0 {
+		return
+	}
+
+	var name, endpoint string
+	if peer := r.device.LookupPeer(event.PublicKey); peer != nil {
+		name = peer.Name()
+		if addr := peer.Endpoint(); addr != nil {
+			endpoint = addr.String()
+		}
+	}
+
+	env := append(os.Environ(),
+		"WG_INTERFACE="+r.interfaceName,
+		"WG_PEER_PUBLIC_KEY="+wgtypes.Key(event.PublicKey[:]).String(),
+		"WG_PEER_NAME="+name,
+		"WG_PEER_ENDPOINT="+endpoint,
+		"WG_PEER_STATE="+event.Liveness.String(),
+	)
+
+	for _, command := range commands {
+		command = strings.ReplaceAll(command, "%i", r.interfaceName)
+
+		ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		cancel()
+		if err != nil {
+			r.logger.Error.Printf("Peer %s hook %q failed: %v: %s\n", event.Liveness, command, err, strings.TrimSpace(string(out)))
+			continue
+		}
+		r.logger.Debug.Printf("Peer %s hook %q ran\n", event.Liveness, command)
+	}
+}
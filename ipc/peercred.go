@@ -0,0 +1,19 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package ipc
+
+import "fmt"
+
+// Credentials identify the process on the other end of a UAPI connection.
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32 // primary group only
+}
+
+func (c *Credentials) String() string {
+	return fmt.Sprintf("pid %d uid %d gid %d", c.PID, c.UID, c.GID)
+}
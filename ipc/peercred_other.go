@@ -0,0 +1,18 @@
+// +build !linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package ipc
+
+import (
+	"errors"
+	"net"
+)
+
+// PeerCredentials is only implemented on Linux.
+func PeerCredentials(conn net.Conn) (*Credentials, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
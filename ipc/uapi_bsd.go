@@ -54,6 +54,10 @@ func (l *UAPIListener) Addr() net.Addr {
 }
 
 func UAPIListen(name string, file *os.File) (net.Listener, error) {
+	return uapiListen(sockPath(name), file)
+}
+
+func uapiListen(socketPath string, file *os.File) (net.Listener, error) {
 
 	// wrap file in listener
 
@@ -72,8 +76,6 @@ func UAPIListen(name string, file *os.File) (net.Listener, error) {
 		unixListener.SetUnlinkOnClose(true)
 	}
 
-	socketPath := sockPath(name)
-
 	// watch for deletion of socket
 
 	uapi.kqueueFd, err = unix.Kqueue()
@@ -53,6 +53,10 @@ func (l *UAPIListener) Addr() net.Addr {
 }
 
 func UAPIListen(name string, file *os.File) (net.Listener, error) {
+	return uapiListen(sockPath(name), file)
+}
+
+func uapiListen(socketPath string, file *os.File) (net.Listener, error) {
 
 	// wrap file in listener
 
@@ -73,8 +77,6 @@ func UAPIListen(name string, file *os.File) (net.Listener, error) {
 
 	// watch for deletion of socket
 
-	socketPath := sockPath(name)
-
 	uapi.inotifyFd, err = unix.InotifyInit()
 	if err != nil {
 		return nil, err
@@ -12,6 +12,9 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"golang.org/x/sys/unix"
 )
@@ -21,28 +24,61 @@ const (
 	IpcErrorProtocol  = -int64(unix.EPROTO)
 	IpcErrorInvalid   = -int64(unix.EINVAL)
 	IpcErrorPortInUse = -int64(unix.EADDRINUSE)
+	IpcErrorAccess    = -int64(unix.EACCES)
 )
 
 // socketDirectory is variable because it is modified by a linker
 // flag in wireguard-android.
 var socketDirectory = "/var/run/wireguard"
 
+// socketPaths holds the socket paths set by SetSocketPath.
+var socketPaths sync.Map
+
+// SetSocketPath makes UAPIOpen and UAPIListen use path instead of the
+// default socket in the socket directory for the named interface.
+func SetSocketPath(iface, path string) {
+	socketPaths.Store(iface, path)
+}
+
 func sockPath(iface string) string {
+	if path, ok := socketPaths.Load(iface); ok {
+		return path.(string)
+	}
 	return fmt.Sprintf("%s/%s.sock", socketDirectory, iface)
 }
 
+// readOnlySockPath returns the path of the read-only socket, next to the
+// regular one.
+func readOnlySockPath(iface string) string {
+	return strings.TrimSuffix(sockPath(iface), ".sock") + ".ro.sock"
+}
+
 func UAPIOpen(name string) (*os.File, error) {
-	if err := os.MkdirAll(socketDirectory, 0755); err != nil {
+	return uapiOpen(sockPath(name), 0077)
+}
+
+// UAPIOpenReadOnly opens the read-only socket of the named interface,
+// <iface>.ro.sock, which any local user may connect to. Connections to it
+// are to be served with Device.IpcHandleReadOnly.
+func UAPIOpenReadOnly(name string) (*os.File, error) {
+	return uapiOpen(readOnlySockPath(name), 0111)
+}
+
+// UAPIListenReadOnly is UAPIListen for the read-only socket.
+func UAPIListenReadOnly(name string, file *os.File) (net.Listener, error) {
+	return uapiListen(readOnlySockPath(name), file)
+}
+
+func uapiOpen(socketPath string, umask int) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
 		return nil, err
 	}
-
-	socketPath := sockPath(name)
 	addr, err := net.ResolveUnixAddr("unix", socketPath)
 	if err != nil {
 		return nil, err
 	}
 
-	oldUmask := unix.Umask(0077)
+	oldUmask := unix.Umask(umask)
 	defer unix.Umask(oldUmask)
 
 	listener, err := net.ListenUnix("unix", addr)
@@ -20,6 +20,7 @@ const (
 	IpcErrorProtocol  = -int64(71)
 	IpcErrorInvalid   = -int64(22)
 	IpcErrorPortInUse = -int64(98)
+	IpcErrorAccess    = -int64(13)
 )
 
 type UAPIListener struct {
@@ -9,16 +9,27 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"os/user"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/bi-zone/ruwireguard-go/authorizer"
 	"github.com/bi-zone/ruwireguard-go/device"
 	"github.com/bi-zone/ruwireguard-go/ipc"
 	"github.com/bi-zone/ruwireguard-go/tun"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgapi"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgmetrics"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
 const (
@@ -29,12 +40,202 @@ const (
 const (
 	ENV_WG_TUN_FD             = "WG_TUN_FD"
 	ENV_WG_UAPI_FD            = "WG_UAPI_FD"
+	ENV_WG_UAPI_RO_FD         = "WG_UAPI_RO_FD"
 	ENV_WG_PROCESS_FOREGROUND = "WG_PROCESS_FOREGROUND"
 )
 
 func printUsage() {
 	fmt.Printf("usage:\n")
-	fmt.Printf("%s [-f/--foreground] INTERFACE-NAME\n", os.Args[0])
+	fmt.Printf("%s [-f/--foreground] [--config FILE] [--mtu MTU] [--uapi-socket PATH] [--uapi-readonly] [--uapi-allow get|set=USERS] [--log-format text|json] [--authorizer URL|SOCKET] [--api-listen ADDR|unix:PATH [--api-cert FILE --api-key FILE --api-client-ca FILE] [--api-secrets NAMES]] [--metrics-listen ADDR|unix:PATH] [--handshake-error-log-rate N] INTERFACE-NAME\n", os.Args[0])
+}
+
+type options struct {
+	foreground    bool
+	interfaceName string
+	configPath    string
+	mtu           int
+	uapiSocket    string
+	uapiReadOnly  bool
+	uapiPolicy    device.IpcPolicy
+	logFormat     string
+	authorizer    string
+	apiListen     string
+	apiCert       string
+	apiKey        string
+	apiClientCA   string
+	apiSecrets    []string
+	metricsListen string
+
+	handshakeErrorLogRate int
+}
+
+func parseArgs(args []string) (*options, error) {
+	opts := &options{
+		mtu:       device.DefaultMTU,
+		logFormat: "text",
+
+		handshakeErrorLogRate: device.DefaultHandshakeErrorLogRate,
+	}
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-f" || args[0] == "--foreground" {
+			opts.foreground = true
+			args = args[1:]
+			continue
+		}
+		if args[0] == "--uapi-readonly" {
+			opts.uapiReadOnly = true
+			args = args[1:]
+			continue
+		}
+
+		if len(args) < 2 {
+			return nil, fmt.Errorf("missing value for %s", args[0])
+		}
+
+		switch args[0] {
+		case "--config":
+			path, err := filepath.Abs(args[1])
+			if err != nil {
+				return nil, err
+			}
+			opts.configPath = path
+		case "--mtu":
+			mtu, err := strconv.Atoi(args[1])
+			if err != nil || mtu < 576 || mtu > 65535 {
+				return nil, fmt.Errorf("invalid MTU: %s", args[1])
+			}
+			opts.mtu = mtu
+		case "--uapi-socket":
+			opts.uapiSocket = args[1]
+		case "--uapi-allow":
+			if err := parseUAPIAllow(&opts.uapiPolicy, args[1]); err != nil {
+				return nil, err
+			}
+		case "--log-format":
+			if args[1] != "text" && args[1] != "json" {
+				return nil, fmt.Errorf("invalid log format: %s", args[1])
+			}
+			opts.logFormat = args[1]
+		case "--authorizer":
+			opts.authorizer = args[1]
+		case "--api-listen":
+			opts.apiListen = args[1]
+		case "--api-secrets":
+			opts.apiSecrets = append(opts.apiSecrets, strings.Split(args[1], ",")...)
+		case "--metrics-listen":
+			opts.metricsListen = args[1]
+		case "--handshake-error-log-rate":
+			rate, err := strconv.Atoi(args[1])
+			if err != nil || rate < 0 {
+				return nil, fmt.Errorf("invalid handshake error log rate: %s", args[1])
+			}
+			opts.handshakeErrorLogRate = rate
+		case "--api-cert", "--api-key", "--api-client-ca":
+			path, err := filepath.Abs(args[1])
+			if err != nil {
+				return nil, err
+			}
+			switch args[0] {
+			case "--api-cert":
+				opts.apiCert = path
+			case "--api-key":
+				opts.apiKey = path
+			default:
+				opts.apiClientCA = path
+			}
+		default:
+			return nil, fmt.Errorf("unknown option: %s", args[0])
+		}
+
+		args = args[2:]
+	}
+
+	if len(args) != 1 {
+		return nil, errors.New("expected exactly one interface name")
+	}
+	opts.interfaceName = args[0]
+
+	// the management API is only served over TCP with mutual TLS
+
+	tcp := opts.apiListen != "" && !strings.HasPrefix(opts.apiListen, "unix:")
+	if tcp && (opts.apiCert == "" || opts.apiKey == "" || opts.apiClientCA == "") {
+		return nil, errors.New("--api-listen on TCP requires --api-cert, --api-key and --api-client-ca")
+	}
+
+	return opts, nil
+}
+
+// parseUAPIAllow adds the users of a --uapi-allow value, OP=LIST, to the
+// policy of the operation. LIST is a comma-separated list of user names or
+// uids, and of group names or gids prefixed with ':'.
+func parseUAPIAllow(policy *device.IpcPolicy, value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("invalid UAPI access, expected OP=USERS: %s", value)
+	}
+
+	var access **device.IpcAccess
+	switch parts[0] {
+	case "get":
+		access = &policy.Get
+	case "set":
+		access = &policy.Set
+	default:
+		return fmt.Errorf("invalid UAPI operation: %s", parts[0])
+	}
+	if *access == nil {
+		*access = new(device.IpcAccess)
+	}
+
+	for _, name := range strings.Split(parts[1], ",") {
+		if strings.HasPrefix(name, ":") {
+			gid, err := lookupID(strings.TrimPrefix(name, ":"), func(name string) (string, error) {
+				group, err := user.LookupGroup(name)
+				if err != nil {
+					return "", err
+				}
+				return group.Gid, nil
+			})
+			if err != nil {
+				return err
+			}
+			(*access).GIDs = append((*access).GIDs, gid)
+			continue
+		}
+
+		uid, err := lookupID(name, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return err
+		}
+		(*access).UIDs = append((*access).UIDs, uid)
+	}
+
+	return nil
+}
+
+// lookupID returns name if it is numeric, or the ID lookup finds for it.
+func lookupID(name string, lookup func(string) (string, error)) (uint32, error) {
+	id, err := strconv.ParseUint(name, 10, 32)
+	if err == nil {
+		return uint32(id), nil
+	}
+
+	s, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	id, err = strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID of %s: %s", name, s)
+	}
+	return uint32(id), nil
 }
 
 func warning() {
@@ -62,31 +263,15 @@ func main() {
 
 	warning()
 
-	var foreground bool
-	var interfaceName string
-	if len(os.Args) < 2 || len(os.Args) > 3 {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		printUsage()
 		return
 	}
 
-	switch os.Args[1] {
-
-	case "-f", "--foreground":
-		foreground = true
-		if len(os.Args) != 3 {
-			printUsage()
-			return
-		}
-		interfaceName = os.Args[2]
-
-	default:
-		foreground = false
-		if len(os.Args) != 2 {
-			printUsage()
-			return
-		}
-		interfaceName = os.Args[1]
-	}
+	foreground := opts.foreground
+	interfaceName := opts.interfaceName
 
 	if !foreground {
 		foreground = os.Getenv(ENV_WG_PROCESS_FOREGROUND) == "1"
@@ -113,7 +298,7 @@ func main() {
 	tun, err := func() (tun.Device, error) {
 		tunFdStr := os.Getenv(ENV_WG_TUN_FD)
 		if tunFdStr == "" {
-			return tun.CreateTUN(interfaceName, device.DefaultMTU)
+			return tun.CreateTUN(interfaceName, opts.mtu)
 		}
 
 		// construct tun device from supplied fd
@@ -129,7 +314,7 @@ func main() {
 		}
 
 		file := os.NewFile(uintptr(fd), "")
-		return tun.CreateTUNFromFile(file, device.DefaultMTU)
+		return tun.CreateTUNFromFile(file, opts.mtu)
 	}()
 
 	if err == nil {
@@ -139,10 +324,15 @@ func main() {
 		}
 	}
 
-	logger := device.NewLogger(
-		logLevel,
-		fmt.Sprintf("(%s) ", interfaceName),
-	)
+	var logger *device.Logger
+	if opts.logFormat == "json" {
+		logger = device.NewJSONLogger(logLevel, interfaceName)
+	} else {
+		logger = device.NewLogger(
+			logLevel,
+			fmt.Sprintf("(%s) ", interfaceName),
+		)
+	}
 
 	logger.Info.Println("Starting wireguard-go version", device.WireGuardGoVersion)
 
@@ -153,8 +343,54 @@ func main() {
 		os.Exit(ExitSetupFailed)
 	}
 
+	// parse the configuration file early, so that a broken file fails
+	// before daemonizing
+
+	var config *wgtypes.Config
+	var hooks *peerHooks
+	if opts.configPath != "" {
+		config, hooks, err = loadConfig(opts.configPath)
+		if err != nil {
+			logger.Error.Println("Failed to load configuration:", err)
+			os.Exit(ExitSetupFailed)
+		}
+	}
+
+	var authorizerClient *authorizer.Client
+	if opts.authorizer != "" {
+		authorizerClient, err = authorizer.New(opts.authorizer, interfaceName)
+		if err != nil {
+			logger.Error.Println("Failed to set up authorizer:", err)
+			os.Exit(ExitSetupFailed)
+		}
+	}
+
+	// load the TLS configuration of the management API early as well
+
+	var apiTLS *tls.Config
+	if opts.apiCert != "" {
+		apiTLS, err = wgapi.ServerTLSConfig(opts.apiCert, opts.apiKey, opts.apiClientCA)
+		if err != nil {
+			logger.Error.Println("Failed to load management API certificates:", err)
+			os.Exit(ExitSetupFailed)
+		}
+	}
+
+	var apiSecrets func(r *http.Request) bool
+	if len(opts.apiSecrets) != 0 {
+		apiSecrets, err = wgapi.SecretsFor(opts.apiSecrets)
+		if err != nil {
+			logger.Error.Println("Failed to set up management API secrets policy:", err)
+			os.Exit(ExitSetupFailed)
+		}
+	}
+
 	// open UAPI file (or use supplied fd)
 
+	if opts.uapiSocket != "" {
+		ipc.SetSocketPath(interfaceName, opts.uapiSocket)
+	}
+
 	fileUAPI, err := func() (*os.File, error) {
 		uapiFdStr := os.Getenv(ENV_WG_UAPI_FD)
 		if uapiFdStr == "" {
@@ -176,6 +412,30 @@ func main() {
 		os.Exit(ExitSetupFailed)
 		return
 	}
+
+	// open the read-only UAPI file (or use supplied fd)
+
+	var fileUAPIReadOnly *os.File
+	if opts.uapiReadOnly {
+		fileUAPIReadOnly, err = func() (*os.File, error) {
+			uapiFdStr := os.Getenv(ENV_WG_UAPI_RO_FD)
+			if uapiFdStr == "" {
+				return ipc.UAPIOpenReadOnly(interfaceName)
+			}
+
+			fd, err := strconv.ParseUint(uapiFdStr, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+
+			return os.NewFile(uintptr(fd), ""), nil
+		}()
+
+		if err != nil {
+			logger.Error.Println("Read-only UAPI listen error:", err)
+			os.Exit(ExitSetupFailed)
+		}
+	}
 	// daemonize the process
 
 	if !foreground {
@@ -204,6 +464,10 @@ func main() {
 			Dir: ".",
 			Env: env,
 		}
+		if fileUAPIReadOnly != nil {
+			attr.Files = append(attr.Files, fileUAPIReadOnly)
+			attr.Env = append(attr.Env, fmt.Sprintf("%s=5", ENV_WG_UAPI_RO_FD))
+		}
 
 		path, err := os.Executable()
 		if err != nil {
@@ -228,8 +492,37 @@ func main() {
 
 	logger.Info.Println("Device started")
 
+	device.SetIpcPolicy(opts.uapiPolicy)
+	device.SetHandshakeErrorLogRate(opts.handshakeErrorLogRate)
+
+	if authorizerClient != nil {
+		device.SetAuthorizer(authorizerClient)
+		logger.Info.Println("Unknown initiators are authorized by", opts.authorizer)
+	}
+
+	// subscribe before applying the configuration, so that the hooks see
+	// every liveness change
+
+	runner := &hookRunner{interfaceName: interfaceName, device: device, logger: logger}
+	runner.set(hooks)
+	go runner.run(runner.subscribe())
+
+	if config != nil {
+		apply := *config
+		apply.ReplacePeers = true
+
+		if err := device.Apply(apply); err != nil {
+			logger.Error.Println("Failed to apply configuration:", err)
+			device.Close()
+			os.Exit(ExitSetupFailed)
+		}
+
+		logger.Info.Println("Configuration applied from", opts.configPath)
+	}
+
 	errs := make(chan error)
 	term := make(chan os.Signal, 1)
+	hup := make(chan os.Signal, 1)
 
 	uapi, err := ipc.UAPIListen(interfaceName, fileUAPI)
 	if err != nil {
@@ -250,20 +543,129 @@ func main() {
 
 	logger.Info.Println("UAPI listener started")
 
+	var uapiReadOnly net.Listener
+	if fileUAPIReadOnly != nil {
+		uapiReadOnly, err = ipc.UAPIListenReadOnly(interfaceName, fileUAPIReadOnly)
+		if err != nil {
+			logger.Error.Println("Failed to listen on read-only uapi socket:", err)
+			os.Exit(ExitSetupFailed)
+		}
+
+		go func() {
+			for {
+				conn, err := uapiReadOnly.Accept()
+				if err != nil {
+					errs <- err
+					return
+				}
+				go device.IpcHandleReadOnly(conn)
+			}
+		}()
+
+		logger.Info.Println("Read-only UAPI listener started")
+	}
+
+	var api net.Listener
+	if opts.apiListen != "" {
+		api, err = wgapi.Listen(opts.apiListen, apiTLS)
+		if err != nil {
+			logger.Error.Println("Failed to listen on management API address:", err)
+			os.Exit(ExitSetupFailed)
+		}
+
+		server := wgapi.NewServer(interfaceName, device, logger.Info)
+		server.AllowSecrets(apiSecrets)
+
+		go func() {
+			errs <- server.Serve(api)
+		}()
+
+		logger.Info.Println("Management API listener started on", opts.apiListen)
+	}
+
+	var metrics net.Listener
+	if opts.metricsListen != "" {
+		metrics, err = wgmetrics.Listen(opts.metricsListen)
+		if err != nil {
+			logger.Error.Println("Failed to listen on metrics address:", err)
+			os.Exit(ExitSetupFailed)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", wgmetrics.Handler(func() ([]*wgtypes.Device, error) {
+			d := device.Snapshot()
+			d.Name = interfaceName
+			return []*wgtypes.Device{&d}, nil
+		}))
+
+		go func() {
+			errs <- http.Serve(metrics, mux)
+		}()
+
+		logger.Info.Println("Metrics listener started on", opts.metricsListen)
+	}
+
 	// wait for program to terminate
 
 	signal.Notify(term, syscall.SIGTERM)
 	signal.Notify(term, os.Interrupt)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	select {
-	case <-term:
-	case <-errs:
-	case <-device.Wait():
+	// SIGHUP re-reads the configuration file and applies the difference
+
+	reload := func() {
+		if opts.configPath == "" {
+			logger.Info.Println("Ignoring SIGHUP, no configuration file given")
+			return
+		}
+
+		next, nextHooks, err := loadConfig(opts.configPath)
+		if err != nil {
+			logger.Error.Println("Failed to reload configuration:", err)
+			return
+		}
+
+		current := device.Snapshot()
+		plan, err := wgtypes.Diff(&current, next)
+		if err != nil {
+			logger.Error.Println("Failed to compare reloaded configuration:", err)
+			return
+		}
+		if err := device.Apply(plan.Config()); err != nil {
+			logger.Error.Println("Failed to apply reloaded configuration:", err)
+			return
+		}
+
+		runner.set(nextHooks)
+		logger.Info.Printf("Configuration reloaded from %s, %d peers changed\n", opts.configPath, len(plan.Peers))
+	}
+
+wait:
+	for {
+		select {
+		case <-hup:
+			reload()
+		case <-term:
+			break wait
+		case <-errs:
+			break wait
+		case <-device.Wait():
+			break wait
+		}
 	}
 
 	// clean up
 
 	uapi.Close()
+	if uapiReadOnly != nil {
+		uapiReadOnly.Close()
+	}
+	if api != nil {
+		api.Close()
+	}
+	if metrics != nil {
+		metrics.Close()
+	}
 	device.Close()
 
 	logger.Info.Println("Shutting down")
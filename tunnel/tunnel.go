@@ -0,0 +1,116 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+// Package tunnel runs a device for programs which embed the protocol
+// instead of running wireguard-go: the interface, the sockets, the logger
+// and the configuration are given in one Options value, and the device is
+// then configured and inspected with the types of wgtypes.
+//
+//	t, err := tunnel.New(tunnel.Options{
+//		Name:   "wg0",
+//		Config: cfg,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer t.Close()
+//
+//	for _, peer := range t.Device().Snapshot().Peers {
+//		fmt.Println(peer.PublicKey, peer.LastHandshakeTime)
+//	}
+package tunnel
+
+import (
+	"github.com/bi-zone/ruwireguard-go/conn"
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/tun"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// Options configure a Tunnel.
+type Options struct {
+	// Name is the name of the interface to create when TUN is nil.
+	Name string
+
+	// MTU is the MTU of the interface to create, device.DefaultMTU if zero.
+	MTU int
+
+	// TUN is the interface of the tunnel. If nil, one named Name is created.
+	TUN tun.Device
+
+	// Bind opens the sockets of the tunnel on a port, or on any port if the
+	// port is zero. If nil, conn.CreateBind opens UDP sockets.
+	Bind func(port uint16) (conn.Bind, uint16, error)
+
+	// Logger receives the log of the device. If nil, nothing is logged.
+	Logger *device.Logger
+
+	// Config is applied before the tunnel is brought up.
+	Config wgtypes.Config
+}
+
+// A Tunnel is a running device.
+type Tunnel struct {
+	device *device.Device
+	name   string
+}
+
+// New creates a device from opts, configures it and brings it up. The
+// interface is closed on failure, even if it was given in opts.
+func New(opts Options) (*Tunnel, error) {
+	tunDevice := opts.TUN
+	if tunDevice == nil {
+		mtu := opts.MTU
+		if mtu == 0 {
+			mtu = device.DefaultMTU
+		}
+
+		var err error
+		tunDevice, err = tun.CreateTUN(opts.Name, mtu)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name, err := tunDevice.Name()
+	if err != nil {
+		tunDevice.Close()
+		return nil, err
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = device.NewLogger(device.LogLevelSilent, "")
+	}
+
+	dev := device.NewDevice(tunDevice, logger)
+	if opts.Bind != nil {
+		dev.SetBindCreator(opts.Bind)
+	}
+
+	if err := dev.Apply(opts.Config); err != nil {
+		dev.Close()
+		return nil, err
+	}
+	dev.Up()
+
+	return &Tunnel{device: dev, name: name}, nil
+}
+
+// Device returns the device of the tunnel, to be reconfigured with Apply
+// and inspected with Snapshot.
+func (t *Tunnel) Device() *device.Device {
+	return t.device
+}
+
+// Name returns the name of the interface of the tunnel.
+func (t *Tunnel) Name() string {
+	return t.name
+}
+
+// Close shuts the tunnel down and closes its interface and sockets.
+func (t *Tunnel) Close() {
+	t.device.Close()
+}
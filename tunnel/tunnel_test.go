@@ -0,0 +1,226 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2020 BI.ZONE LLC. All Rights Reserved.
+ */
+
+package tunnel_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/conn"
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/tun/tuntest"
+	"github.com/bi-zone/ruwireguard-go/tunnel"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestTunnelPing(t *testing.T) {
+	network := newTestNetwork()
+
+	key1, key2 := mustPrivateKey(t), mustPrivateKey(t)
+	tun1, tun2 := tuntest.NewChannelTUN(), tuntest.NewChannelTUN()
+
+	t1 := newTunnel(t, tun1, network, key1, 1001, key2.PublicKey(), 1002, "1.0.0.2/32")
+	t2 := newTunnel(t, tun2, network, key2, 1002, key1.PublicKey(), 1001, "1.0.0.1/32")
+
+	ping := tuntest.Ping(net.ParseIP("1.0.0.2"), net.ParseIP("1.0.0.1"))
+	tun1.Outbound <- ping
+	select {
+	case got := <-tun2.Inbound:
+		if !bytes.Equal(ping, got) {
+			t.Fatal("ping did not transit correctly")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping did not transit")
+	}
+
+	d := t2.Device().Snapshot()
+	if !bytes.Equal(d.PrivateKey, key2) || !bytes.Equal(d.PublicKey, key2.PublicKey()) || d.ListenPort != 1002 {
+		t.Fatalf("unexpected device: %+v", d)
+	}
+	if len(d.Peers) != 1 {
+		t.Fatalf("expected one peer, got %d", len(d.Peers))
+	}
+
+	p := d.Peers[0]
+	if !bytes.Equal(p.PublicKey, key1.PublicKey()) || p.ReceiveBytes == 0 || p.LastHandshakeTime.IsZero() {
+		t.Fatalf("unexpected peer: %+v", p)
+	}
+	if p.Endpoint == nil || p.Endpoint.Port != 1001 {
+		t.Fatalf("unexpected endpoint: %v", p.Endpoint)
+	}
+
+	var pk device.NoisePublicKey
+	copy(pk[:], key2.PublicKey())
+	peer := t1.Device().LookupPeer(pk)
+	if peer == nil {
+		t.Fatal("peer of the first tunnel is missing")
+	}
+	if stats := peer.Stats(); stats.TransmitBytes == 0 || stats.LastHandshake != peer.LastHandshake() {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestTunnelInvalidConfig(t *testing.T) {
+	port := 70000
+	_, err := tunnel.New(tunnel.Options{
+		TUN:    tuntest.NewChannelTUN().TUN(),
+		Bind:   newTestNetwork().bind,
+		Config: wgtypes.Config{ListenPort: &port},
+	})
+
+	var ipcErr *device.IPCError
+	if !errors.As(err, &ipcErr) {
+		t.Fatalf("expected an IPC error, got %v", err)
+	}
+}
+
+func newTunnel(t *testing.T, tunDevice *tuntest.ChannelTUN, network *testNetwork, key wgtypes.Key, port int, peer wgtypes.Key, peerPort int, allowedIP string) *tunnel.Tunnel {
+	t.Helper()
+
+	_, ip, err := net.ParseCIDR(allowedIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt, err := tunnel.New(tunnel.Options{
+		TUN:    tunDevice.TUN(),
+		Bind:   network.bind,
+		Logger: device.NewLogger(device.LogLevelError, fmt.Sprintf("tunnel %d: ", port)),
+		Config: wgtypes.Config{
+			PrivateKey:   &key,
+			ListenPort:   &port,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:  peer,
+				Endpoint:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: peerPort},
+				AllowedIPs: []net.IPNet{*ip},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tunnel: %v", err)
+	}
+	t.Cleanup(tt.Close)
+
+	return tt
+}
+
+func mustPrivateKey(t *testing.T) wgtypes.Key {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// A testNetwork delivers datagrams between binds in memory.
+type testNetwork struct {
+	sync.Mutex
+	ports map[uint16]*testBind
+}
+
+func newTestNetwork() *testNetwork {
+	return &testNetwork{ports: make(map[uint16]*testBind)}
+}
+
+type testPacket struct {
+	data []byte
+	from uint16
+}
+
+func (network *testNetwork) bind(port uint16) (conn.Bind, uint16, error) {
+	network.Lock()
+	defer network.Unlock()
+
+	if _, ok := network.ports[port]; ok || port == 0 {
+		return nil, 0, errors.New("port unavailable")
+	}
+
+	b := &testBind{
+		network: network,
+		port:    port,
+		in:      make(chan testPacket, 64),
+		closed:  make(chan struct{}),
+	}
+	network.ports[port] = b
+
+	return b, port, nil
+}
+
+var errBindClosed = errors.New("bind closed")
+
+type testBind struct {
+	network   *testNetwork
+	port      uint16
+	in        chan testPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (b *testBind) receive(buff []byte) (int, conn.Endpoint, error) {
+	select {
+	case packet := <-b.in:
+		ep, err := conn.CreateEndpoint("127.0.0.1:" + strconv.Itoa(int(packet.from)))
+		if err != nil {
+			return 0, nil, err
+		}
+		return copy(buff, packet.data), ep, nil
+	case <-b.closed:
+		return 0, nil, errBindClosed
+	}
+}
+
+func (b *testBind) ReceiveIPv4(buff []byte) (int, conn.Endpoint, error) {
+	return b.receive(buff)
+}
+
+func (b *testBind) ReceiveIPv6(buff []byte) (int, conn.Endpoint, error) {
+	<-b.closed
+	return 0, nil, errBindClosed
+}
+
+func (b *testBind) Send(buff []byte, ep conn.Endpoint) error {
+	_, port, err := net.SplitHostPort(ep.DstToString())
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	b.network.Lock()
+	dst := b.network.ports[uint16(n)]
+	b.network.Unlock()
+
+	if dst == nil {
+		return nil // lost
+	}
+	select {
+	case dst.in <- testPacket{data: append([]byte(nil), buff...), from: b.port}:
+	default:
+	}
+	return nil
+}
+
+func (b *testBind) Close() error {
+	b.closeOnce.Do(func() {
+		b.network.Lock()
+		delete(b.network.ports, b.port)
+		b.network.Unlock()
+		close(b.closed)
+	})
+	return nil
+}
+
+func (b *testBind) LastMark() uint32          { return 0 }
+func (b *testBind) SetMark(mark uint32) error { return nil }
@@ -1,9 +1,12 @@
 package wgctrl
 
 import (
+	"context"
+	"crypto/tls"
 	"os"
 
 	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wginternal"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgremote"
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
@@ -29,6 +32,24 @@ func New() (*Client, error) {
 	}, nil
 }
 
+// NewRemote creates a new Client which controls the devices of a remote
+// wireguard-go through its management API, see package wgapi, instead of
+// the devices on this system.
+//
+// addr is either unix:PATH or the host:port of a TCP listener. Over TCP the
+// Client authenticates with creds, which must hold its certificate and the
+// CAs of the server; wgapi.ClientTLSConfig loads them from files.
+func NewRemote(addr string, creds *tls.Config) (*Client, error) {
+	c, err := wgremote.New(addr, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		cs: []wginternal.Client{c},
+	}, nil
+}
+
 // Close releases resources used by a Client.
 func (c *Client) Close() error {
 	for _, wgc := range c.cs {
@@ -75,6 +96,69 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 	return nil, os.ErrNotExist
 }
 
+// DeviceWithSecrets retrieves a WireGuard device by its interface name, like
+// Device, along with its private and preshared keys. It returns an error if
+// the device may only be read redacted, e.g. through a management API which
+// does not grant secrets to the caller.
+func (c *Client) DeviceWithSecrets(name string) (*wgtypes.Device, error) {
+	for _, wgc := range c.cs {
+		d, err := wgc.DeviceWithSecrets(name)
+		switch {
+		case err == nil:
+			return d, nil
+		case os.IsNotExist(err):
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// Peer retrieves a single peer of a WireGuard device by its public key,
+// without retrieving the other peers.
+//
+// If the device specified by name or the peer does not exist, an error is
+// returned which can be checked using os.IsNotExist.
+func (c *Client) Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	for _, wgc := range c.cs {
+		p, err := wgc.Peer(name, key)
+		switch {
+		case err == nil:
+			return p, nil
+		case os.IsNotExist(err):
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// PeersPage retrieves a page of the peers of a WireGuard device, ordered by
+// public key. Large peer tables can be walked page by page by passing the
+// Next value of each page as the Cursor of the following request.
+//
+// If the device specified by name does not exist or is not a WireGuard device,
+// an error is returned which can be checked using os.IsNotExist.
+func (c *Client) PeersPage(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error) {
+	for _, wgc := range c.cs {
+		p, err := wgc.PeersPage(name, opts)
+		switch {
+		case err == nil:
+			return p, nil
+		case os.IsNotExist(err):
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
 // ConfigureDevice configures a WireGuard device by its interface name.
 //
 // Because the zero value of some Go types may be significant to WireGuard for
@@ -83,6 +167,9 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 //
 // If the device specified by name does not exist or is not a WireGuard device,
 // an error is returned which can be checked using os.IsNotExist.
+//
+// If a userspace device rejects the configuration, none of it is applied and
+// the error is a *wgtypes.ConfigureError naming the offending line.
 func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	for _, wgc := range c.cs {
 		err := wgc.ConfigureDevice(name, cfg)
@@ -98,3 +185,29 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 
 	return os.ErrNotExist
 }
+
+// Watch calls fn with the events of a WireGuard device, such as completed
+// handshakes, roaming peers and changes of keys, as they happen. It blocks
+// until ctx is done, returning ctx.Err(), or until the device ends the
+// stream, returning nil. Only userspace devices report events.
+//
+// A device drops the events of a watcher which does not keep up; the
+// Dropped field of the next event counts them.
+//
+// If the device specified by name does not exist or is not a WireGuard device,
+// an error is returned which can be checked using os.IsNotExist.
+func (c *Client) Watch(ctx context.Context, name string, fn func(wgtypes.Event)) error {
+	for _, wgc := range c.cs {
+		err := wgc.Watch(ctx, name, fn)
+		switch {
+		case err == nil:
+			return nil
+		case os.IsNotExist(err):
+			continue
+		default:
+			return err
+		}
+	}
+
+	return os.ErrNotExist
+}
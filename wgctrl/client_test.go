@@ -1,6 +1,7 @@
 package wgctrl
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
@@ -225,11 +226,77 @@ func TestClientConfigureDevice(t *testing.T) {
 	}
 }
 
+func TestClientPeer(t *testing.T) {
+	okPeer := &wgtypes.Peer{PublicKey: wgtypes.Key{0x02}}
+
+	c := &Client{
+		cs: []wginternal.Client{
+			&testClient{PeerFunc: func(_ string, _ wgtypes.Key) (*wgtypes.Peer, error) {
+				return nil, os.ErrNotExist
+			}},
+			&testClient{PeerFunc: func(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+				if name != "wg0" {
+					return nil, os.ErrNotExist
+				}
+				return okPeer, nil
+			}},
+		},
+	}
+
+	p, err := c.Peer("wg0", okPeer.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to get peer: %v", err)
+	}
+	if diff := cmp.Diff(okPeer, p); diff != "" {
+		t.Fatalf("unexpected peer (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Peer("wg1", okPeer.PublicKey); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, but got: %v", err)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	event := wgtypes.Event{Type: wgtypes.HandshakeEvent, PublicKey: wgtypes.Key{0x02}}
+
+	c := &Client{
+		cs: []wginternal.Client{
+			&testClient{WatchFunc: func(_ context.Context, _ string, _ func(wgtypes.Event)) error {
+				return os.ErrNotExist
+			}},
+			&testClient{WatchFunc: func(_ context.Context, name string, fn func(wgtypes.Event)) error {
+				if name != "wg0" {
+					return os.ErrNotExist
+				}
+				fn(event)
+				return nil
+			}},
+		},
+	}
+
+	var events []wgtypes.Event
+	if err := c.Watch(context.Background(), "wg0", func(e wgtypes.Event) {
+		events = append(events, e)
+	}); err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	if diff := cmp.Diff([]wgtypes.Event{event}, events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	if err := c.Watch(context.Background(), "wg1", func(wgtypes.Event) {}); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, but got: %v", err)
+	}
+}
+
 type testClient struct {
 	CloseFunc           func() error
 	DevicesFunc         func() ([]*wgtypes.Device, error)
 	DeviceFunc          func(name string) (*wgtypes.Device, error)
+	PeerFunc            func(name string, key wgtypes.Key) (*wgtypes.Peer, error)
+	PeersPageFunc       func(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error)
 	ConfigureDeviceFunc func(name string, cfg wgtypes.Config) error
+	WatchFunc           func(ctx context.Context, name string, fn func(wgtypes.Event)) error
 }
 
 func (c *testClient) Close() error                        { return c.CloseFunc() }
@@ -237,6 +304,18 @@ func (c *testClient) Devices() ([]*wgtypes.Device, error) { return c.DevicesFunc
 func (c *testClient) Device(name string) (*wgtypes.Device, error) {
 	return c.DeviceFunc(name)
 }
+func (c *testClient) DeviceWithSecrets(name string) (*wgtypes.Device, error) {
+	return c.DeviceFunc(name)
+}
+func (c *testClient) Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	return c.PeerFunc(name, key)
+}
+func (c *testClient) PeersPage(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error) {
+	return c.PeersPageFunc(name, opts)
+}
 func (c *testClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	return c.ConfigureDeviceFunc(name, cfg)
 }
+func (c *testClient) Watch(ctx context.Context, name string, fn func(wgtypes.Event)) error {
+	return c.WatchFunc(ctx, name, fn)
+}
@@ -1,6 +1,7 @@
 package wginternal
 
 import (
+	"context"
 	"errors"
 	"io"
 
@@ -17,5 +18,9 @@ type Client interface {
 	io.Closer
 	Devices() ([]*wgtypes.Device, error)
 	Device(name string) (*wgtypes.Device, error)
+	DeviceWithSecrets(name string) (*wgtypes.Device, error)
+	Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error)
+	PeersPage(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error)
 	ConfigureDevice(name string, cfg wgtypes.Config) error
+	Watch(ctx context.Context, name string, fn func(wgtypes.Event)) error
 }
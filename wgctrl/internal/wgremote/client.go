@@ -0,0 +1,316 @@
+package wgremote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wginternal"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+var _ wginternal.Client = &Client{}
+
+// timeout bounds every request to the remote device.
+const timeout = 30 * time.Second
+
+// maxResponseSize bounds the answers read from the remote device.
+const maxResponseSize = 64 << 20
+
+// A Client provides access to the devices of a remote wireguard-go.
+type Client struct {
+	base string
+	c    *http.Client
+
+	// stream shares the transport of c without its timeout, for the
+	// unbounded answers of Watch.
+	stream *http.Client
+}
+
+// New creates a new Client of the management API at addr, either unix:PATH
+// or the host:port of a TCP listener, which is reached over TLS with
+// tlsConfig.
+func New(addr string, tlsConfig *tls.Config) (*Client, error) {
+	var base string
+	var transport *http.Transport
+
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+
+		base = "http://wireguard"
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	} else {
+		if tlsConfig == nil {
+			return nil, errors.New("wgremote: TCP address requires TLS credentials")
+		}
+
+		base = "https://" + addr
+		transport = &http.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+	}
+
+	return &Client{
+		base: base,
+		c: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		stream: &http.Client{
+			Transport: transport,
+		},
+	}, nil
+}
+
+// Close implements wginternal.Client.
+func (c *Client) Close() error {
+	c.c.CloseIdleConnections()
+	return nil
+}
+
+// Devices implements wginternal.Client.
+func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	var listed []*wgtypes.Device
+	if err := c.do(http.MethodGet, "/v1/devices", nil, &listed); err != nil {
+		return nil, err
+	}
+
+	wgds := make([]*wgtypes.Device, 0, len(listed))
+	for _, d := range listed {
+		wgd, err := c.Device(d.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		wgds = append(wgds, wgd)
+	}
+
+	return wgds, nil
+}
+
+// Device implements wginternal.Client.
+func (c *Client) Device(name string) (*wgtypes.Device, error) {
+	var d wgtypes.Device
+	if err := c.do(http.MethodGet, devicePath(name), nil, &d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// DeviceWithSecrets implements wginternal.Client.
+func (c *Client) DeviceWithSecrets(name string) (*wgtypes.Device, error) {
+	var d wgtypes.Device
+	err := c.do(http.MethodGet, devicePath(name)+"?secrets=1", nil, &d)
+	var serr *statusError
+	if errors.As(err, &serr) && serr.status == http.StatusForbidden {
+		return nil, fmt.Errorf("wgremote: the management API does not grant the private and preshared keys to this client, "+
+			"it must be listed in --api-secrets: %s", serr.message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Peer implements wginternal.Client.
+func (c *Client) Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	var p wgtypes.Peer
+	if err := c.do(http.MethodGet, peerPath(name, key), nil, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// PeersPage implements wginternal.Client.
+func (c *Client) PeersPage(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error) {
+	query := make(url.Values)
+	if len(opts.Prefix) > 0 {
+		query.Set("prefix", hex.EncodeToString(opts.Prefix))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	path := devicePath(name) + "/peers"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var pp wgtypes.PeersPage
+	if err := c.do(http.MethodGet, path, nil, &pp); err != nil {
+		return nil, err
+	}
+
+	return &pp, nil
+}
+
+// ConfigureDevice implements wginternal.Client.
+func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return c.do(http.MethodPatch, devicePath(name), cfg, nil)
+}
+
+// Watch implements wginternal.Client.
+func (c *Client) Watch(ctx context.Context, name string, fn func(wgtypes.Event)) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+devicePath(name)+"/events", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.stream.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return os.ErrNotExist
+	case res.StatusCode >= 300:
+		b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+		if err != nil {
+			return err
+		}
+		return responseError(res.StatusCode, b)
+	}
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var e wgtypes.Event
+		err := dec.Decode(&e)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return fmt.Errorf("wgremote: invalid event: %v", err)
+		}
+
+		fn(e)
+	}
+}
+
+func devicePath(name string) string {
+	return "/v1/devices/" + url.PathEscape(name)
+}
+
+func peerPath(name string, key wgtypes.Key) string {
+	return devicePath(name) + "/peers/" + base64.URLEncoding.EncodeToString(key)
+}
+
+// A statusError is an unsuccessful answer which is not an error of the
+// device.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("wgremote: HTTP status %d: %s", e.status, e.message)
+}
+
+type jsonError struct {
+	Errno   *int64 `json:"errno"`
+	Line    *int   `json:"line"`
+	Message string `json:"message"`
+}
+
+// do sends a request with the JSON encoding of in, if not nil, and decodes
+// the answer into out, if not nil.
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return os.ErrNotExist
+	case res.StatusCode >= 300:
+		return responseError(res.StatusCode, b)
+	case out == nil:
+		return nil
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("wgremote: invalid response to %s %s: %v", method, path, err)
+	}
+
+	return nil
+}
+
+// responseError returns the error of an unsuccessful answer. Errors of the
+// device are returned as a *wgtypes.ConfigureError, like the userspace
+// configuration protocol does.
+func responseError(status int, b []byte) error {
+	var v jsonError
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("wgremote: unexpected HTTP status %d", status)
+	}
+
+	if v.Errno == nil {
+		return &statusError{status: status, message: v.Message}
+	}
+
+	cerr := &wgtypes.ConfigureError{
+		Errno:   syscall.Errno(*v.Errno),
+		Message: v.Message,
+	}
+	if v.Line != nil {
+		cerr.Line = *v.Line
+	}
+
+	return cerr
+}
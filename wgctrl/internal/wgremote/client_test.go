@@ -0,0 +1,418 @@
+package wgremote_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/tun/tuntest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgremote"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgapi"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestClient(t *testing.T) {
+	ca := newTestCA(t)
+	c, _ := testServer(t, "127.0.0.1:0", ca.serverConfig(t), func(l net.Listener) (*wgremote.Client, error) {
+		return wgremote.New(l.Addr().String(), ca.clientConfig(t, ca))
+	})
+
+	key := wgtest.MustPublicKey()
+	cfg := wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  key,
+			AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")},
+		}},
+	}
+	if err := c.ConfigureDevice("wg0", cfg); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "wg0" || devices[0].Type != wgtypes.Userspace || len(devices[0].Peers) != 1 {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+
+	p, err := c.Peer("wg0", key)
+	if err != nil {
+		t.Fatalf("failed to get peer: %v", err)
+	}
+	if diff := cmp.Diff(cfg.Peers[0].AllowedIPs, p.AllowedIPs); diff != "" {
+		t.Fatalf("unexpected allowed IPs (-want +got):\n%s", diff)
+	}
+
+	pp, err := c.PeersPage("wg0", wgtypes.PeersPageOptions{Prefix: key[:4], Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to get peers page: %v", err)
+	}
+	if len(pp.Peers) != 1 || pp.Next != "" {
+		t.Fatalf("unexpected page: %+v", pp)
+	}
+
+	if _, err := c.Peer("wg0", wgtest.MustPublicKey()); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing peer, got %v", err)
+	}
+	if _, err := c.Device("wg1"); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing device, got %v", err)
+	}
+
+	keepalive := 100000 * time.Second
+	cfg.Peers[0].PersistentKeepaliveInterval = &keepalive
+	err = c.ConfigureDevice("wg0", cfg)
+
+	var cerr *wgtypes.ConfigureError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a configure error, got %v", err)
+	}
+	want := &wgtypes.ConfigureError{
+		Errno:   syscall.Errno(22),
+		Line:    2,
+		Message: `invalid persistent_keepalive_interval: "100000"`,
+	}
+	if diff := cmp.Diff(want, cerr); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientUnauthenticated(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	c, _ := testServer(t, "127.0.0.1:0", ca.serverConfig(t), func(l net.Listener) (*wgremote.Client, error) {
+		// A certificate of another CA is refused.
+		return wgremote.New(l.Addr().String(), other.clientConfig(t, ca))
+	})
+
+	if _, err := c.Devices(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestClientUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping, Unix sockets are not used on Windows")
+	}
+
+	addr := "unix:" + filepath.Join(t.TempDir(), "wg0.api")
+	c, _ := testServer(t, addr, nil, func(net.Listener) (*wgremote.Client, error) {
+		return wgremote.New(addr, nil)
+	})
+
+	if _, err := c.Device("wg0"); err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping, Unix sockets are not used on Windows")
+	}
+
+	addr := "unix:" + filepath.Join(t.TempDir(), "wg0.api")
+	c, _ := testServer(t, addr, nil, func(net.Listener) (*wgremote.Client, error) {
+		return wgremote.New(addr, nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan wgtypes.Event, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Watch(ctx, "wg0", func(e wgtypes.Event) {
+			select {
+			case events <- e:
+			default:
+			}
+		})
+	}()
+
+	// The watch may not be in place yet, so add peers until one is reported.
+	key := wgtest.MustPublicKey()
+	var got wgtypes.Event
+	for got.Type == wgtypes.UnknownEvent {
+		cfg := wgtypes.Config{
+			ReplacePeers: true,
+			Peers:        []wgtypes.PeerConfig{{PublicKey: key}},
+		}
+		if err := c.ConfigureDevice("wg0", cfg); err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+
+		select {
+		case got = <-events:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if got.Type != wgtypes.PeerAddedEvent && got.Type != wgtypes.PeerRemovedEvent {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	if !bytes.Equal(got.PublicKey, key) {
+		t.Fatalf("unexpected event key: %s", got.PublicKey)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected a canceled watch, got %v", err)
+	}
+
+	if err := c.Watch(context.Background(), "wg1", func(wgtypes.Event) {}); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing device, got %v", err)
+	}
+}
+
+func TestClientSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping, Unix sockets are not used on Windows")
+	}
+
+	addr := "unix:" + filepath.Join(t.TempDir(), "wg0.api")
+	c, api := testServer(t, addr, nil, func(net.Listener) (*wgremote.Client, error) {
+		return wgremote.New(addr, nil)
+	})
+
+	privateKey := mustGenerate(t, wgtypes.GeneratePrivateKey)
+	psk1, psk2 := mustGenerate(t, wgtypes.GenerateKey), mustGenerate(t, wgtypes.GenerateKey)
+	peer1, peer2 := wgtest.MustPublicKey(), wgtest.MustPublicKey()
+	err := c.ConfigureDevice("wg0", wgtypes.Config{
+		PrivateKey: &privateKey,
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: peer1, PresharedKey: &psk1, AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")}},
+			{PublicKey: peer2, PresharedKey: &psk2, AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	// Without secrets the keys are withheld, and the snapshot may not be
+	// diffed against.
+	d, err := c.Device("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	if !d.Redacted || d.PrivateKey != nil || presharedKey(d, peer1) != nil {
+		t.Fatalf("unexpected redacted device: %+v", d)
+	}
+	if _, err := wgtypes.Diff(d, &wgtypes.Config{}); err != wgtypes.ErrRedacted {
+		t.Fatalf("expected ErrRedacted, got: %v", err)
+	}
+	if _, err := c.DeviceWithSecrets("wg0"); err == nil || !strings.Contains(err.Error(), "--api-secrets") {
+		t.Fatalf("expected secrets to be forbidden, got: %v", err)
+	}
+
+	api.AllowSecrets(func(*http.Request) bool { return true })
+
+	// showconf, then setconf of its output, keeps every key.
+	d, err = c.DeviceWithSecrets("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device with secrets: %v", err)
+	}
+	text, err := d.Config().MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	cfg, err := wgtypes.ParseConfig("wg0", bytes.NewReader(text))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	cfg.ReplacePeers = true
+	if err := c.ConfigureDevice("wg0", *cfg); err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+
+	d, err = c.DeviceWithSecrets("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device with secrets: %v", err)
+	}
+	if d.Redacted || !bytes.Equal(d.PrivateKey, privateKey) || !bytes.Equal(presharedKey(d, peer1), psk1) ||
+		!bytes.Equal(presharedKey(d, peer2), psk2) {
+		t.Fatalf("keys lost by showconf and setconf: %+v", d)
+	}
+
+	// syncconf of a file without the first preshared key removes it, and
+	// leaves the second peer alone.
+	cfg.ReplacePeers = false
+	for i := range cfg.Peers {
+		if bytes.Equal(cfg.Peers[i].PublicKey, peer1) {
+			cfg.Peers[i].PresharedKey = nil
+		}
+	}
+	plan, err := wgtypes.Diff(d, cfg)
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if len(plan.Peers) != 1 || !bytes.Equal(plan.Peers[0].PublicKey, peer1) {
+		t.Fatalf("unexpected plan: %+v", plan.Peers)
+	}
+	if err := c.ConfigureDevice("wg0", plan.Config()); err != nil {
+		t.Fatalf("failed to sync config: %v", err)
+	}
+
+	d, err = c.DeviceWithSecrets("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device with secrets: %v", err)
+	}
+	if presharedKey(d, peer1) != nil || !bytes.Equal(presharedKey(d, peer2), psk2) {
+		t.Fatalf("unexpected preshared keys after syncconf: %+v", d.Peers)
+	}
+}
+
+// presharedKey returns the preshared key of the peer of d with key.
+func presharedKey(d *wgtypes.Device, key wgtypes.Key) wgtypes.Key {
+	for _, p := range d.Peers {
+		if bytes.Equal(p.PublicKey, key) {
+			return p.PresharedKey
+		}
+	}
+	return nil
+}
+
+func TestNewRequiresTLS(t *testing.T) {
+	if _, err := wgremote.New("192.0.2.1:8443", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// testServer serves the API of a new device on addr and returns a client
+// created by newClient.
+func testServer(t *testing.T, addr string, tlsConfig *tls.Config, newClient func(net.Listener) (*wgremote.Client, error)) (*wgremote.Client, *wgapi.Server) {
+	t.Helper()
+
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	t.Cleanup(dev.Close)
+
+	l, err := wgapi.Listen(addr, tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	api := wgapi.NewServer("wg0", dev, nil)
+	go api.Serve(l)
+
+	c, err := newClient(l)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, api
+}
+
+// A testCA issues the certificates of a test.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key := mustKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a certificate for localhost with the extended key usage.
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+
+	key := mustKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func (ca *testCA) serverConfig(t *testing.T) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// clientConfig returns the configuration of a client holding a certificate
+// of ca, which trusts the servers of serverCA.
+func (ca *testCA) clientConfig(t *testing.T, serverCA *testCA) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageClientAuth)},
+		RootCAs:      serverCA.pool(),
+	}
+}
+
+func mustGenerate(t *testing.T, generate func() (wgtypes.Key, error)) wgtypes.Key {
+	t.Helper()
+
+	k, err := generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
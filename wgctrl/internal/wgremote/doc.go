@@ -0,0 +1,6 @@
+// Package wgremote provides internal access to the devices of a remote
+// wireguard-go through its management API, see package wgapi.
+//
+// This package is internal-only and not meant for end users to consume.
+// Please use package wgctrl (an abstraction over this package) instead.
+package wgremote
@@ -1,6 +1,7 @@
 package wguser
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -40,8 +41,20 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 		return nil, err
 	}
 
+	// Skip read-only sockets of devices whose regular socket is present, so
+	// that each device is listed once.
+	regular := make(map[string]bool)
+	for _, d := range devices {
+		regular[deviceName(d)] = true
+	}
+
 	var wgds []*wgtypes.Device
 	for _, d := range devices {
+		name := deviceName(d)
+		if strings.HasSuffix(name, readOnlySuffix) && regular[strings.TrimSuffix(name, readOnlySuffix)] {
+			continue
+		}
+
 		wgd, err := c.getDevice(d)
 		if err != nil {
 			return nil, err
@@ -71,6 +84,41 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 	return nil, os.ErrNotExist
 }
 
+// DeviceWithSecrets implements wginternal.Client.
+func (c *Client) DeviceWithSecrets(name string) (*wgtypes.Device, error) {
+	d, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+	if d.Redacted {
+		// Only the read-only socket could be used.
+		return nil, fmt.Errorf("wguser: %s was read from its read-only socket, which leaves out the private and preshared keys: %w",
+			name, os.ErrPermission)
+	}
+
+	return d, nil
+}
+
+// Peer implements wginternal.Client.
+func (c *Client) Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	d, err := c.findDevice(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getPeer(d, key)
+}
+
+// PeersPage implements wginternal.Client.
+func (c *Client) PeersPage(name string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error) {
+	d, err := c.findDevice(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getPeersPage(d, opts)
+}
+
 // ConfigureDevice implements wginternal.Client.
 func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	devices, err := c.find()
@@ -89,6 +137,45 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	return os.ErrNotExist
 }
 
+// findDevice returns the path of a device specified by its name.
+func (c *Client) findDevice(name string) (string, error) {
+	devices, err := c.find()
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range devices {
+		if name == deviceName(d) {
+			return d, nil
+		}
+	}
+
+	return "", os.ErrNotExist
+}
+
+// readOnlySuffix is the suffix of the names of read-only device sockets,
+// <device>.ro.sock.
+const readOnlySuffix = ".ro"
+
+// dialRead connects to the socket of device in order to read from it. If the
+// caller may not use the regular socket, such as an unprivileged user, it
+// falls back to the read-only socket next to it, which leaves out the secrets.
+func (c *Client) dialRead(device string) (net.Conn, error) {
+	conn, err := c.dial(device)
+	if err == nil || !errors.Is(err, os.ErrPermission) ||
+		!strings.HasSuffix(device, ".sock") || strings.HasSuffix(device, readOnlySuffix+".sock") {
+		return conn, err
+	}
+
+	conn, roErr := c.dial(strings.TrimSuffix(device, ".sock") + readOnlySuffix + ".sock")
+	if roErr != nil {
+		// Report why the regular socket could not be used.
+		return nil, err
+	}
+
+	return conn, nil
+}
+
 // deviceName infers a device name from an absolute file path with extension.
 func deviceName(sock string) string {
 	return strings.TrimSuffix(filepath.Base(sock), filepath.Ext(sock))
@@ -127,3 +127,5 @@ func testClient(t *testing.T, res []byte) (*Client, func() []byte) {
 func durPtr(d time.Duration) *time.Duration { return &d }
 func keyPtr(k wgtypes.Key) *wgtypes.Key     { return &k }
 func intPtr(v int) *int                     { return &v }
+func timePtr(t time.Time) *time.Time        { return &t }
+func strPtr(s string) *string               { return &s }
@@ -1,12 +1,15 @@
 package wguser
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
@@ -24,7 +27,7 @@ func (c *Client) configureDevice(device string, cfg wgtypes.Config) error {
 	buf.WriteString("set=1\n")
 
 	// Add any necessary configuration from cfg, then finish with an empty line.
-	writeConfig(&buf, cfg)
+	WriteConfig(&buf, cfg)
 	buf.WriteString("\n")
 
 	// Apply configuration for the device and then check the error number.
@@ -32,25 +35,58 @@ func (c *Client) configureDevice(device string, cfg wgtypes.Config) error {
 		return err
 	}
 
-	res := make([]byte, 32)
-	n, err := conn.Read(res)
-	if err != nil {
-		return err
-	}
+	return readSetResponse(conn)
+}
 
-	// errno=0 indicates success, anything else returns an error number that
-	// matches definitions from errno.h.
-	str := strings.TrimSpace(string(res[:n]))
-	if str != "errno=0" {
-		// TODO(mdlayher): return actual errno on Linux?
-		return os.NewSyscallError("read", fmt.Errorf("wguser: %s", str))
+// readSetResponse reads the answer of a device to a set request. errno=0
+// indicates success, anything else returns an error number that matches
+// definitions from errno.h, which may be preceded by the offending line of
+// the request and a description of the error.
+func readSetResponse(r io.Reader) error {
+	cerr := new(wgtypes.ConfigureError)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("wguser: invalid response line: %q", s.Text())
+		}
+
+		switch kv[0] {
+		case "errno":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return fmt.Errorf("wguser: invalid errno: %q", kv[1])
+			}
+			if n == 0 {
+				return nil
+			}
+			if n < 0 {
+				n = -n
+			}
+			cerr.Errno = syscall.Errno(n)
+			return cerr
+		case "line":
+			cerr.Line, _ = strconv.Atoi(kv[1])
+		case "message":
+			cerr.Message = kv[1]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
 	}
 
-	return nil
+	return io.ErrUnexpectedEOF
 }
 
-// writeConfig writes textual configuration to w as specified by cfg.
-func writeConfig(w io.Writer, cfg wgtypes.Config) {
+// WriteConfig writes textual configuration to w as specified by cfg: the
+// lines of a set request, without the leading set=1 and the terminating
+// empty line.
+func WriteConfig(w io.Writer, cfg wgtypes.Config) {
+	if cfg.RolloverWindow != nil {
+		fmt.Fprintf(w, "rollover_window=%d\n", int(cfg.RolloverWindow.Seconds()))
+	}
+
 	if cfg.PrivateKey != nil {
 		fmt.Fprintf(w, "private_key=%s\n", hexKey(*cfg.PrivateKey))
 	}
@@ -63,6 +99,21 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 		fmt.Fprintf(w, "fwmark=%d\n", *cfg.FirewallMark)
 	}
 
+	// the down threshold comes first, so that the others are checked
+	// against the new one
+
+	if cfg.LivenessDownAfter != nil {
+		fmt.Fprintf(w, "liveness_down_after=%d\n", int(cfg.LivenessDownAfter.Seconds()))
+	}
+
+	if cfg.LivenessDegradedAfter != nil {
+		fmt.Fprintf(w, "liveness_degraded_after=%d\n", int(cfg.LivenessDegradedAfter.Seconds()))
+	}
+
+	if cfg.LivenessProbeInterval != nil {
+		fmt.Fprintf(w, "liveness_probe_interval=%d\n", int(cfg.LivenessProbeInterval.Seconds()))
+	}
+
 	if cfg.ReplacePeers {
 		fmt.Fprintln(w, "replace_peers=true")
 	}
@@ -78,10 +129,42 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 			fmt.Fprintln(w, "update_only=true")
 		}
 
+		if p.Name != nil {
+			fmt.Fprintf(w, "name=%s\n", *p.Name)
+		}
+
+		if p.ReplaceAnnotations {
+			fmt.Fprintln(w, "replace_annotations=true")
+		}
+
+		for _, key := range sortedKeys(p.Annotations) {
+			fmt.Fprintf(w, "annotation=%s=%s\n", key, p.Annotations[key])
+		}
+
 		if p.PresharedKey != nil {
 			fmt.Fprintf(w, "preshared_key=%s\n", hexKey(*p.PresharedKey))
 		}
 
+		if p.NextPresharedKey != nil {
+			fmt.Fprintf(w, "next_preshared_key=%s\n", hexKey(*p.NextPresharedKey))
+		}
+
+		if p.NextPresharedKeyActivation != nil {
+			var secs int64
+			if !p.NextPresharedKeyActivation.IsZero() {
+				secs = p.NextPresharedKeyActivation.Unix()
+			}
+			fmt.Fprintf(w, "next_preshared_key_activation=%d\n", secs)
+		}
+
+		if p.ExpiresAt != nil {
+			var secs int64
+			if !p.ExpiresAt.IsZero() {
+				secs = p.ExpiresAt.Unix()
+			}
+			fmt.Fprintf(w, "expires_at=%d\n", secs)
+		}
+
 		if p.Endpoint != nil {
 			fmt.Fprintf(w, "endpoint=%s\n", p.Endpoint.String())
 		}
@@ -100,6 +183,17 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 	}
 }
 
+// sortedKeys returns the keys of m in order, so that requests are
+// deterministic.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // hexKey encodes a wgtypes.Key into a hexadecimal string.
 func hexKey(k wgtypes.Key) string {
 	return hex.EncodeToString(k[:])
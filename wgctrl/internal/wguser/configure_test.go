@@ -1,11 +1,15 @@
 package wguser
 
 import (
+	"errors"
 	"net"
 	"os"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
@@ -78,6 +82,46 @@ func TestClientConfigureDeviceError(t *testing.T) {
 	}
 }
 
+func TestClientConfigureDeviceRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		res  string
+		want *wgtypes.ConfigureError
+	}{
+		{
+			name: "errno only",
+			res:  "errno=-22\n\n",
+			want: &wgtypes.ConfigureError{Errno: syscall.Errno(22)},
+		},
+		{
+			name: "line and message",
+			res:  "line=6\nmessage=invalid allowed_ip: \"10.0.0.300/32\"\nerrno=-22\n\n",
+			want: &wgtypes.ConfigureError{
+				Errno:   syscall.Errno(22),
+				Line:    6,
+				Message: `invalid allowed_ip: "10.0.0.300/32"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, []byte(tt.res))
+			defer done()
+
+			err := c.ConfigureDevice(testDevice, wgtypes.Config{})
+
+			var cerr *wgtypes.ConfigureError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("expected a configure error, but got: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, cerr); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestClientConfigureDeviceOK(t *testing.T) {
 	tests := []struct {
 		name string
@@ -95,6 +139,38 @@ func TestClientConfigureDeviceOK(t *testing.T) {
 			},
 			req: "set=1\nprivate_key=0000000000000000000000000000000000000000000000000000000000000000\n\n",
 		},
+		{
+			name: "ok, rollover",
+			cfg: wgtypes.Config{
+				PrivateKey:     keyPtr(wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")),
+				RolloverWindow: durPtr(10 * time.Minute),
+			},
+			req: "set=1\nrollover_window=600\nprivate_key=e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a\n\n",
+		},
+		{
+			name: "ok, preshared key schedule",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                  wgtest.MustHexKey("02e330d5efee687eb475edbca2893db68d14ef130a9cab4888b2e97342674e0d54"),
+					NextPresharedKey:           keyPtr(wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")),
+					NextPresharedKeyActivation: timePtr(time.Unix(1600000000, 0)),
+				}},
+			},
+			req: "set=1\npublic_key=02e330d5efee687eb475edbca2893db68d14ef130a9cab4888b2e97342674e0d54\nnext_preshared_key=188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52\nnext_preshared_key_activation=1600000000\n\n",
+		},
+		{
+			name: "ok, labels and expiry",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:          wgtest.MustHexKey("02e330d5efee687eb475edbca2893db68d14ef130a9cab4888b2e97342674e0d54"),
+					Name:               strPtr("alice laptop"),
+					ReplaceAnnotations: true,
+					Annotations:        map[string]string{"team": "ops", "owner": "alice"},
+					ExpiresAt:          timePtr(time.Unix(1600000000, 0)),
+				}},
+			},
+			req: "set=1\npublic_key=02e330d5efee687eb475edbca2893db68d14ef130a9cab4888b2e97342674e0d54\nname=alice laptop\nreplace_annotations=true\nannotation=owner=alice\nannotation=team=ops\nexpires_at=1600000000\n\n",
+		},
 		{
 			name: "ok, all",
 			cfg: wgtypes.Config{
@@ -3,13 +3,20 @@
 package wguser
 
 import (
+	"encoding/hex"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 )
 
 func TestUNIX_findUNIXSockets(t *testing.T) {
@@ -50,6 +57,88 @@ func TestUNIX_findUNIXSockets(t *testing.T) {
 	}
 }
 
+func TestUNIX_readOnlyFallback(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wguser-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The regular socket may not be used, the read-only one answers with
+	// the redacted device.
+	path := filepath.Join(tmp, testDevice+".sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	defer l.Close()
+	if err := os.Chmod(path, 0); err != nil {
+		t.Fatalf("failed to change socket mode: %v", err)
+	}
+
+	ro, err := net.Listen("unix", filepath.Join(tmp, testDevice+".ro.sock"))
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	defer ro.Close()
+
+	publicKey := wgtest.MustPublicKey()
+	go func() {
+		for {
+			c, err := ro.Accept()
+			if err != nil {
+				return
+			}
+
+			_, _ = c.Read(make([]byte, 4096))
+			_, _ = io.WriteString(c, "device_public_key="+hex.EncodeToString(publicKey)+"\nredacted=true\nerrno=0\n\n")
+			_ = c.Close()
+		}
+	}()
+
+	c := &Client{
+		find: testFind(tmp),
+		dial: dial,
+	}
+	if os.Geteuid() == 0 {
+		// The mode does not apply to root, refuse the connection like the
+		// kernel does for other users.
+		c.dial = func(device string) (net.Conn, error) {
+			if fi, err := os.Stat(device); err == nil && fi.Mode().Perm() == 0 {
+				return nil, &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", syscall.EACCES)}
+			}
+			return dial(device)
+		}
+	}
+
+	want := []*wgtypes.Device{{
+		Name:      testDevice,
+		Type:      wgtypes.Userspace,
+		PublicKey: publicKey,
+		Redacted:  true,
+	}}
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	if diff := cmp.Diff(want, devices); diff != "" {
+		t.Fatalf("unexpected Devices (-want +got):\n%s", diff)
+	}
+
+	d, err := c.Device(testDevice)
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	if diff := cmp.Diff(want[0], d); diff != "" {
+		t.Fatalf("unexpected Device (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.DeviceWithSecrets(testDevice); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected a permission error, got: %v", err)
+	}
+}
+
 // testFind produces a Client.find function for integration tests.
 func testFind(dir string) func() ([]string, error) {
 	return func() ([]string, error) {
@@ -9,6 +9,7 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
@@ -20,33 +21,97 @@ import (
 // getDevice gathers device information from a device specified by its path
 // and returns a Device.
 func (c *Client) getDevice(device string) (*wgtypes.Device, error) {
-	conn, err := c.dial(device)
+	d, _, err := c.get(device, "")
+	return d, err
+}
+
+// getPeer retrieves a single peer from a device specified by its path.
+func (c *Client) getPeer(device string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	d, _, err := c.get(device, fmt.Sprintf("public_key=%s\n", hexKey(key)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Peers) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return &d.Peers[0], nil
+}
+
+// getPeersPage retrieves a page of peers from a device specified by its path.
+func (c *Client) getPeersPage(device string, opts wgtypes.PeersPageOptions) (*wgtypes.PeersPage, error) {
+	d, next, err := c.get(device, PeersPageFilter(opts))
 	if err != nil {
 		return nil, err
 	}
+
+	return &wgtypes.PeersPage{
+		Peers: d.Peers,
+		Next:  next,
+	}, nil
+}
+
+// PeersPageFilter returns the filter lines of a get request which selects
+// the page of peers described by opts.
+func PeersPageFilter(opts wgtypes.PeersPageOptions) string {
+	var filter strings.Builder
+	if len(opts.Prefix) > 0 {
+		fmt.Fprintf(&filter, "public_key_prefix=%s\n", hex.EncodeToString(opts.Prefix))
+	}
+	if opts.Cursor != "" {
+		fmt.Fprintf(&filter, "cursor=%s\n", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		fmt.Fprintf(&filter, "limit=%d\n", opts.Limit)
+	}
+
+	return filter.String()
+}
+
+// get sends a get request with optional filter lines to a device specified
+// by its path. It returns the Device and the cursor of the next page of
+// peers, if any.
+func (c *Client) get(device, filter string) (*wgtypes.Device, string, error) {
+	conn, err := c.dialRead(device)
+	if err != nil {
+		return nil, "", err
+	}
 	defer conn.Close()
 
 	// Get information about this device.
-	if _, err := io.WriteString(conn, "get=1\n\n"); err != nil {
-		return nil, err
+	if _, err := io.WriteString(conn, "get=1\n"+filter+"\n"); err != nil {
+		return nil, "", err
 	}
 
 	// Parse the device from the incoming data stream.
-	d, err := parseDevice(conn)
+	d, next, err := ParseDevice(conn)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// TODO(mdlayher): populate interface index too?
 	d.Name = deviceName(device)
 	d.Type = wgtypes.Userspace
 
-	return d, nil
+	return d, next, nil
 }
 
-// parseDevice parses a Device and its Peers from an io.Reader.
-func parseDevice(r io.Reader) (*wgtypes.Device, error) {
+// ParseDevice parses the response to a get request into a Device, leaving
+// its Name and Type to the caller, and returns the cursor of the next page
+// of peers, if any.
+func ParseDevice(r io.Reader) (*wgtypes.Device, string, error) {
 	var dp deviceParser
+	d, err := dp.parse(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return d, dp.next, nil
+}
+
+// parse parses a Device and its Peers from an io.Reader.
+func (dp *deviceParser) parse(r io.Reader) (*wgtypes.Device, error) {
 	s := bufio.NewScanner(r)
 	for s.Scan() {
 		b := s.Bytes()
@@ -55,9 +120,10 @@ func parseDevice(r io.Reader) (*wgtypes.Device, error) {
 			break
 		}
 
-		// All data is in key=value format.
-		kvs := bytes.Split(b, []byte("="))
-		if len(kvs) != 2 {
+		// All data is in key=value format. Only the free text of names and
+		// annotations may contain another '='.
+		kvs := bytes.SplitN(b, []byte("="), 2)
+		if len(kvs) != 2 || bytes.IndexByte(kvs[1], '=') >= 0 && !freeTextKeys[string(kvs[0])] {
 			return nil, fmt.Errorf("wguser: invalid key=value pair: %q", string(b))
 		}
 
@@ -71,6 +137,12 @@ func parseDevice(r io.Reader) (*wgtypes.Device, error) {
 	return dp.Device()
 }
 
+// freeTextKeys are the keys whose values may contain '='.
+var freeTextKeys = map[string]bool{
+	"name":       true,
+	"annotation": true,
+}
+
 // A deviceParser accumulates information about a Device and its Peers.
 type deviceParser struct {
 	d   wgtypes.Device
@@ -79,6 +151,9 @@ type deviceParser struct {
 	parsePeers    bool
 	peers         int
 	hsSec, hsNano int
+
+	// next is the cursor of the next page of peers, if any.
+	next string
 }
 
 // Device returns a Device or any errors that were encountered while parsing
@@ -88,8 +163,11 @@ func (dp *deviceParser) Device() (*wgtypes.Device, error) {
 		return nil, dp.err
 	}
 
-	// Compute remaining fields of the Device now that all parsing is done.
-	dp.d.PublicKey = dp.d.PrivateKey.PublicKey()
+	// Compute remaining fields of the Device now that all parsing is done. A
+	// read-only socket reports the public key in place of the private key.
+	if dp.d.PrivateKey != nil {
+		dp.d.PublicKey = dp.d.PrivateKey.PublicKey()
+	}
 
 	return &dp.d, nil
 }
@@ -105,6 +183,10 @@ func (dp *deviceParser) Parse(key, value string) {
 			dp.err = os.NewSyscallError("read", fmt.Errorf("wguser: errno=%d", errno))
 			return
 		}
+	case "next_cursor":
+		// Follows the last peer of a page, not a field of that peer.
+		dp.next = value
+		return
 	case "public_key":
 		// We've either found the first peer or the next peer.  Stop parsing
 		// Device fields and start parsing Peer fields, including the public
@@ -128,10 +210,48 @@ func (dp *deviceParser) Parse(key, value string) {
 	switch key {
 	case "private_key":
 		dp.d.PrivateKey = dp.parseKey(value)
+	case "device_public_key":
+		dp.d.PublicKey = dp.parseKey(value)
+	case "redacted":
+		dp.d.Redacted = value == "true"
+	case "previous_public_key":
+		dp.d.PreviousPublicKey = dp.parseKey(value)
+	case "rollover_expires":
+		dp.d.RolloverExpires = time.Unix(dp.parseInt64(value), 0)
 	case "listen_port":
 		dp.d.ListenPort = dp.parseInt(value)
 	case "fwmark":
 		dp.d.FirewallMark = dp.parseInt(value)
+	case "liveness_down_after":
+		dp.d.LivenessDownAfter = time.Duration(dp.parseInt(value)) * time.Second
+	case "liveness_degraded_after":
+		dp.d.LivenessDegradedAfter = time.Duration(dp.parseInt(value)) * time.Second
+	case "liveness_probe_interval":
+		dp.d.LivenessProbeInterval = time.Duration(dp.parseInt(value)) * time.Second
+	case "encryption_queue_len":
+		dp.d.EncryptionQueue.Length = dp.parseInt64(value)
+	case "encryption_queue_drops":
+		dp.d.EncryptionQueue.Drops = dp.parseInt64(value)
+	case "decryption_queue_len":
+		dp.d.DecryptionQueue.Length = dp.parseInt64(value)
+	case "decryption_queue_drops":
+		dp.d.DecryptionQueue.Drops = dp.parseInt64(value)
+	case "handshake_queue_len":
+		dp.d.HandshakeQueue.Length = dp.parseInt64(value)
+	case "handshake_queue_drops":
+		dp.d.HandshakeQueue.Drops = dp.parseInt64(value)
+	case "cookie_replies_sent":
+		dp.d.CookieRepliesSent = dp.parseInt64(value)
+	case "ratelimiter_rejects":
+		dp.d.RatelimiterRejects = dp.parseInt64(value)
+	case "decrypt_failures":
+		dp.d.DecryptFailures = dp.parseInt64(value)
+	case "under_load":
+		dp.d.UnderLoad = value == "true"
+	case "handshake_error":
+		dp.parseHandshakeError(value, &dp.d.HandshakeErrors)
+	case "handshake_error_source":
+		dp.parseHandshakeErrorSource(value)
 	}
 }
 
@@ -144,8 +264,34 @@ func (dp *deviceParser) curPeer() *wgtypes.Peer {
 func (dp *deviceParser) peerParse(key, value string) {
 	p := dp.curPeer()
 	switch key {
+	case "name":
+		p.Name = value
+	case "annotation":
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 {
+			dp.err = fmt.Errorf("wguser: invalid annotation: %q", value)
+			return
+		}
+		if p.Annotations == nil {
+			p.Annotations = make(map[string]string)
+		}
+		p.Annotations[kv[0]] = kv[1]
 	case "preshared_key":
 		p.PresharedKey = dp.parseKey(value)
+	case "next_preshared_key":
+		p.NextPresharedKey = dp.parseKey(value)
+	case "next_preshared_key_activation":
+		if secs := dp.parseInt64(value); secs > 0 {
+			p.NextPresharedKeyActivation = time.Unix(secs, 0)
+		}
+	case "expires_at":
+		if secs := dp.parseInt64(value); secs > 0 {
+			p.ExpiresAt = time.Unix(secs, 0)
+		}
+	case "preshared_key_handshakes":
+		p.PresharedKeyHandshakes = dp.parseInt64(value)
+	case "next_preshared_key_handshakes":
+		p.NextPresharedKeyHandshakes = dp.parseInt64(value)
 	case "endpoint":
 		p.Endpoint = dp.parseAddr(value)
 	case "last_handshake_time_sec":
@@ -164,8 +310,40 @@ func (dp *deviceParser) peerParse(key, value string) {
 		p.TransmitBytes = dp.parseInt64(value)
 	case "rx_bytes":
 		p.ReceiveBytes = dp.parseInt64(value)
+	case "tx_packets":
+		p.TransmitPackets = dp.parseInt64(value)
+	case "rx_packets":
+		p.ReceivePackets = dp.parseInt64(value)
+	case "handshake_attempts":
+		p.HandshakeAttempts = dp.parseInt64(value)
+	case "keypair_created":
+		if secs := dp.parseInt64(value); secs > 0 {
+			p.KeypairCreated = time.Unix(secs, 0)
+		}
+	case "tx_drops":
+		p.TransmitDrops = dp.parseInt64(value)
+	case "rx_drops":
+		p.ReceiveDrops = dp.parseInt64(value)
+	case "decrypt_failures":
+		p.DecryptFailures = dp.parseInt64(value)
+	case "replay_rejects":
+		p.ReplayRejects = dp.parseInt64(value)
+	case "allowed_ips_rejects":
+		p.AllowedIPsRejects = dp.parseInt64(value)
+	case "handshake_initiations_received":
+		p.HandshakeInitiationsReceived = dp.parseInt64(value)
+	case "handshake_rtt_nsec":
+		p.HandshakeRTT = time.Duration(dp.parseInt64(value))
+	case "handshake_error":
+		dp.parseHandshakeError(value, &p.HandshakeErrors)
 	case "persistent_keepalive_interval":
 		p.PersistentKeepaliveInterval = time.Duration(dp.parseInt(value)) * time.Second
+	case "liveness":
+		p.Liveness = wgtypes.ParseLivenessState(value)
+	case "liveness_changed":
+		if secs := dp.parseInt64(value); secs > 0 {
+			p.LivenessChanged = time.Unix(secs, 0)
+		}
 	case "allowed_ip":
 		cidr := dp.parseCIDR(value)
 		if cidr != nil {
@@ -176,6 +354,53 @@ func (dp *deviceParser) peerParse(key, value string) {
 	}
 }
 
+// parseHandshakeError parses a "reason,count" pair into errs, allocating it
+// on first use.
+func (dp *deviceParser) parseHandshakeError(s string, errs *map[string]int64) {
+	if dp.err != nil {
+		return
+	}
+
+	fields := strings.Split(s, ",")
+	if len(fields) != 2 {
+		dp.err = fmt.Errorf("wguser: invalid handshake error: %q", s)
+		return
+	}
+
+	count := dp.parseInt64(fields[1])
+	if *errs == nil {
+		*errs = make(map[string]int64)
+	}
+	(*errs)[fields[0]] = count
+}
+
+// parseHandshakeErrorSource parses an "ip,reason,count,last_seen" tuple into
+// the device's handshake error sources.
+func (dp *deviceParser) parseHandshakeErrorSource(s string) {
+	if dp.err != nil {
+		return
+	}
+
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		dp.err = fmt.Errorf("wguser: invalid handshake error source: %q", s)
+		return
+	}
+
+	ip := net.ParseIP(fields[0])
+	if ip == nil {
+		dp.err = fmt.Errorf("wguser: invalid handshake error source address: %q", fields[0])
+		return
+	}
+
+	dp.d.HandshakeErrorSources = append(dp.d.HandshakeErrorSources, wgtypes.HandshakeErrorSource{
+		IP:       ip,
+		Reason:   fields[1],
+		Count:    dp.parseInt64(fields[2]),
+		LastSeen: time.Unix(dp.parseInt64(fields[3]), 0),
+	})
+}
+
 // parseKey parses a Key from a hex string.
 func (dp *deviceParser) parseKey(s string) wgtypes.Key {
 	if dp.err != nil {
@@ -2,9 +2,11 @@ package wguser
 
 import (
 	"net"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
 	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
 	"github.com/google/go-cmp/cmp"
 )
@@ -75,10 +77,172 @@ func TestClientDevices(t *testing.T) {
 			name: "invalid allowed_ip",
 			res:  []byte(okKey + "allowed_ip=foo"),
 		},
+		{
+			name: "invalid rollover_expires",
+			res:  []byte("rollover_expires=foo"),
+		},
+		{
+			name: "invalid next_preshared_key_activation",
+			res:  []byte(okKey + "next_preshared_key_activation=foo"),
+		},
 		{
 			name: "error",
 			res:  []byte("errno=2\n\n"),
 		},
+		{
+			name: "ok, preshared key schedule",
+			res: []byte(`public_key=02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4
+preshared_key=188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52
+next_preshared_key=188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52
+next_preshared_key_activation=1600000000
+preshared_key_handshakes=3
+next_preshared_key_handshakes=1
+errno=0
+
+`),
+			ok: true,
+			d: &wgtypes.Device{
+				Name: testDevice,
+				Type: wgtypes.Userspace,
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey:                  wgtypes.Key{0x02, 0x25, 0x7e, 0x1f, 0x3d, 0x82, 0xd9, 0x7d, 0x0a, 0x2e, 0xc1, 0x8e, 0x27, 0x9b, 0x06, 0x77, 0x91, 0x48, 0x39, 0x1e, 0xeb, 0x43, 0x4f, 0xa4, 0x60, 0x8d, 0xf5, 0x9b, 0x39, 0xba, 0x0a, 0x95, 0xc4},
+						PresharedKey:               wgtypes.Key{0x18, 0x85, 0x15, 0x9, 0x3e, 0x95, 0x2f, 0x5f, 0x22, 0xe8, 0x65, 0xce, 0xf3, 0x1, 0x2e, 0x72, 0xf8, 0xb5, 0xf0, 0xb5, 0x98, 0xac, 0x3, 0x9, 0xd5, 0xda, 0xcc, 0xe3, 0xb7, 0xf, 0xcf, 0x52},
+						NextPresharedKey:           wgtypes.Key{0x18, 0x85, 0x15, 0x9, 0x3e, 0x95, 0x2f, 0x5f, 0x22, 0xe8, 0x65, 0xce, 0xf3, 0x1, 0x2e, 0x72, 0xf8, 0xb5, 0xf0, 0xb5, 0x98, 0xac, 0x3, 0x9, 0xd5, 0xda, 0xcc, 0xe3, 0xb7, 0xf, 0xcf, 0x52},
+						NextPresharedKeyActivation: time.Unix(1600000000, 0),
+						PresharedKeyHandshakes:     3,
+						NextPresharedKeyHandshakes: 1,
+					},
+				},
+			},
+		},
+		{
+			name: "ok, read-only socket",
+			res: []byte(`device_public_key=02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4
+redacted=true
+listen_port=12912
+errno=0
+
+`),
+			ok: true,
+			d: &wgtypes.Device{
+				Name:       testDevice,
+				Type:       wgtypes.Userspace,
+				PublicKey:  wgtest.MustHexKey("02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4"),
+				Redacted:   true,
+				ListenPort: 12912,
+			},
+		},
+		{
+			name: "ok, labels and expiry",
+			res: []byte(`public_key=02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4
+name=alice laptop
+annotation=owner=alice
+annotation=team=ops=oncall
+expires_at=1600000000
+errno=0
+
+`),
+			ok: true,
+			d: &wgtypes.Device{
+				Name: testDevice,
+				Type: wgtypes.Userspace,
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey:   wgtypes.Key{0x02, 0x25, 0x7e, 0x1f, 0x3d, 0x82, 0xd9, 0x7d, 0x0a, 0x2e, 0xc1, 0x8e, 0x27, 0x9b, 0x06, 0x77, 0x91, 0x48, 0x39, 0x1e, 0xeb, 0x43, 0x4f, 0xa4, 0x60, 0x8d, 0xf5, 0x9b, 0x39, 0xba, 0x0a, 0x95, 0xc4},
+						Name:        "alice laptop",
+						Annotations: map[string]string{"owner": "alice", "team": "ops=oncall"},
+						ExpiresAt:   time.Unix(1600000000, 0),
+					},
+				},
+			},
+		},
+		{
+			name: "ok, statistics",
+			res: []byte(`encryption_queue_len=3
+encryption_queue_drops=1
+decryption_queue_len=0
+decryption_queue_drops=2
+handshake_queue_len=4096
+handshake_queue_drops=17
+cookie_replies_sent=5
+ratelimiter_rejects=6
+decrypt_failures=7
+under_load=true
+handshake_error=mac1_mismatch,8
+handshake_error=unknown_peer,1
+handshake_error_source=192.0.2.1,mac1_mismatch,8,1600000000
+handshake_error_source=fd00::1,unknown_peer,1,1600000001
+public_key=02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4
+tx_packets=10
+rx_packets=20
+handshake_attempts=3
+keypair_created=1600000000
+tx_drops=1
+rx_drops=2
+decrypt_failures=3
+replay_rejects=4
+allowed_ips_rejects=5
+handshake_initiations_received=6
+handshake_rtt_nsec=12500000
+handshake_error=replayed_timestamp,2
+errno=0
+
+`),
+			ok: true,
+			d: &wgtypes.Device{
+				Name:               testDevice,
+				Type:               wgtypes.Userspace,
+				EncryptionQueue:    wgtypes.QueueStats{Length: 3, Drops: 1},
+				DecryptionQueue:    wgtypes.QueueStats{Drops: 2},
+				HandshakeQueue:     wgtypes.QueueStats{Length: 4096, Drops: 17},
+				CookieRepliesSent:  5,
+				RatelimiterRejects: 6,
+				DecryptFailures:    7,
+				UnderLoad:          true,
+				HandshakeErrors:    map[string]int64{"mac1_mismatch": 8, "unknown_peer": 1},
+				HandshakeErrorSources: []wgtypes.HandshakeErrorSource{
+					{IP: net.ParseIP("192.0.2.1"), Reason: "mac1_mismatch", Count: 8, LastSeen: time.Unix(1600000000, 0)},
+					{IP: net.ParseIP("fd00::1"), Reason: "unknown_peer", Count: 1, LastSeen: time.Unix(1600000001, 0)},
+				},
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey:         wgtypes.Key{0x02, 0x25, 0x7e, 0x1f, 0x3d, 0x82, 0xd9, 0x7d, 0x0a, 0x2e, 0xc1, 0x8e, 0x27, 0x9b, 0x06, 0x77, 0x91, 0x48, 0x39, 0x1e, 0xeb, 0x43, 0x4f, 0xa4, 0x60, 0x8d, 0xf5, 0x9b, 0x39, 0xba, 0x0a, 0x95, 0xc4},
+						TransmitPackets:   10,
+						ReceivePackets:    20,
+						HandshakeAttempts: 3,
+						KeypairCreated:    time.Unix(1600000000, 0),
+
+						TransmitDrops:                1,
+						ReceiveDrops:                 2,
+						DecryptFailures:              3,
+						ReplayRejects:                4,
+						AllowedIPsRejects:            5,
+						HandshakeInitiationsReceived: 6,
+						HandshakeRTT:                 12500 * time.Microsecond,
+						HandshakeErrors:              map[string]int64{"replayed_timestamp": 2},
+					},
+				},
+			},
+		},
+		{
+			name: "ok, rollover",
+			res: []byte(`private_key=7b049989510ff1dc6e3dcc62d5895c8495184d32f41fa25bb0aaab187cae3dab
+previous_public_key=02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4
+rollover_expires=1600000000
+errno=0
+
+`),
+			ok: true,
+			d: &wgtypes.Device{
+				Name:              testDevice,
+				Type:              wgtypes.Userspace,
+				PrivateKey:        wgtypes.Key{0x7b, 0x04, 0x99, 0x89, 0x51, 0x0f, 0xf1, 0xdc, 0x6e, 0x3d, 0xcc, 0x62, 0xd5, 0x89, 0x5c, 0x84, 0x95, 0x18, 0x4d, 0x32, 0xf4, 0x1f, 0xa2, 0x5b, 0xb0, 0xaa, 0xab, 0x18, 0x7c, 0xae, 0x3d, 0xab},
+				PublicKey:         wgtypes.Key{0x03, 0x63, 0x61, 0xc4, 0x7e, 0xae, 0xae, 0x85, 0xdb, 0xd0, 0x0b, 0x10, 0x48, 0x8d, 0x8c, 0x6e, 0xb3, 0xd4, 0x92, 0xe1, 0x6c, 0x39, 0x0c, 0x71, 0x22, 0x2d, 0x4b, 0xc7, 0x47, 0xa9, 0xb0, 0x67, 0x4b},
+				PreviousPublicKey: wgtypes.Key{0x02, 0x25, 0x7e, 0x1f, 0x3d, 0x82, 0xd9, 0x7d, 0x0a, 0x2e, 0xc1, 0x8e, 0x27, 0x9b, 0x06, 0x77, 0x91, 0x48, 0x39, 0x1e, 0xeb, 0x43, 0x4f, 0xa4, 0x60, 0x8d, 0xf5, 0x9b, 0x39, 0xba, 0x0a, 0x95, 0xc4},
+				RolloverExpires:   time.Unix(1600000000, 0),
+			},
+		},
 		{
 			name: "ok",
 			res:  []byte(okGet),
@@ -174,3 +338,64 @@ func TestClientDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestClientPeersPage(t *testing.T) {
+	const (
+		key1 = "02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4"
+		key2 = "034799ea40dc7b4c312d4467929cc4eb33e0dc2ad88bcb64317703a6e53aa4b5f1"
+	)
+
+	res := []byte("private_key=7b049989510ff1dc6e3dcc62d5895c8495184d32f41fa25bb0aaab187cae3dab\n" +
+		"public_key=" + key2 + "\nprotocol_version=1\nnext_cursor=" + key2 + "\nerrno=0\n\n")
+
+	c, done := testClient(t, res)
+	page, err := c.PeersPage(testDevice, wgtypes.PeersPageOptions{
+		Prefix: []byte{0x03},
+		Cursor: key1,
+		Limit:  1,
+	})
+	req := done()
+	if err != nil {
+		t.Fatalf("failed to get peers page: %v", err)
+	}
+
+	if diff := cmp.Diff("get=1\npublic_key_prefix=03\ncursor="+key1+"\nlimit=1\n\n", string(req)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	want := &wgtypes.PeersPage{
+		Peers: []wgtypes.Peer{{
+			PublicKey:       wgtest.MustHexKey(key2),
+			ProtocolVersion: 1,
+		}},
+		Next: key2,
+	}
+	if diff := cmp.Diff(want, page); diff != "" {
+		t.Fatalf("unexpected page (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientPeer(t *testing.T) {
+	const key = "02257e1f3d82d97d0a2ec18e279b06779148391eeb434fa4608df59b39ba0a95c4"
+
+	c, done := testClient(t, []byte("listen_port=12912\npublic_key="+key+"\nprotocol_version=1\nerrno=0\n\n"))
+	p, err := c.Peer(testDevice, wgtest.MustHexKey(key))
+	req := done()
+	if err != nil {
+		t.Fatalf("failed to get peer: %v", err)
+	}
+
+	if diff := cmp.Diff("get=1\npublic_key="+key+"\n\n", string(req)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&wgtypes.Peer{PublicKey: wgtest.MustHexKey(key), ProtocolVersion: 1}, p); diff != "" {
+		t.Fatalf("unexpected peer (-want +got):\n%s", diff)
+	}
+
+	// a device without the peer answers with no peers at all
+	c, done = testClient(t, []byte("listen_port=12912\nerrno=0\n\n"))
+	defer done()
+	if _, err := c.Peer(testDevice, wgtest.MustHexKey(key)); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, but got: %v", err)
+	}
+}
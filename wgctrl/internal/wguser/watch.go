@@ -0,0 +1,172 @@
+package wguser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// Watch implements wginternal.Client.
+func (c *Client) Watch(ctx context.Context, name string, fn func(wgtypes.Event)) error {
+	d, err := c.findDevice(name)
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.dialRead(d)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the reads below once the caller is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if _, err := io.WriteString(conn, "watch=1\n\n"); err != nil {
+		return err
+	}
+
+	er, err := NewEventReader(conn)
+	if err != nil {
+		return err
+	}
+
+	for {
+		e, err := er.Next()
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		fn(e)
+	}
+}
+
+// An EventReader reads the events streamed by a device in answer to a watch
+// request.
+type EventReader struct {
+	s *bufio.Scanner
+}
+
+// NewEventReader reads the beginning of the answer to a watch request from
+// r, returning an error if the device refused the request.
+func NewEventReader(r io.Reader) (*EventReader, error) {
+	er := &EventReader{s: bufio.NewScanner(r)}
+
+	kvs, err := er.block()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	var errno int
+	var message string
+	for _, kv := range kvs {
+		switch kv[0] {
+		case "errno":
+			errno, err = strconv.Atoi(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("wguser: invalid errno: %q", kv[1])
+			}
+		case "message":
+			message = kv[1]
+		}
+	}
+
+	if errno < 0 {
+		errno = -errno
+	}
+	if errno != 0 {
+		return nil, fmt.Errorf("wguser: watch refused: %s: %w", message, syscall.Errno(errno))
+	}
+
+	return er, nil
+}
+
+// Next returns the next event, or io.EOF once the device ended the stream.
+func (er *EventReader) Next() (wgtypes.Event, error) {
+	kvs, err := er.block()
+	if err != nil {
+		return wgtypes.Event{}, err
+	}
+
+	var e wgtypes.Event
+	var sec, nsec int64
+	for _, kv := range kvs {
+		switch kv[0] {
+		case "event":
+			e.Type = wgtypes.ParseEventType(kv[1])
+		case "time_sec":
+			sec, err = strconv.ParseInt(kv[1], 10, 64)
+		case "time_nsec":
+			nsec, err = strconv.ParseInt(kv[1], 10, 64)
+		case "public_key":
+			var b []byte
+			b, err = hex.DecodeString(kv[1])
+			e.PublicKey = b
+		case "endpoint":
+			e.Endpoint, err = net.ResolveUDPAddr("udp", kv[1])
+		case "liveness":
+			e.Liveness = wgtypes.ParseLivenessState(kv[1])
+		case "dropped":
+			e.Dropped, err = strconv.ParseUint(kv[1], 10, 64)
+		}
+
+		if err != nil {
+			return wgtypes.Event{}, fmt.Errorf("wguser: invalid event %s: %q", kv[0], kv[1])
+		}
+	}
+	e.Time = time.Unix(sec, nsec)
+
+	return e, nil
+}
+
+// block reads the key=value pairs up to the next empty line.
+func (er *EventReader) block() ([][2]string, error) {
+	var kvs [][2]string
+
+	for er.s.Scan() {
+		b := er.s.Bytes()
+		if len(b) == 0 {
+			return kvs, nil
+		}
+
+		kv := bytes.SplitN(b, []byte("="), 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("wguser: invalid key=value pair: %q", string(b))
+		}
+		kvs = append(kvs, [2]string{string(kv[0]), string(kv[1])})
+	}
+
+	if err := er.s.Err(); err != nil {
+		return nil, err
+	}
+	if len(kvs) != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return nil, io.EOF
+}
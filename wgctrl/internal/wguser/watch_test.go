@@ -0,0 +1,68 @@
+package wguser
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestClientWatch(t *testing.T) {
+	const hexKey = "02e330d5efee687eb475edbca2893db68d14ef130a9cab4888b2e97342674e0d54"
+	key := wgtest.MustHexKey(hexKey)
+
+	res := "errno=0\n\n" +
+		"event=handshake\ntime_sec=1600000000\ntime_nsec=5\npublic_key=" + hexKey + "\n\n" +
+		"event=endpoint\ntime_sec=1600000001\ntime_nsec=0\npublic_key=" + hexKey + "\nendpoint=192.0.2.1:51820\ndropped=3\n\n"
+
+	c, done := testClient(t, []byte(res))
+
+	var events []wgtypes.Event
+	err := c.Watch(context.Background(), testDevice, func(e wgtypes.Event) {
+		events = append(events, e)
+	})
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	if want, got := "watch=1\n\n", string(done()); want != got {
+		t.Fatalf("unexpected request: %q", got)
+	}
+
+	want := []wgtypes.Event{
+		{
+			Type:      wgtypes.HandshakeEvent,
+			Time:      time.Unix(1600000000, 5),
+			PublicKey: key,
+		},
+		{
+			Type:      wgtypes.EndpointEvent,
+			Time:      time.Unix(1600000001, 0),
+			PublicKey: key,
+			Endpoint:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820},
+			Dropped:   3,
+		},
+	}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientWatchRefused(t *testing.T) {
+	c, done := testClient(t, []byte("message=watch not permitted\nerrno=-13\n\n"))
+	defer done()
+
+	err := c.Watch(context.Background(), testDevice, func(wgtypes.Event) {
+		t.Fatal("unexpected event")
+	})
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("expected a permission error, but got: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Package wgapi serves the configuration of a userspace WireGuard device as
+// an HTTP/JSON management API.
+//
+// The API exposes the wgtypes model, using its JSON schema, under the
+// following routes:
+//
+//	GET    /v1/openapi.json                     OpenAPI description of the API
+//	GET    /v1/devices                          list devices, without their peers
+//	GET    /v1/devices/{name}                   get a device and all its peers
+//	PATCH  /v1/devices/{name}                   apply a wgtypes.Config
+//	GET    /v1/devices/{name}/peers             get a page of peers
+//	GET    /v1/devices/{name}/peers/{key}       get a peer
+//	PUT    /v1/devices/{name}/peers/{key}       add or update a peer from a wgtypes.PeerConfig
+//	DELETE /v1/devices/{name}/peers/{key}       remove a peer
+//	GET    /v1/devices/{name}/stats             get the traffic and handshake counters of the peers
+//	GET    /v1/devices/{name}/events            stream the events of the device
+//
+// Keys in paths are encoded in URL-safe base64. The pages of peers are
+// selected by the query parameters prefix (hex bytes of the public key),
+// cursor (the next value of the previous page) and limit. Events, in the
+// JSON schema of wgtypes.Event, are streamed one per line until the client
+// closes the connection.
+//
+// Responses leave out the private key of the device and the preshared keys
+// of its peers, as the read-only socket of the userspace configuration
+// protocol does. A GET or PUT with the query parameter secrets=1 includes
+// them, if Server.AllowSecrets admits the client; other clients are
+// answered 403 Forbidden.
+//
+// The server drives the device through the same get and set operations as
+// the userspace configuration protocol, so a configuration is either
+// applied as a whole or rejected without any effect. Failures are answered
+// with a JSON body carrying the errno of the protocol, the offending line of
+// the equivalent set request, if any, and a message:
+//
+//	{"errno": 22, "line": 3, "message": "invalid allowed_ip: \"10.0.0.300/32\""}
+package wgapi
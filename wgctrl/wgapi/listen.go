@@ -0,0 +1,96 @@
+package wgapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// Listen opens a listener for the API on addr. An address of the form
+// unix:PATH is a Unix socket which only its owner may connect to. Any other
+// address is a TCP address, on which the API is served over TLS with
+// tlsConfig.
+func Listen(addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	if tlsConfig == nil {
+		return nil, errors.New("wgapi: TCP address requires TLS")
+	}
+
+	return tls.Listen("tcp", addr, tlsConfig)
+}
+
+// ServerTLSConfig returns the TLS configuration of a server which presents
+// the certificate in certFile and keyFile, and which requires clients to
+// present a certificate issued by a CA in caFile.
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig returns the TLS configuration of a client which presents
+// the certificate in certFile and keyFile, and which accepts servers
+// presenting a certificate issued by a CA in caFile.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadCertPool reads the PEM certificates in file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("wgapi: no certificates in %s", file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,338 @@
+package wgapi
+
+// openAPI is the OpenAPI description of the API, served at
+// /v1/openapi.json.
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "WireGuard management API",
+    "description": "Configuration and statistics of a userspace WireGuard device. Every change is applied as a whole or not at all.",
+    "version": "1"
+  },
+  "paths": {
+    "/v1/devices": {
+      "get": {
+        "summary": "List devices, without their peers",
+        "responses": {
+          "200": {
+            "description": "The devices",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Device"}}}}
+          }
+        }
+      }
+    },
+    "/v1/devices/{name}": {
+      "parameters": [{"$ref": "#/components/parameters/Name"}],
+      "get": {
+        "summary": "Get a device and all its peers",
+        "parameters": [{"$ref": "#/components/parameters/Secrets"}],
+        "responses": {
+          "200": {
+            "description": "The device",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Device"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "patch": {
+        "summary": "Apply a configuration",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Config"}}}
+        },
+        "responses": {
+          "204": {"description": "The configuration was applied"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/devices/{name}/peers": {
+      "parameters": [{"$ref": "#/components/parameters/Name"}],
+      "get": {
+        "summary": "Get a page of peers, ordered by public key when a cursor or a limit is given",
+        "parameters": [
+          {"name": "prefix", "in": "query", "description": "Leading bytes of the public keys, in hex", "schema": {"type": "string"}},
+          {"name": "cursor", "in": "query", "description": "The next value of the previous page", "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "description": "Maximum number of peers", "schema": {"type": "integer", "minimum": 0}},
+          {"$ref": "#/components/parameters/Secrets"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The page of peers",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PeersPage"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/devices/{name}/peers/{key}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Name"},
+        {"name": "key", "in": "path", "required": true, "description": "Public key of the peer, in URL-safe base64", "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Get a peer",
+        "parameters": [{"$ref": "#/components/parameters/Secrets"}],
+        "responses": {
+          "200": {
+            "description": "The peer",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Peer"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Add or update a peer",
+        "parameters": [{"$ref": "#/components/parameters/Secrets"}],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PeerConfig"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The peer as configured",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Peer"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Remove a peer",
+        "responses": {
+          "204": {"description": "The peer is not configured"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/devices/{name}/stats": {
+      "parameters": [{"$ref": "#/components/parameters/Name"}],
+      "get": {
+        "summary": "Get the traffic and handshake counters of the peers",
+        "responses": {
+          "200": {
+            "description": "The counters",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/devices/{name}/events": {
+      "parameters": [{"$ref": "#/components/parameters/Name"}],
+      "get": {
+        "summary": "Stream the events of the device, one JSON object per line, until the connection is closed",
+        "responses": {
+          "200": {
+            "description": "The events",
+            "content": {"application/x-ndjson": {"schema": {"$ref": "#/components/schemas/Event"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/openapi.json": {
+      "get": {
+        "summary": "Get this description",
+        "responses": {
+          "200": {"description": "The OpenAPI description", "content": {"application/json": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "Name": {"name": "name", "in": "path", "required": true, "description": "Name of the device", "schema": {"type": "string"}},
+      "Secrets": {"name": "secrets", "in": "query", "description": "1 to include the private and preshared keys, which are null otherwise; 403 unless the client is allowed to read them", "schema": {"type": "integer", "enum": [0, 1]}}
+    },
+    "responses": {
+      "Error": {
+        "description": "The request failed",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "schemas": {
+      "Key": {"type": "string", "format": "byte", "description": "Key in base64"},
+      "Time": {"type": "string", "format": "date-time", "nullable": true},
+      "Liveness": {"type": "string", "enum": ["up", "degraded", "down"], "nullable": true, "description": "Null when liveness is not monitored"},
+      "Device": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "type": {"type": "string"},
+          "private_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "public_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "redacted": {"type": "boolean", "description": "true when private_key and the preshared keys of the peers were withheld, see the secrets parameter"},
+          "previous_public_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "rollover_expires": {"$ref": "#/components/schemas/Time"},
+          "listen_port": {"type": "integer"},
+          "firewall_mark": {"type": "integer"},
+          "liveness_down_after_seconds": {"type": "integer", "description": "0 when liveness is not monitored"},
+          "liveness_degraded_after_seconds": {"type": "integer"},
+          "liveness_probe_interval_seconds": {"type": "integer"},
+          "encryption_queue": {"$ref": "#/components/schemas/Queue"},
+          "decryption_queue": {"$ref": "#/components/schemas/Queue"},
+          "handshake_queue": {"$ref": "#/components/schemas/Queue"},
+          "cookie_replies_sent": {"type": "integer"},
+          "ratelimiter_rejects": {"type": "integer"},
+          "decrypt_failures": {"type": "integer"},
+          "under_load": {"type": "boolean"},
+          "handshake_errors": {"$ref": "#/components/schemas/HandshakeErrors"},
+          "handshake_error_sources": {"type": "array", "items": {"$ref": "#/components/schemas/HandshakeErrorSource"}, "description": "Rejections by source address, for the addresses seen most recently"},
+          "peers": {"type": "array", "items": {"$ref": "#/components/schemas/Peer"}}
+        }
+      },
+      "HandshakeErrors": {
+        "type": "object",
+        "additionalProperties": {"type": "integer"},
+        "description": "Rejected handshake messages by reason, such as mac1_mismatch, unknown_peer, replayed_timestamp or preshared_key_mismatch"
+      },
+      "HandshakeErrorSource": {
+        "type": "object",
+        "properties": {
+          "ip": {"type": "string"},
+          "reason": {"type": "string"},
+          "count": {"type": "integer"},
+          "last_seen": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Queue": {
+        "type": "object",
+        "properties": {
+          "length": {"type": "integer"},
+          "drops": {"type": "integer", "description": "Elements dropped because the queue was full"}
+        }
+      },
+      "Peer": {
+        "type": "object",
+        "properties": {
+          "public_key": {"$ref": "#/components/schemas/Key"},
+          "name": {"type": "string"},
+          "annotations": {"type": "object", "additionalProperties": {"type": "string"}},
+          "preshared_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "next_preshared_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "next_preshared_key_activation": {"$ref": "#/components/schemas/Time"},
+          "preshared_key_handshakes": {"type": "integer"},
+          "next_preshared_key_handshakes": {"type": "integer"},
+          "expires_at": {"$ref": "#/components/schemas/Time"},
+          "endpoint": {"type": "string", "nullable": true},
+          "persistent_keepalive_seconds": {"type": "integer"},
+          "last_handshake_time": {"$ref": "#/components/schemas/Time"},
+          "liveness": {"$ref": "#/components/schemas/Liveness"},
+          "liveness_changed": {"$ref": "#/components/schemas/Time"},
+          "receive_bytes": {"type": "integer"},
+          "transmit_bytes": {"type": "integer"},
+          "receive_packets": {"type": "integer"},
+          "transmit_packets": {"type": "integer"},
+          "handshake_attempts": {"type": "integer"},
+          "keypair_created": {"$ref": "#/components/schemas/Time"},
+          "transmit_drops": {"type": "integer"},
+          "receive_drops": {"type": "integer"},
+          "decrypt_failures": {"type": "integer"},
+          "replay_rejects": {"type": "integer"},
+          "allowed_ips_rejects": {"type": "integer"},
+          "handshake_initiations_received": {"type": "integer"},
+          "handshake_rtt_ms": {"type": "number", "nullable": true},
+          "handshake_errors": {"$ref": "#/components/schemas/HandshakeErrors"},
+          "allowed_ips": {"type": "array", "items": {"type": "string"}},
+          "protocol_version": {"type": "integer"}
+        }
+      },
+      "PeersPage": {
+        "type": "object",
+        "properties": {
+          "peers": {"type": "array", "items": {"$ref": "#/components/schemas/Peer"}},
+          "next": {"type": "string", "nullable": true, "description": "Cursor of the following page, null on the last page"}
+        }
+      },
+      "Config": {
+        "type": "object",
+        "properties": {
+          "private_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "rollover_window_seconds": {"type": "integer", "nullable": true},
+          "listen_port": {"type": "integer", "nullable": true},
+          "firewall_mark": {"type": "integer", "nullable": true},
+          "liveness_down_after_seconds": {"type": "integer", "nullable": true, "description": "0 turns liveness monitoring off"},
+          "liveness_degraded_after_seconds": {"type": "integer", "nullable": true},
+          "liveness_probe_interval_seconds": {"type": "integer", "nullable": true},
+          "replace_peers": {"type": "boolean"},
+          "peers": {"type": "array", "items": {"$ref": "#/components/schemas/PeerConfig"}}
+        }
+      },
+      "PeerConfig": {
+        "type": "object",
+        "properties": {
+          "public_key": {"$ref": "#/components/schemas/Key"},
+          "remove": {"type": "boolean"},
+          "update_only": {"type": "boolean"},
+          "name": {"type": "string", "nullable": true},
+          "replace_annotations": {"type": "boolean"},
+          "annotations": {"type": "object", "additionalProperties": {"type": "string"}},
+          "preshared_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "next_preshared_key": {"$ref": "#/components/schemas/Key", "nullable": true},
+          "next_preshared_key_activation": {"$ref": "#/components/schemas/Time"},
+          "expires_at": {"$ref": "#/components/schemas/Time"},
+          "endpoint": {"type": "string", "nullable": true},
+          "persistent_keepalive_seconds": {"type": "integer", "nullable": true},
+          "replace_allowed_ips": {"type": "boolean"},
+          "allowed_ips": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "Stats": {
+        "type": "object",
+        "properties": {
+          "peers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "public_key": {"$ref": "#/components/schemas/Key"},
+                "name": {"type": "string"},
+                "last_handshake_time": {"$ref": "#/components/schemas/Time"},
+                "receive_bytes": {"type": "integer"},
+                "transmit_bytes": {"type": "integer"},
+                "receive_packets": {"type": "integer"},
+                "transmit_packets": {"type": "integer"},
+                "handshake_attempts": {"type": "integer"},
+                "handshake_initiations_received": {"type": "integer"},
+                "handshake_rtt_ms": {"type": "number", "nullable": true},
+                "transmit_drops": {"type": "integer"},
+                "receive_drops": {"type": "integer"},
+                "decrypt_failures": {"type": "integer"},
+                "replay_rejects": {"type": "integer"},
+                "allowed_ips_rejects": {"type": "integer"},
+                "preshared_key_handshakes": {"type": "integer"},
+                "next_preshared_key_handshakes": {"type": "integer"},
+                "handshake_errors": {"$ref": "#/components/schemas/HandshakeErrors"}
+              }
+            }
+          },
+          "handshake_errors": {"$ref": "#/components/schemas/HandshakeErrors"}
+        }
+      },
+      "Event": {
+        "type": "object",
+        "properties": {
+          "type": {"type": "string", "enum": ["handshake", "endpoint", "handshake_failed", "keys_zeroed", "peer_added", "peer_removed", "private_key", "liveness", "unknown"]},
+          "time": {"type": "string", "format": "date-time"},
+          "public_key": {"$ref": "#/components/schemas/Key", "nullable": true, "description": "Key of the peer, or the new key of the device for private_key"},
+          "endpoint": {"type": "string", "nullable": true, "description": "New endpoint of the peer for endpoint"},
+          "liveness": {"$ref": "#/components/schemas/Liveness", "description": "New state of the peer for liveness"},
+          "dropped": {"type": "integer", "description": "Events dropped so far because the client fell behind"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "errno": {"type": "integer", "nullable": true, "description": "errno of the device, null for errors of the request itself"},
+          "line": {"type": "integer", "nullable": true, "description": "Offending line of the equivalent set request"},
+          "message": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
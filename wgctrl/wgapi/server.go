@@ -0,0 +1,640 @@
+package wgapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/ipc"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wguser"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// maxRequestSize bounds the bodies read from clients.
+const maxRequestSize = 16 << 20
+
+// A Device is the part of a userspace WireGuard device which the server
+// drives: the operations behind get, set and watch of the configuration
+// protocol. It is implemented by *device.Device.
+type Device interface {
+	IpcGetFilteredOperation(request *bufio.Reader, socket *bufio.Writer) error
+	IpcSetOperation(request *bufio.Reader) error
+	IpcWatchOperation(socket *bufio.Writer, stop <-chan struct{}) error
+}
+
+// A Server serves the management API of a device.
+type Server struct {
+	name    string
+	dev     Device
+	logger  *log.Logger
+	secrets func(r *http.Request) bool
+}
+
+// NewServer creates a Server for the device dev, which the API calls name.
+// Every request which changes the configuration is logged to logger, unless
+// it is nil.
+func NewServer(name string, dev Device, logger *log.Logger) *Server {
+	return &Server{
+		name:   name,
+		dev:    dev,
+		logger: logger,
+	}
+}
+
+// AllowSecrets lets the clients for which allowed returns true read the
+// private and preshared keys, by adding secrets=1 to the query of a GET or
+// PUT. Every other response leaves them out. By default nobody may read
+// them; nil restores the default.
+func (s *Server) AllowSecrets(allowed func(r *http.Request) bool) {
+	s.secrets = allowed
+}
+
+// SecretsFor returns a policy for AllowSecrets which admits the clients
+// whose certificate has one of names as its common name, or, on a Unix
+// socket, whose process runs as one of names, a user name or uid.
+func SecretsFor(names []string) (func(r *http.Request) bool, error) {
+	subjects := make(map[string]bool)
+	uids := make(map[uint32]bool)
+	for _, name := range names {
+		subjects[name] = true
+		if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+			uids[uint32(uid)] = true
+		} else if u, err := user.Lookup(name); err == nil {
+			uid, err := strconv.ParseUint(u.Uid, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid uid of user %q: %q", name, u.Uid)
+			}
+			uids[uint32(uid)] = true
+		}
+	}
+
+	return func(r *http.Request) bool {
+		if r.TLS != nil {
+			return len(r.TLS.PeerCertificates) > 0 && subjects[r.TLS.PeerCertificates[0].Subject.CommonName]
+		}
+		if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+			if cred, err := ipc.PeerCredentials(c); err == nil {
+				return uids[cred.UID]
+			}
+		}
+		return false
+	}, nil
+}
+
+type connKey struct{}
+
+// Serve serves the API on the connections accepted by l, until l fails or
+// is closed.
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, c)
+		},
+	}
+	return srv.Serve(l)
+}
+
+type handlers map[string]func(http.ResponseWriter, *http.Request)
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) < 2 || path[0] != "v1" {
+		s.fail(w, http.StatusNotFound, errors.New("no such resource"))
+		return
+	}
+
+	switch {
+	case len(path) == 2 && path[1] == "openapi.json":
+		s.route(w, r, handlers{http.MethodGet: s.getOpenAPI})
+		return
+	case len(path) == 2 && path[1] == "devices":
+		s.route(w, r, handlers{http.MethodGet: s.listDevices})
+		return
+	case path[1] != "devices":
+		s.fail(w, http.StatusNotFound, errors.New("no such resource"))
+		return
+	case path[2] != s.name:
+		s.fail(w, http.StatusNotFound, fmt.Errorf("no such device: %q", path[2]))
+		return
+	}
+
+	switch {
+	case len(path) == 3:
+		s.route(w, r, handlers{
+			http.MethodGet:   s.getDevice,
+			http.MethodPatch: s.configureDevice,
+		})
+	case len(path) == 4 && path[3] == "peers":
+		s.route(w, r, handlers{http.MethodGet: s.getPeers})
+	case len(path) == 4 && path[3] == "stats":
+		s.route(w, r, handlers{http.MethodGet: s.getStats})
+	case len(path) == 4 && path[3] == "events":
+		s.route(w, r, handlers{http.MethodGet: s.watchEvents})
+	case len(path) == 5 && path[3] == "peers":
+		key, err := parsePathKey(path[4])
+		if err != nil {
+			s.fail(w, http.StatusBadRequest, err)
+			return
+		}
+		s.route(w, r, handlers{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				s.getPeer(w, r, key)
+			},
+			http.MethodPut: func(w http.ResponseWriter, r *http.Request) {
+				s.putPeer(w, r, key)
+			},
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				s.deletePeer(w, r, key)
+			},
+		})
+	default:
+		s.fail(w, http.StatusNotFound, errors.New("no such resource"))
+	}
+}
+
+// route calls the handler of the request method, or answers 405 Method Not
+// Allowed.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, hs handlers) {
+	if h, ok := hs[r.Method]; ok {
+		h(w, r)
+		return
+	}
+
+	allow := make([]string, 0, len(hs))
+	for method := range hs {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	s.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+}
+
+// parsePathKey parses a public key encoded in URL-safe base64.
+func parsePathKey(s string) (wgtypes.Key, error) {
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil || len(b) != wgtypes.PublicKeyLen {
+		return nil, fmt.Errorf("invalid public key: %q", s)
+	}
+	return wgtypes.NewKey(b)
+}
+
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(openAPI))
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	d, _, err := s.get("device_only=true\n", false)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, []*wgtypes.Device{d})
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request) {
+	secrets, ok := s.wantSecrets(w, r)
+	if !ok {
+		return
+	}
+
+	d, _, err := s.get("", secrets)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, d)
+}
+
+func (s *Server) configureDevice(w http.ResponseWriter, r *http.Request) {
+	var cfg wgtypes.Config
+	if !s.decode(w, r, &cfg) {
+		return
+	}
+
+	if err := s.set(r, cfg); err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getPeers(w http.ResponseWriter, r *http.Request) {
+	secrets, ok := s.wantSecrets(w, r)
+	if !ok {
+		return
+	}
+
+	var opts wgtypes.PeersPageOptions
+
+	query := r.URL.Query()
+	if v := query.Get("prefix"); v != "" {
+		prefix, err := hex.DecodeString(v)
+		if err != nil {
+			s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid prefix: %q", v))
+			return
+		}
+		opts.Prefix = prefix
+	}
+	opts.Cursor = query.Get("cursor")
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", v))
+			return
+		}
+		opts.Limit = limit
+	}
+
+	d, next, err := s.get(wguser.PeersPageFilter(opts), secrets)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, wgtypes.PeersPage{
+		Peers: d.Peers,
+		Next:  next,
+	})
+}
+
+type jsonPeerStats struct {
+	PublicKey                    wgtypes.Key `json:"public_key"`
+	Name                         string      `json:"name"`
+	LastHandshakeTime            *time.Time  `json:"last_handshake_time"`
+	ReceiveBytes                 int64       `json:"receive_bytes"`
+	TransmitBytes                int64       `json:"transmit_bytes"`
+	ReceivePackets               int64       `json:"receive_packets"`
+	TransmitPackets              int64       `json:"transmit_packets"`
+	HandshakeAttempts            int64       `json:"handshake_attempts"`
+	HandshakeInitiationsReceived int64       `json:"handshake_initiations_received"`
+	HandshakeRTT                 *float64    `json:"handshake_rtt_ms"`
+	TransmitDrops                int64       `json:"transmit_drops"`
+	ReceiveDrops                 int64       `json:"receive_drops"`
+	DecryptFailures              int64       `json:"decrypt_failures"`
+	ReplayRejects                int64       `json:"replay_rejects"`
+	AllowedIPsRejects            int64       `json:"allowed_ips_rejects"`
+	PresharedKeyHandshakes       int64       `json:"preshared_key_handshakes"`
+	NextPresharedKeyHandshakes   int64       `json:"next_preshared_key_handshakes"`
+
+	HandshakeErrors map[string]int64 `json:"handshake_errors"`
+}
+
+type jsonStats struct {
+	Peers           []jsonPeerStats  `json:"peers"`
+	HandshakeErrors map[string]int64 `json:"handshake_errors"`
+}
+
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	d, _, err := s.get("", false)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	stats := jsonStats{
+		Peers:           make([]jsonPeerStats, 0, len(d.Peers)),
+		HandshakeErrors: handshakeErrorsOrEmpty(d.HandshakeErrors),
+	}
+	for _, p := range d.Peers {
+		ps := jsonPeerStats{
+			PublicKey:                    p.PublicKey,
+			Name:                         p.Name,
+			ReceiveBytes:                 p.ReceiveBytes,
+			TransmitBytes:                p.TransmitBytes,
+			ReceivePackets:               p.ReceivePackets,
+			TransmitPackets:              p.TransmitPackets,
+			HandshakeAttempts:            p.HandshakeAttempts,
+			HandshakeInitiationsReceived: p.HandshakeInitiationsReceived,
+			TransmitDrops:                p.TransmitDrops,
+			ReceiveDrops:                 p.ReceiveDrops,
+			DecryptFailures:              p.DecryptFailures,
+			ReplayRejects:                p.ReplayRejects,
+			AllowedIPsRejects:            p.AllowedIPsRejects,
+			PresharedKeyHandshakes:       p.PresharedKeyHandshakes,
+			NextPresharedKeyHandshakes:   p.NextPresharedKeyHandshakes,
+
+			HandshakeErrors: handshakeErrorsOrEmpty(p.HandshakeErrors),
+		}
+		if !p.LastHandshakeTime.IsZero() {
+			t := p.LastHandshakeTime.UTC()
+			ps.LastHandshakeTime = &t
+		}
+		if p.HandshakeRTT != 0 {
+			ms := float64(p.HandshakeRTT) / float64(time.Millisecond)
+			ps.HandshakeRTT = &ms
+		}
+		stats.Peers = append(stats.Peers, ps)
+	}
+
+	s.reply(w, http.StatusOK, stats)
+}
+
+// handshakeErrorsOrEmpty never returns nil, so that no rejections are {}
+// rather than null, as in the schema of wgtypes.
+func handshakeErrorsOrEmpty(errs map[string]int64) map[string]int64 {
+	if errs == nil {
+		return map[string]int64{}
+	}
+	return errs
+}
+
+func (s *Server) getPeer(w http.ResponseWriter, r *http.Request, key wgtypes.Key) {
+	secrets, ok := s.wantSecrets(w, r)
+	if !ok {
+		return
+	}
+
+	d, _, err := s.get("public_key="+hex.EncodeToString(key)+"\n", secrets)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	if len(d.Peers) == 0 {
+		s.fail(w, http.StatusNotFound, fmt.Errorf("no such peer: %s", key))
+		return
+	}
+
+	s.reply(w, http.StatusOK, d.Peers[0])
+}
+
+func (s *Server) putPeer(w http.ResponseWriter, r *http.Request, key wgtypes.Key) {
+	if _, ok := s.wantSecrets(w, r); !ok {
+		return
+	}
+
+	var pc wgtypes.PeerConfig
+	if !s.decode(w, r, &pc) {
+		return
+	}
+
+	switch {
+	case pc.PublicKey != nil && !bytes.Equal(pc.PublicKey, key):
+		s.fail(w, http.StatusBadRequest, errors.New("public key of the body does not match the path"))
+		return
+	case pc.Remove:
+		s.fail(w, http.StatusBadRequest, errors.New("peers are removed with DELETE"))
+		return
+	}
+	pc.PublicKey = key
+
+	if err := s.set(r, wgtypes.Config{Peers: []wgtypes.PeerConfig{pc}}); err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	s.getPeer(w, r, key)
+}
+
+func (s *Server) deletePeer(w http.ResponseWriter, r *http.Request, key wgtypes.Key) {
+	cfg := wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey: key,
+			Remove:    true,
+		}},
+	}
+
+	if err := s.set(r, cfg); err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// watchEvents streams the events of the device as JSON lines, until the
+// client goes away.
+func (s *Server) watchEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.fail(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(s.dev.IpcWatchOperation(bufio.NewWriter(pw), r.Context().Done()))
+	}()
+
+	// The subscription is in place once the device answers.
+	er, err := wguser.NewEventReader(pr)
+	if err != nil {
+		s.failDevice(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		e, err := er.Next()
+		if err != nil {
+			return
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// wantSecrets reports whether the request asks for the secrets with
+// secrets=1, or answers 403 Forbidden if its client may not read them.
+func (s *Server) wantSecrets(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	switch v := r.URL.Query().Get("secrets"); v {
+	case "", "0":
+		return false, true
+	case "1":
+	default:
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid secrets: %q", v))
+		return false, false
+	}
+
+	if s.secrets == nil || !s.secrets(r) {
+		s.fail(w, http.StatusForbidden, fmt.Errorf("secrets not permitted for %s", caller(r)))
+		return false, false
+	}
+	return true, true
+}
+
+// get runs a get operation with optional filter lines on the device, which
+// leaves out the private and preshared keys unless secrets is set.
+func (s *Server) get(filter string, secrets bool) (*wgtypes.Device, string, error) {
+	var buf bytes.Buffer
+	response := bufio.NewWriter(&buf)
+
+	if !secrets {
+		filter = "redact=true\n" + filter
+	}
+
+	request := bufio.NewReader(strings.NewReader(filter + "\n"))
+	if err := s.dev.IpcGetFilteredOperation(request, response); err != nil {
+		return nil, "", err
+	}
+	if err := response.Flush(); err != nil {
+		return nil, "", err
+	}
+
+	d, next, err := wguser.ParseDevice(&buf)
+	if err != nil {
+		return nil, "", err
+	}
+
+	d.Name = s.name
+	d.Type = wgtypes.Userspace
+
+	return d, next, nil
+}
+
+// set applies cfg to the device as a single set operation, which takes
+// effect as a whole or not at all, and logs the outcome.
+func (s *Server) set(r *http.Request, cfg wgtypes.Config) error {
+	var buf bytes.Buffer
+	wguser.WriteConfig(&buf, cfg)
+	buf.WriteString("\n")
+
+	err := s.dev.IpcSetOperation(bufio.NewReader(&buf))
+
+	if s.logger != nil {
+		if err != nil {
+			s.logger.Printf("Management API: %s %s by %s rejected: %v\n", r.Method, r.URL.Path, caller(r), err)
+		} else {
+			s.logger.Printf("Management API: %s %s by %s applied\n", r.Method, r.URL.Path, caller(r))
+		}
+	}
+
+	return err
+}
+
+// caller describes the client of a request for the log: the subject of its
+// certificate, its process on a Unix socket, or its address.
+func caller(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return "certificate " + r.TLS.PeerCertificates[0].Subject.String()
+	}
+
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		if cred, err := ipc.PeerCredentials(c); err == nil {
+			return cred.String()
+		}
+	}
+
+	if r.RemoteAddr != "" {
+		return r.RemoteAddr
+	}
+	return "unknown caller"
+}
+
+// decode reads the JSON body of a request into v, or answers 400 Bad
+// Request.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err := dec.Decode(v); err != nil {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) reply(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(b, '\n'))
+}
+
+type jsonError struct {
+	Errno   *int64 `json:"errno"`
+	Line    *int   `json:"line"`
+	Message string `json:"message"`
+}
+
+// An ipcError is an error of a get or set operation of the device.
+type ipcError interface {
+	error
+	ErrorCode() int64
+	Line() int
+	Unwrap() error
+}
+
+func (s *Server) fail(w http.ResponseWriter, status int, err error) {
+	s.failJSON(w, status, jsonError{Message: err.Error()})
+}
+
+// failDevice answers an error of the device with the status matching its
+// errno.
+func (s *Server) failDevice(w http.ResponseWriter, err error) {
+	var ierr ipcError
+	if !errors.As(err, &ierr) {
+		s.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch ierr.ErrorCode() {
+	case ipc.IpcErrorInvalid, ipc.IpcErrorProtocol:
+		status = http.StatusBadRequest
+	case ipc.IpcErrorAccess:
+		status = http.StatusForbidden
+	case ipc.IpcErrorPortInUse:
+		status = http.StatusConflict
+	}
+
+	errno := -ierr.ErrorCode()
+	v := jsonError{
+		Errno:   &errno,
+		Message: ierr.Error(),
+	}
+	if cause := ierr.Unwrap(); cause != nil {
+		v.Message = cause.Error()
+	}
+	if line := ierr.Line(); line != 0 {
+		v.Line = &line
+	}
+
+	s.failJSON(w, status, v)
+}
+
+func (s *Server) failJSON(w http.ResponseWriter, status int, v jsonError) {
+	b, _ := json.Marshal(v)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(b, '\n'))
+}
@@ -0,0 +1,426 @@
+package wgapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/device"
+	"github.com/bi-zone/ruwireguard-go/tun/tuntest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/internal/wgtest"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgapi"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+var _ wgapi.Device = &device.Device{}
+
+func TestServer(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	srv := httptest.NewServer(wgapi.NewServer("wg0", dev, nil))
+	defer srv.Close()
+
+	peerA, peerB := wgtest.MustPublicKey(), wgtest.MustPublicKey()
+	pathA := "/v1/devices/wg0/peers/" + base64.URLEncoding.EncodeToString(peerA)
+	pathB := "/v1/devices/wg0/peers/" + base64.URLEncoding.EncodeToString(peerB)
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		check                    func(t *testing.T, body []byte)
+	}{
+		{
+			name:   "add peer",
+			method: http.MethodPut,
+			path:   pathA,
+			body:   `{"name": "alice", "allowed_ips": ["10.0.0.1/32"]}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var p wgtypes.Peer
+				mustUnmarshal(t, body, &p)
+				if diff := cmp.Diff([]net.IPNet{wgtest.MustCIDR("10.0.0.1/32")}, p.AllowedIPs); p.Name != "alice" || diff != "" {
+					t.Fatalf("unexpected peer %q (-want +got):\n%s", p.Name, diff)
+				}
+			},
+		},
+		{
+			name:   "configure rejected",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg0",
+			body: `{"peers": [{"public_key": "` + peerB.String() + `", "allowed_ips": ["10.0.0.2/32"]},` +
+				`{"public_key": "` + peerA.String() + `", "endpoint": "bogus"}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "configure rejected without effect",
+			method: http.MethodGet,
+			path:   pathB,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "configure",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg0",
+			body:   `{"listen_port": 0, "peers": [{"public_key": "` + peerB.String() + `", "allowed_ips": ["10.0.0.2/32"]}]}`,
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "list devices",
+			method: http.MethodGet,
+			path:   "/v1/devices",
+			status: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var ds []wgtypes.Device
+				mustUnmarshal(t, body, &ds)
+				if len(ds) != 1 || ds[0].Name != "wg0" || len(ds[0].Peers) != 0 {
+					t.Fatalf("unexpected devices: %s", body)
+				}
+			},
+		},
+		{
+			name:   "get device",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0",
+			status: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var d wgtypes.Device
+				mustUnmarshal(t, body, &d)
+				if d.Type != wgtypes.Userspace || len(d.Peers) != 2 {
+					t.Fatalf("unexpected device: %s", body)
+				}
+			},
+		},
+		{
+			name:   "get page",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0/peers?limit=1",
+			status: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				var pp wgtypes.PeersPage
+				mustUnmarshal(t, body, &pp)
+				if len(pp.Peers) != 1 || pp.Next == "" {
+					t.Fatalf("unexpected page: %s", body)
+				}
+			},
+		},
+		{
+			name:   "get stats",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0/stats",
+			status: http.StatusOK,
+			check: func(t *testing.T, body []byte) {
+				if !strings.HasPrefix(string(body), `{"peers":[{"public_key":`) {
+					t.Fatalf("unexpected stats: %s", body)
+				}
+			},
+		},
+		{
+			name:   "remove peer",
+			method: http.MethodDelete,
+			path:   pathA,
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "removed peer",
+			method: http.MethodGet,
+			path:   pathA,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "key mismatch",
+			method: http.MethodPut,
+			path:   pathA,
+			body:   `{"public_key": "` + peerB.String() + `"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "bad key",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0/peers/AAAA",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown device",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg1",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			path:   "/v1/devices/wg0",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("unexpected status %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if tt.check != nil {
+				tt.check(t, body)
+			}
+		})
+	}
+}
+
+func TestServerSecrets(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	privateKey, psk, peer := wgtest.MustPrivateKey(), wgtest.MustPresharedKey(), wgtest.MustPublicKey()
+	if err := dev.Apply(wgtypes.Config{
+		PrivateKey: &privateKey,
+		Peers:      []wgtypes.PeerConfig{{PublicKey: peer, PresharedKey: &psk}},
+	}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	api := wgapi.NewServer("wg0", dev, nil)
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	get := func(t *testing.T, path string, status int) []byte {
+		res, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != status {
+			t.Fatalf("unexpected status %d, want %d: %s", res.StatusCode, status, body)
+		}
+		return body
+	}
+
+	peerPath := "/v1/devices/wg0/peers/" + base64.URLEncoding.EncodeToString(peer)
+
+	t.Run("redacted by default", func(t *testing.T) {
+		for _, path := range []string{"/v1/devices/wg0", "/v1/devices/wg0/peers", peerPath} {
+			body := get(t, path, http.StatusOK)
+			if bytes.Contains(body, []byte(privateKey.String())) || bytes.Contains(body, []byte(psk.String())) {
+				t.Fatalf("%s returned secrets: %s", path, body)
+			}
+		}
+
+		var d wgtypes.Device
+		mustUnmarshal(t, get(t, "/v1/devices/wg0", http.StatusOK), &d)
+		if !d.Redacted || d.PrivateKey != nil || !bytes.Equal(d.PublicKey, privateKey.PublicKey()) || len(d.Peers) != 1 || d.Peers[0].PresharedKey != nil {
+			t.Fatalf("unexpected redacted device: %+v", d)
+		}
+	})
+
+	t.Run("secrets forbidden", func(t *testing.T) {
+		get(t, "/v1/devices/wg0?secrets=1", http.StatusForbidden)
+	})
+
+	t.Run("secrets allowed", func(t *testing.T) {
+		api.AllowSecrets(func(r *http.Request) bool { return true })
+		defer api.AllowSecrets(nil)
+
+		var p wgtypes.Peer
+		mustUnmarshal(t, get(t, peerPath+"?secrets=1", http.StatusOK), &p)
+		if !bytes.Equal(p.PresharedKey, psk) {
+			t.Fatalf("unexpected preshared key: %v", p.PresharedKey)
+		}
+	})
+}
+
+func TestServerError(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	srv := httptest.NewServer(wgapi.NewServer("wg0", dev, nil))
+	defer srv.Close()
+
+	body := `{"peers": [{"public_key": "` + wgtest.MustPublicKey().String() + `", "allowed_ips": ["10.0.0.0/8"], "persistent_keepalive_seconds": 70000}]}`
+	req, err := http.NewRequest(http.MethodPatch, srv.URL+"/v1/devices/wg0", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer res.Body.Close()
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"errno":   float64(22),
+		"line":    float64(2),
+		"message": `invalid persistent_keepalive_interval: "70000"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	srv := httptest.NewServer(wgapi.NewServer("wg0", dev, nil))
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/v1/devices/wg0/events")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %s", res.Status)
+	}
+
+	key := wgtest.MustPublicKey()
+	if err := dev.Apply(wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: key}}}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+
+	var e wgtypes.Event
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if e.Type != wgtypes.PeerAddedEvent || !bytes.Equal(e.PublicKey, key) {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestServerOpenAPI(t *testing.T) {
+	srv := httptest.NewServer(wgapi.NewServer("wg0", nil, nil))
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer res.Body.Close()
+
+	var doc struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode description: %v", err)
+	}
+
+	want := map[string][]string{
+		"/v1/devices":                    {"get"},
+		"/v1/devices/{name}":             {"get", "patch"},
+		"/v1/devices/{name}/events":      {"get"},
+		"/v1/devices/{name}/peers":       {"get"},
+		"/v1/devices/{name}/peers/{key}": {"delete", "get", "put"},
+		"/v1/devices/{name}/stats":       {"get"},
+		"/v1/openapi.json":               {"get"},
+	}
+
+	got := make(map[string][]string)
+	for path, ops := range doc.Paths {
+		for _, method := range []string{"delete", "get", "patch", "put"} {
+			if _, ok := ops[method]; ok {
+				got[path] = append(got[path], method)
+			}
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected routes (-want +got):\n%s", diff)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping, Unix sockets are not used on Windows")
+	}
+
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	path := filepath.Join(t.TempDir(), "wg0.api")
+	l, err := wgapi.Listen("unix:"+path, nil)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("unexpected permissions %v", perm)
+	}
+
+	go wgapi.NewServer("wg0", dev, nil).Serve(l)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	res, err := client.Get("http://wg0/v1/devices/wg0")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+}
+
+func TestListenTCPRequiresTLS(t *testing.T) {
+	if _, err := wgapi.Listen("127.0.0.1:0", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func mustUnmarshal(t *testing.T, b []byte, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", b, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package wgmetrics exports the statistics of WireGuard devices in the
+// OpenMetrics text format, which Prometheus scrapes.
+//
+// The names below are stable: a metric may be added, but an existing one
+// keeps its name, type, labels and meaning. Every metric has an interface
+// label; the metrics of peers also have a public_key label, in base64, and
+// a name label when the peer has a name.
+//
+// Device metrics:
+//
+//	wireguard_peers                              gauge    peers configured on the device
+//	wireguard_queue_length{queue}                gauge    elements in a work queue
+//	wireguard_queue_drops_total{queue}           counter  elements dropped because a work queue was full
+//	wireguard_cookie_replies_sent_total          counter  cookie replies sent to initiators under load
+//	wireguard_ratelimiter_rejects_total          counter  handshake messages refused by the ratelimiter
+//	wireguard_decrypt_failures_total             counter  transport packets which failed authentication
+//	wireguard_under_load                         gauge    1 while the device demands cookies, else 0
+//	wireguard_handshake_errors_total{reason}     counter  handshake messages rejected by the device
+//
+// The queue label is encryption, decryption or handshake. The reason label
+// names why a handshake message was rejected, such as mac1_mismatch,
+// unknown_peer or replayed_timestamp; a reason appears once it occurs.
+// These metrics are only kept by userspace devices.
+//
+// Peer metrics:
+//
+//	wireguard_peer_receive_bytes_total           counter  bytes received from the peer
+//	wireguard_peer_transmit_bytes_total          counter  bytes sent to the peer
+//	wireguard_peer_receive_packets_total         counter  authenticated packets received from the peer
+//	wireguard_peer_transmit_packets_total        counter  packets sent to the peer
+//	wireguard_peer_handshake_attempts_total      counter  handshake initiations sent to the peer
+//	wireguard_peer_last_handshake_seconds        gauge    Unix time of the last handshake
+//	wireguard_peer_handshake_age_seconds         gauge    seconds since the last handshake
+//	wireguard_peer_keypair_age_seconds           gauge    seconds since the current session keys were derived
+//	wireguard_peer_transmit_drops_total          counter  packets to the peer dropped because a queue was full
+//	wireguard_peer_receive_drops_total           counter  packets from the peer dropped because a queue was full
+//	wireguard_peer_decrypt_failures_total        counter  transport packets from the peer which failed authentication
+//	wireguard_peer_replay_rejects_total          counter  transport packets from the peer refused by the replay filter
+//	wireguard_peer_allowed_ips_rejects_total     counter  packets from the peer with a source outside its allowed IPs
+//	wireguard_peer_handshake_initiations_received_total
+//	                                             counter  handshake initiations received from the peer
+//	wireguard_peer_handshake_rtt_seconds         gauge    round trip time of the last handshake initiated
+//	wireguard_peer_handshake_errors_total{reason}
+//	                                             counter  handshake messages from the peer rejected by the device
+//
+// The handshake times and ages, the keypair age and the handshake round
+// trip time are left out for a peer without a handshake, without session
+// keys or without a handshake it initiated, rather than reported as 0.
+package wgmetrics
@@ -0,0 +1,261 @@
+package wgmetrics
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+// ContentType is the media type of the metrics served by Handler.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// A metric is a family of samples. The samples of a counter are named with
+// a _total suffix, as OpenMetrics requires.
+type metric struct {
+	name, typ, help string
+}
+
+func (m metric) sampleName() string {
+	if m.typ == "counter" {
+		return m.name + "_total"
+	}
+	return m.name
+}
+
+// emit records a sample with its value and the label pairs besides those
+// identifying the device or the peer.
+type emit func(value float64, labels ...string)
+
+var deviceMetrics = []struct {
+	metric
+	samples func(d *wgtypes.Device, now time.Time, emit emit)
+}{
+	{metric{"wireguard_peers", "gauge", "Peers configured on the device."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(len(d.Peers)))
+	}},
+	{metric{"wireguard_queue_length", "gauge", "Elements in a work queue of the device."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(d.EncryptionQueue.Length), "queue", "encryption")
+		emit(float64(d.DecryptionQueue.Length), "queue", "decryption")
+		emit(float64(d.HandshakeQueue.Length), "queue", "handshake")
+	}},
+	{metric{"wireguard_queue_drops", "counter", "Elements dropped because a work queue of the device was full."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(d.EncryptionQueue.Drops), "queue", "encryption")
+		emit(float64(d.DecryptionQueue.Drops), "queue", "decryption")
+		emit(float64(d.HandshakeQueue.Drops), "queue", "handshake")
+	}},
+	{metric{"wireguard_cookie_replies_sent", "counter", "Cookie replies sent to handshake initiators while under load."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(d.CookieRepliesSent))
+	}},
+	{metric{"wireguard_ratelimiter_rejects", "counter", "Handshake messages refused by the ratelimiter."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(d.RatelimiterRejects))
+	}},
+	{metric{"wireguard_decrypt_failures", "counter", "Transport packets which failed authentication."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emit(float64(d.DecryptFailures))
+	}},
+	{metric{"wireguard_under_load", "gauge", "Whether the device demands cookies from handshake initiators."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		if d.UnderLoad {
+			emit(1)
+		} else {
+			emit(0)
+		}
+	}},
+	{metric{"wireguard_handshake_errors", "counter", "Handshake messages rejected by the device, by reason."}, func(d *wgtypes.Device, now time.Time, emit emit) {
+		emitHandshakeErrors(d.HandshakeErrors, emit)
+	}},
+}
+
+var peerMetrics = []struct {
+	metric
+	samples func(p *wgtypes.Peer, now time.Time, emit emit)
+}{
+	{metric{"wireguard_peer_receive_bytes", "counter", "Bytes received from the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.ReceiveBytes))
+	}},
+	{metric{"wireguard_peer_transmit_bytes", "counter", "Bytes sent to the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.TransmitBytes))
+	}},
+	{metric{"wireguard_peer_receive_packets", "counter", "Authenticated packets received from the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.ReceivePackets))
+	}},
+	{metric{"wireguard_peer_transmit_packets", "counter", "Packets sent to the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.TransmitPackets))
+	}},
+	{metric{"wireguard_peer_handshake_attempts", "counter", "Handshake initiations sent to the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.HandshakeAttempts))
+	}},
+	{metric{"wireguard_peer_last_handshake_seconds", "gauge", "Unix time of the last handshake with the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		if !p.LastHandshakeTime.IsZero() {
+			emit(float64(p.LastHandshakeTime.UnixNano()) / float64(time.Second))
+		}
+	}},
+	{metric{"wireguard_peer_handshake_age_seconds", "gauge", "Seconds since the last handshake with the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		if !p.LastHandshakeTime.IsZero() {
+			emit(age(now, p.LastHandshakeTime))
+		}
+	}},
+	{metric{"wireguard_peer_keypair_age_seconds", "gauge", "Seconds since the current session keys with the peer were derived."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		if !p.KeypairCreated.IsZero() {
+			emit(age(now, p.KeypairCreated))
+		}
+	}},
+	{metric{"wireguard_peer_transmit_drops", "counter", "Packets to the peer dropped before encryption because a queue was full."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.TransmitDrops))
+	}},
+	{metric{"wireguard_peer_receive_drops", "counter", "Packets from the peer dropped before decryption because a queue was full."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.ReceiveDrops))
+	}},
+	{metric{"wireguard_peer_decrypt_failures", "counter", "Transport packets from the peer which failed authentication."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.DecryptFailures))
+	}},
+	{metric{"wireguard_peer_replay_rejects", "counter", "Transport packets from the peer refused by the replay filter."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.ReplayRejects))
+	}},
+	{metric{"wireguard_peer_allowed_ips_rejects", "counter", "Packets from the peer with a source address outside its allowed IPs."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.AllowedIPsRejects))
+	}},
+	{metric{"wireguard_peer_handshake_initiations_received", "counter", "Handshake initiations received from the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emit(float64(p.HandshakeInitiationsReceived))
+	}},
+	{metric{"wireguard_peer_handshake_rtt_seconds", "gauge", "Round trip time of the last handshake initiated with the peer."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		if p.HandshakeRTT != 0 {
+			emit(p.HandshakeRTT.Seconds())
+		}
+	}},
+	{metric{"wireguard_peer_handshake_errors", "counter", "Handshake messages from the peer rejected by the device, by reason."}, func(p *wgtypes.Peer, now time.Time, emit emit) {
+		emitHandshakeErrors(p.HandshakeErrors, emit)
+	}},
+}
+
+// emitHandshakeErrors emits a sample for every reason of errs, in order of
+// the reason.
+func emitHandshakeErrors(errs map[string]int64, emit emit) {
+	reasons := make([]string, 0, len(errs))
+	for reason := range errs {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for _, reason := range reasons {
+		emit(float64(errs[reason]), "reason", reason)
+	}
+}
+
+// age returns the seconds from t to now, never negative.
+func age(now, t time.Time) float64 {
+	d := now.Sub(t)
+	if d < 0 {
+		return 0
+	}
+	return d.Seconds()
+}
+
+// Write writes the metrics of devices, as of now, to w in the OpenMetrics
+// text format.
+func Write(w io.Writer, devices []*wgtypes.Device, now time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	for _, m := range deviceMetrics {
+		writeHeader(bw, m.metric)
+		for _, d := range devices {
+			m.samples(d, now, func(value float64, labels ...string) {
+				writeSample(bw, m.sampleName(), append([]string{"interface", d.Name}, labels...), value)
+			})
+		}
+	}
+
+	for _, m := range peerMetrics {
+		writeHeader(bw, m.metric)
+		for _, d := range devices {
+			for i := range d.Peers {
+				p := &d.Peers[i]
+
+				peer := []string{"interface", d.Name, "public_key", base64.StdEncoding.EncodeToString(p.PublicKey)}
+				if p.Name != "" {
+					peer = append(peer, "name", p.Name)
+				}
+
+				m.samples(p, now, func(value float64, labels ...string) {
+					writeSample(bw, m.sampleName(), append(peer, labels...), value)
+				})
+			}
+		}
+	}
+
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, m metric) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+}
+
+// writeSample writes a sample with labels given as name, value pairs.
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+	w.WriteString(name)
+	w.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(w, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	w.WriteString("} ")
+	w.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Handler returns an http.Handler which serves the metrics of the devices
+// returned by devices on every request.
+func Handler(devices func() ([]*wgtypes.Device, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ds, err := devices()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to read devices: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		Write(w, ds, time.Now())
+	})
+}
+
+// Listen opens a listener for Handler on addr. An address of the form
+// unix:PATH is a Unix socket which only its owner may connect to. Any other
+// address is a TCP address, on which metrics are served in plain HTTP, as
+// Prometheus scrapes them.
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,223 @@
+package wgmetrics_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgmetrics"
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+var (
+	testNow = time.Unix(1600000100, 0)
+
+	testKey = wgtypes.Key{0x03, 0x0a, 0x07, 0xb2, 0x59, 0x17, 0xa7, 0x14, 0xb3, 0x19, 0x4e, 0x12, 0x5a, 0x5c, 0x18, 0x56, 0x6b, 0xd5, 0x84, 0x35, 0xd1, 0x05, 0xf6, 0xd2, 0xfa, 0xeb, 0x91, 0x90, 0xa3, 0xa6, 0x28, 0x35}
+)
+
+func testDevices() []*wgtypes.Device {
+	return []*wgtypes.Device{
+		{
+			Name:               "wg0",
+			EncryptionQueue:    wgtypes.QueueStats{Length: 2, Drops: 1},
+			DecryptionQueue:    wgtypes.QueueStats{Length: 3},
+			HandshakeQueue:     wgtypes.QueueStats{Drops: 7},
+			CookieRepliesSent:  4,
+			RatelimiterRejects: 5,
+			DecryptFailures:    6,
+			UnderLoad:          true,
+			HandshakeErrors:    map[string]int64{"unknown_peer": 2, "mac1_mismatch": 5},
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         testKey,
+					Name:              `al"ice`,
+					ReceiveBytes:      100,
+					TransmitBytes:     200,
+					ReceivePackets:    10,
+					TransmitPackets:   20,
+					HandshakeAttempts: 3,
+					LastHandshakeTime: time.Unix(1600000000, 5e8),
+					KeypairCreated:    time.Unix(1600000000, 0),
+
+					TransmitDrops:                1,
+					ReceiveDrops:                 2,
+					DecryptFailures:              3,
+					ReplayRejects:                4,
+					AllowedIPsRejects:            5,
+					HandshakeInitiationsReceived: 6,
+					HandshakeRTT:                 12500 * time.Microsecond,
+					HandshakeErrors:              map[string]int64{"replayed_timestamp": 1},
+				},
+			},
+		},
+		{
+			Name: "wg1",
+			Peers: []wgtypes.Peer{
+				{PublicKey: testKey},
+			},
+		},
+	}
+}
+
+const testMetrics = `# TYPE wireguard_peers gauge
+# HELP wireguard_peers Peers configured on the device.
+wireguard_peers{interface="wg0"} 1
+wireguard_peers{interface="wg1"} 1
+# TYPE wireguard_queue_length gauge
+# HELP wireguard_queue_length Elements in a work queue of the device.
+wireguard_queue_length{interface="wg0",queue="encryption"} 2
+wireguard_queue_length{interface="wg0",queue="decryption"} 3
+wireguard_queue_length{interface="wg0",queue="handshake"} 0
+wireguard_queue_length{interface="wg1",queue="encryption"} 0
+wireguard_queue_length{interface="wg1",queue="decryption"} 0
+wireguard_queue_length{interface="wg1",queue="handshake"} 0
+# TYPE wireguard_queue_drops counter
+# HELP wireguard_queue_drops Elements dropped because a work queue of the device was full.
+wireguard_queue_drops_total{interface="wg0",queue="encryption"} 1
+wireguard_queue_drops_total{interface="wg0",queue="decryption"} 0
+wireguard_queue_drops_total{interface="wg0",queue="handshake"} 7
+wireguard_queue_drops_total{interface="wg1",queue="encryption"} 0
+wireguard_queue_drops_total{interface="wg1",queue="decryption"} 0
+wireguard_queue_drops_total{interface="wg1",queue="handshake"} 0
+# TYPE wireguard_cookie_replies_sent counter
+# HELP wireguard_cookie_replies_sent Cookie replies sent to handshake initiators while under load.
+wireguard_cookie_replies_sent_total{interface="wg0"} 4
+wireguard_cookie_replies_sent_total{interface="wg1"} 0
+# TYPE wireguard_ratelimiter_rejects counter
+# HELP wireguard_ratelimiter_rejects Handshake messages refused by the ratelimiter.
+wireguard_ratelimiter_rejects_total{interface="wg0"} 5
+wireguard_ratelimiter_rejects_total{interface="wg1"} 0
+# TYPE wireguard_decrypt_failures counter
+# HELP wireguard_decrypt_failures Transport packets which failed authentication.
+wireguard_decrypt_failures_total{interface="wg0"} 6
+wireguard_decrypt_failures_total{interface="wg1"} 0
+# TYPE wireguard_under_load gauge
+# HELP wireguard_under_load Whether the device demands cookies from handshake initiators.
+wireguard_under_load{interface="wg0"} 1
+wireguard_under_load{interface="wg1"} 0
+# TYPE wireguard_handshake_errors counter
+# HELP wireguard_handshake_errors Handshake messages rejected by the device, by reason.
+wireguard_handshake_errors_total{interface="wg0",reason="mac1_mismatch"} 5
+wireguard_handshake_errors_total{interface="wg0",reason="unknown_peer"} 2
+# TYPE wireguard_peer_receive_bytes counter
+# HELP wireguard_peer_receive_bytes Bytes received from the peer.
+wireguard_peer_receive_bytes_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 100
+wireguard_peer_receive_bytes_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_transmit_bytes counter
+# HELP wireguard_peer_transmit_bytes Bytes sent to the peer.
+wireguard_peer_transmit_bytes_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 200
+wireguard_peer_transmit_bytes_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_receive_packets counter
+# HELP wireguard_peer_receive_packets Authenticated packets received from the peer.
+wireguard_peer_receive_packets_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 10
+wireguard_peer_receive_packets_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_transmit_packets counter
+# HELP wireguard_peer_transmit_packets Packets sent to the peer.
+wireguard_peer_transmit_packets_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 20
+wireguard_peer_transmit_packets_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_handshake_attempts counter
+# HELP wireguard_peer_handshake_attempts Handshake initiations sent to the peer.
+wireguard_peer_handshake_attempts_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 3
+wireguard_peer_handshake_attempts_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_last_handshake_seconds gauge
+# HELP wireguard_peer_last_handshake_seconds Unix time of the last handshake with the peer.
+wireguard_peer_last_handshake_seconds{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 1600000000.5
+# TYPE wireguard_peer_handshake_age_seconds gauge
+# HELP wireguard_peer_handshake_age_seconds Seconds since the last handshake with the peer.
+wireguard_peer_handshake_age_seconds{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 99.5
+# TYPE wireguard_peer_keypair_age_seconds gauge
+# HELP wireguard_peer_keypair_age_seconds Seconds since the current session keys with the peer were derived.
+wireguard_peer_keypair_age_seconds{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 100
+# TYPE wireguard_peer_transmit_drops counter
+# HELP wireguard_peer_transmit_drops Packets to the peer dropped before encryption because a queue was full.
+wireguard_peer_transmit_drops_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 1
+wireguard_peer_transmit_drops_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_receive_drops counter
+# HELP wireguard_peer_receive_drops Packets from the peer dropped before decryption because a queue was full.
+wireguard_peer_receive_drops_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 2
+wireguard_peer_receive_drops_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_decrypt_failures counter
+# HELP wireguard_peer_decrypt_failures Transport packets from the peer which failed authentication.
+wireguard_peer_decrypt_failures_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 3
+wireguard_peer_decrypt_failures_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_replay_rejects counter
+# HELP wireguard_peer_replay_rejects Transport packets from the peer refused by the replay filter.
+wireguard_peer_replay_rejects_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 4
+wireguard_peer_replay_rejects_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_allowed_ips_rejects counter
+# HELP wireguard_peer_allowed_ips_rejects Packets from the peer with a source address outside its allowed IPs.
+wireguard_peer_allowed_ips_rejects_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 5
+wireguard_peer_allowed_ips_rejects_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_handshake_initiations_received counter
+# HELP wireguard_peer_handshake_initiations_received Handshake initiations received from the peer.
+wireguard_peer_handshake_initiations_received_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 6
+wireguard_peer_handshake_initiations_received_total{interface="wg1",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU="} 0
+# TYPE wireguard_peer_handshake_rtt_seconds gauge
+# HELP wireguard_peer_handshake_rtt_seconds Round trip time of the last handshake initiated with the peer.
+wireguard_peer_handshake_rtt_seconds{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice"} 0.0125
+# TYPE wireguard_peer_handshake_errors counter
+# HELP wireguard_peer_handshake_errors Handshake messages from the peer rejected by the device, by reason.
+wireguard_peer_handshake_errors_total{interface="wg0",public_key="AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU=",name="al\"ice",reason="replayed_timestamp"} 1
+# EOF
+`
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := wgmetrics.Write(&buf, testDevices(), testNow); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+
+	if diff := cmp.Diff(testMetrics, buf.String()); diff != "" {
+		t.Fatalf("unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(wgmetrics.Handler(func() ([]*wgtypes.Device, error) {
+		return testDevices(), nil
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get metrics: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != wgmetrics.ContentType {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	if !bytes.HasSuffix(b, []byte("# EOF\n")) {
+		t.Fatalf("metrics not terminated by # EOF:\n%s", b)
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	srv := httptest.NewServer(wgmetrics.Handler(func() ([]*wgtypes.Device, error) {
+		return nil, errors.New("no such device")
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get metrics: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %s", res.Status)
+	}
+}
@@ -0,0 +1,666 @@
+package wgtypes
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A ParseError is returned by ParseConfig when a configuration file cannot be
+// parsed. It carries the position of the offending line.
+type ParseError struct {
+	// Name is the name of the configuration file, if known.
+	Name string
+
+	// Line is the 1-based number of the offending line.
+	Line int
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *ParseError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %v", e.Name, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// A ConfigureError is returned when a userspace device rejects a
+// configuration. Such devices apply a configuration as a whole, so none of it
+// has taken effect.
+type ConfigureError struct {
+	// Errno is the error number reported by the device, as in errno.h.
+	Errno syscall.Errno
+
+	// Line is the 1-based number of the offending line of the request sent
+	// to the device, or 0 if the device did not name one.
+	Line int
+
+	// Message describes the error, if the device provided a description.
+	Message string
+}
+
+// Error implements error.
+func (e *ConfigureError) Error() string {
+	switch {
+	case e.Message == "":
+		return fmt.Sprintf("device rejected configuration: %v", e.Errno)
+	case e.Line == 0:
+		return fmt.Sprintf("device rejected configuration: %s", e.Message)
+	default:
+		return fmt.Sprintf("device rejected configuration: line %d: %s", e.Line, e.Message)
+	}
+}
+
+// Unwrap returns Errno, so that the error can be matched against syscall
+// errors with errors.Is.
+func (e *ConfigureError) Unwrap() error {
+	return e.Errno
+}
+
+// Configuration file sections and keys. Both are matched case-insensitively.
+const (
+	sectionInterface = "interface"
+	sectionPeer      = "peer"
+
+	keyPrivateKey                 = "privatekey"
+	keyListenPort                 = "listenport"
+	keyFwMark                     = "fwmark"
+	keyRolloverWindow             = "rolloverwindow"
+	keyLivenessDownAfter          = "livenessdownafter"
+	keyLivenessDegradedAfter      = "livenessdegradedafter"
+	keyLivenessProbeInterval      = "livenessprobeinterval"
+	keyPublicKey                  = "publickey"
+	keyPresharedKey               = "presharedkey"
+	keyNextPresharedKey           = "nextpresharedkey"
+	keyNextPresharedKeyActivation = "nextpresharedkeyactivation"
+	keyExpiresAt                  = "expiresat"
+	keyAllowedIPs                 = "allowedips"
+	keyEndpoint                   = "endpoint"
+	keyPersistentKeepalive        = "persistentkeepalive"
+	keyName                       = "name"
+	keyAnnotation                 = "annotation"
+)
+
+// ParseConfig parses a configuration file in the format used by wg setconf
+// and produced by wg showconf. name is only used in error messages.
+//
+// Lines may contain comments starting with '#'. Section names and keys are
+// case-insensitive. AllowedIPs may be repeated and holds a comma-separated
+// list, Annotation may be repeated and holds a key=value pair; any other key
+// given twice in the same section overrides the earlier value. In a [Peer]
+// section, Name and Annotation may also be written as comments, such as
+// "# Name = alice", for files shared with tools which do not know them.
+// Errors are of type *ParseError.
+func ParseConfig(name string, r io.Reader) (*Config, error) {
+	var cfg Config
+	var peer *PeerConfig
+	var peerLine int
+
+	finishPeer := func() error {
+		if peer == nil {
+			return nil
+		}
+		if peer.PublicKey == nil {
+			return &ParseError{Name: name, Line: peerLine, Err: fmt.Errorf("peer is missing a public key")}
+		}
+
+		cfg.Peers = append(cfg.Peers, *peer)
+		peer = nil
+
+		return nil
+	}
+
+	err := scanConfig(name, r, func(line configLine) error {
+		if line.key == "" {
+			if err := finishPeer(); err != nil {
+				return err
+			}
+			if line.section == sectionPeer {
+				peer = new(PeerConfig)
+				peerLine = line.num
+			}
+			return nil
+		}
+
+		var err error
+		if line.section == sectionInterface {
+			err = parseInterfaceKey(&cfg, strings.ToLower(line.key), line.value)
+		} else {
+			err = parsePeerKey(peer, strings.ToLower(line.key), line.value)
+		}
+
+		return line.error(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := finishPeer(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// A configLine is a section header or a setting of a configuration file.
+type configLine struct {
+	name string
+	num  int
+
+	// section is the lowercased name of the current section.
+	section string
+
+	// key and value are empty for a section header. key keeps its case.
+	key, value string
+}
+
+// error wraps the error of parsing the setting on line into a *ParseError.
+func (line configLine) error(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case errUnknownKey:
+		err = fmt.Errorf("unknown key in [%s] section: %s", line.section, line.key)
+	default:
+		err = fmt.Errorf("invalid %s: %v", line.key, err)
+	}
+
+	return &ParseError{Name: line.name, Line: line.num, Err: err}
+}
+
+// scanConfig splits a configuration file into lines, strips comments and
+// checks the structure of sections, then calls fn for every header and
+// setting. It stops at the first error, either its own or one from fn.
+func scanConfig(name string, r io.Reader, fn func(line configLine) error) error {
+	var section string
+
+	fail := func(line int, format string, a ...interface{}) error {
+		return &ParseError{Name: name, Line: line, Err: fmt.Errorf(format, a...)}
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if section == sectionPeer && strings.HasPrefix(line, "#") {
+			if key, value, ok := commentLabel(line[1:]); ok {
+				if err := fn(configLine{name: name, num: lineNum, section: section, key: key, value: value}); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fail(lineNum, "malformed section header: %s", line)
+			}
+
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if section != sectionInterface && section != sectionPeer {
+				return fail(lineNum, "unknown section: %s", line)
+			}
+
+			if err := fn(configLine{name: name, num: lineNum, section: section}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return fail(lineNum, "line unrecognized: %s", line)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+
+		if section == "" {
+			return fail(lineNum, "key outside of a section: %s", key)
+		}
+
+		if err := fn(configLine{name: name, num: lineNum, section: section, key: key, value: value}); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// commentLabel recognizes "Name = ..." and "Annotation = ..." in the text
+// of a comment.
+func commentLabel(comment string) (key, value string, ok bool) {
+	i := strings.IndexByte(comment, '=')
+	if i < 0 {
+		return "", "", false
+	}
+
+	key = strings.TrimSpace(comment[:i])
+	switch strings.ToLower(key) {
+	case keyName, keyAnnotation:
+		return key, strings.TrimSpace(comment[i+1:]), true
+	default:
+		return "", "", false
+	}
+}
+
+var errUnknownKey = errors.New("unknown key")
+
+func parseInterfaceKey(cfg *Config, key, value string) error {
+	switch key {
+	case keyPrivateKey:
+		k, err := parseKeyLen(value, PrivateKeyLen)
+		if err != nil {
+			return err
+		}
+		cfg.PrivateKey = &k
+	case keyListenPort:
+		port, err := strconv.ParseUint(value, 0, 16)
+		if err != nil {
+			return err
+		}
+		p := int(port)
+		cfg.ListenPort = &p
+	case keyFwMark:
+		if value == "off" {
+			value = "0"
+		}
+		mark, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return err
+		}
+		m := int(mark)
+		cfg.FirewallMark = &m
+	case keyRolloverWindow:
+		secs, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		d := time.Duration(secs) * time.Second
+		cfg.RolloverWindow = &d
+	case keyLivenessDownAfter, keyLivenessDegradedAfter, keyLivenessProbeInterval:
+		secs, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		d := time.Duration(secs) * time.Second
+		switch key {
+		case keyLivenessDownAfter:
+			cfg.LivenessDownAfter = &d
+		case keyLivenessDegradedAfter:
+			cfg.LivenessDegradedAfter = &d
+		default:
+			cfg.LivenessProbeInterval = &d
+		}
+	default:
+		return errUnknownKey
+	}
+
+	return nil
+}
+
+func parsePeerKey(peer *PeerConfig, key, value string) error {
+	switch key {
+	case keyPublicKey:
+		k, err := parseKeyLen(value, PublicKeyLen)
+		if err != nil {
+			return err
+		}
+		peer.PublicKey = k
+	case keyPresharedKey:
+		k, err := parseKeyLen(value, PskLen)
+		if err != nil {
+			return err
+		}
+		peer.PresharedKey = &k
+	case keyNextPresharedKey:
+		k, err := parseKeyLen(value, PskLen)
+		if err != nil {
+			return err
+		}
+		peer.NextPresharedKey = &k
+	case keyNextPresharedKeyActivation:
+		t, err := ParseTime(value)
+		if err != nil {
+			return err
+		}
+		peer.NextPresharedKeyActivation = &t
+	case keyExpiresAt:
+		t, err := ParseTime(value)
+		if err != nil {
+			return err
+		}
+		peer.ExpiresAt = &t
+	case keyAllowedIPs:
+		ips, err := parseAllowedIPs(value)
+		if err != nil {
+			return err
+		}
+		// AllowedIPs accumulate across repeated lines, but an empty value
+		// still has to yield a non-nil list.
+		if peer.AllowedIPs == nil {
+			peer.AllowedIPs = []net.IPNet{}
+		}
+		peer.AllowedIPs = append(peer.AllowedIPs, ips...)
+	case keyEndpoint:
+		endpoint, err := parseEndpoint(value)
+		if err != nil {
+			return err
+		}
+		peer.Endpoint = endpoint
+	case keyPersistentKeepalive:
+		if value == "off" {
+			value = "0"
+		}
+		secs, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		if secs == 0 {
+			peer.PersistentKeepaliveInterval = nil
+			break
+		}
+		d := time.Duration(secs) * time.Second
+		peer.PersistentKeepaliveInterval = &d
+	case keyName:
+		peer.Name = &value
+	case keyAnnotation:
+		i := strings.IndexByte(value, '=')
+		if i <= 0 {
+			return errors.New("not a key=value pair")
+		}
+		if peer.Annotations == nil {
+			peer.Annotations = make(map[string]string)
+		}
+		peer.Annotations[strings.TrimSpace(value[:i])] = strings.TrimSpace(value[i+1:])
+	default:
+		return errUnknownKey
+	}
+
+	return nil
+}
+
+func parseKeyLen(s string, length int) (Key, error) {
+	k, err := ParseKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(k) != length {
+		return nil, fmt.Errorf("incorrect key size: %d", len(k))
+	}
+
+	return k, nil
+}
+
+// ParseTime parses a time as written in configuration files, either an RFC
+// 3339 timestamp or UNIX seconds, where 0 stands for the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, fmt.Errorf("neither RFC 3339 nor UNIX seconds: %s", s)
+	}
+	if secs == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(secs, 0), nil
+}
+
+func parseAllowedIPs(s string) ([]net.IPNet, error) {
+	var ips []net.IPNet
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+
+		ips = append(ips, *n)
+	}
+
+	return ips, nil
+}
+
+// parseEndpoint resolves a host:port pair. The host may carry an IPv6 zone.
+func parseEndpoint(s string) (*net.UDPAddr, error) {
+	hostStr, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// The IPv6 scoped addressing zone identifier starts after the last
+	// percent sign.
+	host, zone := hostStr, ""
+	if i := strings.LastIndexByte(hostStr, '%'); i > 0 {
+		host, zone = hostStr[:i], hostStr[i+1:]
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &net.UDPAddr{
+		IP:   ips[0],
+		Port: int(port),
+		Zone: zone,
+	}, nil
+}
+
+// Config returns the configuration which recreates d when applied with
+// ReplacePeers. Unset and all-zero keys are left nil.
+func (d *Device) Config() Config {
+	var cfg Config
+
+	if d.ListenPort != 0 {
+		cfg.ListenPort = &d.ListenPort
+	}
+	if d.FirewallMark != 0 {
+		cfg.FirewallMark = &d.FirewallMark
+	}
+	if d.LivenessDownAfter != 0 {
+		cfg.LivenessDownAfter = &d.LivenessDownAfter
+		cfg.LivenessDegradedAfter = &d.LivenessDegradedAfter
+		cfg.LivenessProbeInterval = &d.LivenessProbeInterval
+	}
+	if !isZeroKey(d.PrivateKey) {
+		cfg.PrivateKey = &d.PrivateKey
+	}
+
+	for i := range d.Peers {
+		peer := &d.Peers[i]
+		peerCfg := PeerConfig{
+			PublicKey:  peer.PublicKey,
+			Endpoint:   peer.Endpoint,
+			AllowedIPs: peer.AllowedIPs,
+		}
+
+		if peer.Name != "" {
+			peerCfg.Name = &peer.Name
+		}
+		if len(peer.Annotations) != 0 {
+			peerCfg.Annotations = peer.Annotations
+		}
+
+		if !isZeroKey(peer.PresharedKey) {
+			peerCfg.PresharedKey = &peer.PresharedKey
+		}
+		if !peer.NextPresharedKeyActivation.IsZero() {
+			peerCfg.NextPresharedKey = &peer.NextPresharedKey
+			peerCfg.NextPresharedKeyActivation = &peer.NextPresharedKeyActivation
+		}
+		if !peer.ExpiresAt.IsZero() {
+			peerCfg.ExpiresAt = &peer.ExpiresAt
+		}
+		if peer.PersistentKeepaliveInterval != 0 {
+			peerCfg.PersistentKeepaliveInterval = &peer.PersistentKeepaliveInterval
+		}
+
+		cfg.Peers = append(cfg.Peers, peerCfg)
+	}
+
+	return cfg
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isZeroKey(k Key) bool {
+	for _, b := range k {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalText implements encoding.TextMarshaler. The output is a
+// configuration file accepted by ParseConfig and wg setconf; fields which
+// cannot be expressed in a configuration file, such as ReplacePeers or
+// PeerConfig.Remove, are ignored.
+func (cfg Config) MarshalText() ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "[Interface]\n")
+	if cfg.ListenPort != nil {
+		fmt.Fprintf(&b, "ListenPort = %d\n", *cfg.ListenPort)
+	}
+	if cfg.FirewallMark != nil {
+		fmt.Fprintf(&b, "FwMark = 0x%x\n", *cfg.FirewallMark)
+	}
+	if cfg.PrivateKey != nil {
+		fmt.Fprintf(&b, "PrivateKey = %s\n", cfg.PrivateKey.String())
+	}
+	if cfg.RolloverWindow != nil {
+		fmt.Fprintf(&b, "RolloverWindow = %d\n", *cfg.RolloverWindow/time.Second)
+	}
+	if cfg.LivenessDownAfter != nil {
+		fmt.Fprintf(&b, "LivenessDownAfter = %d\n", *cfg.LivenessDownAfter/time.Second)
+	}
+	if cfg.LivenessDegradedAfter != nil {
+		fmt.Fprintf(&b, "LivenessDegradedAfter = %d\n", *cfg.LivenessDegradedAfter/time.Second)
+	}
+	if cfg.LivenessProbeInterval != nil {
+		fmt.Fprintf(&b, "LivenessProbeInterval = %d\n", *cfg.LivenessProbeInterval/time.Second)
+	}
+
+	for _, peer := range cfg.Peers {
+		if peer.PublicKey == nil {
+			return nil, fmt.Errorf("wgtypes: peer is missing a public key")
+		}
+
+		fmt.Fprintf(&b, "\n[Peer]\nPublicKey = %s\n", peer.PublicKey.String())
+
+		if peer.Name != nil {
+			if strings.ContainsAny(*peer.Name, "#\n") {
+				return nil, fmt.Errorf("wgtypes: peer name cannot be written to a configuration file: %q", *peer.Name)
+			}
+			fmt.Fprintf(&b, "Name = %s\n", *peer.Name)
+		}
+		for _, key := range sortedKeys(peer.Annotations) {
+			value := peer.Annotations[key]
+			if strings.ContainsAny(key+value, "#\n") || strings.ContainsRune(key, '=') {
+				return nil, fmt.Errorf("wgtypes: annotation cannot be written to a configuration file: %q", key)
+			}
+			fmt.Fprintf(&b, "Annotation = %s=%s\n", key, value)
+		}
+
+		if peer.PresharedKey != nil {
+			fmt.Fprintf(&b, "PresharedKey = %s\n", peer.PresharedKey.String())
+		}
+		if peer.NextPresharedKey != nil {
+			fmt.Fprintf(&b, "NextPresharedKey = %s\n", peer.NextPresharedKey.String())
+		}
+		if peer.NextPresharedKeyActivation != nil {
+			if peer.NextPresharedKeyActivation.IsZero() {
+				fmt.Fprintf(&b, "NextPresharedKeyActivation = 0\n")
+			} else {
+				fmt.Fprintf(&b, "NextPresharedKeyActivation = %s\n", peer.NextPresharedKeyActivation.UTC().Format(time.RFC3339))
+			}
+		}
+		if peer.ExpiresAt != nil {
+			if peer.ExpiresAt.IsZero() {
+				fmt.Fprintf(&b, "ExpiresAt = 0\n")
+			} else {
+				fmt.Fprintf(&b, "ExpiresAt = %s\n", peer.ExpiresAt.UTC().Format(time.RFC3339))
+			}
+		}
+
+		if peer.AllowedIPs != nil {
+			s := make([]string, 0, len(peer.AllowedIPs))
+			for _, ip := range peer.AllowedIPs {
+				s = append(s, ip.String())
+			}
+			fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(s, ", "))
+		}
+
+		if peer.Endpoint != nil {
+			fmt.Fprintf(&b, "Endpoint = %s\n", peer.Endpoint.String())
+		}
+
+		if peer.PersistentKeepaliveInterval != nil {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", *peer.PersistentKeepaliveInterval/time.Second)
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseConfig.
+func (cfg *Config) UnmarshalText(text []byte) error {
+	parsed, err := ParseConfig("", bytes.NewReader(text))
+	if err != nil {
+		return err
+	}
+
+	*cfg = *parsed
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package wgtypes_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+const (
+	testPrivateKey = "27Ra+J32PrdNntVpH0gI4aRhvPRFRLHQPmT3vhICfVk="
+	testPublicKey1 = "AwoHslkXpxSzGU4SWlwYVmvVhDXRBfbS+uuRkKOmKDU1"
+	testPublicKey2 = "AtAZRTfsGdeW1EXx0yeO9KY+cA94kJMPL71Q1uHKxx6u"
+	testPskKey     = "3jB5o5+qR3Mc5iDMGhaSrO1GGvyWhSAK0/6fT1QR9XI="
+)
+
+func mustParseKey(s string) wgtypes.Key {
+	k, err := wgtypes.ParseKey(s)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func mustCIDR(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return *n
+}
+
+func TestParseConfig(t *testing.T) {
+	config := `
+# server configuration
+[interface]
+privatekey = ` + testPrivateKey + `   # inline comment
+ListenPort = 1337
+FwMark = off
+
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+AllowedIPs = 10.10.10.1/32, 192.168.1.0/24
+ALLOWEDIPS = fd00::1/128
+PersistentKeepalive = 25
+PersistentKeepalive = 30
+
+[PEER]
+PublicKey = ` + testPublicKey2 + `
+AllowedIPs =
+PresharedKey = ` + testPskKey + `
+`
+
+	privateKey := mustParseKey(testPrivateKey)
+	presharedKey := mustParseKey(testPskKey)
+	port, fwmark := 1337, 0
+	keepalive := 30 * time.Second
+
+	want := &wgtypes.Config{
+		PrivateKey:   &privateKey,
+		ListenPort:   &port,
+		FirewallMark: &fwmark,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   mustParseKey(testPublicKey1),
+				PersistentKeepaliveInterval: &keepalive,
+				AllowedIPs: []net.IPNet{
+					mustCIDR("10.10.10.1/32"),
+					mustCIDR("192.168.1.0/24"),
+					mustCIDR("fd00::1/128"),
+				},
+			},
+			{
+				PublicKey:    mustParseKey(testPublicKey2),
+				PresharedKey: &presharedKey,
+				AllowedIPs:   []net.IPNet{},
+			},
+		},
+	}
+
+	got, err := wgtypes.ParseConfig("wg0.conf", strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ParseConfig() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseConfigLabels(t *testing.T) {
+	config := `
+[Interface]
+# Name = ignored outside of peers
+
+[Peer]
+# Name = alice laptop
+# Annotation = owner=alice
+# just a comment
+PublicKey = ` + testPublicKey1 + `
+
+[Peer]
+PublicKey = ` + testPublicKey2 + `
+Name = bob
+Annotation = team = ops=oncall
+`
+
+	alice, bob := "alice laptop", "bob"
+
+	want := &wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:   mustParseKey(testPublicKey1),
+				Name:        &alice,
+				Annotations: map[string]string{"owner": "alice"},
+			},
+			{
+				PublicKey:   mustParseKey(testPublicKey2),
+				Name:        &bob,
+				Annotations: map[string]string{"team": "ops=oncall"},
+			},
+		},
+	}
+
+	got, err := wgtypes.ParseConfig("wg0.conf", strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ParseConfig() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		line   int
+		msg    string
+	}{
+		{
+			name:   "no equals sign",
+			config: "[Interface]\nListenPort\n",
+			line:   2,
+			msg:    "wg0.conf:2: line unrecognized: ListenPort",
+		},
+		{
+			name:   "key outside of a section",
+			config: "# comment\nListenPort = 1\n",
+			line:   2,
+			msg:    "wg0.conf:2: key outside of a section: ListenPort",
+		},
+		{
+			name:   "unknown section",
+			config: "[Interface]\n[Server]\n",
+			line:   2,
+			msg:    "wg0.conf:2: unknown section: [Server]",
+		},
+		{
+			name:   "unknown key",
+			config: "[Peer]\nPublicKey = " + testPublicKey1 + "\nFoo = bar\n",
+			line:   3,
+			msg:    "wg0.conf:3: unknown key in [peer] section: Foo",
+		},
+		{
+			name:   "invalid value",
+			config: "[Interface]\n\nListenPort = 70000\n",
+			line:   3,
+		},
+		{
+			name:   "private key as public key",
+			config: "[Peer]\nPublicKey = " + testPrivateKey + "\n",
+			line:   2,
+		},
+		{
+			name:   "peer without public key",
+			config: "[Peer]\nAllowedIPs = 10.0.0.1/32\n\n[Peer]\nPublicKey = " + testPublicKey1 + "\n",
+			line:   1,
+			msg:    "wg0.conf:1: peer is missing a public key",
+		},
+		{
+			name:   "last peer without public key",
+			config: "[Peer]\nPublicKey = " + testPublicKey1 + "\n[Peer]\n",
+			line:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := wgtypes.ParseConfig("wg0.conf", strings.NewReader(tt.config))
+
+			var perr *wgtypes.ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a *ParseError, got: %v", err)
+			}
+			if perr.Line != tt.line {
+				t.Fatalf("unexpected line: %d, want %d (%v)", perr.Line, tt.line, err)
+			}
+			if tt.msg != "" && err.Error() != tt.msg {
+				t.Fatalf("unexpected error message:\n got: %s\nwant: %s", err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestConfigMarshalTextRoundTrip(t *testing.T) {
+	privateKey := mustParseKey(testPrivateKey)
+	presharedKey := mustParseKey(testPskKey)
+	port, fwmark := 51820, 0x10
+	window := 10 * time.Minute
+	keepalive := 25 * time.Second
+	down, degraded, probe := 2*time.Minute, 30*time.Second, time.Duration(0)
+	activation := time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)
+	name := "alice laptop"
+	expiresAt := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	cfg := wgtypes.Config{
+		PrivateKey:     &privateKey,
+		ListenPort:     &port,
+		FirewallMark:   &fwmark,
+		RolloverWindow: &window,
+
+		LivenessDownAfter:     &down,
+		LivenessDegradedAfter: &degraded,
+		LivenessProbeInterval: &probe,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   mustParseKey(testPublicKey1),
+				Name:                        &name,
+				Annotations:                 map[string]string{"owner": "alice", "team": "ops=oncall"},
+				PresharedKey:                &presharedKey,
+				NextPresharedKey:            &presharedKey,
+				NextPresharedKeyActivation:  &activation,
+				ExpiresAt:                   &expiresAt,
+				PersistentKeepaliveInterval: &keepalive,
+				Endpoint: &net.UDPAddr{
+					IP:   net.ParseIP("fe80::1ff:fe23:4567:890a"),
+					Port: 1337,
+					Zone: "eth0",
+				},
+				AllowedIPs: []net.IPNet{
+					mustCIDR("10.10.10.1/32"),
+					mustCIDR("fd00::/64"),
+				},
+			},
+			{
+				PublicKey: mustParseKey(testPublicKey2),
+				Endpoint: &net.UDPAddr{
+					IP:   net.IPv4(192, 168, 0, 1),
+					Port: 1337,
+				},
+			},
+		},
+	}
+
+	text, err := cfg.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed wgtypes.Config
+	if err := parsed.UnmarshalText(text); err != nil {
+		t.Fatalf("failed to parse marshaled configuration: %v\n%s", err, text)
+	}
+
+	if diff := cmp.Diff(cfg, parsed); diff != "" {
+		t.Fatalf("round trip mismatch (-want +got):\n%s", diff)
+	}
+
+	again, err := parsed.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(string(text), string(again)); diff != "" {
+		t.Fatalf("MarshalText() is not stable (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,391 @@
+package wgtypes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Possible PeerChange actions.
+const (
+	PeerAdd    = "add"
+	PeerUpdate = "update"
+	PeerRemove = "remove"
+)
+
+// hiddenValue stands in for secrets in a Change.
+const hiddenValue = "(hidden)"
+
+// A Change is the change of a single field, named after its configuration
+// file key. Old is empty when the field was not set before, and secrets are
+// never shown.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// A PeerChange lists the changes to a single peer.
+type PeerChange struct {
+	PublicKey         Key      `json:"public_key"`
+	Action            string   `json:"action"`
+	Changes           []Change `json:"changes,omitempty"`
+	AllowedIPsAdded   []string `json:"allowed_ips_added,omitempty"`
+	AllowedIPsRemoved []string `json:"allowed_ips_removed,omitempty"`
+}
+
+// A Plan is the set of changes which brings a Device to the state described
+// by a Config, with the semantics of wg syncconf: peers missing from the
+// Config are removed, and fields the Config leaves unset are kept, except for
+// the preshared key and the persistent keepalive interval, which are reset. An
+// expiry is only cancelled by a zero ExpiresAt.
+type Plan struct {
+	Interface []Change     `json:"interface,omitempty"`
+	Peers     []PeerChange `json:"peers,omitempty"`
+
+	config Config
+}
+
+// Empty reports whether applying the plan would change nothing.
+func (p *Plan) Empty() bool {
+	return len(p.Interface) == 0 && len(p.Peers) == 0
+}
+
+// Config returns the minimal configuration which carries out the plan. Peers
+// being updated use UpdateOnly, and ReplaceAllowedIPs only when some allowed
+// IPs are removed.
+func (p *Plan) Config() Config {
+	return p.config
+}
+
+// ErrRedacted is returned by Diff for a device read without its secrets,
+// whose missing keys cannot be told apart from keys which are not set.
+var ErrRedacted = errors.New("wgtypes: device was read without its secrets")
+
+// Diff computes the plan which turns device into cfg. It returns ErrRedacted
+// if device is Redacted.
+func Diff(device *Device, cfg *Config) (*Plan, error) {
+	if device.Redacted {
+		return nil, ErrRedacted
+	}
+
+	plan := new(Plan)
+
+	if cfg.PrivateKey != nil && !bytes.Equal(device.PrivateKey, *cfg.PrivateKey) {
+		change := Change{Field: "PrivateKey", New: hiddenValue}
+		if !isZeroKey(device.PrivateKey) {
+			change.Old = hiddenValue
+		}
+		plan.Interface = append(plan.Interface, change)
+		plan.config.PrivateKey = cfg.PrivateKey
+		plan.config.RolloverWindow = cfg.RolloverWindow
+	}
+
+	if cfg.ListenPort != nil && *cfg.ListenPort != device.ListenPort {
+		plan.Interface = append(plan.Interface, Change{
+			Field: "ListenPort",
+			Old:   formatPort(device.ListenPort),
+			New:   formatPort(*cfg.ListenPort),
+		})
+		plan.config.ListenPort = cfg.ListenPort
+	}
+
+	if cfg.FirewallMark != nil && *cfg.FirewallMark != device.FirewallMark {
+		plan.Interface = append(plan.Interface, Change{
+			Field: "FwMark",
+			Old:   formatFwMark(device.FirewallMark),
+			New:   formatFwMark(*cfg.FirewallMark),
+		})
+		plan.config.FirewallMark = cfg.FirewallMark
+	}
+
+	liveness := []struct {
+		field   string
+		current time.Duration
+		next    *time.Duration
+		set     **time.Duration
+	}{
+		{"LivenessDownAfter", device.LivenessDownAfter, cfg.LivenessDownAfter, &plan.config.LivenessDownAfter},
+		{"LivenessDegradedAfter", device.LivenessDegradedAfter, cfg.LivenessDegradedAfter, &plan.config.LivenessDegradedAfter},
+		{"LivenessProbeInterval", device.LivenessProbeInterval, cfg.LivenessProbeInterval, &plan.config.LivenessProbeInterval},
+	}
+	for _, l := range liveness {
+		if l.next != nil && *l.next != l.current {
+			plan.Interface = append(plan.Interface, Change{
+				Field: l.field,
+				Old:   formatKeepalive(l.current),
+				New:   formatKeepalive(*l.next),
+			})
+			*l.set = l.next
+		}
+	}
+
+	current := make(map[string]*Peer)
+	for i := range device.Peers {
+		current[string(device.Peers[i].PublicKey)] = &device.Peers[i]
+	}
+
+	wanted := make(map[string]bool)
+	for i := range cfg.Peers {
+		peerCfg := &cfg.Peers[i]
+		peer, exists := current[string(peerCfg.PublicKey)]
+
+		if peerCfg.Remove {
+			continue
+		}
+		wanted[string(peerCfg.PublicKey)] = true
+
+		if !exists {
+			plan.addPeer(peerCfg)
+		} else {
+			plan.updatePeer(peer, peerCfg)
+		}
+	}
+
+	for i := range device.Peers {
+		peer := &device.Peers[i]
+		if wanted[string(peer.PublicKey)] {
+			continue
+		}
+
+		plan.Peers = append(plan.Peers, PeerChange{PublicKey: peer.PublicKey, Action: PeerRemove})
+		plan.config.Peers = append(plan.config.Peers, PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+	}
+
+	return plan, nil
+}
+
+func (p *Plan) addPeer(cfg *PeerConfig) {
+	change := PeerChange{PublicKey: cfg.PublicKey, Action: PeerAdd}
+
+	if cfg.Name != nil && *cfg.Name != "" {
+		change.Changes = append(change.Changes, Change{Field: "Name", New: *cfg.Name})
+	}
+	if len(cfg.Annotations) != 0 {
+		change.Changes = append(change.Changes, Change{Field: "Annotations", New: formatAnnotations(cfg.Annotations)})
+	}
+
+	if cfg.PresharedKey != nil && !isZeroKey(*cfg.PresharedKey) {
+		change.Changes = append(change.Changes, Change{Field: "PresharedKey", New: hiddenValue})
+	}
+	if cfg.NextPresharedKeyActivation != nil && !cfg.NextPresharedKeyActivation.IsZero() {
+		change.Changes = append(change.Changes,
+			Change{Field: "NextPresharedKey", New: hiddenValue},
+			Change{Field: "NextPresharedKeyActivation", New: formatTime(*cfg.NextPresharedKeyActivation)},
+		)
+	}
+	if cfg.ExpiresAt != nil && !cfg.ExpiresAt.IsZero() {
+		change.Changes = append(change.Changes, Change{Field: "ExpiresAt", New: formatTime(*cfg.ExpiresAt)})
+	}
+	if cfg.Endpoint != nil {
+		change.Changes = append(change.Changes, Change{Field: "Endpoint", New: cfg.Endpoint.String()})
+	}
+	if cfg.PersistentKeepaliveInterval != nil && *cfg.PersistentKeepaliveInterval != 0 {
+		change.Changes = append(change.Changes, Change{Field: "PersistentKeepalive", New: formatKeepalive(*cfg.PersistentKeepaliveInterval)})
+	}
+	for _, ip := range cfg.AllowedIPs {
+		change.AllowedIPsAdded = append(change.AllowedIPsAdded, ip.String())
+	}
+
+	peer := *cfg
+	peer.UpdateOnly = false
+	peer.ReplaceAllowedIPs = false
+
+	p.Peers = append(p.Peers, change)
+	p.config.Peers = append(p.config.Peers, peer)
+}
+
+func (p *Plan) updatePeer(current *Peer, cfg *PeerConfig) {
+	change := PeerChange{PublicKey: cfg.PublicKey, Action: PeerUpdate}
+	update := PeerConfig{PublicKey: cfg.PublicKey, UpdateOnly: true}
+
+	// an unset name, annotations, preshared key, expiry or keepalive means
+	// none, as with setconf
+
+	var name string
+	if cfg.Name != nil {
+		name = *cfg.Name
+	}
+	if name != current.Name {
+		change.Changes = append(change.Changes, Change{Field: "Name", Old: current.Name, New: name})
+		update.Name = &name
+	}
+
+	if formatAnnotations(cfg.Annotations) != formatAnnotations(current.Annotations) {
+		change.Changes = append(change.Changes, Change{
+			Field: "Annotations",
+			Old:   formatAnnotations(current.Annotations),
+			New:   formatAnnotations(cfg.Annotations),
+		})
+		update.ReplaceAnnotations = true
+		update.Annotations = cfg.Annotations
+	}
+
+	psk := make(Key, PskLen)
+	if cfg.PresharedKey != nil {
+		psk = *cfg.PresharedKey
+	}
+	currentPsk := current.PresharedKey
+	if isZeroKey(currentPsk) {
+		currentPsk = make(Key, PskLen)
+	}
+	if !bytes.Equal(currentPsk, psk) {
+		c := Change{Field: "PresharedKey"}
+		if !isZeroKey(currentPsk) {
+			c.Old = hiddenValue
+		}
+		if !isZeroKey(psk) {
+			c.New = hiddenValue
+		}
+		change.Changes = append(change.Changes, c)
+		update.PresharedKey = &psk
+	}
+
+	if activation := cfg.NextPresharedKeyActivation; activation != nil {
+		keyChanged := cfg.NextPresharedKey != nil && !bytes.Equal(*cfg.NextPresharedKey, current.NextPresharedKey)
+
+		if keyChanged || !activation.Equal(current.NextPresharedKeyActivation) {
+			if keyChanged {
+				change.Changes = append(change.Changes, Change{Field: "NextPresharedKey", New: hiddenValue})
+			}
+
+			c := Change{Field: "NextPresharedKeyActivation"}
+			if !current.NextPresharedKeyActivation.IsZero() {
+				c.Old = formatTime(current.NextPresharedKeyActivation)
+			}
+			if !activation.IsZero() {
+				c.New = formatTime(*activation)
+			}
+			change.Changes = append(change.Changes, c)
+
+			update.NextPresharedKey = cfg.NextPresharedKey
+			update.NextPresharedKeyActivation = activation
+		}
+	}
+
+	// an expiry set at runtime is kept unless the Config cancels it, and the
+	// device keeps it in whole seconds
+	if expiresAt := cfg.ExpiresAt; expiresAt != nil &&
+		(expiresAt.IsZero() != current.ExpiresAt.IsZero() || expiresAt.Unix() != current.ExpiresAt.Unix()) {
+		c := Change{Field: "ExpiresAt"}
+		if !current.ExpiresAt.IsZero() {
+			c.Old = formatTime(current.ExpiresAt)
+		}
+		if !expiresAt.IsZero() {
+			c.New = formatTime(*expiresAt)
+		}
+		change.Changes = append(change.Changes, c)
+		update.ExpiresAt = expiresAt
+	}
+
+	if cfg.Endpoint != nil && (current.Endpoint == nil || current.Endpoint.String() != cfg.Endpoint.String()) {
+		c := Change{Field: "Endpoint", New: cfg.Endpoint.String()}
+		if current.Endpoint != nil {
+			c.Old = current.Endpoint.String()
+		}
+		change.Changes = append(change.Changes, c)
+		update.Endpoint = cfg.Endpoint
+	}
+
+	var keepalive time.Duration
+	if cfg.PersistentKeepaliveInterval != nil {
+		keepalive = *cfg.PersistentKeepaliveInterval
+	}
+	if keepalive != current.PersistentKeepaliveInterval {
+		change.Changes = append(change.Changes, Change{
+			Field: "PersistentKeepalive",
+			Old:   formatKeepalive(current.PersistentKeepaliveInterval),
+			New:   formatKeepalive(keepalive),
+		})
+		update.PersistentKeepaliveInterval = &keepalive
+	}
+
+	added, removed := diffAllowedIPs(current.AllowedIPs, cfg.AllowedIPs)
+	for _, ip := range added {
+		change.AllowedIPsAdded = append(change.AllowedIPsAdded, ip.String())
+	}
+	for _, ip := range removed {
+		change.AllowedIPsRemoved = append(change.AllowedIPsRemoved, ip.String())
+	}
+
+	if len(removed) != 0 {
+		update.ReplaceAllowedIPs = true
+		update.AllowedIPs = append([]net.IPNet{}, cfg.AllowedIPs...)
+	} else {
+		update.AllowedIPs = added
+	}
+
+	if len(change.Changes) == 0 && len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	p.Peers = append(p.Peers, change)
+	p.config.Peers = append(p.config.Peers, update)
+}
+
+// diffAllowedIPs returns the entries of next missing from current, in the
+// order of next, and the entries of current missing from next, in the order
+// of current.
+func diffAllowedIPs(current, next []net.IPNet) (added, removed []net.IPNet) {
+	has := func(list []net.IPNet, ip net.IPNet) bool {
+		for _, other := range list {
+			if other.String() == ip.String() {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, ip := range next {
+		if !has(current, ip) && !has(added, ip) {
+			added = append(added, ip)
+		}
+	}
+	for _, ip := range current {
+		if !has(next, ip) {
+			removed = append(removed, ip)
+		}
+	}
+
+	return added, removed
+}
+
+// formatAnnotations renders annotations as sorted, comma-separated
+// key=value pairs.
+func formatAnnotations(annotations map[string]string) string {
+	var pairs []string
+	for _, key := range sortedKeys(annotations) {
+		pairs = append(pairs, key+"="+annotations[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func formatPort(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", port)
+}
+
+func formatFwMark(mark int) string {
+	if mark == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("0x%x", mark)
+}
+
+// formatKeepalive formats keepalive intervals and other durations in whole
+// seconds, where 0 turns the setting off.
+func formatKeepalive(d time.Duration) string {
+	if d == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d", d/time.Second)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
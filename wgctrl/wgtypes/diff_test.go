@@ -0,0 +1,301 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestDiff(t *testing.T) {
+	var (
+		peer1 = mustParseKey(testPublicKey1)
+		peer2 = mustParseKey(testPublicKey2)
+		psk   = mustParseKey(testPskKey)
+		zero  = make(wgtypes.Key, wgtypes.PskLen)
+
+		port      = 51820
+		keepalive = 25 * time.Second
+		off       = time.Duration(0)
+		endpoint  = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820}
+		name      = "alice laptop"
+
+		expiresAt       = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+		expiresAtMillis = expiresAt.Add(500 * time.Millisecond)
+	)
+
+	tests := []struct {
+		name       string
+		device     *wgtypes.Device
+		cfg        *wgtypes.Config
+		interfaces []wgtypes.Change
+		peers      []wgtypes.PeerChange
+		want       wgtypes.Config
+	}{
+		{
+			name: "unchanged",
+			device: &wgtypes.Device{
+				ListenPort: port,
+				Peers: []wgtypes.Peer{{
+					PublicKey:                   peer1,
+					PresharedKey:                psk,
+					PersistentKeepaliveInterval: keepalive,
+					AllowedIPs:                  []net.IPNet{mustCIDR("10.0.0.1/32")},
+				}},
+			},
+			cfg: &wgtypes.Config{
+				ListenPort: &port,
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   peer1,
+					PresharedKey:                &psk,
+					PersistentKeepaliveInterval: &keepalive,
+					AllowedIPs:                  []net.IPNet{mustCIDR("10.0.0.1/32")},
+				}},
+			},
+		},
+		{
+			name:   "listen port",
+			device: &wgtypes.Device{ListenPort: 1337},
+			cfg:    &wgtypes.Config{ListenPort: &port},
+			interfaces: []wgtypes.Change{
+				{Field: "ListenPort", Old: "1337", New: "51820"},
+			},
+			want: wgtypes.Config{ListenPort: &port},
+		},
+		{
+			name: "liveness",
+			device: &wgtypes.Device{
+				LivenessDownAfter:     time.Minute,
+				LivenessDegradedAfter: keepalive,
+			},
+			cfg: &wgtypes.Config{
+				LivenessDownAfter:     &keepalive,
+				LivenessDegradedAfter: &off,
+				LivenessProbeInterval: &off,
+			},
+			interfaces: []wgtypes.Change{
+				{Field: "LivenessDownAfter", Old: "60", New: "25"},
+				{Field: "LivenessDegradedAfter", Old: "25", New: "off"},
+			},
+			want: wgtypes.Config{
+				LivenessDownAfter:     &keepalive,
+				LivenessDegradedAfter: &off,
+			},
+		},
+		{
+			name: "allowed ips added",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{
+					PublicKey:  peer1,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.0.1/32")},
+				}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer1,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.0.1/32"), mustCIDR("10.0.1.0/24")},
+				}},
+			},
+			peers: []wgtypes.PeerChange{{
+				PublicKey:       peer1,
+				Action:          wgtypes.PeerUpdate,
+				AllowedIPsAdded: []string{"10.0.1.0/24"},
+			}},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer1,
+					UpdateOnly: true,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.1.0/24")},
+				}},
+			},
+		},
+		{
+			name: "allowed ips removed",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{
+					PublicKey:  peer1,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.0.1/32"), mustCIDR("10.0.1.0/24")},
+				}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer1,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.0.1/32")},
+				}},
+			},
+			peers: []wgtypes.PeerChange{{
+				PublicKey:         peer1,
+				Action:            wgtypes.PeerUpdate,
+				AllowedIPsRemoved: []string{"10.0.1.0/24"},
+			}},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:         peer1,
+					UpdateOnly:        true,
+					ReplaceAllowedIPs: true,
+					AllowedIPs:        []net.IPNet{mustCIDR("10.0.0.1/32")},
+				}},
+			},
+		},
+		{
+			name: "dropped settings are reset",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{
+					PublicKey:                   peer1,
+					PresharedKey:                psk,
+					PersistentKeepaliveInterval: keepalive,
+				}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey: peer1,
+					Endpoint:  endpoint,
+				}},
+			},
+			peers: []wgtypes.PeerChange{{
+				PublicKey: peer1,
+				Action:    wgtypes.PeerUpdate,
+				Changes: []wgtypes.Change{
+					{Field: "PresharedKey", Old: "(hidden)"},
+					{Field: "Endpoint", New: "192.0.2.1:51820"},
+					{Field: "PersistentKeepalive", Old: "25", New: "off"},
+				},
+			}},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   peer1,
+					UpdateOnly:                  true,
+					PresharedKey:                &zero,
+					Endpoint:                    endpoint,
+					PersistentKeepaliveInterval: &off,
+				}},
+			},
+		},
+		{
+			name: "labels",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{
+					PublicKey:   peer1,
+					Name:        "alice",
+					Annotations: map[string]string{"owner": "alice", "team": "ops"},
+				}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:   peer1,
+					Name:        &name,
+					Annotations: map[string]string{"owner": "alice"},
+				}},
+			},
+			peers: []wgtypes.PeerChange{{
+				PublicKey: peer1,
+				Action:    wgtypes.PeerUpdate,
+				Changes: []wgtypes.Change{
+					{Field: "Name", Old: "alice", New: "alice laptop"},
+					{Field: "Annotations", Old: "owner=alice, team=ops", New: "owner=alice"},
+				},
+			}},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:          peer1,
+					UpdateOnly:         true,
+					Name:               &name,
+					ReplaceAnnotations: true,
+					Annotations:        map[string]string{"owner": "alice"},
+				}},
+			},
+		},
+		{
+			name: "expiry",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{
+					{PublicKey: peer1, ExpiresAt: expiresAt},
+					{PublicKey: peer2, ExpiresAt: expiresAt},
+				},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{PublicKey: peer1, ExpiresAt: &expiresAtMillis},
+					{PublicKey: peer2, ExpiresAt: &time.Time{}},
+				},
+			},
+			peers: []wgtypes.PeerChange{{
+				PublicKey: peer2,
+				Action:    wgtypes.PeerUpdate,
+				Changes: []wgtypes.Change{
+					{Field: "ExpiresAt", Old: "2020-12-01T00:00:00Z"},
+				},
+			}},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer2,
+					UpdateOnly: true,
+					ExpiresAt:  &time.Time{},
+				}},
+			},
+		},
+		{
+			name: "expiry kept",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{PublicKey: peer1, ExpiresAt: expiresAt}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: peer1}},
+			},
+		},
+		{
+			name: "peers added and removed",
+			device: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{PublicKey: peer1}},
+			},
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer2,
+					AllowedIPs: []net.IPNet{mustCIDR("10.0.0.2/32")},
+				}},
+			},
+			peers: []wgtypes.PeerChange{
+				{PublicKey: peer2, Action: wgtypes.PeerAdd, AllowedIPsAdded: []string{"10.0.0.2/32"}},
+				{PublicKey: peer1, Action: wgtypes.PeerRemove},
+			},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{PublicKey: peer2, AllowedIPs: []net.IPNet{mustCIDR("10.0.0.2/32")}},
+					{PublicKey: peer1, Remove: true},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := wgtypes.Diff(tt.device, tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to diff: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.interfaces, plan.Interface); diff != "" {
+				t.Errorf("unexpected interface changes (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.peers, plan.Peers); diff != "" {
+				t.Errorf("unexpected peer changes (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want, plan.Config()); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+			if empty := len(tt.interfaces) == 0 && len(tt.peers) == 0; plan.Empty() != empty {
+				t.Errorf("Empty() = %v, want %v", plan.Empty(), empty)
+			}
+		})
+	}
+}
+
+func TestDiffRedacted(t *testing.T) {
+	device := &wgtypes.Device{Redacted: true}
+	if _, err := wgtypes.Diff(device, &wgtypes.Config{}); err != wgtypes.ErrRedacted {
+		t.Fatalf("expected ErrRedacted, got: %v", err)
+	}
+}
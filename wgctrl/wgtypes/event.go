@@ -0,0 +1,96 @@
+package wgtypes
+
+import (
+	"net"
+	"time"
+)
+
+// An EventType specifies what an Event reports.
+type EventType int
+
+// Possible EventType values.
+const (
+	UnknownEvent EventType = iota
+
+	// HandshakeEvent reports a completed handshake with a peer.
+	HandshakeEvent
+
+	// EndpointEvent reports that a peer roamed to a new endpoint.
+	EndpointEvent
+
+	// HandshakeFailedEvent reports that the device gave up on a handshake
+	// with a peer after retrying it.
+	HandshakeFailedEvent
+
+	// KeysZeroedEvent reports that the session keys of a peer were wiped,
+	// because no new handshake completed in time.
+	KeysZeroedEvent
+
+	// PeerAddedEvent reports that a peer was added.
+	PeerAddedEvent
+
+	// PeerRemovedEvent reports that a peer was removed.
+	PeerRemovedEvent
+
+	// PrivateKeyEvent reports that the private key of the device changed.
+	PrivateKeyEvent
+
+	// LivenessEvent reports that the liveness state of a peer changed.
+	LivenessEvent
+)
+
+var eventTypeNames = []string{
+	UnknownEvent:         "unknown",
+	HandshakeEvent:       "handshake",
+	EndpointEvent:        "endpoint",
+	HandshakeFailedEvent: "handshake_failed",
+	KeysZeroedEvent:      "keys_zeroed",
+	PeerAddedEvent:       "peer_added",
+	PeerRemovedEvent:     "peer_removed",
+	PrivateKeyEvent:      "private_key",
+	LivenessEvent:        "liveness",
+}
+
+// String returns the name of an EventType in the userspace configuration
+// protocol.
+func (et EventType) String() string {
+	if et < 0 || int(et) >= len(eventTypeNames) {
+		return eventTypeNames[UnknownEvent]
+	}
+	return eventTypeNames[et]
+}
+
+// ParseEventType parses the name of an EventType, returning UnknownEvent for
+// names it does not know.
+func ParseEventType(s string) EventType {
+	for et, name := range eventTypeNames {
+		if name == s {
+			return EventType(et)
+		}
+	}
+	return UnknownEvent
+}
+
+// An Event is something which happened to a device or to one of its peers,
+// as reported by Client.Watch.
+type Event struct {
+	// Type specifies what happened.
+	Type EventType
+
+	// Time is when it happened.
+	Time time.Time
+
+	// PublicKey is the public key of the peer, or the new public key of the
+	// device for a PrivateKeyEvent.
+	PublicKey Key
+
+	// Endpoint is the new endpoint of the peer for an EndpointEvent.
+	Endpoint *net.UDPAddr
+
+	// Liveness is the new state of the peer for a LivenessEvent.
+	Liveness LivenessState
+
+	// Dropped is the number of events of the watch which the device dropped
+	// before this one because the watcher did not keep up.
+	Dropped uint64
+}
@@ -0,0 +1,670 @@
+package wgtypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// JSONSchemaVersion is the version of the JSON representation of Device,
+// Peer and Config. Fields may be added within a version; it is only bumped
+// when a field is renamed, removed or changes its meaning.
+//
+// In version 1 keys are base64 strings, times are RFC 3339 strings,
+// durations are whole seconds, round trip times are milliseconds, allowed
+// IPs are arrays of CIDR strings and unset values are null rather than
+// omitted.
+const JSONSchemaVersion = 1
+
+// MarshalText implements encoding.TextMarshaler, encoding k in base64.
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see ParseKey.
+func (k *Key) UnmarshalText(text []byte) error {
+	key, err := ParseKey(string(text))
+	if err != nil {
+		return err
+	}
+
+	*k = key
+	return nil
+}
+
+type jsonDevice struct {
+	Name                  string     `json:"name"`
+	Type                  string     `json:"type"`
+	PrivateKey            *Key       `json:"private_key"`
+	PublicKey             *Key       `json:"public_key"`
+	Redacted              bool       `json:"redacted"`
+	PreviousPublicKey     *Key       `json:"previous_public_key"`
+	RolloverExpires       *time.Time `json:"rollover_expires"`
+	ListenPort            int        `json:"listen_port"`
+	FirewallMark          int        `json:"firewall_mark"`
+	LivenessDownAfter     int64      `json:"liveness_down_after_seconds"`
+	LivenessDegradedAfter int64      `json:"liveness_degraded_after_seconds"`
+	LivenessProbeInterval int64      `json:"liveness_probe_interval_seconds"`
+	EncryptionQueue       jsonQueue  `json:"encryption_queue"`
+	DecryptionQueue       jsonQueue  `json:"decryption_queue"`
+	HandshakeQueue        jsonQueue  `json:"handshake_queue"`
+	CookieRepliesSent     int64      `json:"cookie_replies_sent"`
+	RatelimiterRejects    int64      `json:"ratelimiter_rejects"`
+	DecryptFailures       int64      `json:"decrypt_failures"`
+	UnderLoad             bool       `json:"under_load"`
+
+	HandshakeErrors       map[string]int64           `json:"handshake_errors"`
+	HandshakeErrorSources []jsonHandshakeErrorSource `json:"handshake_error_sources"`
+
+	Peers []Peer `json:"peers"`
+}
+
+type jsonHandshakeErrorSource struct {
+	IP       string    `json:"ip"`
+	Reason   string    `json:"reason"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type jsonQueue struct {
+	Length int64 `json:"length"`
+	Drops  int64 `json:"drops"`
+}
+
+type jsonPeer struct {
+	PublicKey                    Key               `json:"public_key"`
+	Name                         string            `json:"name"`
+	Annotations                  map[string]string `json:"annotations"`
+	PresharedKey                 *Key              `json:"preshared_key"`
+	NextPresharedKey             *Key              `json:"next_preshared_key"`
+	NextPresharedKeyActivation   *time.Time        `json:"next_preshared_key_activation"`
+	PresharedKeyHandshakes       int64             `json:"preshared_key_handshakes"`
+	NextPresharedKeyHandshakes   int64             `json:"next_preshared_key_handshakes"`
+	ExpiresAt                    *time.Time        `json:"expires_at"`
+	Endpoint                     *string           `json:"endpoint"`
+	PersistentKeepalive          int64             `json:"persistent_keepalive_seconds"`
+	LastHandshakeTime            *time.Time        `json:"last_handshake_time"`
+	Liveness                     *string           `json:"liveness"`
+	LivenessChanged              *time.Time        `json:"liveness_changed"`
+	ReceiveBytes                 int64             `json:"receive_bytes"`
+	TransmitBytes                int64             `json:"transmit_bytes"`
+	ReceivePackets               int64             `json:"receive_packets"`
+	TransmitPackets              int64             `json:"transmit_packets"`
+	HandshakeAttempts            int64             `json:"handshake_attempts"`
+	KeypairCreated               *time.Time        `json:"keypair_created"`
+	TransmitDrops                int64             `json:"transmit_drops"`
+	ReceiveDrops                 int64             `json:"receive_drops"`
+	DecryptFailures              int64             `json:"decrypt_failures"`
+	ReplayRejects                int64             `json:"replay_rejects"`
+	AllowedIPsRejects            int64             `json:"allowed_ips_rejects"`
+	HandshakeInitiationsReceived int64             `json:"handshake_initiations_received"`
+	HandshakeRTT                 *float64          `json:"handshake_rtt_ms"`
+	HandshakeErrors              map[string]int64  `json:"handshake_errors"`
+	AllowedIPs                   []string          `json:"allowed_ips"`
+	ProtocolVersion              int               `json:"protocol_version"`
+}
+
+type jsonPeersPage struct {
+	Peers []Peer  `json:"peers"`
+	Next  *string `json:"next"`
+}
+
+type jsonEvent struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	PublicKey *Key      `json:"public_key"`
+	Endpoint  *string   `json:"endpoint"`
+	Liveness  *string   `json:"liveness"`
+	Dropped   uint64    `json:"dropped"`
+}
+
+type jsonConfig struct {
+	PrivateKey            *Key         `json:"private_key"`
+	RolloverWindow        *int64       `json:"rollover_window_seconds"`
+	ListenPort            *int         `json:"listen_port"`
+	FirewallMark          *int         `json:"firewall_mark"`
+	LivenessDownAfter     *int64       `json:"liveness_down_after_seconds"`
+	LivenessDegradedAfter *int64       `json:"liveness_degraded_after_seconds"`
+	LivenessProbeInterval *int64       `json:"liveness_probe_interval_seconds"`
+	ReplacePeers          bool         `json:"replace_peers"`
+	Peers                 []PeerConfig `json:"peers"`
+}
+
+type jsonPeerConfig struct {
+	PublicKey                  Key               `json:"public_key"`
+	Remove                     bool              `json:"remove"`
+	UpdateOnly                 bool              `json:"update_only"`
+	Name                       *string           `json:"name"`
+	ReplaceAnnotations         bool              `json:"replace_annotations"`
+	Annotations                map[string]string `json:"annotations"`
+	PresharedKey               *Key              `json:"preshared_key"`
+	NextPresharedKey           *Key              `json:"next_preshared_key"`
+	NextPresharedKeyActivation *time.Time        `json:"next_preshared_key_activation"`
+	ExpiresAt                  *time.Time        `json:"expires_at"`
+	Endpoint                   *string           `json:"endpoint"`
+	PersistentKeepalive        *int64            `json:"persistent_keepalive_seconds"`
+	ReplaceAllowedIPs          bool              `json:"replace_allowed_ips"`
+	AllowedIPs                 []string          `json:"allowed_ips"`
+}
+
+// MarshalJSON implements json.Marshaler. Zero keys and times are null.
+func (d Device) MarshalJSON() ([]byte, error) {
+	peers := d.Peers
+	if peers == nil {
+		peers = []Peer{}
+	}
+
+	return json.Marshal(jsonDevice{
+		Name:                  d.Name,
+		Type:                  d.Type.String(),
+		PrivateKey:            nonZeroKey(d.PrivateKey),
+		PublicKey:             nonZeroKey(d.PublicKey),
+		Redacted:              d.Redacted,
+		PreviousPublicKey:     nonZeroKey(d.PreviousPublicKey),
+		RolloverExpires:       nonZeroTime(d.RolloverExpires),
+		ListenPort:            d.ListenPort,
+		FirewallMark:          d.FirewallMark,
+		LivenessDownAfter:     int64(d.LivenessDownAfter / time.Second),
+		LivenessDegradedAfter: int64(d.LivenessDegradedAfter / time.Second),
+		LivenessProbeInterval: int64(d.LivenessProbeInterval / time.Second),
+		EncryptionQueue:       jsonQueue(d.EncryptionQueue),
+		DecryptionQueue:       jsonQueue(d.DecryptionQueue),
+		HandshakeQueue:        jsonQueue(d.HandshakeQueue),
+		CookieRepliesSent:     d.CookieRepliesSent,
+		RatelimiterRejects:    d.RatelimiterRejects,
+		DecryptFailures:       d.DecryptFailures,
+		UnderLoad:             d.UnderLoad,
+
+		HandshakeErrors:       handshakeErrorsOrEmpty(d.HandshakeErrors),
+		HandshakeErrorSources: formatHandshakeErrorSources(d.HandshakeErrorSources),
+
+		Peers: peers,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Device) UnmarshalJSON(b []byte) error {
+	var v jsonDevice
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	sources, err := parseHandshakeErrorSources(v.HandshakeErrorSources)
+	if err != nil {
+		return err
+	}
+
+	if len(v.HandshakeErrors) == 0 {
+		v.HandshakeErrors = nil
+	}
+
+	*d = Device{
+		Name:                  v.Name,
+		Type:                  parseDeviceType(v.Type),
+		PrivateKey:            keyOrNil(v.PrivateKey),
+		PublicKey:             keyOrNil(v.PublicKey),
+		Redacted:              v.Redacted,
+		PreviousPublicKey:     keyOrNil(v.PreviousPublicKey),
+		RolloverExpires:       timeOrZero(v.RolloverExpires),
+		ListenPort:            v.ListenPort,
+		FirewallMark:          v.FirewallMark,
+		LivenessDownAfter:     time.Duration(v.LivenessDownAfter) * time.Second,
+		LivenessDegradedAfter: time.Duration(v.LivenessDegradedAfter) * time.Second,
+		LivenessProbeInterval: time.Duration(v.LivenessProbeInterval) * time.Second,
+		EncryptionQueue:       QueueStats(v.EncryptionQueue),
+		DecryptionQueue:       QueueStats(v.DecryptionQueue),
+		HandshakeQueue:        QueueStats(v.HandshakeQueue),
+		CookieRepliesSent:     v.CookieRepliesSent,
+		RatelimiterRejects:    v.RatelimiterRejects,
+		DecryptFailures:       v.DecryptFailures,
+		UnderLoad:             v.UnderLoad,
+
+		HandshakeErrors:       v.HandshakeErrors,
+		HandshakeErrorSources: sources,
+
+		Peers: v.Peers,
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Zero keys and times are null.
+func (p Peer) MarshalJSON() ([]byte, error) {
+	annotations := p.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	v := jsonPeer{
+		PublicKey:                    p.PublicKey,
+		Name:                         p.Name,
+		Annotations:                  annotations,
+		PresharedKey:                 nonZeroKey(p.PresharedKey),
+		NextPresharedKey:             nonZeroKey(p.NextPresharedKey),
+		NextPresharedKeyActivation:   nonZeroTime(p.NextPresharedKeyActivation),
+		PresharedKeyHandshakes:       p.PresharedKeyHandshakes,
+		NextPresharedKeyHandshakes:   p.NextPresharedKeyHandshakes,
+		ExpiresAt:                    nonZeroTime(p.ExpiresAt),
+		Endpoint:                     formatEndpoint(p.Endpoint),
+		PersistentKeepalive:          int64(p.PersistentKeepaliveInterval / time.Second),
+		LastHandshakeTime:            nonZeroTime(p.LastHandshakeTime),
+		Liveness:                     formatLiveness(p.Liveness),
+		LivenessChanged:              nonZeroTime(p.LivenessChanged),
+		ReceiveBytes:                 p.ReceiveBytes,
+		TransmitBytes:                p.TransmitBytes,
+		ReceivePackets:               p.ReceivePackets,
+		TransmitPackets:              p.TransmitPackets,
+		HandshakeAttempts:            p.HandshakeAttempts,
+		KeypairCreated:               nonZeroTime(p.KeypairCreated),
+		TransmitDrops:                p.TransmitDrops,
+		ReceiveDrops:                 p.ReceiveDrops,
+		DecryptFailures:              p.DecryptFailures,
+		ReplayRejects:                p.ReplayRejects,
+		AllowedIPsRejects:            p.AllowedIPsRejects,
+		HandshakeInitiationsReceived: p.HandshakeInitiationsReceived,
+		HandshakeRTT:                 nonZeroMilliseconds(p.HandshakeRTT),
+		HandshakeErrors:              handshakeErrorsOrEmpty(p.HandshakeErrors),
+		AllowedIPs:                   formatIPNets(p.AllowedIPs),
+		ProtocolVersion:              p.ProtocolVersion,
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Peer) UnmarshalJSON(b []byte) error {
+	var v jsonPeer
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	endpoint, err := parseJSONEndpoint(v.Endpoint)
+	if err != nil {
+		return err
+	}
+	allowedIPs, err := parseIPNets(v.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	if len(v.Annotations) == 0 {
+		v.Annotations = nil
+	}
+	if len(v.HandshakeErrors) == 0 {
+		v.HandshakeErrors = nil
+	}
+
+	*p = Peer{
+		PublicKey:                    v.PublicKey,
+		Name:                         v.Name,
+		Annotations:                  v.Annotations,
+		PresharedKey:                 keyOrNil(v.PresharedKey),
+		NextPresharedKey:             keyOrNil(v.NextPresharedKey),
+		NextPresharedKeyActivation:   timeOrZero(v.NextPresharedKeyActivation),
+		PresharedKeyHandshakes:       v.PresharedKeyHandshakes,
+		NextPresharedKeyHandshakes:   v.NextPresharedKeyHandshakes,
+		ExpiresAt:                    timeOrZero(v.ExpiresAt),
+		Endpoint:                     endpoint,
+		PersistentKeepaliveInterval:  time.Duration(v.PersistentKeepalive) * time.Second,
+		LastHandshakeTime:            timeOrZero(v.LastHandshakeTime),
+		Liveness:                     parseJSONLiveness(v.Liveness),
+		LivenessChanged:              timeOrZero(v.LivenessChanged),
+		ReceiveBytes:                 v.ReceiveBytes,
+		TransmitBytes:                v.TransmitBytes,
+		ReceivePackets:               v.ReceivePackets,
+		TransmitPackets:              v.TransmitPackets,
+		HandshakeAttempts:            v.HandshakeAttempts,
+		KeypairCreated:               timeOrZero(v.KeypairCreated),
+		TransmitDrops:                v.TransmitDrops,
+		ReceiveDrops:                 v.ReceiveDrops,
+		DecryptFailures:              v.DecryptFailures,
+		ReplayRejects:                v.ReplayRejects,
+		AllowedIPsRejects:            v.AllowedIPsRejects,
+		HandshakeInitiationsReceived: v.HandshakeInitiationsReceived,
+		HandshakeRTT:                 millisecondsOrZero(v.HandshakeRTT),
+		HandshakeErrors:              v.HandshakeErrors,
+		AllowedIPs:                   allowedIPs,
+		ProtocolVersion:              v.ProtocolVersion,
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The cursor of the last page is
+// null.
+func (pp PeersPage) MarshalJSON() ([]byte, error) {
+	peers := pp.Peers
+	if peers == nil {
+		peers = []Peer{}
+	}
+
+	var next *string
+	if pp.Next != "" {
+		next = &pp.Next
+	}
+
+	return json.Marshal(jsonPeersPage{
+		Peers: peers,
+		Next:  next,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pp *PeersPage) UnmarshalJSON(b []byte) error {
+	var v jsonPeersPage
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*pp = PeersPage{Peers: v.Peers}
+	if v.Next != nil {
+		pp.Next = *v.Next
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The type is the name returned by
+// EventType.String.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonEvent{
+		Type:      e.Type.String(),
+		Time:      e.Time,
+		PublicKey: nonZeroKey(e.PublicKey),
+		Endpoint:  formatEndpoint(e.Endpoint),
+		Liveness:  formatLiveness(e.Liveness),
+		Dropped:   e.Dropped,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var v jsonEvent
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	endpoint, err := parseJSONEndpoint(v.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	*e = Event{
+		Type:      ParseEventType(v.Type),
+		Time:      v.Time,
+		PublicKey: keyOrNil(v.PublicKey),
+		Endpoint:  endpoint,
+		Liveness:  parseJSONLiveness(v.Liveness),
+		Dropped:   v.Dropped,
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Fields which are not set are null.
+func (cfg Config) MarshalJSON() ([]byte, error) {
+	peers := cfg.Peers
+	if peers == nil {
+		peers = []PeerConfig{}
+	}
+
+	return json.Marshal(jsonConfig{
+		PrivateKey:            cfg.PrivateKey,
+		RolloverWindow:        durationSeconds(cfg.RolloverWindow),
+		ListenPort:            cfg.ListenPort,
+		FirewallMark:          cfg.FirewallMark,
+		LivenessDownAfter:     durationSeconds(cfg.LivenessDownAfter),
+		LivenessDegradedAfter: durationSeconds(cfg.LivenessDegradedAfter),
+		LivenessProbeInterval: durationSeconds(cfg.LivenessProbeInterval),
+		ReplacePeers:          cfg.ReplacePeers,
+		Peers:                 peers,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (cfg *Config) UnmarshalJSON(b []byte) error {
+	var v jsonConfig
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*cfg = Config{
+		PrivateKey:            v.PrivateKey,
+		RolloverWindow:        secondsDuration(v.RolloverWindow),
+		ListenPort:            v.ListenPort,
+		FirewallMark:          v.FirewallMark,
+		LivenessDownAfter:     secondsDuration(v.LivenessDownAfter),
+		LivenessDegradedAfter: secondsDuration(v.LivenessDegradedAfter),
+		LivenessProbeInterval: secondsDuration(v.LivenessProbeInterval),
+		ReplacePeers:          v.ReplacePeers,
+		Peers:                 v.Peers,
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Fields which are not set are null.
+func (p PeerConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPeerConfig{
+		PublicKey:                  p.PublicKey,
+		Remove:                     p.Remove,
+		UpdateOnly:                 p.UpdateOnly,
+		Name:                       p.Name,
+		ReplaceAnnotations:         p.ReplaceAnnotations,
+		Annotations:                p.Annotations,
+		PresharedKey:               p.PresharedKey,
+		NextPresharedKey:           p.NextPresharedKey,
+		NextPresharedKeyActivation: p.NextPresharedKeyActivation,
+		ExpiresAt:                  p.ExpiresAt,
+		Endpoint:                   formatEndpoint(p.Endpoint),
+		PersistentKeepalive:        durationSeconds(p.PersistentKeepaliveInterval),
+		ReplaceAllowedIPs:          p.ReplaceAllowedIPs,
+		AllowedIPs:                 formatIPNets(p.AllowedIPs),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *PeerConfig) UnmarshalJSON(b []byte) error {
+	var v jsonPeerConfig
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	endpoint, err := parseJSONEndpoint(v.Endpoint)
+	if err != nil {
+		return err
+	}
+	allowedIPs, err := parseIPNets(v.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	*p = PeerConfig{
+		PublicKey:                   v.PublicKey,
+		Remove:                      v.Remove,
+		UpdateOnly:                  v.UpdateOnly,
+		Name:                        v.Name,
+		ReplaceAnnotations:          v.ReplaceAnnotations,
+		Annotations:                 v.Annotations,
+		PresharedKey:                v.PresharedKey,
+		NextPresharedKey:            v.NextPresharedKey,
+		NextPresharedKeyActivation:  v.NextPresharedKeyActivation,
+		ExpiresAt:                   v.ExpiresAt,
+		Endpoint:                    endpoint,
+		PersistentKeepaliveInterval: secondsDuration(v.PersistentKeepalive),
+		ReplaceAllowedIPs:           v.ReplaceAllowedIPs,
+		AllowedIPs:                  allowedIPs,
+	}
+
+	return nil
+}
+
+// formatLiveness returns nil for LivenessUnknown.
+func formatLiveness(s LivenessState) *string {
+	if s == LivenessUnknown {
+		return nil
+	}
+	name := s.String()
+	return &name
+}
+
+func parseJSONLiveness(s *string) LivenessState {
+	if s == nil {
+		return LivenessUnknown
+	}
+	return ParseLivenessState(*s)
+}
+
+func nonZeroKey(k Key) *Key {
+	if isZeroKey(k) {
+		return nil
+	}
+	return &k
+}
+
+func keyOrNil(k *Key) Key {
+	if k == nil {
+		return nil
+	}
+	return *k
+}
+
+func nonZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func nonZeroMilliseconds(d time.Duration) *float64 {
+	if d == 0 {
+		return nil
+	}
+	ms := float64(d) / float64(time.Millisecond)
+	return &ms
+}
+
+func millisecondsOrZero(ms *float64) time.Duration {
+	if ms == nil {
+		return 0
+	}
+	return time.Duration(*ms * float64(time.Millisecond))
+}
+
+func durationSeconds(d *time.Duration) *int64 {
+	if d == nil {
+		return nil
+	}
+	secs := int64(*d / time.Second)
+	return &secs
+}
+
+func secondsDuration(secs *int64) *time.Duration {
+	if secs == nil {
+		return nil
+	}
+	d := time.Duration(*secs) * time.Second
+	return &d
+}
+
+func parseDeviceType(s string) DeviceType {
+	for _, dt := range []DeviceType{LinuxKernel, OpenBSDKernel, Userspace} {
+		if dt.String() == s {
+			return dt
+		}
+	}
+	return Unknown
+}
+
+func formatEndpoint(addr *net.UDPAddr) *string {
+	if addr == nil {
+		return nil
+	}
+	s := addr.String()
+	return &s
+}
+
+func parseJSONEndpoint(s *string) (*net.UDPAddr, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", *s)
+	if err != nil {
+		return nil, fmt.Errorf("wgtypes: invalid endpoint: %v", err)
+	}
+
+	return addr, nil
+}
+
+// formatIPNets never returns nil, so that empty lists are [] rather than
+// null.
+func formatIPNets(ips []net.IPNet) []string {
+	s := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+func parseIPNets(s []string) ([]net.IPNet, error) {
+	var ips []net.IPNet
+	for _, item := range s {
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("wgtypes: invalid allowed IP: %v", err)
+		}
+		ips = append(ips, *n)
+	}
+	return ips, nil
+}
+
+// handshakeErrorsOrEmpty never returns nil, so that no rejections are {}
+// rather than null.
+func handshakeErrorsOrEmpty(errs map[string]int64) map[string]int64 {
+	if errs == nil {
+		return map[string]int64{}
+	}
+	return errs
+}
+
+// formatHandshakeErrorSources never returns nil, so that empty lists are []
+// rather than null.
+func formatHandshakeErrorSources(sources []HandshakeErrorSource) []jsonHandshakeErrorSource {
+	s := make([]jsonHandshakeErrorSource, 0, len(sources))
+	for _, source := range sources {
+		s = append(s, jsonHandshakeErrorSource{
+			IP:       source.IP.String(),
+			Reason:   source.Reason,
+			Count:    source.Count,
+			LastSeen: source.LastSeen,
+		})
+	}
+	return s
+}
+
+func parseHandshakeErrorSources(s []jsonHandshakeErrorSource) ([]HandshakeErrorSource, error) {
+	var sources []HandshakeErrorSource
+	for _, item := range s {
+		ip := net.ParseIP(item.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("wgtypes: invalid handshake error source: %q", item.IP)
+		}
+		sources = append(sources, HandshakeErrorSource{
+			IP:       ip,
+			Reason:   item.Reason,
+			Count:    item.Count,
+			LastSeen: item.LastSeen,
+		})
+	}
+	return sources, nil
+}
@@ -0,0 +1,154 @@
+package wgtypes_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestPeerMarshalJSON(t *testing.T) {
+	peer := wgtypes.Peer{
+		PublicKey:                   mustParseKey(testPublicKey1),
+		PresharedKey:                make(wgtypes.Key, wgtypes.PskLen),
+		Endpoint:                    &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820},
+		PersistentKeepaliveInterval: 25 * time.Second,
+		LastHandshakeTime:           time.Date(2020, 5, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+		ReceiveBytes:                1024,
+		TransmitBytes:               2048,
+	}
+
+	expected := `{"public_key":"` + testPublicKey1 + `","name":"","annotations":{},"preshared_key":null,"next_preshared_key":null,` +
+		`"next_preshared_key_activation":null,"preshared_key_handshakes":0,"next_preshared_key_handshakes":0,` +
+		`"expires_at":null,"endpoint":"192.0.2.1:51820","persistent_keepalive_seconds":25,"last_handshake_time":"2020-05-01T09:00:00Z",` +
+		`"liveness":null,"liveness_changed":null,"receive_bytes":1024,"transmit_bytes":2048,` +
+		`"receive_packets":0,"transmit_packets":0,"handshake_attempts":0,"keypair_created":null,` +
+		`"transmit_drops":0,"receive_drops":0,"decrypt_failures":0,"replay_rejects":0,"allowed_ips_rejects":0,` +
+		`"handshake_initiations_received":0,"handshake_rtt_ms":null,"handshake_errors":{},"allowed_ips":[],"protocol_version":0}`
+
+	b, err := json.Marshal(peer)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Errorf("unexpected JSON (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	psk := mustParseKey(testPskKey)
+	privateKey := mustParseKey(testPrivateKey)
+	port := 51820
+	keepalive := 25 * time.Second
+	activation := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	device := wgtypes.Device{
+		Name:            "wg0",
+		Type:            wgtypes.Userspace,
+		PrivateKey:      privateKey,
+		PublicKey:       privateKey.PublicKey(),
+		RolloverExpires: time.Time{},
+		ListenPort:      port,
+
+		LivenessDownAfter:     time.Minute,
+		LivenessDegradedAfter: 20 * time.Second,
+
+		HandshakeQueue:     wgtypes.QueueStats{Length: 12, Drops: 3},
+		CookieRepliesSent:  4,
+		RatelimiterRejects: 5,
+		DecryptFailures:    6,
+		UnderLoad:          true,
+
+		HandshakeErrors: map[string]int64{"mac1_mismatch": 2, "unknown_peer": 1},
+		HandshakeErrorSources: []wgtypes.HandshakeErrorSource{
+			{IP: net.ParseIP("192.0.2.1"), Reason: "mac1_mismatch", Count: 2, LastSeen: activation},
+			{IP: net.ParseIP("fd00::2"), Reason: "unknown_peer", Count: 1, LastSeen: activation},
+		},
+
+		Peers: []wgtypes.Peer{{
+			PublicKey:                  mustParseKey(testPublicKey1),
+			PresharedKey:               psk,
+			NextPresharedKey:           psk,
+			NextPresharedKeyActivation: activation,
+			Endpoint:                   &net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 51820},
+			LastHandshakeTime:          activation,
+			Liveness:                   wgtypes.LivenessDegraded,
+			LivenessChanged:            activation,
+			ReceivePackets:             7,
+			TransmitPackets:            8,
+			HandshakeAttempts:          2,
+			KeypairCreated:             activation,
+			ReplayRejects:              3,
+			HandshakeRTT:               12500 * time.Microsecond,
+			HandshakeErrors:            map[string]int64{"replayed_timestamp": 4},
+			AllowedIPs:                 []net.IPNet{mustCIDR("10.0.0.0/24"), mustCIDR("fd00::/64")},
+		}},
+	}
+
+	cfg := wgtypes.Config{
+		PrivateKey:        &privateKey,
+		ListenPort:        &port,
+		LivenessDownAfter: &keepalive,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   mustParseKey(testPublicKey2),
+			PresharedKey:                &psk,
+			NextPresharedKeyActivation:  &activation,
+			PersistentKeepaliveInterval: &keepalive,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  []net.IPNet{mustCIDR("10.0.1.0/24")},
+		}},
+	}
+
+	page := wgtypes.PeersPage{
+		Peers: device.Peers,
+		Next:  "02ab",
+	}
+
+	event := wgtypes.Event{
+		Type:      wgtypes.EndpointEvent,
+		Time:      activation,
+		PublicKey: mustParseKey(testPublicKey1),
+		Endpoint:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 51820},
+		Dropped:   3,
+	}
+
+	liveness := wgtypes.Event{
+		Type:      wgtypes.LivenessEvent,
+		Time:      activation,
+		PublicKey: mustParseKey(testPublicKey1),
+		Liveness:  wgtypes.LivenessDown,
+	}
+
+	tests := []struct {
+		name string
+		in   interface{}
+		out  interface{}
+	}{
+		{name: "device", in: &device, out: new(wgtypes.Device)},
+		{name: "config", in: &cfg, out: new(wgtypes.Config)},
+		{name: "peers page", in: &page, out: new(wgtypes.PeersPage)},
+		{name: "event", in: &event, out: new(wgtypes.Event)},
+		{name: "liveness event", in: &liveness, out: new(wgtypes.Event)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if err := json.Unmarshal(b, tt.out); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.in, tt.out); diff != "" {
+				t.Errorf("unexpected round trip (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
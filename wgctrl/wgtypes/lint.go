@@ -0,0 +1,291 @@
+package wgtypes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/ruwireguard-go/crypto/gost/gost3410"
+)
+
+// Possible Problem severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Identifiers of the checks run by LintConfig.
+const (
+	CheckSyntax              = "syntax"
+	CheckMissingPrivateKey   = "missing-private-key"
+	CheckInvalidKey          = "invalid-key"
+	CheckDuplicatePeer       = "duplicate-peer"
+	CheckOwnPublicKey        = "own-public-key"
+	CheckOverlappingIPs      = "overlapping-allowed-ips"
+	CheckHostBits            = "host-bits"
+	CheckUnresolvedEndpoint  = "unresolved-endpoint"
+	CheckKeepaliveOutOfRange = "keepalive-range"
+	CheckExpiredPeer         = "expired-peer"
+)
+
+// A Problem is a mistake in a configuration file found by LintConfig.
+type Problem struct {
+	Name     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+// String formats p like a compiler diagnostic.
+func (p Problem) String() string {
+	pos := fmt.Sprintf("line %d", p.Line)
+	if p.Name != "" {
+		pos = fmt.Sprintf("%s:%d", p.Name, p.Line)
+	}
+
+	return fmt.Sprintf("%s: %s: %s [%s]", pos, p.Severity, p.Message, p.Check)
+}
+
+// LintOptions tune LintConfig.
+type LintOptions struct {
+	// NoResolve skips the resolution of endpoint host names, for checks
+	// which run offline.
+	NoResolve bool
+}
+
+// lintPeer remembers where the settings of a peer were found.
+type lintPeer struct {
+	cfg        *PeerConfig
+	line       int
+	keyLine    int
+	allowedIPs []int
+}
+
+type linter struct {
+	opts     LintOptions
+	name     string
+	problems []Problem
+
+	cfg            Config
+	interfaceLine  int
+	privateKeyLine int
+	peers          []*lintPeer
+}
+
+// LintConfig parses a configuration file like ParseConfig and checks it for
+// mistakes which the device would either reject with a bare errno or,
+// worse, silently accept. Unlike ParseConfig it reports every problem it
+// finds, skipping settings which cannot be parsed; only a broken section
+// structure stops it early. Problems are sorted by line, and the error is
+// only set when r cannot be read.
+func LintConfig(name string, r io.Reader, opts LintOptions) ([]Problem, error) {
+	l := &linter{opts: opts, name: name}
+
+	err := scanConfig(name, r, l.line)
+	if perr, ok := err.(*ParseError); ok {
+		l.syntax(perr)
+	} else if err != nil {
+		return nil, err
+	}
+
+	l.check()
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+
+	return l.problems, nil
+}
+
+func (l *linter) report(line int, severity, check, format string, a ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		Name:     l.name,
+		Line:     line,
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) syntax(err error) {
+	perr := err.(*ParseError)
+	l.report(perr.Line, SeverityError, CheckSyntax, "%v", perr.Err)
+}
+
+func (l *linter) line(line configLine) error {
+	if line.key == "" {
+		if line.section == sectionInterface {
+			l.interfaceLine = line.num
+		} else {
+			l.peers = append(l.peers, &lintPeer{cfg: new(PeerConfig), line: line.num})
+		}
+		return nil
+	}
+
+	key := strings.ToLower(line.key)
+
+	if line.section == sectionInterface {
+		if err := line.error(parseInterfaceKey(&l.cfg, key, line.value)); err != nil {
+			l.syntax(err)
+		} else if key == keyPrivateKey {
+			l.privateKeyLine = line.num
+		}
+		return nil
+	}
+
+	peer := l.peers[len(l.peers)-1]
+
+	switch key {
+	case keyPersistentKeepalive:
+		if n, err := strconv.ParseInt(line.value, 10, 64); err == nil && (n < 0 || n > 65535) {
+			l.report(line.num, SeverityError, CheckKeepaliveOutOfRange,
+				"persistent keepalive is neither 0/off nor 1-65535: %d", n)
+			return nil
+		}
+	case keyEndpoint:
+		if l.lintEndpoint(line) {
+			return nil
+		}
+	case keyAllowedIPs:
+		l.lintAllowedIPs(line)
+	case keyPublicKey:
+		peer.keyLine = line.num
+	case keyExpiresAt:
+		if t, err := ParseTime(line.value); err == nil && !t.IsZero() && t.Before(time.Now()) {
+			l.report(line.num, SeverityWarning, CheckExpiredPeer,
+				"peer expired at %s, the device removes it right away", t.UTC().Format(time.RFC3339))
+		}
+	}
+
+	before := len(peer.cfg.AllowedIPs)
+
+	if err := line.error(parsePeerKey(peer.cfg, key, line.value)); err != nil {
+		l.syntax(err)
+		return nil
+	}
+
+	for i := before; i < len(peer.cfg.AllowedIPs); i++ {
+		peer.allowedIPs = append(peer.allowedIPs, line.num)
+	}
+
+	return nil
+}
+
+// lintEndpoint reports an endpoint whose host cannot be resolved, and
+// whether it did so. Syntax errors are left to parsePeerKey.
+func (l *linter) lintEndpoint(line configLine) bool {
+	host, _, err := net.SplitHostPort(line.value)
+	if err != nil {
+		return false
+	}
+	if i := strings.LastIndexByte(host, '%'); i > 0 {
+		host = host[:i]
+	}
+
+	if l.opts.NoResolve && net.ParseIP(host) == nil {
+		return true
+	}
+
+	if _, err := net.LookupIP(host); err != nil {
+		l.report(line.num, SeverityError, CheckUnresolvedEndpoint, "cannot resolve endpoint %s: %v", line.value, err)
+		return true
+	}
+
+	return false
+}
+
+// lintAllowedIPs reports networks written with host bits set, which the
+// device silently masks off.
+func (l *linter) lintAllowedIPs(line configLine) {
+	for _, item := range strings.Split(line.value, ",") {
+		item = strings.TrimSpace(item)
+
+		ip, n, err := net.ParseCIDR(item)
+		if err != nil || ip.Equal(n.IP) {
+			continue
+		}
+
+		l.report(line.num, SeverityWarning, CheckHostBits, "%s has host bits set, it means %s", item, n.String())
+	}
+}
+
+// check runs the checks which need the whole file.
+func (l *linter) check() {
+	var publicKey Key
+
+	if l.cfg.PrivateKey == nil {
+		line := l.interfaceLine
+		if line == 0 {
+			line = 1
+		}
+		l.report(line, SeverityWarning, CheckMissingPrivateKey, "interface has no private key")
+	} else if publicKey = l.cfg.PrivateKey.PublicKey(); publicKey == nil {
+		l.report(l.privateKeyLine, SeverityError, CheckInvalidKey, "private key is not a valid GOST R 34.10-2012 key")
+	}
+
+	seen := make(map[string]*lintPeer)
+
+	for i, peer := range l.peers {
+		if peer.cfg.PublicKey == nil {
+			// an unparsable key has already been reported
+			if peer.keyLine == 0 {
+				l.report(peer.line, SeverityError, CheckSyntax, "peer is missing a public key")
+			}
+			continue
+		}
+
+		if x, _ := gost3410.UnmarshalCompressed(Curve, peer.cfg.PublicKey); x == nil {
+			l.report(peer.keyLine, SeverityError, CheckInvalidKey, "public key is not a point of the GOST R 34.10-2012 curve")
+		}
+
+		if publicKey != nil && bytes.Equal(peer.cfg.PublicKey, publicKey) {
+			l.report(peer.keyLine, SeverityError, CheckOwnPublicKey, "public key of the peer is the public key of this interface")
+		}
+
+		if first, ok := seen[string(peer.cfg.PublicKey)]; ok {
+			l.report(peer.keyLine, SeverityError, CheckDuplicatePeer, "duplicate peer, first defined on line %d", first.line)
+		} else {
+			seen[string(peer.cfg.PublicKey)] = peer
+		}
+
+		for j, ip := range peer.cfg.AllowedIPs {
+			for _, other := range l.peers[:i] {
+				if other.cfg.PublicKey == nil || bytes.Equal(other.cfg.PublicKey, peer.cfg.PublicKey) {
+					continue
+				}
+
+				for k, otherIP := range other.cfg.AllowedIPs {
+					if !overlaps(ip, otherIP) {
+						continue
+					}
+
+					if ip.String() == otherIP.String() {
+						l.report(peer.allowedIPs[j], SeverityError, CheckOverlappingIPs,
+							"%s is also allowed for the peer on line %d, only the last one gets it",
+							ip.String(), other.allowedIPs[k])
+					} else {
+						l.report(peer.allowedIPs[j], SeverityWarning, CheckOverlappingIPs,
+							"%s overlaps %s of the peer on line %d, the more specific one wins",
+							ip.String(), otherIP.String(), other.allowedIPs[k])
+					}
+				}
+			}
+		}
+	}
+}
+
+// overlaps reports whether two networks share any address, which for CIDR
+// networks means that one contains the other.
+func overlaps(a, b net.IPNet) bool {
+	if (a.IP.To4() == nil) != (b.IP.To4() == nil) {
+		return false
+	}
+
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,148 @@
+package wgtypes_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bi-zone/ruwireguard-go/wgctrl/wgtypes"
+)
+
+func TestLintConfig(t *testing.T) {
+	ownKey := mustParseKey(testPrivateKey).PublicKey().String()
+	offCurve := wgtypes.Key(append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...)).String()
+
+	type finding struct {
+		Line  int
+		Check string
+	}
+
+	tests := []struct {
+		name string
+		conf string
+		want []finding
+	}{
+		{
+			name: "clean",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+AllowedIPs = 10.0.0.1/32
+Endpoint = 192.0.2.1:51820
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = ` + testPublicKey2 + `
+AllowedIPs = 10.0.0.2/32`,
+		},
+		{
+			name: "missing private key",
+			conf: `[Interface]
+ListenPort = 51820`,
+			want: []finding{{1, wgtypes.CheckMissingPrivateKey}},
+		},
+		{
+			name: "duplicate and own keys",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+[Peer]
+PublicKey = ` + ownKey,
+			want: []finding{
+				{6, wgtypes.CheckDuplicatePeer},
+				{8, wgtypes.CheckOwnPublicKey},
+			},
+		},
+		{
+			name: "invalid point",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+[Peer]
+PublicKey = ` + offCurve,
+			want: []finding{{4, wgtypes.CheckInvalidKey}},
+		},
+		{
+			name: "allowed ips",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+AllowedIPs = 10.0.0.1/24, fd00::/64
+[Peer]
+PublicKey = ` + testPublicKey2 + `
+AllowedIPs = 10.0.0.0/24
+AllowedIPs = 10.0.0.128/25, fd01::/64`,
+			want: []finding{
+				{5, wgtypes.CheckHostBits},
+				{8, wgtypes.CheckOverlappingIPs},
+				{9, wgtypes.CheckOverlappingIPs},
+			},
+		},
+		{
+			name: "bad values do not stop the checks",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+ListenPort = many
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+PersistentKeepalive = 70000
+Endpoint = 192.0.2.1
+[Peer]
+PublicKey = ` + testPublicKey1,
+			want: []finding{
+				{3, wgtypes.CheckSyntax},
+				{6, wgtypes.CheckKeepaliveOutOfRange},
+				{7, wgtypes.CheckSyntax},
+				{9, wgtypes.CheckDuplicatePeer},
+			},
+		},
+		{
+			name: "expired peer",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+[Peer]
+PublicKey = ` + testPublicKey1 + `
+ExpiresAt = 2020-01-01T00:00:00Z
+[Peer]
+PublicKey = ` + testPublicKey2 + `
+ExpiresAt = 2999-01-01T00:00:00Z`,
+			want: []finding{{5, wgtypes.CheckExpiredPeer}},
+		},
+		{
+			name: "broken structure",
+			conf: `[Interface]
+PrivateKey = ` + testPrivateKey + `
+[Peer
+PublicKey = ` + testPublicKey1,
+			want: []finding{{3, wgtypes.CheckSyntax}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := wgtypes.LintConfig("wg0.conf", strings.NewReader(tt.conf), wgtypes.LintOptions{NoResolve: true})
+			if err != nil {
+				t.Fatalf("failed to lint: %v", err)
+			}
+
+			var got []finding
+			for _, p := range problems {
+				got = append(got, finding{p.Line, p.Check})
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected problems (-want +got):\n%s", diff)
+				for _, p := range problems {
+					t.Log(p)
+				}
+			}
+		})
+	}
+}
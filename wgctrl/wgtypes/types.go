@@ -35,6 +35,55 @@ func (dt DeviceType) String() string {
 	}
 }
 
+// A LivenessState is the health of a peer, as seen by the liveness
+// monitoring of a userspace device.
+type LivenessState int
+
+// Possible LivenessState values.
+const (
+	// LivenessUnknown indicates that the liveness of the peer is not
+	// monitored.
+	LivenessUnknown LivenessState = iota
+
+	// LivenessUp indicates that the peer was heard from recently.
+	LivenessUp
+
+	// LivenessDegraded indicates that the peer has been silent for
+	// LivenessDegradedAfter, or that a handshake with it is being retried.
+	LivenessDegraded
+
+	// LivenessDown indicates that the peer has been silent for
+	// LivenessDownAfter, or that a handshake with it was given up.
+	LivenessDown
+)
+
+var livenessStateNames = []string{
+	LivenessUnknown:  "unknown",
+	LivenessUp:       "up",
+	LivenessDegraded: "degraded",
+	LivenessDown:     "down",
+}
+
+// String returns the name of a LivenessState in the userspace configuration
+// protocol.
+func (s LivenessState) String() string {
+	if s < 0 || int(s) >= len(livenessStateNames) {
+		return livenessStateNames[LivenessUnknown]
+	}
+	return livenessStateNames[s]
+}
+
+// ParseLivenessState parses the name of a LivenessState, returning
+// LivenessUnknown for names it does not know.
+func ParseLivenessState(s string) LivenessState {
+	for state, name := range livenessStateNames {
+		if name == s {
+			return LivenessState(state)
+		}
+	}
+	return LivenessUnknown
+}
+
 // A Device is a WireGuard device.
 type Device struct {
 	// Name is the name of the device.
@@ -49,6 +98,24 @@ type Device struct {
 	// PublicKey is the device's public key, computed from its PrivateKey.
 	PublicKey Key
 
+	// Redacted indicates that the secrets of the device were left out, as
+	// when it is read from a read-only socket, from a management API which
+	// does not grant them, or printed by wg show --format. PrivateKey and the
+	// preshared keys of the Peers are then nil, whatever the device holds.
+	Redacted bool
+
+	// PreviousPublicKey is the public key the device used before its last
+	// private key change, if a rollover is in progress. Incoming handshakes
+	// addressed to it are still accepted until RolloverExpires.
+	//
+	// A nil Key indicates that no rollover is in progress.
+	PreviousPublicKey Key
+
+	// RolloverExpires indicates when PreviousPublicKey stops being accepted.
+	//
+	// A zero-value time.Time indicates that no rollover is in progress.
+	RolloverExpires time.Time
+
 	// ListenPort is the device's network listening port.
 	ListenPort int
 
@@ -58,10 +125,88 @@ type Device struct {
 	// take action on outgoing WireGuard packets.
 	FirewallMark int
 
+	// LivenessDownAfter is how long a peer may be silent before it is
+	// considered down.
+	//
+	// A value of 0 indicates that the liveness of peers is not monitored.
+	LivenessDownAfter time.Duration
+
+	// LivenessDegradedAfter is how long a peer may be silent before it is
+	// considered degraded.
+	//
+	// A value of 0 indicates that silence alone does not degrade a peer.
+	LivenessDegradedAfter time.Duration
+
+	// LivenessProbeInterval is how long a peer may be silent before it is
+	// probed.
+	//
+	// A value of 0 indicates that peers are not probed.
+	LivenessProbeInterval time.Duration
+
+	// EncryptionQueue, DecryptionQueue and HandshakeQueue describe the work
+	// queues of a userspace device, which are shared by all of its peers.
+	EncryptionQueue QueueStats
+	DecryptionQueue QueueStats
+	HandshakeQueue  QueueStats
+
+	// CookieRepliesSent indicates the number of cookie replies the device
+	// sent to handshake initiators while under load.
+	CookieRepliesSent int64
+
+	// RatelimiterRejects indicates the number of handshake messages the
+	// device refused because their source exceeded its rate limit.
+	RatelimiterRejects int64
+
+	// DecryptFailures indicates the number of transport packets which
+	// failed authentication.
+	DecryptFailures int64
+
+	// UnderLoad indicates that the device is under load, and demands
+	// cookies from handshake initiators.
+	UnderLoad bool
+
+	// HandshakeErrors indicates the number of handshake messages the device
+	// rejected, keyed by the reason, such as "mac1_mismatch" or
+	// "replayed_timestamp".
+	//
+	// A nil map indicates that no handshake message was rejected.
+	HandshakeErrors map[string]int64
+
+	// HandshakeErrorSources breaks HandshakeErrors down by the addresses the
+	// messages came from, for the addresses seen most recently.
+	HandshakeErrorSources []HandshakeErrorSource
+
 	// Peers is the list of network peers associated with this device.
 	Peers []Peer
 }
 
+// HandshakeErrorSource counts the handshake messages from one address which
+// a device rejected for one reason.
+type HandshakeErrorSource struct {
+	// IP is the source address of the messages.
+	IP net.IP
+
+	// Reason is why the messages were rejected, as in Device.HandshakeErrors.
+	Reason string
+
+	// Count indicates the number of messages rejected.
+	Count int64
+
+	// LastSeen indicates when a message from IP was last rejected, for any
+	// reason.
+	LastSeen time.Time
+}
+
+// QueueStats describes a work queue of a userspace device.
+type QueueStats struct {
+	// Length indicates the number of elements currently queued.
+	Length int64
+
+	// Drops indicates the number of elements dropped because the queue was
+	// full.
+	Drops int64
+}
+
 var Curve = gost3410.CurveIdtc26gost34102012256paramSetA()
 
 const PrivateKeyLen = 32
@@ -155,12 +300,44 @@ type Peer struct {
 	// PublicKey is always present in a Peer.
 	PublicKey Key
 
+	// Name is an optional friendly name of the peer, used in place of its
+	// public key in logs and wg show.
+	Name string
+
+	// Annotations are optional free-form labels of the peer.
+	Annotations map[string]string
+
 	// PresharedKey is an optional preshared key which may be used as an
 	// additional layer of security for peer communications.
 	//
 	// A zero-value Key means no preshared key is configured.
 	PresharedKey Key
 
+	// NextPresharedKey is a preshared key scheduled to replace PresharedKey
+	// at NextPresharedKeyActivation. Around the activation, handshakes are
+	// attempted with both keys.
+	NextPresharedKey Key
+
+	// NextPresharedKeyActivation indicates when NextPresharedKey takes
+	// effect.
+	//
+	// A zero-value time.Time indicates that no preshared key rotation is
+	// scheduled.
+	NextPresharedKeyActivation time.Time
+
+	// PresharedKeyHandshakes indicates the number of handshakes with this
+	// peer which used the preshared key in effect at the time.
+	PresharedKeyHandshakes int64
+
+	// NextPresharedKeyHandshakes indicates the number of handshakes with
+	// this peer which used the scheduled preshared key.
+	NextPresharedKeyHandshakes int64
+
+	// ExpiresAt indicates when the peer is removed from the device.
+	//
+	// A zero-value time.Time indicates that the peer does not expire.
+	ExpiresAt time.Time
+
 	// Endpoint is the most recent source address used for communication by
 	// this Peer.
 	Endpoint *net.UDPAddr
@@ -178,12 +355,75 @@ type Peer struct {
 	// this peer.
 	LastHandshakeTime time.Time
 
+	// Liveness indicates the health of this peer, if the device monitors it.
+	Liveness LivenessState
+
+	// LivenessChanged indicates when the peer entered its Liveness state.
+	//
+	// A zero-value time.Time indicates that liveness is not monitored.
+	LivenessChanged time.Time
+
 	// ReceiveBytes indicates the number of bytes received from this peer.
 	ReceiveBytes int64
 
 	// TransmitBytes indicates the number of bytes transmitted to this peer.
 	TransmitBytes int64
 
+	// ReceivePackets indicates the number of authenticated packets received
+	// from this peer.
+	ReceivePackets int64
+
+	// TransmitPackets indicates the number of packets transmitted to this
+	// peer.
+	TransmitPackets int64
+
+	// HandshakeAttempts indicates the number of handshake initiations sent
+	// to this peer.
+	HandshakeAttempts int64
+
+	// KeypairCreated indicates when the current session keys with this peer
+	// were derived.
+	//
+	// A zero-value time.Time indicates that there is no current session.
+	KeypairCreated time.Time
+
+	// TransmitDrops indicates the number of packets to this peer dropped
+	// before encryption because a queue was full.
+	TransmitDrops int64
+
+	// ReceiveDrops indicates the number of packets from this peer dropped
+	// before decryption because a queue was full.
+	ReceiveDrops int64
+
+	// DecryptFailures indicates the number of transport packets from this
+	// peer which failed authentication.
+	DecryptFailures int64
+
+	// ReplayRejects indicates the number of transport packets from this peer
+	// refused by the replay filter, as duplicated or too old.
+	ReplayRejects int64
+
+	// AllowedIPsRejects indicates the number of packets from this peer
+	// dropped because their source address is outside its allowed IPs.
+	AllowedIPsRejects int64
+
+	// HandshakeInitiationsReceived indicates the number of handshake
+	// initiations received from this peer.
+	HandshakeInitiationsReceived int64
+
+	// HandshakeRTT indicates the round trip time of the last handshake
+	// initiated with this peer, from the initiation to the response.
+	//
+	// A zero value indicates that no such handshake has completed.
+	HandshakeRTT time.Duration
+
+	// HandshakeErrors indicates the number of handshake messages from this
+	// peer which the device rejected, keyed by the reason, as in
+	// Device.HandshakeErrors.
+	//
+	// A nil map indicates that no handshake message was rejected.
+	HandshakeErrors map[string]int64
+
 	// AllowedIPs specifies which IPv4 and IPv6 addresses this peer is allowed
 	// to communicate on.
 	//
@@ -198,6 +438,33 @@ type Peer struct {
 	ProtocolVersion int
 }
 
+// PeersPageOptions select a page of the peers of a device.
+type PeersPageOptions struct {
+	// Prefix, if not empty, selects the peers whose public key starts with
+	// these bytes.
+	Prefix []byte
+
+	// Cursor is the Next value of the previous page. An empty cursor starts
+	// at the first peer.
+	Cursor string
+
+	// Limit is the maximum number of peers on the page.
+	//
+	// A value of 0 indicates no limit.
+	Limit int
+}
+
+// A PeersPage is a page of the peers of a device, ordered by public key.
+type PeersPage struct {
+	// Peers are the peers on this page.
+	Peers []Peer
+
+	// Next is the cursor of the following page.
+	//
+	// An empty cursor indicates that this is the last page.
+	Next string
+}
+
 // A Config is a WireGuard device configuration.
 //
 // Because the zero value of some Go types may be significant to WireGuard for
@@ -209,6 +476,14 @@ type Config struct {
 	// A non-nil, zero-value Key will clear the private key.
 	PrivateKey *Key
 
+	// RolloverWindow specifies how long the replaced private key remains
+	// valid for incoming handshakes, if not nil.
+	//
+	// If PrivateKey is also set, the current identity is kept as the previous
+	// one for this duration. Otherwise the expiry of a rollover in progress
+	// is moved, and a non-nil value of 0 ends it immediately.
+	RolloverWindow *time.Duration
+
 	// ListenPort specifies a device's listening port, if not nil.
 	ListenPort *int
 
@@ -217,6 +492,26 @@ type Config struct {
 	// If non-nil and set to 0, the firewall mark will be cleared.
 	FirewallMark *int
 
+	// LivenessDownAfter specifies how long a peer may be silent before it
+	// is considered down, if not nil.
+	//
+	// A non-nil value of 0 turns liveness monitoring off.
+	LivenessDownAfter *time.Duration
+
+	// LivenessDegradedAfter specifies how long a peer may be silent before
+	// it is considered degraded, if not nil. It must be below
+	// LivenessDownAfter.
+	//
+	// A non-nil value of 0 lets silence take peers down without degrading
+	// them first.
+	LivenessDegradedAfter *time.Duration
+
+	// LivenessProbeInterval specifies how long a peer may be silent before
+	// it is probed, if not nil.
+	//
+	// A non-nil value of 0 turns probes off.
+	LivenessProbeInterval *time.Duration
+
 	// ReplacePeers specifies if the Peers in this configuration should replace
 	// the existing peer list, instead of appending them to the existing list.
 	ReplacePeers bool
@@ -245,11 +540,42 @@ type PeerConfig struct {
 	// if the peer already exists as part of the interface.
 	UpdateOnly bool
 
+	// Name specifies the friendly name of the peer, if not nil.
+	//
+	// A non-nil, empty name will clear it.
+	Name *string
+
+	// ReplaceAnnotations specifies if Annotations should replace the
+	// existing ones, instead of being merged into them.
+	ReplaceAnnotations bool
+
+	// Annotations specifies labels to set on the peer. An empty value
+	// removes the label.
+	Annotations map[string]string
+
 	// PresharedKey specifies a peer's preshared key configuration, if not nil.
 	//
 	// A non-nil, zero-value Key will clear the preshared key.
 	PresharedKey *Key
 
+	// NextPresharedKey schedules a preshared key rotation, if not nil.
+	//
+	// The key takes effect at NextPresharedKeyActivation, or immediately if
+	// NextPresharedKeyActivation is nil.
+	NextPresharedKey *Key
+
+	// NextPresharedKeyActivation specifies when NextPresharedKey takes
+	// effect, if not nil.
+	//
+	// A non-nil, zero-value time.Time will cancel a scheduled rotation.
+	NextPresharedKeyActivation *time.Time
+
+	// ExpiresAt specifies when the peer is removed from the device, if not
+	// nil. A time in the past removes the peer right away.
+	//
+	// A non-nil, zero-value time.Time will cancel the expiry.
+	ExpiresAt *time.Time
+
 	// Endpoint specifies the endpoint of this peer entry, if not nil.
 	Endpoint *net.UDPAddr
 